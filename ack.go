@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ackCallbackPrefix marks the Acknowledge buttons of the alerts, so they are not published as mapping callbacks
+const ackCallbackPrefix = "ack:"
+
+const defaultAckTimeout = 10 * time.Minute
+
+// AckConfig makes the critical messages of a mapping acknowledgeable alerts, escalated when nobody acknowledges them
+type AckConfig struct {
+	Timeout Duration `json:"timeout"` // Wait for an acknowledgement before each escalation. Defaults to 10m
+	Resend  int      `json:"resend"`  // Times the alert is sent again before escalating to the admin and topic
+	Admin   bool     `json:"admin"`   // Notify the telegram_admin of the alerts not acknowledged
+	Topic   string   `json:"topic"`   // Topic of the escalation and acknowledgement events, like {topic}_escalation
+}
+
+// pendingAlert is a critical message waiting to be acknowledged
+type pendingAlert struct {
+	id      string
+	mapping *Mapping
+	n       Notification
+
+	lock     sync.Mutex
+	resends  int
+	messages []alertMessage
+	timer    *time.Timer
+}
+
+// alertMessage is a Telegram message of an alert, updated on the acknowledgement
+type alertMessage struct {
+	chat    int64
+	id      int
+	text    string
+	options TelegramOptions
+}
+
+var alertsLock sync.Mutex
+var pendingAlerts = map[string]*pendingAlert{}
+
+// alertEvent is published to the escalation topic
+type alertEvent struct {
+	Event        string    `json:"event"` // escalated or acknowledged
+	Topic        string    `json:"topic"`
+	From         string    `json:"from"`
+	Message      string    `json:"message"`
+	Resends      int       `json:"resends"`
+	Acknowledger string    `json:"acknowledged_by,omitempty"`
+	Time         time.Time `json:"time"`
+}
+
+func (c *AckConfig) setup() error {
+	if c.Timeout.Duration < 0 || c.Resend < 0 {
+		return fmt.Errorf("invalid acknowledge timeout or resend")
+	}
+
+	if c.Timeout.Duration == 0 {
+		c.Timeout.Duration = defaultAckTimeout
+	}
+
+	return nil
+}
+
+// newAlert registers a critical notification of the mapping as an alert, set in n.alert so the Telegram sinks add the button
+func newAlert(mapping *Mapping, n *Notification) {
+	alertsLock.Lock()
+	defer alertsLock.Unlock()
+
+	a := &pendingAlert{id: randomHex(8), mapping: mapping} // Random, so the acknowledgements can't be guessed
+	pendingAlerts[a.id] = a
+
+	n.alert = a
+	a.n = *n
+}
+
+// delivered starts waiting for the acknowledgement of an alert that was sent, or forgets it if the delivery failed
+func (a *pendingAlert) delivered(ok bool) {
+	if !ok {
+		a.forget()
+		return
+	}
+
+	a.lock.Lock()
+	a.timer = time.AfterFunc(a.mapping.Acknowledge.Timeout.Duration, a.escalate)
+	a.lock.Unlock()
+}
+
+func (a *pendingAlert) forget() {
+	alertsLock.Lock()
+	delete(pendingAlerts, a.id)
+	alertsLock.Unlock()
+}
+
+// send sends the alert text with the Acknowledge button to a chat
+func (a *pendingAlert) send(ctx context.Context, chat int64, text string, options TelegramOptions) error {
+	mqttLog.Info("[%d] alert %s: %s", chat, a.id, logText(text))
+
+	keyboard := models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+		{{Text: a.mapping.tr("ack_button"), CallbackData: ackCallbackPrefix + a.id}},
+	}}
+
+	msg, err := getTelegramBot().SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:              chat,
+		MessageThreadID:     options.ThreadID,
+		Text:                text,
+		ParseMode:           options.parseMode(),
+		DisableNotification: options.DisableNotification,
+		ProtectContent:      options.ProtectContent,
+		ReplyMarkup:         keyboard,
+	})
+	if err != nil {
+		telLog.Error("Error sending alert to group %d: %s", chat, err)
+		return err
+	}
+
+	a.lock.Lock()
+	a.messages = append(a.messages, alertMessage{chat: chat, id: msg.ID, text: text, options: options})
+	a.lock.Unlock()
+
+	return nil
+}
+
+// escalate runs when the alert was not acknowledged in the timeout: it is sent again, or escalated to the admin and topic
+func (a *pendingAlert) escalate() {
+	alertsLock.Lock()
+	_, pending := pendingAlerts[a.id]
+	alertsLock.Unlock()
+	if !pending {
+		return
+	}
+
+	ack := a.mapping.Acknowledge
+
+	a.lock.Lock()
+	resend := a.resends < ack.Resend
+	if resend {
+		a.resends++
+	}
+	resends, n := a.resends, a.n
+	a.lock.Unlock()
+
+	if resend {
+		sinkLog.Warn("Alert %s of topic %s not acknowledged, sending again (%d/%d)", a.id, n.Topic, resends, ack.Resend)
+		n.Message = a.mapping.trMessage("alert_reminder", formatted(n.Message))
+		a.delivered(deliverMessage(a.mapping, n) == nil)
+		return
+	}
+
+	a.forget()
+	sinkLog.Warn("Alert %s of topic %s not acknowledged, escalating", a.id, n.Topic)
+
+	if ack.Admin {
+		notifyAdmin(a.mapping.tr("alert_escalated", n.Topic, ack.Timeout.Duration*time.Duration(resends+1), n.Message))
+	}
+
+	a.publish(alertEvent{Event: "escalated", Topic: n.Topic, From: n.From, Message: n.Message, Resends: resends, Time: time.Now().UTC()})
+}
+
+// publish publishes an event of the alert to the escalation topic, if any
+func (a *pendingAlert) publish(e alertEvent) {
+	if a.mapping.Acknowledge.Topic == "" {
+		return
+	}
+
+	topic := mqttTopic(expandTopic(a.mapping.Acknowledge.Topic, a.mapping.Topic))
+	payload, _ := json.Marshal(e)
+
+	if err := getMQTTClient().Publish(MQTTMessage{Topic: topic, Payload: payload}); err != nil {
+		mqttLog.Error("Error publishing to %s: %s", topic, err)
+	}
+}
+
+// sentTo returns if the alert was sent to the chat
+func (a *pendingAlert) sentTo(chat int64) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for _, m := range a.messages {
+		if m.chat == chat {
+			return true
+		}
+	}
+
+	return false
+}
+
+// handleAckCallback acknowledges the alert of a pressed Acknowledge button, updating its messages
+func handleAckCallback(q *models.CallbackQuery) {
+	id := strings.TrimPrefix(q.Data, ackCallbackPrefix)
+
+	alertsLock.Lock()
+	a, ok := pendingAlerts[id]
+	alertsLock.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if chat, _, ok := callbackMessage(q); !ok || !a.sentTo(chat.ID) {
+		telLog.Warn("Ignoring acknowledgement of alert %s from chat %d, where it was not sent", id, chat.ID)
+		return
+	}
+
+	alertsLock.Lock()
+	_, ok = pendingAlerts[id]
+	delete(pendingAlerts, id)
+	alertsLock.Unlock()
+
+	if !ok { // Acknowledged meanwhile
+		return
+	}
+
+	a.lock.Lock()
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	messages, resends, n := a.messages, a.resends, a.n
+	a.lock.Unlock()
+
+	name := strings.TrimSpace(q.From.FirstName + " " + q.From.LastName)
+	telLog.Info("Alert %s of topic %s acknowledged by %s", id, n.Topic, name)
+
+	ctx, cancel := telegramContext(context.Background())
+	defer cancel()
+
+	for _, m := range messages {
+		_, err := getTelegramBot().EditMessageText(ctx, &bot.EditMessageTextParams{
+			ChatID:    m.chat,
+			MessageID: m.id,
+			Text:      m.text + "\n" + a.mapping.trMessageFor(m.options, "acknowledged", name),
+			ParseMode: m.options.parseMode(),
+		})
+		if err != nil {
+			telLog.Error("Error updating alert message: %s", err)
+		}
+	}
+
+	a.publish(alertEvent{Event: "acknowledged", Topic: n.Topic, From: n.From, Message: n.Message, Resends: resends, Acknowledger: name, Time: time.Now().UTC()})
+}
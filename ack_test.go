@@ -0,0 +1,53 @@
+package main
+
+import (
+	"github.com/go-telegram/bot/models"
+	"strings"
+	"testing"
+)
+
+func TestAckCallback(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "alarm/smoke", Acknowledge: &AckConfig{}}
+	setupTestMappings(t, mapping)
+
+	doMessage(mapping, MQTTMessage{Topic: mapping.Topic, Payload: []byte(`{"type": "message", "from": "Smoke", "message": "Kitchen", "critical": true}`)})
+
+	calls := telegram.Calls("sendMessage")
+	if len(calls) != 1 {
+		t.Fatalf("expected the alert to be sent, got %d calls", len(calls))
+	}
+
+	data := calls[0].Params.Get("reply_markup")
+	start := strings.Index(data, ackCallbackPrefix)
+	if start == -1 || len(data) < start+len(ackCallbackPrefix)+16 {
+		t.Fatalf("expected the acknowledge button, got %s", data)
+	}
+	callback := data[start : start+len(ackCallbackPrefix)+16]
+
+	press := func(chat int64) {
+		handleAckCallback(&models.CallbackQuery{
+			From:    models.User{ID: 7, FirstName: "Jane", LastName: "a_b"},
+			Data:    callback,
+			Message: models.MaybeInaccessibleMessage{Message: &models.Message{ID: 1, Chat: models.Chat{ID: chat}}},
+		})
+	}
+
+	press(-200)
+	if calls := telegram.Calls("editMessageText"); len(calls) != 0 {
+		t.Errorf("expected the acknowledgement from another chat to be ignored")
+	}
+
+	press(-100)
+	calls = telegram.Calls("editMessageText")
+	if len(calls) != 1 {
+		t.Fatalf("expected the alert to be acknowledged, got %d edits", len(calls))
+	}
+
+	// The name of the acknowledger is escaped for the parse mode of the alert
+	if text := calls[0].Params.Get("text"); !strings.HasSuffix(text, "\n✅ Acknowledged by Jane a\\_b") {
+		t.Errorf("unexpected acknowledged alert %q", text)
+	}
+}
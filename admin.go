@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"strconv"
+	"sync"
+)
+
+// disabledChats are chats the bot was removed from, with the reason. Sends to them are skipped until re-enabled.
+var disabledChats = map[int64]string{}
+var disabledLock = sync.Mutex{}
+
+// notifyAdmin sends a direct message to the telegram_admin. Requires telegram_admin to be a user id.
+func notifyAdmin(text string) {
+	if telegramAdminId == "" || getTelegramBot() == nil {
+		return
+	}
+
+	adminChat, err := strconv.ParseInt(telegramAdminId, 10, 64)
+	if err != nil {
+		telLog.Warn("Cannot notify admin %s, telegram_admin must be an user id: %s", telegramAdminId, text)
+		return
+	}
+
+	if _, err := sendTelegram(&bot.SendMessageParams{ChatID: adminChat, Text: text}); err != nil {
+		telLog.Error("Error notifying admin: %s", err)
+	}
+}
+
+func isChatDisabled(chat int64) bool {
+	disabledLock.Lock()
+	defer disabledLock.Unlock()
+
+	_, ok := disabledChats[chat]
+	return ok
+}
+
+// disableChat stops sends to a chat the bot can't post to anymore and notifies the admin
+func disableChat(chat int64, reason string) {
+	disabledLock.Lock()
+	_, alreadyDisabled := disabledChats[chat]
+	disabledChats[chat] = reason
+	disabledLock.Unlock()
+
+	if alreadyDisabled {
+		return
+	}
+
+	telLog.Warn("Disabling chat %d: %s", chat, reason)
+	notifyAdmin(fmt.Sprintf("Disabled sends to chat %d: %s. Use /enable %d after adding the bot back.", chat, reason, chat))
+}
+
+// enableChat resumes sends to a disabled chat. Returns false if the chat was not disabled.
+func enableChat(chat int64) bool {
+	disabledLock.Lock()
+	defer disabledLock.Unlock()
+
+	if _, ok := disabledChats[chat]; !ok {
+		return false
+	}
+
+	delete(disabledChats, chat)
+	telLog.Info("Enabled chat %d", chat)
+
+	return true
+}
+
+func enableCommand(msg *models.Message) string {
+	chat, err := strconv.ParseInt(commandArguments(msg), 10, 64)
+	if err != nil {
+		return translate(defaultLanguage, "enable_usage")
+	}
+
+	if !enableChat(chat) {
+		return translate(defaultLanguage, "chat_not_disabled", chat)
+	}
+
+	return translate(defaultLanguage, "chat_enabled", chat)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// amqpExchange is the topic exchange of the mapping routing keys. Defaults to amq.topic, the exchange of the RabbitMQ MQTT plugin
+var amqpExchange = os.Getenv("amqp_exchange")
+
+// amqpClient is an AMQP 0.9.1 (RabbitMQ) client using amqp091-go. Each subscription consumes a durable queue bound to the
+// exchange, and publishes go to the exchange. Topics are converted to routing keys (sensors/+ to sensors.*), so the mappings work unchanged.
+type amqpClient struct {
+	options MQTTOptions
+
+	lock          sync.Mutex
+	conn          *amqp.Connection
+	ch            *amqp.Channel
+	disconnected  bool
+	subscriptions map[string]MQTTHandler
+}
+
+func newAMQPClient(o MQTTOptions) *amqpClient {
+	if amqpExchange == "" {
+		amqpExchange = "amq.topic"
+	}
+
+	return &amqpClient{
+		options:       o,
+		subscriptions: map[string]MQTTHandler{},
+	}
+}
+
+// amqpRoutingKey converts a MQTT topic or filter to an AMQP routing or binding key
+func amqpRoutingKey(topic string) string {
+	return strings.NewReplacer("/", ".", "+", "*").Replace(topic)
+}
+
+func (c *amqpClient) connect() error {
+	u, err := url.Parse(c.options.BrokerURL)
+	if err != nil {
+		return err
+	}
+	if c.options.Username != "" {
+		u.User = url.UserPassword(c.options.Username, c.options.Password())
+	}
+
+	conn, err := amqp.DialConfig(u.String(), amqp.Config{
+		Heartbeat: c.options.KeepAlive,
+		Dial:      amqp.DefaultDial(c.options.ConnectTimeout),
+	})
+	if err != nil {
+		return err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	c.lock.Lock()
+	c.conn, c.ch = conn, ch
+	subscriptions := map[string]MQTTHandler{}
+	for filter, handler := range c.subscriptions {
+		subscriptions[filter] = handler
+	}
+	c.lock.Unlock()
+
+	for filter, handler := range subscriptions {
+		if err := c.subscribe(ch, filter, handler); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+
+	if c.options.OnConnect != nil {
+		c.options.OnConnect()
+	}
+
+	go c.watch(conn)
+
+	return nil
+}
+
+// watch reconnects when the connection is closed by the broker or the network
+func (c *amqpClient) watch(conn *amqp.Connection) {
+	err := <-conn.NotifyClose(make(chan *amqp.Error, 1))
+
+	c.lock.Lock()
+	disconnected := c.disconnected
+	c.lock.Unlock()
+
+	if disconnected {
+		return
+	}
+
+	if c.options.OnConnectionLost != nil {
+		c.options.OnConnectionLost(err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		d := time.Duration(attempt) * time.Second
+		if d > c.options.MaxReconnectInterval {
+			d = c.options.MaxReconnectInterval
+		}
+		time.Sleep(d)
+
+		if err := c.connect(); err != nil {
+			mqttLog.Error("Error reconnecting to %s: %s", c.options.BrokerURL, err)
+			continue
+		}
+		return
+	}
+}
+
+func (c *amqpClient) Connect() error {
+	return c.connect()
+}
+
+// amqpQueue returns the durable queue and the binding key of a subscription filter: the shared subscriptions
+// ($share/group/filter) consume the queue <group>.<binding key>, the others an exclusive queue named by the server ("").
+func amqpQueue(filter string) (string, string) {
+	if parts := strings.SplitN(filter, "/", 3); parts[0] == "$share" && len(parts) == 3 {
+		key := amqpRoutingKey(parts[2])
+		return parts[1] + "." + key, key
+	}
+
+	return "", amqpRoutingKey(filter)
+}
+
+// subscribe consumes a queue bound to the filter. Shared subscriptions ($share/group/filter) consume the durable
+// queue <group>.<binding key>, shared by the instances of the group; the other subscriptions consume an exclusive
+// queue of the instance, deleted when it disconnects, so each instance receives all the messages, like in MQTT.
+func (c *amqpClient) subscribe(ch *amqp.Channel, filter string, handler MQTTHandler) error {
+	name, key := amqpQueue(filter)
+
+	var q amqp.Queue
+	var err error
+	if name != "" {
+		q, err = ch.QueueDeclare(name, true, false, false, false, nil)
+	} else {
+		q, err = ch.QueueDeclare("", false, true, true, false, nil)
+	}
+	if err != nil {
+		mqttLog.Error("Error declaring queue for %s: %s", filter, err)
+		return err
+	}
+	queue := q.Name
+
+	if err := ch.QueueBind(queue, key, amqpExchange, false, nil); err != nil {
+		mqttLog.Error("Error binding queue %s to %s: %s", queue, amqpExchange, err)
+		return err
+	}
+
+	deliveries, err := ch.Consume(queue, "", true, false, false, false, nil)
+	if err != nil {
+		mqttLog.Error("Error consuming queue %s: %s", queue, err)
+		return err
+	}
+
+	go func() {
+		for d := range deliveries {
+			msg := MQTTMessage{
+				Topic:   strings.Replace(d.RoutingKey, ".", "/", -1),
+				Payload: d.Body,
+			}
+
+			if len(d.Headers) > 0 {
+				msg.UserProperties = map[string]string{}
+				for k, v := range d.Headers {
+					if s, ok := v.(string); ok {
+						msg.UserProperties[k] = s
+					}
+				}
+			}
+
+			handler(msg)
+		}
+	}()
+
+	return nil
+}
+
+func (c *amqpClient) Subscribe(topic string, handler MQTTHandler) error {
+	c.lock.Lock()
+	c.subscriptions[topic] = handler
+	ch := c.ch
+	c.lock.Unlock()
+
+	return c.subscribe(ch, topic, handler)
+}
+
+func (c *amqpClient) Publish(msg MQTTMessage) error {
+	p := amqp.Publishing{
+		Body:      msg.Payload,
+		Timestamp: time.Now(),
+	}
+
+	if len(msg.UserProperties) > 0 {
+		p.Headers = amqp.Table{}
+		for k, v := range msg.UserProperties {
+			p.Headers[k] = v
+		}
+	}
+
+	if msg.Expiry > 0 {
+		p.Expiration = strconv.FormatInt(int64(msg.Expiry/time.Millisecond), 10)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.ConnectTimeout)
+	defer cancel()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.ch == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	return c.ch.PublishWithContext(ctx, amqpExchange, amqpRoutingKey(msg.Topic), false, false, p)
+}
+
+func (c *amqpClient) IsConnected() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.conn != nil && !c.conn.IsClosed()
+}
+
+func (c *amqpClient) Disconnect() {
+	c.lock.Lock()
+	c.disconnected = true
+	conn := c.conn
+	c.lock.Unlock()
+
+	if conn != nil {
+		conn.Close()
+	}
+}
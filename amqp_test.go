@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestAMQPQueue(t *testing.T) {
+	tests := []struct {
+		filter, queue, key string
+	}{
+		// The replicas of the group share the durable queue
+		{"$share/ha/sensors/+/temperature", "ha.sensors.*.temperature", "sensors.*.temperature"},
+		// Every instance receives the other subscriptions in its own exclusive queue
+		{"sensors/#", "", "sensors.#"},
+		{"$bridge/control", "", "$bridge.control"},
+	}
+
+	for _, test := range tests {
+		if queue, key := amqpQueue(test.filter); queue != test.queue || key != test.key {
+			t.Errorf("%s: expected queue %q bound to %s, got %q bound to %s", test.filter, test.queue, test.key, queue, key)
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/go-telegram/bot/models"
+	_ "modernc.org/sqlite"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	archiveFile       = os.Getenv("archive_file")
+	archiveQueryTopic = os.Getenv("archive_query_topic")
+)
+
+var archiveLog = newLogger("Archive")
+
+var archiveDB *sql.DB
+
+// Archived message directions
+const (
+	DirectionToTelegram = "to_telegram" // Received from MQTT and delivered to the mapping sinks
+	DirectionToMQTT     = "to_mqtt"     // Received from Telegram and published to MQTT
+)
+
+const archiveSchema = `
+CREATE TABLE IF NOT EXISTS messages (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	time      INTEGER NOT NULL,
+	direction TEXT NOT NULL,
+	topic     TEXT NOT NULL,
+	chat_id   INTEGER NOT NULL,
+	sender    TEXT NOT NULL,
+	message   TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS messages_time ON messages (time);
+CREATE INDEX IF NOT EXISTS messages_topic ON messages (topic, time);
+CREATE TABLE IF NOT EXISTS dead_letters (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	time     INTEGER NOT NULL,
+	topic    TEXT NOT NULL,
+	reason   TEXT NOT NULL,
+	letter   TEXT NOT NULL,
+	replayed INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS dead_letters_time ON dead_letters (time);
+`
+
+// ArchivedMessage is a bridged message stored in the archive
+type ArchivedMessage struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Topic     string    `json:"topic"`
+	ChatID    int64     `json:"chat_id"`
+	From      string    `json:"from"`
+	Message   string    `json:"message"`
+}
+
+// ArchiveQuery filters the archived messages. Empty fields are not filtered.
+type ArchiveQuery struct {
+	Text  string    `json:"query"`
+	Topic string    `json:"topic"`
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+	Limit int       `json:"limit"`
+}
+
+// openArchive opens the archive_file database and starts the retention cleanup
+func openArchive() {
+	if archiveFile == "" {
+		return
+	}
+
+	db, err := openArchiveDB(archiveFile)
+	if err != nil {
+		archiveLog.Fatal("Error opening archive %s: %s", archiveFile, err)
+	}
+
+	archiveDB = db
+	archiveLog.Info("Archiving messages to %s", archiveFile)
+
+	retention := getEnvDuration("archive_retention", 30*24*time.Hour)
+	if retention > 0 {
+		go func() {
+			for {
+				pruneArchive(time.Now().Add(-retention))
+				time.Sleep(time.Hour)
+			}
+		}()
+	}
+
+	if archiveQueryTopic != "" {
+		subscribe(mqttTopic(archiveQueryTopic), archiveQueryHandler)
+	}
+}
+
+// openArchiveDB opens an archive database, creating its schema
+func openArchiveDB(file string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", file)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer. The replay subcommand writes to the archive of a running bridge, so wait for its locks.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("PRAGMA busy_timeout = 5000"); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if _, err := db.Exec(archiveSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating schema: %s", err)
+	}
+
+	return db, nil
+}
+
+func pruneArchive(before time.Time) {
+	res, err := archiveDB.Exec("DELETE FROM messages WHERE time < ?", before.UnixNano())
+	if err != nil {
+		archiveLog.Error("Error pruning archive: %s", err)
+		return
+	}
+
+	if n, _ := res.RowsAffected(); n > 0 {
+		archiveLog.Info("Pruned %d messages older than %s", n, before.Format(time.RFC3339))
+	}
+
+	if _, err := archiveDB.Exec("DELETE FROM dead_letters WHERE time < ?", before.UnixNano()); err != nil {
+		archiveLog.Error("Error pruning dead letters: %s", err)
+	}
+}
+
+// archiveMessage stores a bridged message, if the archive is enabled
+func archiveMessage(m ArchivedMessage) {
+	if archiveDB == nil {
+		return
+	}
+
+	_, err := archiveDB.Exec("INSERT INTO messages (time, direction, topic, chat_id, sender, message) VALUES (?, ?, ?, ?, ?, ?)",
+		m.Time.UnixNano(), m.Direction, m.Topic, m.ChatID, m.From, m.Message)
+
+	if err != nil {
+		archiveLog.Error("Error archiving message from topic %s: %s", m.Topic, err)
+	}
+}
+
+// archiveDeadLetter stores a dead letter to be replayed later, if the archive is enabled
+func archiveDeadLetter(dl DeadLetter) {
+	if archiveDB == nil {
+		return
+	}
+
+	letter, _ := json.Marshal(dl)
+
+	_, err := archiveDB.Exec("INSERT INTO dead_letters (time, topic, reason, letter) VALUES (?, ?, ?, ?)",
+		dl.Failed.UnixNano(), dl.Topic, string(dl.Reason), string(letter))
+
+	if err != nil {
+		archiveLog.Error("Error archiving dead letter from topic %s: %s", dl.Topic, err)
+	}
+}
+
+// searchArchive returns the archived messages matching the query, newest first
+func searchArchive(q ArchiveQuery) ([]ArchivedMessage, error) {
+	if archiveDB == nil {
+		return nil, fmt.Errorf("archive is disabled")
+	}
+
+	var where []string
+	var args []interface{}
+
+	if q.Text != "" {
+		where = append(where, "(message LIKE ? OR sender LIKE ?)")
+		args = append(args, "%"+q.Text+"%", "%"+q.Text+"%")
+	}
+	if q.Topic != "" {
+		where = append(where, "topic = ?")
+		args = append(args, q.Topic)
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, q.Since.UnixNano())
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "time < ?")
+		args = append(args, q.Until.UnixNano())
+	}
+
+	query := "SELECT time, direction, topic, chat_id, sender, message FROM messages"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY time DESC"
+
+	if q.Limit > 0 {
+		query += " LIMIT " + strconv.Itoa(q.Limit)
+	}
+
+	rows, err := archiveDB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []ArchivedMessage
+	for rows.Next() {
+		var m ArchivedMessage
+		var t int64
+		if err := rows.Scan(&t, &m.Direction, &m.Topic, &m.ChatID, &m.From, &m.Message); err != nil {
+			return nil, err
+		}
+		m.Time = time.Unix(0, t)
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+// archiveQueryHandler answers archive queries received on archive_query_topic at the _result topic,
+// or at the MQTT 5 response topic when present
+func archiveQueryHandler(msg MQTTMessage) {
+	q := ArchiveQuery{Limit: 10}
+
+	var result interface{}
+	if err := json.Unmarshal(msg.Payload, &q); err != nil {
+		result = map[string]string{"error": err.Error()}
+	} else if messages, err := searchArchive(q); err != nil {
+		result = map[string]string{"error": err.Error()}
+	} else {
+		result = messages
+	}
+
+	payload, _ := json.Marshal(result)
+
+	reply := MQTTMessage{
+		Topic:           mqttTopic(archiveQueryTopic) + "_result",
+		Payload:         payload,
+		CorrelationData: msg.CorrelationData,
+	}
+	if msg.ResponseTopic != "" {
+		reply.Topic = msg.ResponseTopic
+	}
+
+	if err := getMQTTClient().Publish(reply); err != nil {
+		archiveLog.Error("Error publishing archive query result to %s: %s", reply.Topic, err)
+	}
+}
+
+func searchCommand(msg *models.Message) string {
+	query := commandArguments(msg)
+	if query == "" {
+		return translate(chatLanguage(msg.Chat.ID), "search_usage")
+	}
+
+	messages, err := searchArchive(ArchiveQuery{Text: query, Limit: 10})
+	if err != nil {
+		return translate(chatLanguage(msg.Chat.ID), "search_error", err)
+	}
+
+	if len(messages) == 0 {
+		return translate(chatLanguage(msg.Chat.ID), "search_empty")
+	}
+
+	var b strings.Builder
+	for _, m := range messages {
+		fmt.Fprintf(&b, "[%s] %s %s: %s\n", m.Time.Format(defaultTimestampFormat), m.Topic, m.From, m.Message)
+	}
+
+	return b.String()
+}
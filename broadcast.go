@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/tidwall/gjson"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// broadcastTopic receives the messages delivered to every mapped chat, like maintenance announcements. Disabled when empty.
+var broadcastTopic = os.Getenv("broadcast_topic")
+
+// broadcastToken is the secret the broadcasts must have in the token field. Any broadcast is accepted when empty.
+var broadcastToken = os.Getenv("broadcast_token")
+
+// broadcastMessage is the payload of the broadcast topic. Plain text payloads are the message.
+type broadcastMessage struct {
+	From    string `json:"from"`
+	Message string `json:"message"`
+	Silent  bool   `json:"silent"`
+	Token   string `json:"token"` // The broadcast_token
+}
+
+// broadcastHandler sends the broadcast messages to the chats of all the mappings
+func broadcastHandler(msg MQTTMessage) {
+	b := broadcastMessage{Message: strings.TrimSpace(string(msg.Payload))}
+	if gjson.ValidBytes(msg.Payload) && gjson.ParseBytes(msg.Payload).IsObject() {
+		if err := json.Unmarshal(msg.Payload, &b); err != nil {
+			mqttLog.Error("Received invalid broadcast on %s: %s", msg.Topic, err)
+			return
+		}
+	}
+
+	if broadcastToken != "" && subtle.ConstantTimeCompare([]byte(b.Token), []byte(broadcastToken)) != 1 {
+		mqttLog.Error("Rejecting broadcast on %s: invalid token", msg.Topic)
+		return
+	}
+
+	if b.Message == "" {
+		mqttLog.Warn("Received broadcast without message on %s", msg.Topic)
+		return
+	}
+
+	if b.From == "" {
+		b.From = "Bridge"
+	}
+
+	mappings := listGroupMappings()
+
+	var chats []int64
+	for chat := range mappings {
+		chats = append(chats, chat)
+	}
+	sort.Slice(chats, func(i, j int) bool { return chats[i] < chats[j] })
+
+	mqttLog.Info("Broadcasting to %d chats: %s", len(chats), logText(b.Message))
+
+	for _, chat := range chats {
+		mapping := mappings[chat]
+		n := Notification{Topic: strings.TrimPrefix(msg.Topic, topicPrefix), From: b.From, Message: b.Message, Silent: b.Silent, Time: time.Now()}
+
+		if err := mapping.telegramSink().Send(n); err != nil {
+			mqttLog.Error("Error broadcasting to %d: %s", chat, err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBroadcast(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	broker := newFakeBroker(t)
+
+	setupTestMappings(t, &Mapping{GroupID: -100, Topic: "home"}, &Mapping{GroupID: -200, Topic: "office"})
+	subscribe("bridge/broadcast", broadcastHandler)
+
+	broker.Publish(MQTTMessage{Topic: "bridge/broadcast", Payload: []byte(`{"from": "Ops", "message": "Maintenance at 22:00", "silent": true}`)})
+
+	calls := telegram.Calls("sendMessage")
+	if len(calls) != 2 || calls[0].Params.Get("chat_id") != "-200" || calls[1].Params.Get("chat_id") != "-100" {
+		t.Fatalf("expected the broadcast sent to both chats, got %v", calls)
+	}
+
+	if !strings.Contains(calls[0].Params.Get("text"), "Maintenance at 22:00") || calls[0].Params.Get("disable_notification") != "true" {
+		t.Errorf("unexpected broadcast %v", calls[0])
+	}
+
+	telegram.Reset()
+	broker.Publish(MQTTMessage{Topic: "bridge/broadcast", Payload: []byte("Back online")})
+
+	if calls := telegram.Calls("sendMessage"); len(calls) != 2 || calls[1].Params.Get("text") != "*Bridge*: Back online" {
+		t.Errorf("expected the plain text broadcast, got %v", calls)
+	}
+}
+
+func TestBroadcastToken(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	broker := newFakeBroker(t)
+
+	previousToken := broadcastToken
+	broadcastToken = "br0adcast"
+	t.Cleanup(func() { broadcastToken = previousToken })
+
+	setupTestMappings(t, &Mapping{GroupID: -100, Topic: "home"})
+	subscribe("bridge/broadcast", broadcastHandler)
+
+	for _, payload := range []string{`Back online`, `{"message": "Back online"}`, `{"message": "Back online", "token": "guess"}`} {
+		broker.Publish(MQTTMessage{Topic: "bridge/broadcast", Payload: []byte(payload)})
+	}
+
+	if calls := telegram.Calls("sendMessage"); len(calls) > 0 {
+		t.Fatalf("expected the broadcasts without the token rejected, got %v", calls)
+	}
+
+	broker.Publish(MQTTMessage{Topic: "bridge/broadcast", Payload: []byte(`{"message": "Back online", "token": "br0adcast"}`)})
+
+	if calls := telegram.Calls("sendMessage"); len(calls) != 1 {
+		t.Errorf("expected the broadcast with the token sent, got %v", calls)
+	}
+}
@@ -1,15 +1,13 @@
 package main
 
 import (
-	"encoding/json"
+	"flag"
 	"fmt"
-	"github.com/eclipse/paho.mqtt.golang"
-	"github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/go-telegram/bot"
 	"github.com/quan-to/slog"
 	"os"
 	"os/signal"
-	"strconv"
-	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -19,147 +17,60 @@ var (
 	telegramAdminId  = os.Getenv("telegram_admin")
 	groupToTopic     = os.Getenv("group_to_topic")
 	mqttHost         = os.Getenv("mqtt_server")
+	mqttVersion      = os.Getenv("mqtt_version")
 )
 
-var telLog = slog.Scope("Telegram")
-var mqttLog = slog.Scope("MQTT")
+var telLog = newLogger("Telegram")
+var mqttLog = newLogger("MQTT")
 
-var groupMaps = map[int64]string{}
-var topicMaps = map[string]int64{}
-var topicToMap = map[string]string{}
+var telegramBot *bot.Bot
+var telegramBreaker = &CircuitBreaker{}
 
-var telegramBot *tgbotapi.BotAPI
-var mqttClient mqtt.Client
+// mqttClient is the broker connection, replaced when the MQTT password changes. Use getMQTTClient and setMQTTClient
+var mqttClient MQTTClient
+var mqttClientLock = sync.RWMutex{}
 
-func doMessage(topic string, jsonData []byte) {
-	defer func() {
-		if r := recover(); r != nil {
-			mqttLog.Error("Recovered from panic on doMessage.")
-			mqttClient.Publish(fmt.Sprintf("%s_error", topic), 0, false, fmt.Sprintf("There was an error processing the message: recovered from panic"))
-		}
-	}()
+// getMQTTClient returns the current broker connection
+func getMQTTClient() MQTTClient {
+	mqttClientLock.RLock()
+	defer mqttClientLock.RUnlock()
 
-	var data map[string]interface{}
-	err := json.Unmarshal(jsonData, &data)
-	if err != nil {
-		mqttLog.Error("Received invalid JSON: %s", err)
-		mqttClient.Publish(fmt.Sprintf("%s_error", topic), 0, false, fmt.Sprintf("There was an error processing the message: %s", err))
-		return
-	}
-
-	t := data["type"].(string)
+	return mqttClient
+}
 
-	if t == "message" {
-		group, ok := topicMaps[topic]
-		if !ok {
-			mqttLog.Warn("Received message on topic %s but no telegram channel associated.", topic)
-			return
-		}
+// setMQTTClient replaces the broker connection, returning the previous one
+func setMQTTClient(client MQTTClient) MQTTClient {
+	mqttClientLock.Lock()
+	defer mqttClientLock.Unlock()
 
-		if data["message"] != nil {
-			from := "Unknown"
-			if data["from"] != nil {
-				from = data["from"].(string)
-			}
-			message := data["message"].(string)
-			mqttLog.Info("[%d] %s: %s", group, from, message)
-
-			msg := tgbotapi.NewMessage(group, fmt.Sprintf("*%s*: %s", from, message))
-			msg.ParseMode = tgbotapi.ModeMarkdown
-
-			_, err := telegramBot.Send(msg)
-			if err != nil {
-				telLog.Error("Error sending message to group %d: %s", group, err)
-			}
-		} else {
-			mqttLog.Error("Received data without message: %s", string(jsonData))
-			mqttClient.Publish(fmt.Sprintf("%s_error", topic), 0, false, fmt.Sprintf("Received data without message: %s", string(jsonData)))
-		}
-	} else {
-		mqttLog.Info("Received message (%s): %s", t, string(jsonData))
-	}
+	previous := mqttClient
+	mqttClient = client
+	return previous
 }
 
-func CheckTelegramUpdates() {
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+func main() {
+	var err error
 
-	updates, err := telegramBot.GetUpdatesChan(u)
+	parseFlags()
 
-	if err != nil {
-		telLog.Error("Error fetching updates: %s", err)
-		return
+	if *checkConfig {
+		os.Exit(runCheckConfig())
 	}
 
-	for update := range updates {
-		if update.ChannelPost != nil {
-			msg := update.ChannelPost
-
-			from := msg.Chat.Title
-			telLog.Info("%s: %s", from, msg.Text)
-
-			topic, ok := groupMaps[msg.Chat.ID]
-
-			if ok {
-				topicTo, ok := topicToMap[topic]
-				telLog.Debug("Redirecting message from Channel: %s", msg.Chat.Title)
-				if ok {
-
-					data := map[string]interface{}{
-						"sendmsg": true,
-						"to":      topicTo,
-						"message": msg.Text,
-					}
-
-					jsonData, _ := json.Marshal(data)
-					mqttLog.Debug("Publishing to %s_msg: %s", topic, string(jsonData))
-					mqttClient.Publish(fmt.Sprintf("%s_msg", topic), 0, false, jsonData)
-				} else {
-					telLog.Error("Received message but can't send because no msgToName defined!")
-				}
-			}
-		}
+	switch flag.Arg(0) {
+	case "setup":
+		os.Exit(runSetup())
+	case "healthcheck":
+		os.Exit(runHealthcheck())
+	case "replay":
+		os.Exit(runReplay(flag.Args()[1:]))
+	}
 
-		if update.Message != nil { // ignore any non-Message Updates
-			msg := update.Message
-
-			from := msg.From.UserName
-			if from == "" {
-				from = "Unknown"
-			}
-
-			if msg.Chat.ID != int64(msg.From.ID) {
-				telLog.Info("[%s(%d)] %s: %s", msg.Chat.Title, msg.Chat.ID, from, msg.Text)
-			} else {
-				telLog.Info("%s: %s", from, msg.Text)
-			}
-
-			topic, ok := groupMaps[msg.Chat.ID]
-
-			if ok {
-				topicTo, ok := topicToMap[topic]
-				telLog.Debug("Redirecting message from User: %s", msg.Chat.Title)
-				if ok {
-
-					data := map[string]interface{}{
-						"sendmsg": true,
-						"to":      topicTo,
-						"message": fmt.Sprintf("%s %s: %s", msg.From.FirstName, msg.From.LastName, msg.Text),
-					}
-
-					jsonData, _ := json.Marshal(data)
-					mqttLog.Debug("Publishing to %s_msg: %s", topic, string(jsonData))
-					mqttClient.Publish(fmt.Sprintf("%s_msg", topic), 0, false, jsonData)
-				} else {
-					telLog.Error("Received message but can't send because no msgToName defined!")
-				}
-			}
-		}
+	if err := loadSecrets(); err != nil {
+		slog.Fatal(err)
 	}
-}
 
-func main() {
-	var err error
+	startEmbeddedBroker()
 
 	if telegramBotToken == "" {
 		slog.Error("Telegram Bot Token was not defined! Please define at environment variable \"telegram_bot_token\"")
@@ -173,77 +84,103 @@ func main() {
 		slog.Warn(`Telegram Administrator ID not defined. Administrator will be disabled. Define at environment variable 'telegram_admin'`)
 	}
 
-	if groupToTopic == "" {
-		slog.Error(`Group to Topic was not defined! Please define at environment variable 'group_to_topic'`)
+	if configFile != "" {
+		config, err = loadConfig(configFile)
+		if err != nil {
+			slog.Fatal("Error loading config file %s: %s", configFile, err)
+		}
+	}
+
+	if groupToTopic == "" && len(config.Mappings) == 0 && autoProvisionTopic == "" {
+		slog.Error(`Group to Topic was not defined! Please define at environment variable 'group_to_topic' or in the config file mappings`)
 		slog.Warn(`Format: groupId:mqttTopic:messageTo;groupId2:mqttTopic2:messageTo2`)
 	}
 
-	if telegramBotToken == "" || groupToTopic == "" || mqttHost == "" {
+	if telegramBotToken == "" || (groupToTopic == "" && len(config.Mappings) == 0 && autoProvisionTopic == "") || mqttHost == "" {
 		slog.Fatal("One or more environment variables not defined. Aborting...")
 	}
 
-	groups := strings.Split(groupToTopic, ";")
-
-	for _, m := range groups {
-		z := strings.Split(m, ":")
-		group, _ := strconv.ParseInt(z[0], 10, 64)
-		topic := z[1]
+	mappings, err := loadMappings()
+	if err != nil {
+		slog.Fatal(err)
+	}
 
-		mqttLog.Info("Mapping Telegram Group %d to MQTT Topic %s", group, topic)
+	for _, m := range mappings {
+		addMapping(m)
+	}
 
-		groupMaps[group] = topic
-		topicMaps[topic] = group
+	if err := setupDialogs(config.Dialogs); err != nil {
+		slog.Fatal(err)
+	}
 
-		if len(z) > 2 {
-			topicToMap[topic] = z[2]
-		} else {
-			mqttLog.Warn("Topic %s does not have a third argument which represents the message to.")
-		}
+	if err := setupRules(config.Rules); err != nil {
+		slog.Fatal(err)
 	}
 
+	telegramBreaker.Threshold = getEnvInt("telegram_breaker_threshold", 5)
+	telegramBreaker.Cooldown = getEnvDuration("telegram_breaker_cooldown", time.Minute)
+
 	slog.Info("Starting")
+	setupTracing()
+	setupErrorReporting()
+	startHTTPServer()
+	startGRPCServer()
+
 	// region Telegram Bot Connect
-	telegramBot, err = tgbotapi.NewBotAPI(telegramBotToken)
-	if err != nil {
+	if err := connectTelegram(); err != nil {
 		telLog.Fatal(err)
 	}
 
-	telegramBot.Debug = true
-
-	telLog.Info("Authorized on account %s", telegramBot.Self.UserName)
+	telLog.Info("Authorized on account %s", getTelegramSelf().Username)
 	// endregion
 	// region MQTT
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker(fmt.Sprintf("tcp://%s:1883", mqttHost))
-	opts.SetDefaultPublishHandler(func(client mqtt.Client, message mqtt.Message) {
-		mqttLog.Debug(`Received Message on Topic %s: %s`, message.Topic(), string(message.Payload()))
-		doMessage(message.Topic(), message.Payload())
-	})
-	opts.SetPingTimeout(1 * time.Second)
-	opts.SetKeepAlive(2 * time.Second)
-
-	mqttClient = mqtt.NewClient(opts)
-	if token := mqttClient.Connect(); token.Wait() && token.Error() != nil {
-		mqttLog.Fatal(token.Error())
+	if err := connectMQTT(); err != nil {
+		mqttLog.Fatal(err)
 	}
 
 	mqttLog.Info("Connected")
 
-	token := mqttClient.Subscribe("presence", 0, nil)
-	token.Wait()
-	err = token.Error()
-	if err != nil {
-		mqttLog.Fatal("Error subscribing to %s: %s", "presence", err)
+	if presenceTopic == "" {
+		presenceTopic = "presence"
 	}
 
-	for k := range topicMaps {
-		token := mqttClient.Subscribe(k, 0, nil)
-		token.Wait()
-		err = token.Error()
-		if err != nil {
-			mqttLog.Fatal("Error subscribing to %s: %s", k, err)
+	if presenceTopic != "none" {
+		subscribe(mqttTopic(presenceTopic), presenceHandler)
+	}
+
+	startQueue()
+	startFloodProtection()
+	for topic, mapping := range listTopicMappings() {
+		subscribe(sharedTopic(mqttTopic(topic)), mappingHandler(mapping))
+	}
+
+	for _, mapping := range listTopicMappings() {
+		if mapping.Devices != nil {
+			subscribe(mqttTopic(mapping.Devices.Topic), devicesHandler(mapping))
 		}
 	}
+	startWatchdogs()
+
+	if broadcastTopic != "" {
+		subscribe(sharedTopic(mqttTopic(broadcastTopic)), broadcastHandler)
+	}
+
+	if homeAssistantTopic != "" {
+		subscribe(sharedTopic(mqttTopic(homeAssistantTopic+"/#")), homeAssistantHandler)
+	}
+
+	startLeaderElection()
+	startControl()
+	startStats()
+	// endregion
+	watchSecrets()
+	openArchive()
+	setupStorage()
+	loadLastValues()
+	// region Scheduler
+	setupSchedules(config.Schedules)
+	loadPendingMessages()
+	go RunScheduler()
 	// endregion
 
 	c := make(chan os.Signal, 1)
@@ -256,18 +193,45 @@ func main() {
 		done <- true
 	}()
 
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			slog.Info("Received SIGHUP, reloading the secrets")
+			reloadSecrets()
+		}
+	}()
+
 	tick := time.NewTicker(time.Second * 1)
 	running := true
 
 	slog.Info("Starting global loop")
+	handleDumpSignal()
+	setStartupStage(StageReady)
+	sdNotify("READY=1")
+	startWatchdog()
+	notifyAdmin(fmt.Sprintf("MQTT Telegram started as %s", getTelegramSelf().Username))
 
 	for running {
 		select {
 		case <-tick.C:
-			CheckTelegramUpdates()
+			heartbeat(&lastLoop)
+			pollTelegram(isLeader())
 		case <-done:
 			running = false
 		}
 	}
+	setStartupStage(StageStopping)
+	sdNotify("STOPPING=1")
+	pollTelegram(false)
+	notifyAdmin("MQTT Telegram stopping")
+	stopQueue()
+	getMQTTClient().Disconnect()
+	if lastValuesFile != "" {
+		saveLastValues()
+	}
+	shutdownTracing()
+	flushErrorReporting()
 	slog.Info("MQTT Telegram Stopped")
 }
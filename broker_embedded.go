@@ -0,0 +1,84 @@
+package main
+
+import (
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"io/ioutil"
+	stdslog "log/slog"
+	"net"
+	"os"
+)
+
+var (
+	embeddedBroker     = os.Getenv("embedded_broker")      // Listen address of the embedded MQTT broker, like :1883
+	embeddedBrokerWS   = os.Getenv("embedded_broker_ws")   // Listen address of the MQTT over WebSocket listener
+	embeddedBrokerAuth = os.Getenv("embedded_broker_auth") // Auth ledger (YAML or JSON) of the users and ACLs. Allows all on loopback listeners when empty
+)
+
+// isLoopbackAddress returns if a listen address only accepts local connections, like 127.0.0.1:1883
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// startEmbeddedBroker starts the embedded MQTT broker, when embedded_broker is defined, and makes the bridge connect to it
+// when mqtt_server is not defined
+func startEmbeddedBroker() {
+	if embeddedBroker == "" {
+		return
+	}
+
+	server := mochi.New(&mochi.Options{
+		Logger: stdslog.New(stdslog.NewTextHandler(os.Stderr, &stdslog.HandlerOptions{Level: stdslog.LevelWarn})),
+	})
+
+	var err error
+	if embeddedBrokerAuth != "" {
+		data, readErr := ioutil.ReadFile(embeddedBrokerAuth)
+		if readErr != nil {
+			mqttLog.Fatal("Error reading embedded_broker_auth %s: %s", embeddedBrokerAuth, readErr)
+		}
+		err = server.AddHook(new(auth.Hook), &auth.Options{Data: data})
+	} else {
+		for _, address := range []string{embeddedBroker, embeddedBrokerWS} {
+			if address != "" && !isLoopbackAddress(address) {
+				mqttLog.Fatal("The embedded broker requires embedded_broker_auth to listen at %s, or listen at 127.0.0.1 to allow all the local clients", address)
+			}
+		}
+		err = server.AddHook(new(auth.AllowHook), nil)
+	}
+	if err != nil {
+		mqttLog.Fatal("Error setting up the embedded broker auth: %s", err)
+	}
+
+	if err := server.AddListener(listeners.NewTCP(listeners.Config{ID: "tcp", Address: embeddedBroker})); err != nil {
+		mqttLog.Fatal("Error listening at %s: %s", embeddedBroker, err)
+	}
+
+	if embeddedBrokerWS != "" {
+		if err := server.AddListener(listeners.NewWebsocket(listeners.Config{ID: "ws", Address: embeddedBrokerWS})); err != nil {
+			mqttLog.Fatal("Error listening at %s: %s", embeddedBrokerWS, err)
+		}
+	}
+
+	if err := server.Serve(); err != nil {
+		mqttLog.Fatal("Error starting the embedded broker: %s", err)
+	}
+
+	mqttLog.Info("Embedded broker listening at %s", embeddedBroker)
+
+	if mqttHost == "" {
+		_, port, _ := net.SplitHostPort(embeddedBroker)
+		mqttHost = net.JoinHostPort("127.0.0.1", port)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"strings"
+	"time"
+)
+
+// handleCallbackQuery publishes the inline button presses of mapped chats to the mapping callback topic
+func handleCallbackQuery(q *models.CallbackQuery) {
+	ctx, cancel := telegramContext(context.Background())
+	defer cancel()
+
+	if _, err := getTelegramBot().AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{CallbackQueryID: q.ID}); err != nil {
+		telLog.Error("Error answering callback query: %s", err)
+	}
+
+	chat, messageID, ok := callbackMessage(q)
+	if !ok {
+		return
+	}
+
+	if strings.HasPrefix(q.Data, provisionCallbackPrefix) {
+		handleProvisionCallback(q)
+		return
+	}
+
+	if strings.HasPrefix(q.Data, ackCallbackPrefix) {
+		handleAckCallback(q)
+		return
+	}
+
+	if strings.HasPrefix(q.Data, dialogCallbackPrefix) {
+		handleDialogCallback(q)
+		return
+	}
+
+	mapping, ok := groupMapping(chat.ID)
+	if !ok {
+		return
+	}
+
+	if !allowFromTelegram(mapping, chat, &q.From) {
+		return
+	}
+
+	data := map[string]interface{}{
+		"data":          q.Data,
+		"chat_id":       chat.ID,
+		"message_id":    messageID,
+		"time":          time.Now().UTC().Format(time.RFC3339),
+		"from":          q.From.FirstName + " " + q.From.LastName,
+		"from_username": q.From.Username,
+		"from_id":       q.From.ID,
+	}
+
+	msg := &models.Message{ID: messageID, Chat: chat, From: &q.From}
+	if q.Message.Message != nil {
+		msg.IsTopicMessage, msg.MessageThreadID = q.Message.Message.IsTopicMessage, q.Message.Message.MessageThreadID
+	}
+
+	callbackTopic := mapping.callbackTopic(msg)
+	payload, _ := json.Marshal(data)
+
+	telLog.Info("Button %q pressed in %s", q.Data, chat.Title)
+	if err := getMQTTClient().Publish(MQTTMessage{Topic: callbackTopic, Payload: payload}); err != nil {
+		mqttLog.Error("Error publishing to %s: %s", callbackTopic, err)
+	}
+}
+
+// callbackMessage returns the chat and id of the message with the pressed button. Callbacks of inline messages have no message.
+func callbackMessage(q *models.CallbackQuery) (models.Chat, int, bool) {
+	switch {
+	case q.Message.Message != nil:
+		return q.Message.Message.Chat, q.Message.Message.ID, true
+	case q.Message.InaccessibleMessage != nil:
+		return q.Message.InaccessibleMessage.Chat, q.Message.InaccessibleMessage.MessageID, true
+	}
+
+	return models.Chat{}, 0, false
+}
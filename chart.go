@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"github.com/wcharczuk/go-chart/v2"
+	"strings"
+	"time"
+)
+
+// maxChartPoints limits the memory used by the series of each mapping
+const maxChartPoints = 10000
+
+const defaultChartWindow = 24 * time.Hour
+
+var errNotEnoughValues = fmt.Errorf("not enough values to chart")
+
+type chartPoint struct {
+	Time  time.Time
+	Value float64
+}
+
+// recordChartValue buffers the chart_field value of a payload, if it is numeric
+func (m *Mapping) recordChartValue(data map[string]interface{}, t time.Time) {
+	if m.ChartField == "" {
+		return
+	}
+
+	value, ok := numericValue(data[m.ChartField])
+	if !ok {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.series = append(m.series, chartPoint{Time: t, Value: value})
+
+	window := m.chartWindow()
+
+	cut := 0
+	for cut < len(m.series) && (m.series[cut].Time.Before(t.Add(-window)) || len(m.series)-cut > maxChartPoints) {
+		cut++
+	}
+	m.series = m.series[cut:]
+}
+
+// renderChart renders the values buffered since a time as a PNG
+func (m *Mapping) renderChart(since time.Time) ([]byte, error) {
+	m.lock.Lock()
+	var times []time.Time
+	var values []float64
+	for _, p := range m.series {
+		if !p.Time.Before(since) {
+			times = append(times, p.Time.In(m.location))
+			values = append(values, p.Value)
+		}
+	}
+	m.lock.Unlock()
+
+	if len(values) < 2 {
+		return nil, errNotEnoughValues
+	}
+
+	format := "15:04"
+	if times[len(times)-1].Sub(times[0]) > 24*time.Hour {
+		format = "01-02 15:04"
+	}
+
+	graph := chart.Chart{
+		Title: m.Topic,
+		XAxis: chart.XAxis{ValueFormatter: chart.TimeValueFormatterWithFormat(format)},
+		YAxis: chart.YAxis{Name: m.ChartField},
+		Series: []chart.Series{
+			chart.TimeSeries{XValues: times, YValues: values},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := graph.Render(chart.PNG, &buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// chartWindow returns how long the chart values are kept
+func (m *Mapping) chartWindow() time.Duration {
+	if m.ChartWindow.Duration == 0 {
+		return defaultChartWindow
+	}
+
+	return m.ChartWindow.Duration
+}
+
+// deliverChart renders the chart of the last duration and sends it to the mapping group
+func deliverChart(mapping *Mapping, d time.Duration) error {
+	if mapping.isMuted() {
+		return errMuted
+	}
+
+	image, err := mapping.renderChart(time.Now().Add(-d))
+	if err != nil {
+		return err
+	}
+
+	return mapping.telegramSink().SendPhoto(fmt.Sprintf("%s (%s)", mapping.Topic, d), image)
+}
+
+// graphCommand sends the chart of a mapping: /graph [duration] [topic]. The topic defaults to the chat mapping
+func graphCommand(msg *models.Message) string {
+	args := strings.Fields(commandArguments(msg))
+
+	mapping, ok := groupMapping(msg.Chat.ID)
+	duration := ""
+	for _, arg := range args {
+		if m, found := topicMapping(arg); found && isAdmin(msg.From) {
+			mapping, ok = m, true
+		} else {
+			duration = arg
+		}
+	}
+
+	if !ok {
+		return translate(chatLanguage(msg.Chat.ID), "graph_usage")
+	}
+
+	if mapping.ChartField == "" {
+		return mapping.tr("graph_disabled", mapping.Topic)
+	}
+
+	d := mapping.chartWindow()
+	if duration != "" {
+		var err error
+		if d, err = time.ParseDuration(duration); err != nil {
+			return mapping.tr("graph_invalid_duration", duration)
+		}
+	}
+
+	image, err := mapping.renderChart(time.Now().Add(-d))
+	if err == errNotEnoughValues {
+		return mapping.tr("graph_no_values", mapping.Topic)
+	} else if err != nil {
+		return err.Error()
+	}
+
+	ctx, cancel := telegramContext(context.Background())
+	defer cancel()
+
+	_, err = getTelegramBot().SendPhoto(ctx, &bot.SendPhotoParams{
+		ChatID:          msg.Chat.ID,
+		MessageThreadID: msg.MessageThreadID,
+		Photo:           &models.InputFileUpload{Filename: "chart.png", Data: bytes.NewReader(image)},
+		Caption:         fmt.Sprintf("%s (%s)", mapping.Topic, d),
+		ReplyParameters: replyTo(msg),
+	})
+	if err != nil {
+		return mapping.tr("graph_send_error", err)
+	}
+
+	return ""
+}
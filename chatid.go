@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"os"
+)
+
+// discoveryMode replies the chat id to messages in unmapped chats and when the bot joins a group
+var discoveryMode = os.Getenv("discovery_mode") == "true"
+
+func chatIDText(chat *models.Chat) string {
+	return translate(chatLanguage(chat.ID), "chat_id", chat.ID, chat.Type)
+}
+
+func chatIDCommand(msg *models.Message) string {
+	return chatIDText(&msg.Chat)
+}
+
+// replyChatID replies the chat id in discovery mode, for messages in chats without mapping or when the bot is added to a group
+func replyChatID(msg *models.Message) {
+	if !discoveryMode {
+		return
+	}
+
+	joined := false
+	for _, member := range msg.NewChatMembers {
+		joined = joined || member.ID == getTelegramSelf().ID
+	}
+
+	if _, mapped := groupMapping(msg.Chat.ID); mapped && !joined {
+		return
+	}
+
+	if _, err := sendTelegram(&bot.SendMessageParams{ChatID: msg.Chat.ID, Text: chatIDText(&msg.Chat)}); err != nil {
+		telLog.Error("Error sending chat id to %d: %s", msg.Chat.ID, err)
+	}
+}
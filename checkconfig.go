@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/go-telegram/bot"
+)
+
+var checkConfig = flag.Bool("check-config", false, "Validate the configuration, Telegram chats and MQTT broker, then exit")
+
+// configChecker collects the problems found by -check-config
+type configChecker struct {
+	problems int
+}
+
+func (c *configChecker) ok(format string, args ...interface{}) {
+	fmt.Printf("OK    "+format+"\n", args...)
+}
+
+func (c *configChecker) fail(format string, args ...interface{}) {
+	c.problems++
+	fmt.Printf("FAIL  "+format+"\n", args...)
+}
+
+func (c *configChecker) warn(format string, args ...interface{}) {
+	fmt.Printf("WARN  "+format+"\n", args...)
+}
+
+// runCheckConfig validates the whole configuration and returns the process exit code
+func runCheckConfig() int {
+	c := &configChecker{}
+
+	if err := loadSecrets(); err != nil {
+		c.fail("%s", err)
+	}
+
+	if configFile != "" {
+		var err error
+		config, err = loadConfig(configFile)
+		if err != nil {
+			c.fail("config file %s: %s", configFile, err)
+		} else {
+			c.ok("config file %s", configFile)
+		}
+	}
+
+	if telegramBotToken == "" {
+		c.fail("telegram_bot_token not defined")
+	}
+	if mqttHost == "" {
+		c.fail("mqtt_server not defined")
+	}
+	if telegramAdminId == "" {
+		c.warn("telegram_admin not defined, admin commands and notifications are disabled")
+	}
+
+	mappings, err := parseGroupToTopic(groupToTopic)
+	if err != nil {
+		c.fail("group_to_topic: %s", err)
+	}
+	mappings = append(mappings, config.Mappings...)
+
+	if len(mappings) == 0 {
+		c.fail("no mappings defined at group_to_topic or the config file")
+	}
+
+	var valid []*Mapping
+	for _, m := range mappings {
+		if err := m.setup(); err != nil {
+			c.fail("mapping %s: %s", m.Topic, err)
+			continue
+		}
+		c.ok("mapping %s <-> %d", m.Topic, m.GroupID)
+		valid = append(valid, m)
+	}
+
+	for _, sc := range config.Schedules {
+		if _, err := parseCron(sc); err != nil {
+			c.fail("schedule %q for topic %s: %s", sc.Cron, sc.Topic, err)
+		} else {
+			c.ok("schedule %q for topic %s", sc.Cron, sc.Topic)
+		}
+	}
+
+	if err := setupDialogs(config.Dialogs); err != nil {
+		c.fail("dialogs: %s", err)
+	} else if len(config.Dialogs) > 0 {
+		c.ok("%d dialogs", len(config.Dialogs))
+	}
+
+	if err := setupRules(config.Rules); err != nil {
+		c.fail("rules: %s", err)
+	} else if len(config.Rules) > 0 {
+		c.ok("%d rules", len(config.Rules))
+	}
+
+	if telegramBotToken != "" {
+		c.checkTelegram(valid)
+	}
+
+	if mqttHost != "" {
+		c.checkMQTT()
+	}
+
+	if c.problems > 0 {
+		fmt.Printf("\n%d problems found\n", c.problems)
+		return 1
+	}
+
+	fmt.Println("\nConfiguration is valid")
+	return 0
+}
+
+// checkTelegram authorizes the bot and resolves the chats of the mappings and their telegram sinks
+func (c *configChecker) checkTelegram(mappings []*Mapping) {
+	b, self, err := newTelegramBot(telegramBotToken)
+	if err != nil {
+		c.fail("telegram authorization: %s", err)
+		return
+	}
+	c.ok("telegram authorized as %s", self.Username)
+
+	chats := map[int64]bool{}
+	for _, m := range mappings {
+		chats[m.GroupID] = true
+		for _, s := range m.Sinks {
+			if s.Type == SinkTelegram {
+				chats[s.ChatID] = true
+			}
+		}
+	}
+
+	for id := range chats {
+		ctx, cancel := telegramContext(context.Background())
+		chat, err := b.GetChat(ctx, &bot.GetChatParams{ChatID: id})
+		cancel()
+		if err != nil {
+			c.fail("telegram chat %d: %s", id, err)
+			continue
+		}
+		c.ok("telegram chat %d: %s (%s)", id, chat.Title, chat.Type)
+	}
+}
+
+// checkMQTT connects to the broker and disconnects
+func (c *configChecker) checkMQTT() {
+	client, err := newMQTTClient(getMQTTPassword())
+	if err != nil {
+		c.fail("mqtt: %s", err)
+		return
+	}
+
+	if err := client.Connect(); err != nil {
+		c.fail("mqtt connection to %s: %s", mqttHost, err)
+		return
+	}
+	client.Disconnect()
+
+	c.ok("mqtt connection to %s", mqttHost)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitBreaker stops calling a failing service after Threshold consecutive failures.
+// After Cooldown a single trial call is allowed, closing the circuit again if it succeeds.
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	lock      sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+// Allow returns if a call should be attempted
+func (cb *CircuitBreaker) Allow() bool {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	if cb.failures < cb.Threshold {
+		return true
+	}
+
+	if cb.trial || time.Now().Before(cb.openUntil) {
+		return false
+	}
+
+	cb.trial = true
+
+	return true
+}
+
+// IsOpen returns if the circuit is currently open (calls are being blocked)
+func (cb *CircuitBreaker) IsOpen() bool {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	return cb.failures >= cb.Threshold
+}
+
+func (cb *CircuitBreaker) Success() {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	cb.failures = 0
+	cb.trial = false
+}
+
+func (cb *CircuitBreaker) Failure() {
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	cb.failures++
+	cb.trial = false
+
+	if cb.failures >= cb.Threshold {
+		cb.openUntil = time.Now().Add(cb.Cooldown)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-telegram/bot/models"
+	"time"
+)
+
+const cloudEventsSpecVersion = "1.0"
+const cloudEventMessageType = "com.github.racerxdl.mqtttelegram.message"
+
+// isCloudEvent returns if the payload is a CloudEvents structured JSON event
+func isCloudEvent(data map[string]interface{}) bool {
+	_, ok := data["specversion"].(string)
+	return ok
+}
+
+// fromCloudEvent converts a CloudEvent into the bridge payload format.
+// "source" is used as the sender, "time" as the timestamp and "data" as the message.
+// If data is an object with "message" / "from" fields they take precedence.
+// The original event is available to templates as .Data.cloudevent
+func fromCloudEvent(ce map[string]interface{}) map[string]interface{} {
+	data := map[string]interface{}{
+		"type":       "message",
+		"cloudevent": ce,
+	}
+
+	if ce["source"] != nil {
+		data["from"] = ce["source"]
+	}
+
+	if ce["time"] != nil {
+		data["timestamp"] = ce["time"]
+	}
+
+	switch v := ce["data"].(type) {
+	case string:
+		data["message"] = v
+	case map[string]interface{}:
+		for k, value := range v {
+			if k != "type" {
+				data[k] = value
+			}
+		}
+		if data["message"] == nil {
+			j, _ := json.Marshal(v)
+			data["message"] = string(j)
+		}
+	case nil:
+		data["message"] = fmt.Sprintf("%v", ce["type"])
+	default:
+		j, _ := json.Marshal(v)
+		data["message"] = string(j)
+	}
+
+	return data
+}
+
+// toCloudEvent wraps a Telegram to MQTT payload into a CloudEvent
+func toCloudEvent(msg *models.Message, data map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"specversion":     cloudEventsSpecVersion,
+		"id":              fmt.Sprintf("%d-%d", msg.Chat.ID, msg.ID),
+		"source":          fmt.Sprintf("telegram/%d", msg.Chat.ID),
+		"type":            cloudEventMessageType,
+		"time":            time.Unix(int64(msg.Date), 0).UTC().Format(time.RFC3339),
+		"datacontenttype": "application/json",
+		"data":            data,
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Payload codecs
+const (
+	CodecJSON     = "json"
+	CodecCBOR     = "cbor"
+	CodecProtobuf = "protobuf"
+)
+
+// Codec decodes a MQTT payload into the bridge payload format
+type Codec interface {
+	Decode(payload []byte) (map[string]interface{}, error)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Decode(payload []byte) (map[string]interface{}, error) {
+	var data map[string]interface{}
+	err := json.Unmarshal(payload, &data)
+	return data, err
+}
+
+func getCodec(name string) (Codec, error) {
+	switch name {
+	case "", CodecJSON:
+		return jsonCodec{}, nil
+	case CodecCBOR:
+		return cborCodec{}, nil
+	case CodecProtobuf:
+		return protobufCodec{}, nil
+	}
+
+	return nil, fmt.Errorf("invalid codec %q", name)
+}
+
+// decodePayload decrypts (if encryption_key is set) and decodes the payload with the mapping codec, renaming fields according to codec_fields.
+// Binary codecs default the payload type to "message", since devices usually don't send it.
+func (m *Mapping) decodePayload(payload []byte) (map[string]interface{}, error) {
+	if m == nil || m.codec == nil {
+		return decodeObject(jsonCodec{}, payload)
+	}
+
+	if m.key != nil {
+		plain, err := decryptPayload(m.key, payload)
+		if err != nil {
+			return nil, err
+		}
+		payload = plain
+	}
+
+	data, err := decodeObject(m.codec, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	for src, dst := range m.CodecFields {
+		if v, ok := data[src]; ok {
+			delete(data, src)
+			data[dst] = v
+		}
+	}
+
+	m.extractFields(data)
+
+	if _, isJSON := m.codec.(jsonCodec); !isJSON && data["type"] == nil {
+		data["type"] = "message"
+	}
+
+	return data, nil
+}
+
+// rawPayload returns if decodePayload returns the payload as received, a JSON object that was not decrypted, renamed or
+// extended with the fields, so it can be stored without encoding it again
+func (m *Mapping) rawPayload() bool {
+	_, isJSON := m.codec.(jsonCodec)
+	return isJSON && m.key == nil && len(m.CodecFields) == 0 && len(m.Fields) == 0
+}
+
+// decodeObject decodes the payload with the codec, rejecting payloads that are not objects, like null
+func decodeObject(codec Codec, payload []byte) (map[string]interface{}, error) {
+	data, err := codec.Decode(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if data == nil {
+		return nil, fmt.Errorf("expected an object payload")
+	}
+
+	return data, nil
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const cborMaxDepth = 32
+
+// cborCodec decodes RFC 8949 CBOR payloads. Numbers are decoded as float64 and byte strings as base64
+// so the result has the same shape as a decoded JSON payload.
+type cborCodec struct{}
+
+func (cborCodec) Decode(payload []byte) (map[string]interface{}, error) {
+	d := &cborDecoder{data: payload}
+
+	v, err := d.decode(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("cbor: %d trailing bytes", len(d.data)-d.pos)
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cbor: expected map at top level")
+	}
+
+	return m, nil
+}
+
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+var errCBORBreak = fmt.Errorf("cbor: unexpected break")
+
+func (d *cborDecoder) readByte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, fmt.Errorf("cbor: unexpected end of data")
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b, nil
+}
+
+func (d *cborDecoder) readN(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, fmt.Errorf("cbor: unexpected end of data")
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// readArgument reads the argument of a data item. indefinite is true for additional info 31
+func (d *cborDecoder) readArgument(info byte) (value uint64, indefinite bool, err error) {
+	switch {
+	case info < 24:
+		return uint64(info), false, nil
+	case info == 24:
+		b, err := d.readN(1)
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(b[0]), false, nil
+	case info == 25:
+		b, err := d.readN(2)
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(binary.BigEndian.Uint16(b)), false, nil
+	case info == 26:
+		b, err := d.readN(4)
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(binary.BigEndian.Uint32(b)), false, nil
+	case info == 27:
+		b, err := d.readN(8)
+		if err != nil {
+			return 0, false, err
+		}
+		return binary.BigEndian.Uint64(b), false, nil
+	case info == 31:
+		return 0, true, nil
+	}
+
+	return 0, false, fmt.Errorf("cbor: invalid additional info %d", info)
+}
+
+func (d *cborDecoder) readString(major byte, info byte, depth int) ([]byte, error) {
+	n, indefinite, err := d.readArgument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	if !indefinite {
+		return d.readN(n)
+	}
+
+	var result []byte
+	for {
+		b, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == 0xff {
+			return result, nil
+		}
+		if b>>5 != major || b&0x1f == 31 {
+			return nil, fmt.Errorf("cbor: invalid chunk in indefinite string")
+		}
+		chunk, err := d.readString(major, b&0x1f, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, chunk...)
+	}
+}
+
+func halfToFloat(h uint16) float64 {
+	exp := (h >> 10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var v float64
+
+	switch exp {
+	case 0:
+		v = mant * math.Pow(2, -24)
+	case 31:
+		if mant == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = (mant + 1024) * math.Pow(2, float64(exp)-25)
+	}
+
+	if h&0x8000 != 0 {
+		return -v
+	}
+	return v
+}
+
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+	if depth > cborMaxDepth {
+		return nil, fmt.Errorf("cbor: maximum nesting depth exceeded")
+	}
+
+	b, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	major := b >> 5
+	info := b & 0x1f
+
+	switch major {
+	case 0, 1:
+		n, indefinite, err := d.readArgument(info)
+		if err != nil {
+			return nil, err
+		}
+		if indefinite {
+			return nil, fmt.Errorf("cbor: invalid indefinite integer")
+		}
+		if major == 1 {
+			return -1 - float64(n), nil
+		}
+		return float64(n), nil
+	case 2:
+		s, err := d.readString(major, info, depth)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.EncodeToString(s), nil
+	case 3:
+		s, err := d.readString(major, info, depth)
+		if err != nil {
+			return nil, err
+		}
+		return string(s), nil
+	case 4:
+		n, indefinite, err := d.readArgument(info)
+		if err != nil {
+			return nil, err
+		}
+		arr := []interface{}{}
+		for i := uint64(0); indefinite || i < n; i++ {
+			v, err := d.decode(depth + 1)
+			if err == errCBORBreak && indefinite {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case 5:
+		n, indefinite, err := d.readArgument(info)
+		if err != nil {
+			return nil, err
+		}
+		m := map[string]interface{}{}
+		for i := uint64(0); indefinite || i < n; i++ {
+			k, err := d.decode(depth + 1)
+			if err == errCBORBreak && indefinite {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprintf("%v", k)] = v
+		}
+		return m, nil
+	case 6:
+		// Tags are ignored, only the tagged value is used
+		if _, _, err := d.readArgument(info); err != nil {
+			return nil, err
+		}
+		return d.decode(depth + 1)
+	}
+
+	// Major type 7: simple values and floats
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		v, _, err := d.readArgument(info)
+		if err != nil {
+			return nil, err
+		}
+		return halfToFloat(uint16(v)), nil
+	case 26:
+		v, _, err := d.readArgument(info)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(uint32(v))), nil
+	case 27:
+		v, _, err := d.readArgument(info)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(v), nil
+	case 31:
+		return nil, errCBORBreak
+	}
+
+	if info < 24 {
+		return float64(info), nil
+	}
+
+	if info == 24 {
+		v, _, err := d.readArgument(info)
+		return float64(v), err
+	}
+
+	return nil, fmt.Errorf("cbor: invalid simple value %d", info)
+}
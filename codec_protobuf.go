@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// protobufCodec decodes protobuf wire format payloads without a schema.
+// Fields are named by their field number (use codec_fields to rename them):
+//   - varint as integers
+//   - fixed32 / fixed64 as float / double
+//   - length delimited as string when valid UTF-8, base64 otherwise
+//
+// Repeated fields are decoded as arrays.
+type protobufCodec struct{}
+
+func readVarint(data []byte, pos int) (uint64, int, error) {
+	v, n := binary.Uvarint(data[pos:])
+	if n <= 0 {
+		return 0, pos, fmt.Errorf("protobuf: invalid varint at %d", pos)
+	}
+	return v, pos + n, nil
+}
+
+func (protobufCodec) Decode(payload []byte) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+	pos := 0
+
+	for pos < len(payload) {
+		key, p, err := readVarint(payload, pos)
+		if err != nil {
+			return nil, err
+		}
+		pos = p
+
+		field := key >> 3
+		if field == 0 {
+			return nil, fmt.Errorf("protobuf: invalid field number 0")
+		}
+
+		var value interface{}
+
+		switch key & 7 {
+		case 0: // varint
+			v, p, err := readVarint(payload, pos)
+			if err != nil {
+				return nil, err
+			}
+			pos = p
+			value = float64(int64(v))
+		case 1: // fixed64
+			if len(payload)-pos < 8 {
+				return nil, fmt.Errorf("protobuf: unexpected end of data")
+			}
+			value = math.Float64frombits(binary.LittleEndian.Uint64(payload[pos:]))
+			pos += 8
+		case 2: // length delimited
+			l, p, err := readVarint(payload, pos)
+			if err != nil {
+				return nil, err
+			}
+			pos = p
+			if l > uint64(len(payload)-pos) {
+				return nil, fmt.Errorf("protobuf: unexpected end of data")
+			}
+			b := payload[pos : pos+int(l)]
+			pos += int(l)
+			if utf8.Valid(b) {
+				value = string(b)
+			} else {
+				value = base64.StdEncoding.EncodeToString(b)
+			}
+		case 5: // fixed32
+			if len(payload)-pos < 4 {
+				return nil, fmt.Errorf("protobuf: unexpected end of data")
+			}
+			value = float64(math.Float32frombits(binary.LittleEndian.Uint32(payload[pos:])))
+			pos += 4
+		default:
+			return nil, fmt.Errorf("protobuf: unsupported wire type %d", key&7)
+		}
+
+		name := strconv.FormatUint(field, 10)
+		switch existing := data[name].(type) {
+		case nil:
+			data[name] = value
+		case []interface{}:
+			data[name] = append(existing, value)
+		default:
+			data[name] = []interface{}{existing, value}
+		}
+	}
+
+	return data, nil
+}
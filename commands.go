@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// publicCommands allows members of mapped groups to run the public commands
+var publicCommands = os.Getenv("public_commands") == "true"
+
+var startTime = time.Now()
+
+// commandHandler handles a bot command, returning the reply text
+type commandHandler func(msg *models.Message) string
+
+type command struct {
+	handler commandHandler
+	public  bool // Can be run by members of mapped groups when public_commands is enabled
+	open    bool // Can be run by anyone, in any chat
+}
+
+var commands = map[string]command{
+	"stats":    {handler: statsCommand, public: true},
+	"status":   {handler: statusCommand, public: true},
+	"enable":   {handler: enableCommand},
+	"mute":     {handler: muteCommand, public: true},
+	"unmute":   {handler: unmuteCommand, public: true},
+	"search":   {handler: searchCommand},
+	"export":   {handler: exportCommand},
+	"graph":    {handler: graphCommand, public: true},
+	"keyboard": {handler: keyboardCommand, public: true},
+	"get":      {handler: getCommand, public: true},
+	"devices":  {handler: devicesCommand, public: true},
+	"chatid":   {handler: chatIDCommand, open: true},
+}
+
+// isAdmin checks if the user is the telegram_admin, defined by user id or username
+func isAdmin(user *models.User) bool {
+	if telegramAdminId == "" || user == nil {
+		return false
+	}
+
+	return telegramAdminId == strconv.FormatInt(user.ID, 10) || strings.TrimPrefix(telegramAdminId, "@") == user.Username
+}
+
+func canRunCommand(c command, msg *models.Message) bool {
+	if c.open || isAdmin(msg.From) {
+		return true
+	}
+
+	_, mapped := groupMapping(msg.Chat.ID)
+
+	return c.public && publicCommands && mapped
+}
+
+// handleCommand runs a bot command. Returns false if the message is not a known command.
+func handleCommand(msg *models.Message) bool {
+	if !isCommand(msg) {
+		return false
+	}
+
+	c, ok := commands[commandName(msg)]
+	if !ok {
+		return false
+	}
+
+	if !canRunCommand(c, msg) {
+		telLog.Warn("User %s is not allowed to run /%s", telegramSender(msg), commandName(msg))
+		return true
+	}
+
+	text := c.handler(msg)
+	if text == "" { // The command already replied
+		return true
+	}
+
+	_, err := sendTelegram(&bot.SendMessageParams{
+		ChatID:          msg.Chat.ID,
+		MessageThreadID: msg.MessageThreadID,
+		Text:            text,
+		ReplyParameters: replyTo(msg),
+	})
+	if err != nil {
+		telLog.Error("Error replying to /%s: %s", commandName(msg), err)
+	}
+
+	return true
+}
+
+// visibleMappings returns the mappings the message sender can see: all for the admin, only the chat mapping for group members
+func visibleMappings(msg *models.Message) []*Mapping {
+	var mappings []*Mapping
+
+	if !isAdmin(msg.From) {
+		if m, ok := groupMapping(msg.Chat.ID); ok {
+			mappings = append(mappings, m)
+		}
+		return mappings
+	}
+
+	for _, m := range listTopicMappings() {
+		mappings = append(mappings, m)
+	}
+
+	sort.Slice(mappings, func(i, j int) bool {
+		return mappings[i].Topic < mappings[j].Topic
+	})
+
+	return mappings
+}
+
+func statusCommand(msg *models.Message) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Uptime: %s\n", time.Since(startTime).Truncate(time.Second))
+	fmt.Fprintf(&b, "MQTT connected: %t\n", getMQTTClient().IsConnected())
+
+	if haLeaderTopic != "" {
+		fmt.Fprintf(&b, "Leader: %t\n", isLeader())
+	}
+
+	if isDraining() {
+		b.WriteString("Draining: true\n")
+	}
+
+	pendingLock.Lock()
+	fmt.Fprintf(&b, "Pending messages: %d\n", len(pendingMessages))
+	pendingLock.Unlock()
+
+	if messageQueue != nil {
+		var lanes []string
+		total := 0
+		for i, length := range messageQueue.LaneLengths() {
+			lanes = append(lanes, fmt.Sprintf("%s %d", priorityLanes[i], length))
+			total += length
+		}
+		fmt.Fprintf(&b, "Queue: %d/%d (%s)\n", total, messageQueue.Size, strings.Join(lanes, ", "))
+	}
+
+	b.WriteString("\nMappings:\n")
+	for _, m := range visibleMappings(msg) {
+		state := "enabled"
+		if isChatDisabled(m.GroupID) {
+			state = "disabled"
+		}
+		fmt.Fprintf(&b, "  %s <-> %d (%s)\n", m.Topic, m.GroupID, state)
+	}
+
+	return b.String()
+}
+
+func statsCommand(msg *models.Message) string {
+	var b strings.Builder
+
+	visible := map[string]bool{}
+	visibleChats := map[string]bool{}
+	for _, m := range visibleMappings(msg) {
+		visible[m.Topic] = true
+		visibleChats[strconv.FormatInt(m.GroupID, 10)] = true
+	}
+
+	b.WriteString("MQTT messages:\n")
+	mqttMessages.Each(func(values []string, count uint64) {
+		if visible[values[0]] {
+			fmt.Fprintf(&b, "  %s %s: %d\n", values[0], values[1], count)
+		}
+	})
+
+	b.WriteString("\nTelegram messages:\n")
+	telegramReceived.Each(func(values []string, count uint64) {
+		if visible[values[0]] {
+			fmt.Fprintf(&b, "  %s: %d\n", values[0], count)
+		}
+	})
+
+	if !isAdmin(msg.From) {
+		return b.String()
+	}
+
+	b.WriteString("\nTelegram messages sent:\n")
+	telegramSent.Each(func(values []string, count uint64) {
+		fmt.Fprintf(&b, "  %s: %d\n", values[0], count)
+	})
+
+	b.WriteString("\nTelegram errors:\n")
+	telegramErrors.Each(func(values []string, count uint64) {
+		fmt.Fprintf(&b, "  %s %s: %d\n", values[0], values[1], count)
+	})
+
+	disabledLock.Lock()
+	if len(disabledChats) > 0 {
+		b.WriteString("\nDisabled chats:\n")
+		for chat, reason := range disabledChats {
+			fmt.Fprintf(&b, "  %d: %s\n", chat, reason)
+		}
+	}
+	disabledLock.Unlock()
+
+	return b.String()
+}
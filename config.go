@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/quan-to/slog"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+)
+
+var configFile = os.Getenv("config_file")
+
+// Duration is a time.Duration that can be unmarshalled from a duration string (5m, 1h30m) or a number of seconds
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	switch value := v.(type) {
+	case float64:
+		d.Duration = time.Duration(value * float64(time.Second))
+	case string:
+		var err error
+		d.Duration, err = time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid duration %s", string(b))
+	}
+
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// ScheduleConfig represents a recurring message defined in the configuration file
+type ScheduleConfig struct {
+	Topic   string `json:"topic"`
+	Cron    string `json:"cron"`
+	From    string `json:"from"`
+	Message string `json:"message"`
+}
+
+// Config represents the optional JSON configuration file pointed by config_file
+type Config struct {
+	Mappings  []*Mapping       `json:"mappings"`
+	Schedules []ScheduleConfig `json:"schedules"`
+	Dialogs   []*DialogConfig  `json:"dialogs"`
+	Rules     []*RuleConfig    `json:"rules"`
+
+	Messages map[string]map[string]string `json:"messages"` // Message catalogs per language, overriding the built-in texts
+}
+
+var config Config
+
+// getEnvInt reads an integer environment variable, returning def if not defined or invalid
+func getEnvInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		slog.Warn("Invalid value %q for environment variable %s, using default %d", v, name, def)
+		return def
+	}
+
+	return i
+}
+
+// getEnvDuration reads a duration environment variable (5m, 1h30m), returning def if not defined or invalid
+func getEnvDuration(name string, def time.Duration) time.Duration {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		slog.Warn("Invalid value %q for environment variable %s, using default %s", v, name, def)
+		return def
+	}
+
+	return d
+}
+
+func loadConfig(filename string) (Config, error) {
+	var c Config
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return c, err
+	}
+
+	err = json.Unmarshal(data, &c)
+	if err == nil {
+		addMessageCatalogs(c.Messages)
+	}
+
+	return c, err
+}
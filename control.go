@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"github.com/quan-to/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// controlTopic receives the runtime commands of the bridge, like $bridge/control. Empty disables it
+var controlTopic = os.Getenv("control_topic")
+
+// controlToken is the secret the control commands must have in the token field
+var controlToken = os.Getenv("control_token")
+
+var controlLog = newLogger("Control")
+
+// controlCommand is a runtime command received on the control topic
+type controlCommand struct {
+	Command  string `json:"command"`  // reload, mute, unmute, log_level, privacy, drain or resume
+	Instance string `json:"instance"` // Only the instance with this ha_instance_id runs the command. Empty for all
+	Topic    string `json:"topic"`    // mute, unmute: mapping topic
+	Duration string `json:"duration"` // mute: how long
+	Level    string `json:"level"`    // log_level: debug, info, warn or error
+	Enabled  bool   `json:"enabled"`  // privacy: hide the message contents in the logs
+	Token    string `json:"token"`    // The control_token
+}
+
+var drainLock sync.Mutex
+var draining bool
+
+// isDraining returns true after a drain command, while the instance does not take new Telegram updates
+func isDraining() bool {
+	drainLock.Lock()
+	defer drainLock.Unlock()
+
+	return draining
+}
+
+func setDraining(d bool) {
+	drainLock.Lock()
+	draining = d
+	drainLock.Unlock()
+}
+
+// setLogLevel enables the log levels from level up
+func setLogLevel(level string) error {
+	levels := map[string]int{"debug": 0, "info": 1, "warn": 2, "error": 3}
+
+	l, ok := levels[level]
+	if !ok {
+		return fmt.Errorf("invalid log level %q", level)
+	}
+
+	slog.SetDebug(l <= 0)
+	slog.SetInfo(l <= 1)
+	slog.SetWarning(l <= 2)
+	slog.SetError(true)
+
+	return nil
+}
+
+// runControlCommand runs a control command, returning an error if it is invalid
+func runControlCommand(c controlCommand) error {
+	switch c.Command {
+	case "reload":
+		reloadSecrets()
+	case "mute", "unmute":
+		mapping, ok := topicMapping(c.Topic)
+		if !ok {
+			return fmt.Errorf("no mapping for topic %q", c.Topic)
+		}
+		if c.Command == "unmute" {
+			mapping.unmute()
+			return nil
+		}
+		d, err := time.ParseDuration(c.Duration)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid duration %q", c.Duration)
+		}
+		mapping.mute(d)
+	case "log_level":
+		return setLogLevel(c.Level)
+	case "privacy":
+		setPrivacyMode(c.Enabled)
+	case "drain":
+		setDraining(true)
+		go notifyAdmin(fmt.Sprintf("Instance %s draining", haInstanceID))
+	case "resume":
+		setDraining(false)
+	default:
+		return fmt.Errorf("invalid command %q", c.Command)
+	}
+
+	return nil
+}
+
+func controlHandler(msg MQTTMessage) {
+	response := &rpcResponse{Status: rpcOK}
+	defer sendRPCResponse(msg, response)
+
+	var c controlCommand
+	if err := json.Unmarshal(msg.Payload, &c); err != nil {
+		controlLog.Error("Invalid control command on %s: %s", msg.Topic, err)
+		response.Status, response.Error = rpcError, err.Error()
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(c.Token), []byte(controlToken)) != 1 {
+		controlLog.Error("Rejecting control command on %s: invalid token", msg.Topic)
+		response.Status, response.Error = rpcError, "invalid token"
+		return
+	}
+
+	if c.Instance != "" && c.Instance != haInstanceID {
+		response.Status = rpcIgnored
+		return
+	}
+
+	controlLog.Info("Running control command %s", string(msg.Payload))
+	if err := runControlCommand(c); err != nil {
+		controlLog.Error("Error running control command %s: %s", c.Command, err)
+		response.Status, response.Error = rpcError, err.Error()
+	}
+}
+
+// startControl subscribes to the control topic, if enabled
+func startControl() {
+	if controlTopic == "" || controlTopic == "none" {
+		return
+	}
+
+	if controlToken == "" {
+		controlLog.Fatal("control_topic requires a control_token")
+	}
+
+	if haInstanceID == "" {
+		haInstanceID = instanceID()
+	}
+
+	controlLog.Info("Receiving control commands on %s", mqttTopic(controlTopic))
+	subscribe(mqttTopic(controlTopic), controlHandler)
+}
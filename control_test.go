@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestControlCommands(t *testing.T) {
+	broker := newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "sensors/rack"}
+	setupTestMappings(t, mapping)
+
+	previousToken := controlToken
+	controlToken = "c0ntrol"
+	t.Cleanup(func() { controlToken = previousToken })
+
+	tests := []struct {
+		name    string
+		payload string
+		status  string
+		muted   bool
+	}{
+		{"without token", `{"command": "mute", "topic": "sensors/rack", "duration": "1h"}`, rpcError, false},
+		{"wrong token", `{"command": "mute", "topic": "sensors/rack", "duration": "1h", "token": "guess"}`, rpcError, false},
+		{"other instance", `{"command": "mute", "topic": "sensors/rack", "duration": "1h", "instance": "other", "token": "c0ntrol"}`, rpcIgnored, false},
+		{"mute", `{"command": "mute", "topic": "sensors/rack", "duration": "1h", "token": "c0ntrol"}`, rpcOK, true},
+		{"invalid duration", `{"command": "mute", "topic": "sensors/rack", "duration": "soon", "token": "c0ntrol"}`, rpcError, false},
+		{"unknown mapping", `{"command": "mute", "topic": "sensors/other", "duration": "1h", "token": "c0ntrol"}`, rpcError, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker.Reset()
+			mapping.unmute()
+
+			controlHandler(MQTTMessage{Topic: "$bridge/control", Payload: []byte(test.payload), ResponseTopic: "control/reply"})
+
+			replies := broker.Published("control/reply")
+			if len(replies) != 1 {
+				t.Fatalf("expected 1 response, got %d", len(replies))
+			}
+
+			var response rpcResponse
+			json.Unmarshal(replies[0].Payload, &response)
+			if response.Status != test.status {
+				t.Errorf("expected status %q, got %q (%s)", test.status, response.Status, response.Error)
+			}
+
+			if mapping.isMuted() != test.muted {
+				t.Errorf("expected muted %t, got %t", test.muted, mapping.isMuted())
+			}
+		})
+	}
+
+	mapping.mute(time.Hour)
+	controlHandler(MQTTMessage{Topic: "$bridge/control", Payload: []byte(`{"command": "unmute", "topic": "sensors/rack", "token": "c0ntrol"}`)})
+	if mapping.isMuted() {
+		t.Errorf("expected the mapping unmuted")
+	}
+}
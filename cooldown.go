@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Cooldown keys, what makes alerts the same for the cooldown
+const (
+	CooldownByTopic   = "topic"   // Any message on the same topic (default)
+	CooldownByMessage = "message" // Identical messages on the same topic
+)
+
+type cooldownEntry struct {
+	topic string
+	from  string
+	count int
+}
+
+func (m *Mapping) setupCooldown() error {
+	switch m.CooldownBy {
+	case "":
+		m.CooldownBy = CooldownByTopic
+	case CooldownByTopic, CooldownByMessage:
+	default:
+		return fmt.Errorf("invalid cooldown_by %q", m.CooldownBy)
+	}
+
+	if m.Cooldown.Duration < 0 {
+		return fmt.Errorf("invalid cooldown %s", m.Cooldown)
+	}
+
+	return nil
+}
+
+// cooldownKey returns the key of a message in the cooldowns
+func (m *Mapping) cooldownKey(topic, from, message string) string {
+	if m.CooldownBy == CooldownByMessage {
+		return topic + "\x00" + dedupHash(from, message)
+	}
+
+	return topic
+}
+
+// inCooldown returns true if a message received on topic must be suppressed, because an alert of the same topic
+// (or an identical one, with cooldown_by message) was forwarded inside the mapping cooldown, counting it
+func (m *Mapping) inCooldown(topic, from, message string) bool {
+	if m.Cooldown.Duration <= 0 {
+		return false
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if entry, ok := m.cooldowns[m.cooldownKey(topic, from, message)]; ok {
+		entry.count++
+		return true
+	}
+
+	return false
+}
+
+// startCooldown starts the cooldown of a forwarded message, so the dropped or failed messages don't start it.
+// When the cooldown ends, the number of suppressed messages is sent.
+func (m *Mapping) startCooldown(topic, from, message string) {
+	if m.Cooldown.Duration <= 0 {
+		return
+	}
+
+	key := m.cooldownKey(topic, from, message)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.cooldowns == nil {
+		m.cooldowns = map[string]*cooldownEntry{}
+	}
+
+	if _, ok := m.cooldowns[key]; ok { // Started by a concurrent message
+		return
+	}
+
+	m.cooldowns[key] = &cooldownEntry{topic: topic, from: from}
+
+	time.AfterFunc(m.Cooldown.Duration, func() {
+		m.lock.Lock()
+		entry := m.cooldowns[key]
+		delete(m.cooldowns, key)
+		m.lock.Unlock()
+
+		if entry.count > 0 {
+			deliverMessage(m, Notification{
+				Topic:   entry.topic,
+				From:    entry.from,
+				Message: m.trMessage("cooldown_summary", entry.count, entry.topic, m.Cooldown),
+			})
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// parseKey parses an AES key in hex or base64 format. Keys must have 16, 24 or 32 bytes.
+func parseKey(key string) ([]byte, error) {
+	k, err := hex.DecodeString(key)
+	if err != nil {
+		k, err = base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("key must be hex or base64 encoded")
+		}
+	}
+
+	switch len(k) {
+	case 16, 24, 32:
+		return k, nil
+	}
+
+	return nil, fmt.Errorf("key must have 16, 24 or 32 bytes, got %d", len(k))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encryptPayload encrypts a payload with AES-GCM. The result is base64(nonce || ciphertext)
+func encryptPayload(key, payload []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, payload, nil)
+
+	return []byte(base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// decryptPayload decrypts a payload encrypted by encryptPayload. Raw binary nonce || ciphertext is also accepted.
+func decryptPayload(key, payload []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data := payload
+	if decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(payload))); err == nil {
+		data = decoded
+	}
+
+	if len(data) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, fmt.Errorf("encrypted payload too short")
+	}
+
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt payload: %s", err)
+	}
+
+	return plain, nil
+}
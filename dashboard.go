@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/hex"
+	"html/template"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"time"
+)
+
+var (
+	dashboardEnabled  = os.Getenv("dashboard") == "true"
+	dashboardUser     = os.Getenv("dashboard_user")
+	dashboardPassword = os.Getenv("dashboard_password")
+)
+
+//go:embed dashboard.html
+var dashboardHTML string
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(dashboardHTML))
+
+// dashboardCSRF is a random key sent in the dashboard forms, so other sites cannot post with the browser credentials
+var dashboardCSRF = randomHex(16)
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// dashboardPage is the context of the dashboard template
+type dashboardPage struct {
+	State debugState
+	Token string // Query token, when using the http_token
+	CSRF  string
+	Error string
+}
+
+// requireDashboardAuth protects the dashboard with basic auth, when dashboard_user is defined, or with the http_token
+func requireDashboardAuth(handler http.HandlerFunc) http.HandlerFunc {
+	if dashboardUser == "" {
+		return requireToken(handler)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(dashboardUser)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(password), []byte(dashboardPassword)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="mqtttelegram"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func renderDashboard(w http.ResponseWriter, r *http.Request, errorMessage string) {
+	page := dashboardPage{
+		State: collectDebugState(),
+		CSRF:  dashboardCSRF,
+		Error: errorMessage,
+	}
+	if dashboardUser == "" {
+		page.Token = httpToken
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, page); err != nil {
+		httpLog.Error("Error rendering dashboard: %s", err)
+	}
+}
+
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	renderDashboard(w, r, "")
+}
+
+// dashboardRedirect returns to the dashboard after a form post, keeping the query token
+func dashboardRedirect(w http.ResponseWriter, r *http.Request) {
+	url := "/dashboard"
+	if token := r.URL.Query().Get("token"); token != "" {
+		url += "?token=" + neturl.QueryEscape(token)
+	}
+	http.Redirect(w, r, url, http.StatusSeeOther)
+}
+
+// dashboardAction handles a dashboard form post for a mapping, re-rendering the dashboard with the error if it fails
+func dashboardAction(action func(mapping *Mapping, r *http.Request) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(r.FormValue("csrf")), []byte(dashboardCSRF)) != 1 {
+			http.Error(w, "invalid form", http.StatusForbidden)
+			return
+		}
+
+		mapping, ok := topicMapping(r.FormValue("topic"))
+		if !ok {
+			renderDashboard(w, r, "No mapping for topic "+r.FormValue("topic"))
+			return
+		}
+
+		if errorMessage := action(mapping, r); errorMessage != "" {
+			renderDashboard(w, r, errorMessage)
+			return
+		}
+
+		dashboardRedirect(w, r)
+	}
+}
+
+func dashboardSend(mapping *Mapping, r *http.Request) string {
+	httpLog.Info("Sending test message from the dashboard to topic %s", mapping.Topic)
+
+	err := deliverMessage(mapping, Notification{
+		Topic:   mapping.Topic,
+		From:    "Dashboard",
+		Message: r.FormValue("message"),
+		Time:    time.Now(),
+	})
+	if err != nil {
+		return "Error sending message: " + err.Error()
+	}
+
+	return ""
+}
+
+func dashboardMute(mapping *Mapping, r *http.Request) string {
+	d, err := time.ParseDuration(r.FormValue("duration"))
+	if err != nil || d <= 0 {
+		return "Invalid duration " + r.FormValue("duration")
+	}
+
+	mapping.mute(d)
+	return ""
+}
+
+func dashboardUnmute(mapping *Mapping, r *http.Request) string {
+	mapping.unmute()
+	return ""
+}
+
+func dashboardEnable(mapping *Mapping, r *http.Request) string {
+	enableChat(mapping.GroupID)
+	return ""
+}
+
+// registerDashboardHandlers adds the web dashboard to the HTTP server, when enabled
+func registerDashboardHandlers() {
+	if !dashboardEnabled {
+		return
+	}
+
+	httpMux.HandleFunc("/dashboard", requireDashboardAuth(dashboardHandler))
+	httpMux.HandleFunc("/dashboard/state", requireDashboardAuth(debugStateHandler))
+	httpMux.HandleFunc("/dashboard/send", requireDashboardAuth(dashboardAction(dashboardSend)))
+	httpMux.HandleFunc("/dashboard/mute", requireDashboardAuth(dashboardAction(dashboardMute)))
+	httpMux.HandleFunc("/dashboard/unmute", requireDashboardAuth(dashboardAction(dashboardUnmute)))
+	httpMux.HandleFunc("/dashboard/enable", requireDashboardAuth(dashboardAction(dashboardEnable)))
+}
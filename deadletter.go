@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+	"unicode/utf8"
+)
+
+// FailureReason is the class of a permanent processing failure, sent with the dead letters
+type FailureReason string
+
+// Failure reasons
+const (
+	FailureSchema    FailureReason = "schema"    // Invalid payload or fields, like a message that is not a string
+	FailureSignature FailureReason = "signature" // Unsigned or invalid signature, rejected by the signature policy
+	FailureAuth      FailureReason = "auth"      // Missing or invalid token
+	FailureTransform FailureReason = "transform" // The transform command failed
+	FailureOversized FailureReason = "oversized" // Too long to be sent to Telegram
+	FailureDelivery  FailureReason = "delivery"  // The sinks failed, after the retries
+	FailurePanic     FailureReason = "panic"     // Processing the message panicked
+)
+
+// deadLetterTopic is the default dead letter topic pattern of the mappings. Dead letters are disabled when empty.
+var deadLetterTopic = os.Getenv("dead_letter_topic")
+
+var deadLetters = NewCounterVec("mqtttelegram_dead_letters_total", "Messages published to the dead letter topic by mapping topic and reason", "topic", "reason")
+
+// DeadLetter is a message that permanently failed, published to the dead letter topic with the failure metadata
+type DeadLetter struct {
+	Topic         string            `json:"topic"`                    // Topic the message was received on, without the topic_prefix
+	Payload       string            `json:"payload,omitempty"`        // Original payload, when it is valid UTF-8
+	PayloadBase64 []byte            `json:"payload_base64,omitempty"` // Original binary payload
+	Retained      bool              `json:"retained,omitempty"`
+	Properties    map[string]string `json:"properties,omitempty"` // MQTT 5 user properties
+	Reason        FailureReason     `json:"reason"`
+	Error         string            `json:"error"`
+	Attempts      int               `json:"attempts"` // Delivery attempts made, including the retries
+	Received      time.Time         `json:"received"`
+	Failed        time.Time         `json:"failed"`
+}
+
+// failureReason returns the reason of a failed delivery
+func failureReason(err error) FailureReason {
+	if classifyTelegramError(err) == TelegramErrTooLong {
+		return FailureOversized
+	}
+
+	return FailureDelivery
+}
+
+// deadLetterTopic returns the broker topic of the mapping dead letters of a message received on topic, or empty if disabled.
+// The message topic is used instead of the mapping filter, since {topic} would have the wildcards of the filter.
+func (m *Mapping) deadLetterTopic(topic string) string {
+	if m.DeadLetterTopic == "" || m.DeadLetterTopic == "none" {
+		return ""
+	}
+
+	return mqttTopic(expandTopic(m.DeadLetterTopic, topic))
+}
+
+// publishDeadLetter publishes a message received on topic that permanently failed to the mapping dead letter topic
+func publishDeadLetter(mapping *Mapping, topic string, msg MQTTMessage, received time.Time, reason FailureReason, err error) {
+	dl := messageDeadLetter(topic, msg, received, reason, err)
+	if reason == FailureDelivery {
+		dl.Attempts += mapping.Retries
+	}
+
+	sendDeadLetter(mapping, dl)
+}
+
+// messageDeadLetter returns the dead letter of an MQTT message after one attempt
+func messageDeadLetter(topic string, msg MQTTMessage, received time.Time, reason FailureReason, err error) DeadLetter {
+	dl := DeadLetter{
+		Topic:      topic,
+		Retained:   msg.Retained,
+		Properties: msg.UserProperties,
+		Reason:     reason,
+		Error:      err.Error(),
+		Attempts:   1,
+		Received:   received.UTC(),
+	}
+
+	if utf8.Valid(msg.Payload) {
+		dl.Payload = string(msg.Payload)
+	} else {
+		dl.PayloadBase64 = msg.Payload
+	}
+
+	return dl
+}
+
+// notificationDeadLetter returns the dead letter of a notification that failed after its retries: of its MQTT message,
+// if any, or else of its decoded payload or message fields
+func notificationDeadLetter(mapping *Mapping, n Notification, err error) DeadLetter {
+	msg := n.msg
+	if msg == nil {
+		data := n.Data
+		if data == nil {
+			data = map[string]interface{}{"type": "message", "from": n.From, "message": n.Message, "critical": n.Critical}
+		}
+		payload, _ := json.Marshal(data)
+		msg = &MQTTMessage{Topic: n.Topic, Payload: payload, UserProperties: n.Properties}
+	}
+
+	dl := messageDeadLetter(n.Topic, *msg, n.Time, failureReason(err), err)
+	dl.Attempts += mapping.Retries
+
+	return dl
+}
+
+// sendDeadLetter archives a dead letter and publishes it to the mapping dead letter topic
+func sendDeadLetter(mapping *Mapping, dl DeadLetter) {
+	dl.Failed = time.Now().UTC()
+	deadLetters.Inc(mapping.Topic, string(dl.Reason))
+	archiveDeadLetter(dl)
+
+	topic := mapping.deadLetterTopic(dl.Topic)
+	if topic == "" {
+		return
+	}
+
+	payload, _ := json.Marshal(dl)
+
+	mqttLog.Warn("Publishing %s failure of topic %s to the dead letter topic %s", dl.Reason, dl.Topic, topic)
+
+	if err := getMQTTClient().Publish(MQTTMessage{Topic: topic, Payload: payload}); err != nil {
+		mqttLog.Error("Error publishing to %s: %s", topic, err)
+	}
+}
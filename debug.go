@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"sort"
+	"time"
+)
+
+type debugMapping struct {
+	Topic      string    `json:"topic"`
+	GroupID    int64     `json:"group_id"`
+	MessageTo  string    `json:"message_to"`
+	Sinks      []string  `json:"sinks"`
+	Fallback   string    `json:"fallback,omitempty"`
+	Disabled   bool      `json:"disabled"`
+	MutedUntil time.Time `json:"muted_until,omitempty"`
+	Failures   int       `json:"failures"`
+}
+
+// debugState is served at /debug/state. Secrets like keys and sink tokens are not included.
+type debugState struct {
+	Uptime        string            `json:"uptime"`
+	Goroutines    int               `json:"goroutines"`
+	MQTTConnected bool              `json:"mqtt_connected"`
+	Leader        bool              `json:"leader"`
+	Mappings      []debugMapping    `json:"mappings"`
+	Pending       []PendingMessage  `json:"pending"`
+	DisabledChats map[int64]string  `json:"disabled_chats"`
+	Memory        map[string]uint64 `json:"memory"`
+	Recent        []recentMessage   `json:"recent"`
+}
+
+// collectMappings returns the state of the mappings, sorted by topic
+func collectMappings() []debugMapping {
+	var mappings []debugMapping
+
+	for _, m := range listTopicMappings() {
+		dm := debugMapping{
+			Topic:     m.Topic,
+			GroupID:   m.GroupID,
+			MessageTo: m.MessageTo,
+			Disabled:  isChatDisabled(m.GroupID),
+		}
+		for _, s := range m.sinks {
+			dm.Sinks = append(dm.Sinks, s.String())
+		}
+		if m.fallback != nil {
+			dm.Fallback = m.fallback.String()
+		}
+
+		m.lock.Lock()
+		dm.MutedUntil = m.mutedUntil
+		dm.Failures = m.failures
+		m.lock.Unlock()
+
+		mappings = append(mappings, dm)
+	}
+
+	sort.Slice(mappings, func(i, j int) bool {
+		return mappings[i].Topic < mappings[j].Topic
+	})
+
+	return mappings
+}
+
+// collectDebugState returns the current state, for /debug/state and the SIGUSR1 dump
+func collectDebugState() debugState {
+	client := getMQTTClient()
+	state := debugState{
+		Uptime:        time.Since(startTime).String(),
+		Goroutines:    runtime.NumGoroutine(),
+		MQTTConnected: client != nil && client.IsConnected(),
+		Leader:        isLeader(),
+		Mappings:      collectMappings(),
+		DisabledChats: map[int64]string{},
+	}
+
+	pendingLock.Lock()
+	state.Pending = append([]PendingMessage{}, pendingMessages...)
+	pendingLock.Unlock()
+
+	disabledLock.Lock()
+	for chat, reason := range disabledChats {
+		state.DisabledChats[chat] = reason
+	}
+	disabledLock.Unlock()
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	state.Memory = map[string]uint64{
+		"alloc":       mem.Alloc,
+		"heap_inuse":  mem.HeapInuse,
+		"sys":         mem.Sys,
+		"num_gc":      uint64(mem.NumGC),
+		"total_alloc": mem.TotalAlloc,
+	}
+
+	state.Recent = getRecentMessages()
+
+	return state
+}
+
+func debugStateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(collectDebugState())
+}
+
+// registerDebugHandlers adds pprof and /debug/state to the HTTP server, protected by the http_token
+func registerDebugHandlers() {
+	httpMux.HandleFunc("/debug/state", requireToken(debugStateHandler))
+	httpMux.HandleFunc("/debug/pprof/", requireToken(pprof.Index))
+	httpMux.HandleFunc("/debug/pprof/cmdline", requireToken(pprof.Cmdline))
+	httpMux.HandleFunc("/debug/pprof/profile", requireToken(pprof.Profile))
+	httpMux.HandleFunc("/debug/pprof/symbol", requireToken(pprof.Symbol))
+	httpMux.HandleFunc("/debug/pprof/trace", requireToken(pprof.Trace))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+type dedupEntry struct {
+	from    string
+	message string
+	count   int
+}
+
+func dedupHash(from, message string) string {
+	h := sha256.Sum256([]byte(from + "\x00" + message))
+	return hex.EncodeToString(h[:])
+}
+
+// isDuplicate returns true if the same message was already forwarded inside the mapping dedup window.
+// When the window closes and dedup_summary is enabled, a "(repeated N times)" message is sent.
+func (m *Mapping) isDuplicate(from, message string) bool {
+	if m.DedupWindow.Duration <= 0 {
+		return false
+	}
+
+	hash := dedupHash(from, message)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.dedup == nil {
+		m.dedup = map[string]*dedupEntry{}
+	}
+
+	if entry, ok := m.dedup[hash]; ok {
+		entry.count++
+		return true
+	}
+
+	m.dedup[hash] = &dedupEntry{
+		from:    from,
+		message: message,
+	}
+
+	time.AfterFunc(m.DedupWindow.Duration, func() {
+		m.lock.Lock()
+		entry := m.dedup[hash]
+		delete(m.dedup, hash)
+		m.lock.Unlock()
+
+		if m.DedupSummary && entry.count > 0 {
+			message := m.trMessage("repeated", formatted(entry.message), entry.count)
+			if entry.count == 1 {
+				message = m.trMessage("repeated_once", formatted(entry.message))
+			}
+
+			deliverMessage(m, Notification{
+				Topic:   m.Topic,
+				From:    entry.from,
+				Message: message,
+			})
+		}
+	})
+
+	return false
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDedupSummary(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "sensors/door", DedupWindow: Duration{20 * time.Millisecond}, DedupSummary: true}
+	setupTestMappings(t, mapping)
+
+	payload := []byte(`{"type": "message", "from": "Door", "message": "open"}`)
+	for _, repeats := range []int{1, 2} {
+		telegram.Reset()
+		for i := 0; i <= repeats; i++ {
+			doMessage(mapping, MQTTMessage{Topic: mapping.Topic, Payload: payload})
+		}
+
+		waitFor(t, "the dedup summary", func() bool { return len(telegram.Calls("sendMessage")) == 2 })
+
+		expected := map[int]string{1: "*Door*: open (repeated once)", 2: "*Door*: open (repeated 2 times)"}[repeats]
+		if text := telegram.Calls("sendMessage")[1].Params.Get("text"); text != expected {
+			t.Errorf("expected %q, got %q", expected, text)
+		}
+	}
+}
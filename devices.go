@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-telegram/bot/models"
+	"github.com/tidwall/gjson"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DevicesConfig tracks the online status of the devices of a mapping, from their LWT status or heartbeat messages
+type DevicesConfig struct {
+	Topic     string   `json:"topic"`     // Topic filter of the device messages, like tele/+/LWT. The wildcard levels are the device name
+	Online    string   `json:"online"`    // Status payload of an online device. Defaults to online
+	Offline   string   `json:"offline"`   // Status payload of an offline device, like the LWT. Defaults to offline
+	Timeout   Duration `json:"timeout"`   // Devices without messages for this long are offline, for heartbeat topics
+	Threshold Duration `json:"threshold"` // Notify only the devices offline for longer than this
+	Recovery  bool     `json:"recovery"`  // Notify when a device notified offline comes back online
+
+	lock    sync.Mutex
+	devices map[string]*deviceState
+}
+
+type deviceState struct {
+	online       bool
+	lastSeen     time.Time
+	offlineSince time.Time
+	notified     bool
+	timeout      *time.Timer
+	threshold    *time.Timer
+}
+
+func (c *DevicesConfig) setup() error {
+	if c.Topic == "" {
+		return fmt.Errorf("devices requires topic")
+	}
+
+	if c.Online == "" {
+		c.Online = "online"
+	}
+
+	if c.Offline == "" {
+		c.Offline = "offline"
+	}
+
+	c.devices = map[string]*deviceState{}
+	return nil
+}
+
+// deviceName returns the levels of the topic matched by the wildcards of the filter, or the topic without wildcards
+func deviceName(filter, topic string) string {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+
+	var name []string
+	for i, part := range f {
+		if part == "#" {
+			name = append(name, t[i:]...)
+			break
+		}
+		if part == "+" && i < len(t) {
+			name = append(name, t[i])
+		}
+	}
+
+	if len(name) == 0 {
+		return topic
+	}
+
+	return strings.Join(name, "/")
+}
+
+// deviceStatus returns if a device payload is an online or offline status. Other payloads are heartbeats.
+// The status can be the whole payload or the state, status or online field of JSON payloads.
+func (c *DevicesConfig) deviceStatus(payload []byte) (online, status bool) {
+	value := strings.TrimSpace(string(payload))
+	if gjson.ValidBytes(payload) && gjson.ParseBytes(payload).IsObject() {
+		switch p := gjson.ParseBytes(payload); {
+		case p.Get("online").IsBool():
+			return p.Get("online").Bool(), true
+		case p.Get("state").Exists():
+			value = p.Get("state").String()
+		case p.Get("status").Exists():
+			value = p.Get("status").String()
+		}
+	}
+
+	switch {
+	case strings.EqualFold(value, c.Online):
+		return true, true
+	case strings.EqualFold(value, c.Offline):
+		return false, true
+	}
+
+	return true, false
+}
+
+// devicesHandler tracks the devices of the mapping
+func devicesHandler(mapping *Mapping) MQTTHandler {
+	return func(msg MQTTMessage) {
+		c := mapping.Devices
+		topic := strings.TrimPrefix(msg.Topic, topicPrefix)
+		online, _ := c.deviceStatus(msg.Payload)
+
+		c.seen(mapping, deviceName(c.Topic, topic), online, time.Now())
+	}
+}
+
+// seen updates a device status, starting the offline timers
+func (c *DevicesConfig) seen(mapping *Mapping, name string, online bool, now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	d, ok := c.devices[name]
+	if !ok {
+		d = &deviceState{}
+		c.devices[name] = d
+	}
+
+	if !online {
+		c.goOffline(mapping, name, d, now)
+		return
+	}
+
+	if !d.online && d.notified && c.Recovery {
+		go c.notify(mapping, mapping.trMessage("device_online", name, formatDuration(now.Sub(d.offlineSince))))
+	}
+
+	d.online, d.lastSeen, d.notified = true, now, false
+	if d.threshold != nil {
+		d.threshold.Stop()
+	}
+
+	if c.Timeout.Duration > 0 {
+		if d.timeout != nil {
+			d.timeout.Stop()
+		}
+		d.timeout = time.AfterFunc(c.Timeout.Duration, func() {
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			c.goOffline(mapping, name, d, time.Now())
+		})
+	}
+}
+
+// goOffline marks a device offline, notifying the mapping after the threshold. Called with the lock held.
+func (c *DevicesConfig) goOffline(mapping *Mapping, name string, d *deviceState, now time.Time) {
+	if !d.online && !d.offlineSince.IsZero() {
+		return
+	}
+
+	d.online, d.offlineSince = false, now
+	if d.timeout != nil {
+		d.timeout.Stop()
+	}
+
+	mqttLog.Info("Device %s of %s offline", name, mapping.Topic)
+
+	d.threshold = time.AfterFunc(c.Threshold.Duration, func() {
+		c.lock.Lock()
+		if d.online || d.notified {
+			c.lock.Unlock()
+			return
+		}
+		d.notified = true
+		since := d.offlineSince
+		c.lock.Unlock()
+
+		c.notify(mapping, mapping.trMessage("device_offline", name, since.In(mapping.location).Format("2006-01-02 15:04:05")))
+	})
+}
+
+func (c *DevicesConfig) notify(mapping *Mapping, message string) {
+	if !isLeader() {
+		return
+	}
+
+	if err := deliverMessage(mapping, Notification{Topic: mapping.Topic, From: "Bridge", Message: message, Time: time.Now()}); err != nil {
+		mqttLog.Error("Error notifying device status of %s: %s", mapping.Topic, err)
+	}
+}
+
+// report returns the status of the devices, sorted by name
+func (c *DevicesConfig) report(mapping *Mapping) []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var names []string
+	for name := range c.devices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	now := time.Now()
+	var lines []string
+	for _, name := range names {
+		d := c.devices[name]
+		if d.online {
+			lines = append(lines, mapping.tr("device_status_online", name, formatDuration(now.Sub(d.lastSeen))))
+		} else {
+			lines = append(lines, mapping.tr("device_status_offline", name, formatDuration(now.Sub(d.offlineSince))))
+		}
+	}
+
+	return lines
+}
+
+func devicesCommand(msg *models.Message) string {
+	var b strings.Builder
+
+	for _, m := range visibleMappings(msg) {
+		if m.Devices == nil {
+			continue
+		}
+
+		lines := m.Devices.report(m)
+		if len(lines) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, "%s:\n", m.Topic)
+		for _, line := range lines {
+			fmt.Fprintf(&b, "  %s\n", line)
+		}
+	}
+
+	if b.Len() == 0 {
+		return translate(chatLanguage(msg.Chat.ID), "no_devices")
+	}
+
+	return b.String()
+}
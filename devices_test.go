@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeviceName(t *testing.T) {
+	tests := []struct{ filter, topic, expected string }{
+		{"tele/+/LWT", "tele/plug1/LWT", "plug1"},
+		{"devices/#", "devices/garage/door", "garage/door"},
+		{"home/+/+/status", "home/kitchen/sensor/status", "kitchen/sensor"},
+		{"printer/status", "printer/status", "printer/status"},
+	}
+
+	for _, test := range tests {
+		if name := deviceName(test.filter, test.topic); name != test.expected {
+			t.Errorf("%s on %s: expected %q, got %q", test.topic, test.filter, test.expected, name)
+		}
+	}
+}
+
+func TestDevicesPresence(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "home", Devices: &DevicesConfig{Topic: "tele/+/LWT", Threshold: Duration{30 * time.Millisecond}, Recovery: true}}
+	setupTestMappings(t, mapping)
+
+	handler := devicesHandler(mapping)
+	handler(MQTTMessage{Topic: "tele/plug1/LWT", Payload: []byte("Online")})
+	handler(MQTTMessage{Topic: "tele/plug2/LWT", Payload: []byte(`{"state": "online"}`)})
+	handler(MQTTMessage{Topic: "tele/plug1/LWT", Payload: []byte("Offline")})
+	handler(MQTTMessage{Topic: "tele/plug2/LWT", Payload: []byte("offline")})
+	handler(MQTTMessage{Topic: "tele/plug2/LWT", Payload: []byte("online")}) // Back before the threshold
+
+	time.Sleep(60 * time.Millisecond)
+
+	calls := telegram.Calls("sendMessage")
+	if len(calls) != 1 || !strings.Contains(calls[0].Params.Get("text"), "plug1 offline since") {
+		t.Fatalf("expected only plug1 notified offline, got %v", calls)
+	}
+
+	report := strings.Join(mapping.Devices.report(mapping), "\n")
+	if !strings.Contains(report, "🔴 plug1") || !strings.Contains(report, "🟢 plug2") {
+		t.Errorf("unexpected devices report %q", report)
+	}
+
+	handler(MQTTMessage{Topic: "tele/plug1/LWT", Payload: []byte("online")})
+	time.Sleep(10 * time.Millisecond)
+
+	if calls := telegram.Calls("sendMessage"); len(calls) != 2 || !strings.Contains(calls[1].Params.Get("text"), "plug1 back online") {
+		t.Errorf("expected plug1 recovery, got %v", calls)
+	}
+}
+
+func TestDevicesHeartbeat(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "home", Devices: &DevicesConfig{Topic: "sensors/+/heartbeat", Timeout: Duration{30 * time.Millisecond}}}
+	setupTestMappings(t, mapping)
+
+	handler := devicesHandler(mapping)
+	for i := 0; i < 3; i++ {
+		handler(MQTTMessage{Topic: "sensors/door/heartbeat", Payload: []byte(`{"uptime": 10}`)})
+		time.Sleep(15 * time.Millisecond)
+	}
+
+	if len(telegram.Calls("sendMessage")) != 0 {
+		t.Fatalf("expected no notification while the heartbeats arrive")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if calls := telegram.Calls("sendMessage"); len(calls) != 1 || !strings.Contains(calls[0].Params.Get("text"), "door offline") {
+		t.Errorf("expected door notified offline after the timeout, got %v", calls)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// dialogCallbackPrefix marks the inline buttons of dialogs, so they are not published as mapping callbacks
+const dialogCallbackPrefix = "dlg:"
+
+// dialogTimeout is how long a dialog waits for the next choice
+const dialogTimeout = 10 * time.Minute
+
+// DialogConfig is a multi-step dialog started by a bot command and navigated with inline keyboards.
+// The choices are published as JSON to the topic when confirmed.
+type DialogConfig struct {
+	Command string        `json:"command"`
+	Topic   string        `json:"topic"`
+	Steps   []*DialogStep `json:"steps"`
+	Confirm string        `json:"confirm"` // text/template of the confirmation, receiving the choices. Empty publishes without confirmation
+
+	confirm *template.Template
+}
+
+// DialogStep is a choice of a dialog, stored in the field of the published payload
+type DialogStep struct {
+	Field   string         `json:"field"`
+	Prompt  string         `json:"prompt"`
+	Options []DialogOption `json:"options"`
+}
+
+type DialogOption struct {
+	Text  string      `json:"text"`
+	Value interface{} `json:"value"` // Defaults to the text
+}
+
+// dialogSession is a dialog in progress, identified by the chat and the message with the keyboard
+type dialogSession struct {
+	dialog  *DialogConfig
+	step    int
+	user    int64
+	values  map[string]interface{}
+	expires time.Time
+}
+
+var dialogLock sync.Mutex
+var dialogSessions = map[string]*dialogSession{}
+
+// setupDialogs validates the dialogs and registers their commands
+func setupDialogs(dialogs []*DialogConfig) error {
+	for _, d := range dialogs {
+		if d.Command == "" || d.Topic == "" || len(d.Steps) == 0 {
+			return fmt.Errorf("dialogs require command, topic and steps")
+		}
+
+		if _, exists := commands[d.Command]; exists {
+			return fmt.Errorf("dialog command /%s is already a command", d.Command)
+		}
+
+		for _, s := range d.Steps {
+			if s.Field == "" || len(s.Options) == 0 {
+				return fmt.Errorf("steps of dialog /%s require field and options", d.Command)
+			}
+		}
+
+		if d.Confirm != "" {
+			t, err := parseTemplate(d.Command, d.Confirm)
+			if err != nil {
+				return fmt.Errorf("invalid confirm of dialog /%s: %s", d.Command, err)
+			}
+			d.confirm = t
+		}
+
+		commands[d.Command] = command{handler: d.start, public: true}
+	}
+
+	return nil
+}
+
+func dialogKey(chat int64, message int) string {
+	return fmt.Sprintf("%d:%d", chat, message)
+}
+
+// keyboard returns the prompt and the inline keyboard of the session step, or of the confirmation
+func (s *dialogSession) keyboard(lang string) (string, models.InlineKeyboardMarkup) {
+	cancel := []models.InlineKeyboardButton{{Text: translate(lang, "dialog_cancel"), CallbackData: dialogCallbackPrefix + "cancel"}}
+
+	if s.step == len(s.dialog.Steps) {
+		text := &strings.Builder{}
+		if err := s.dialog.confirm.Execute(text, s.values); err != nil {
+			telLog.Error("Error rendering confirm of dialog /%s: %s", s.dialog.Command, err)
+		}
+
+		return text.String(), models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: translate(lang, "dialog_confirm"), CallbackData: dialogCallbackPrefix + "confirm"}},
+			cancel,
+		}}
+	}
+
+	step := s.dialog.Steps[s.step]
+	var rows [][]models.InlineKeyboardButton
+	for i, o := range step.Options {
+		rows = append(rows, []models.InlineKeyboardButton{{Text: o.Text, CallbackData: dialogCallbackPrefix + strconv.Itoa(i)}})
+	}
+	rows = append(rows, cancel)
+
+	return step.Prompt, models.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// start is the command handler of the dialog, sending the first step
+func (d *DialogConfig) start(msg *models.Message) string {
+	s := &dialogSession{
+		dialog:  d,
+		values:  map[string]interface{}{},
+		expires: time.Now().Add(dialogTimeout),
+	}
+	if msg.From != nil {
+		s.user = msg.From.ID
+	}
+
+	text, keyboard := s.keyboard(chatLanguage(msg.Chat.ID))
+	sent, err := sendTelegram(&bot.SendMessageParams{ChatID: msg.Chat.ID, Text: text, ReplyMarkup: keyboard})
+	if err != nil {
+		telLog.Error("Error starting dialog /%s: %s", d.Command, err)
+		return ""
+	}
+
+	dialogLock.Lock()
+	defer dialogLock.Unlock()
+
+	now := time.Now()
+	for key, session := range dialogSessions {
+		if now.After(session.expires) {
+			delete(dialogSessions, key)
+		}
+	}
+	dialogSessions[dialogKey(msg.Chat.ID, sent.ID)] = s
+
+	return ""
+}
+
+// handleDialogCallback advances the dialog of the message with the choice
+func handleDialogCallback(q *models.CallbackQuery) {
+	c, message, ok := callbackMessage(q)
+	if !ok {
+		return
+	}
+
+	chat := c.ID
+	lang := chatLanguage(chat)
+	key := dialogKey(chat, message)
+
+	dialogLock.Lock()
+	s, ok := dialogSessions[key]
+	if ok && s.user != 0 && q.From.ID != s.user {
+		dialogLock.Unlock()
+		return // Only the user that started the dialog can answer it
+	}
+	if ok && time.Now().After(s.expires) {
+		delete(dialogSessions, key)
+		ok = false
+	}
+	dialogLock.Unlock()
+
+	if !ok {
+		editDialog(chat, message, translate(lang, "dialog_expired"), nil)
+		return
+	}
+
+	choice := strings.TrimPrefix(q.Data, dialogCallbackPrefix)
+
+	switch {
+	case choice == "cancel":
+		finishDialog(key)
+		editDialog(chat, message, translate(lang, "dialog_cancelled"), nil)
+		return
+	case choice == "confirm" && s.step == len(s.dialog.Steps):
+		finishDialog(key)
+		editDialog(chat, message, dialogResult(publishDialog(s, c, message, q), lang), nil)
+		return
+	}
+
+	i, err := strconv.Atoi(choice)
+	if err != nil || s.step >= len(s.dialog.Steps) || i < 0 || i >= len(s.dialog.Steps[s.step].Options) {
+		return
+	}
+
+	step := s.dialog.Steps[s.step]
+	value := step.Options[i].Value
+	if value == nil {
+		value = step.Options[i].Text
+	}
+
+	dialogLock.Lock()
+	s.values[step.Field] = value
+	s.step++
+	s.expires = time.Now().Add(dialogTimeout)
+	dialogLock.Unlock()
+
+	if s.step == len(s.dialog.Steps) && s.dialog.confirm == nil {
+		finishDialog(key)
+		editDialog(chat, message, dialogResult(publishDialog(s, c, message, q), lang), nil)
+		return
+	}
+
+	text, keyboard := s.keyboard(lang)
+	editDialog(chat, message, text, &keyboard)
+}
+
+// dialogResult returns the final text of a dialog, done or cancelled when its choices were not published
+func dialogResult(published bool, lang string) string {
+	if published {
+		return translate(lang, "dialog_done")
+	}
+	return translate(lang, "dialog_cancelled")
+}
+
+func finishDialog(key string) {
+	dialogLock.Lock()
+	delete(dialogSessions, key)
+	dialogLock.Unlock()
+}
+
+// publishDialog publishes the dialog choices to its topic, with the flood protection and moderation of the chat mapping, if any.
+// Returns false if the choices were not published.
+func publishDialog(s *dialogSession, chat models.Chat, message int, q *models.CallbackQuery) bool {
+	data := map[string]interface{}{}
+	for k, v := range s.values {
+		data[k] = v
+	}
+
+	if mapping, ok := groupMapping(chat.ID); ok {
+		msg := &models.Message{ID: message, Chat: chat, From: &q.From}
+		if !allowFromTelegram(mapping, chat, &q.From) || !moderateMessage(mapping, msg, data) {
+			return false
+		}
+	}
+	data["from"] = q.From.FirstName + " " + q.From.LastName
+	data["from_username"] = q.From.Username
+	data["from_id"] = q.From.ID
+
+	topic := mqttTopic(s.dialog.Topic)
+	payload, _ := json.Marshal(data)
+
+	telLog.Info("Dialog /%s finished, publishing to %s: %s", s.dialog.Command, topic, logText(string(payload)))
+	if err := getMQTTClient().Publish(MQTTMessage{Topic: topic, Payload: payload}); err != nil {
+		mqttLog.Error("Error publishing to %s: %s", topic, err)
+	}
+
+	return true
+}
+
+func editDialog(chat int64, message int, text string, keyboard *models.InlineKeyboardMarkup) {
+	edit := &bot.EditMessageTextParams{ChatID: chat, MessageID: message, Text: text}
+	if keyboard != nil {
+		edit.ReplyMarkup = keyboard
+	}
+
+	ctx, cancel := telegramContext(context.Background())
+	defer cancel()
+
+	if _, err := getTelegramBot().EditMessageText(ctx, edit); err != nil {
+		telLog.Error("Error updating dialog message: %s", err)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// directUser returns the Telegram user of the user_id payload field, who receives the message in private instead
+// of the mapping sinks. The user must be in the mapping dm_users. Returns 0 when the field is not set.
+func (m *Mapping) directUser(data map[string]interface{}) (int64, error) {
+	v, ok := data["user_id"]
+	if !ok {
+		return 0, nil
+	}
+
+	var user int64
+	if s, ok := v.(string); ok {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid user_id field %q", s)
+		}
+		user = id
+	} else if f, ok := numericValue(v); ok && f == float64(int64(f)) {
+		user = int64(f)
+	} else {
+		return 0, fmt.Errorf("invalid user_id field: expected user id")
+	}
+
+	for _, allowed := range m.DMUsers {
+		if allowed == user {
+			return user, nil
+		}
+	}
+
+	return 0, fmt.Errorf("user %d is not in dm_users", user)
+}
+
+// sendDirect sends a notification in private to its user, instead of the mapping sinks
+func sendDirect(mapping *Mapping, n Notification) error {
+	s := &TelegramSink{ChatID: n.UserID, Options: mapping.TelegramOptions}
+
+	err := sendWithRetries(mapping, s, n, func(err error) { finishRetries(mapping, s, n, err) })
+	if err != nil && err != errRetrying {
+		sinkLog.Error("Error sending message from topic %s to user %d: %s", mapping.Topic, n.UserID, err)
+	}
+
+	return err
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/quan-to/slog"
+	"io/ioutil"
+	"os"
+)
+
+var dumpFile = os.Getenv("dump_file")
+
+// dumpState writes the bridge state to the log, or to dump_file when defined
+func dumpState() {
+	state := collectDebugState()
+
+	if dumpFile == "" {
+		if isPrivacyMode() {
+			for i := range state.Recent {
+				state.Recent[i].Payload = logText(state.Recent[i].Payload)
+			}
+		}
+		data, _ := json.MarshalIndent(state, "", "  ")
+		slog.Info("State dump:\n%s", string(data))
+		return
+	}
+
+	data, _ := json.MarshalIndent(state, "", "  ")
+	if err := ioutil.WriteFile(dumpFile, data, 0600); err != nil {
+		slog.Error("Error writing state dump to %s: %s", dumpFile, err)
+		return
+	}
+
+	slog.Info("State dumped to %s", dumpFile)
+}
@@ -0,0 +1,4 @@
+package main
+
+// handleDumpSignal does nothing, there is no SIGUSR1 on windows
+func handleDumpSignal() {}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/getsentry/sentry-go"
+	"github.com/quan-to/slog"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+var (
+	sentryDSN    = os.Getenv("sentry_dsn")
+	errorWebhook = os.Getenv("error_webhook")
+)
+
+var sentryEnabled = false
+
+// errorReport is the JSON posted to the error_webhook
+type errorReport struct {
+	Error string            `json:"error"`
+	Stack string            `json:"stack,omitempty"`
+	Tags  map[string]string `json:"tags,omitempty"`
+	Time  time.Time         `json:"time"`
+}
+
+func setupErrorReporting() {
+	if sentryDSN == "" {
+		return
+	}
+
+	err := sentry.Init(sentry.ClientOptions{
+		Dsn:              sentryDSN,
+		AttachStacktrace: true,
+	})
+	if err != nil {
+		slog.Fatal("Error initializing Sentry: %s", err)
+	}
+
+	sentryEnabled = true
+	slog.Info("Reporting errors to Sentry")
+}
+
+func flushErrorReporting() {
+	if sentryEnabled {
+		sentry.Flush(5 * time.Second)
+	}
+}
+
+func postErrorWebhook(report errorReport) {
+	body, _ := json.Marshal(report)
+
+	err := checkHTTPResponse(sinkHTTPClient.Post(errorWebhook, "application/json", bytes.NewReader(body)))
+	if err != nil {
+		slog.Error("Error posting to error_webhook: %s", err)
+	}
+}
+
+// reportPanic reports a recovered panic with its stack trace. Must be called from the deferred recover.
+func reportPanic(r interface{}, tags map[string]string) {
+	if sentryEnabled {
+		hub := sentry.CurrentHub().Clone()
+		hub.Scope().SetTags(tags)
+		hub.Recover(r)
+	}
+
+	if errorWebhook != "" {
+		go postErrorWebhook(errorReport{
+			Error: fmt.Sprintf("panic: %v", r),
+			Stack: string(debug.Stack()),
+			Tags:  tags,
+			Time:  time.Now(),
+		})
+	}
+}
+
+// reportError reports an operational error, like repeated delivery failures
+func reportError(err error, tags map[string]string) {
+	if sentryEnabled {
+		hub := sentry.CurrentHub().Clone()
+		hub.Scope().SetTags(tags)
+		hub.CaptureException(err)
+	}
+
+	if errorWebhook != "" {
+		go postErrorWebhook(errorReport{
+			Error: err.Error(),
+			Tags:  tags,
+			Time:  time.Now(),
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseRangeTime parses an export range boundary: RFC3339, a date (2006-01-02) or a duration before now (720h)
+func parseRangeTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", v, time.Local); err == nil {
+		return t, nil
+	}
+
+	if d, err := time.ParseDuration(v); err == nil {
+		return time.Now().Add(-d), nil
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q, expected RFC3339, 2006-01-02 or a duration", v)
+}
+
+// exportArchive writes the archived messages of the query, oldest first, as csv or json
+func exportArchive(w io.Writer, q ArchiveQuery, format string) error {
+	messages, err := searchArchive(q)
+	if err != nil {
+		return err
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	switch format {
+	case "", "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"time", "direction", "topic", "chat_id", "from", "message"})
+		for _, m := range messages {
+			cw.Write([]string{
+				m.Time.Format(time.RFC3339),
+				m.Direction,
+				m.Topic,
+				strconv.FormatInt(m.ChatID, 10),
+				m.From,
+				m.Message,
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "json":
+		if messages == nil {
+			messages = []ArchivedMessage{}
+		}
+		return json.NewEncoder(w).Encode(messages)
+	}
+
+	return fmt.Errorf("invalid format %q, expected csv or json", format)
+}
+
+// exportHandler serves /export?topic=alarms&since=2019-08-01&until=2019-09-01&format=csv
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	q := ArchiveQuery{Topic: params.Get("topic")}
+
+	var err error
+	if q.Since, err = parseRangeTime(params.Get("since")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Until, err = parseRangeTime(params.Get("until")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := params.Get("format")
+
+	var buf bytes.Buffer
+	if err := exportArchive(&buf, q, format); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "text/csv")
+	}
+	w.Write(buf.Bytes())
+}
+
+// exportCommand sends the export as a document: /export <topic> [since] [until] [csv|json]
+func exportCommand(msg *models.Message) string {
+	args := strings.Fields(commandArguments(msg))
+	if len(args) == 0 {
+		return translate(chatLanguage(msg.Chat.ID), "export_usage")
+	}
+
+	q := ArchiveQuery{Topic: args[0]}
+	format := "csv"
+
+	var rangeArgs []string
+	for _, arg := range args[1:] {
+		if arg == "csv" || arg == "json" {
+			format = arg
+		} else {
+			rangeArgs = append(rangeArgs, arg)
+		}
+	}
+
+	var err error
+	if len(rangeArgs) > 0 {
+		if q.Since, err = parseRangeTime(rangeArgs[0]); err != nil {
+			return err.Error()
+		}
+	}
+	if len(rangeArgs) > 1 {
+		if q.Until, err = parseRangeTime(rangeArgs[1]); err != nil {
+			return err.Error()
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := exportArchive(&buf, q, format); err != nil {
+		return translate(chatLanguage(msg.Chat.ID), "export_error", err)
+	}
+
+	ctx, cancel := telegramContext(context.Background())
+	defer cancel()
+
+	_, err = getTelegramBot().SendDocument(ctx, &bot.SendDocumentParams{
+		ChatID:          msg.Chat.ID,
+		MessageThreadID: msg.MessageThreadID,
+		Document:        &models.InputFileUpload{Filename: fmt.Sprintf("%s.%s", strings.Replace(q.Topic, "/", "_", -1), format), Data: &buf},
+	})
+	if err != nil {
+		return translate(chatLanguage(msg.Chat.ID), "export_send_error", err)
+	}
+
+	return ""
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
+// envFlag is a command line flag mirroring an environment variable.
+// The environment variable is used when the flag is not given.
+type envFlag struct {
+	env    string
+	usage  string
+	target interface{} // Variable already read from the environment: *string, *bool, *int or nil when read on use
+}
+
+var envFlags = []envFlag{
+	{"telegram_bot_token", "Telegram bot token", &telegramBotToken},
+	{"telegram_bot_token_file", "File with the Telegram bot token", &telegramBotTokenFile},
+	{"telegram_admin", "Telegram admin user id or username", &telegramAdminId},
+	{"group_to_topic", "Mappings as groupId:mqttTopic:messageTo;...", &groupToTopic},
+	{"config_file", "JSON configuration file", &configFile},
+	{"mqtt_server", "MQTT broker URL or host[:port]", &mqttHost},
+	{"mqtt_version", "MQTT protocol version: 3 or 5", &mqttVersion},
+	{"mqtt_username", "MQTT username", &mqttUsername},
+	{"mqtt_password", "MQTT password", &mqttPassword},
+	{"mqtt_password_file", "File with the MQTT password", &mqttPasswordFile},
+	{"secret_reload_interval", "Interval to check the secret files for changes", nil},
+	{"mqtt_keepalive", "MQTT keepalive interval", nil},
+	{"mqtt_ping_timeout", "MQTT ping timeout", nil},
+	{"mqtt_connect_timeout", "MQTT connect timeout", nil},
+	{"mqtt_max_reconnect_interval", "MQTT maximum reconnect interval", nil},
+	{"startup_retry_delay", "Wait before retrying to connect to Telegram or MQTT at startup, doubled on each failure", nil},
+	{"startup_retry_max_delay", "Maximum wait between the startup connection retries", nil},
+	{"startup_timeout", "Time retrying to connect at startup before exiting, 0 to retry forever", nil},
+	{"topic_prefix", "Prefix of all MQTT topics, like bridge/home1/", &topicPrefix},
+	{"homeassistant_topic", "Topic of the Home Assistant notify payloads", &homeAssistantTopic},
+	{"homeassistant_photo_dir", "Directory of the local photo files the Home Assistant notifications can send", &homeAssistantPhotoDir},
+	{"homeassistant_photo_urls", "Download the photo URLs of the Home Assistant notifications, from public addresses only", &homeAssistantPhotoURLs},
+	{"homeassistant_photo_hosts", "Hosts the Home Assistant photos can be downloaded from even on private addresses, like homeassistant:8123", &homeAssistantPhotoHosts},
+	{"presence_topic", "Presence topic, none to disable", &presenceTopic},
+	{"auto_provision_topic", "Topic pattern of the mappings of new groups the bot is added to, like telegram/{chat_id}, approved by the admin", &autoProvisionTopic},
+	{"auto_provision_file", "File where the approved auto provisioned mappings are kept", &autoProvisionFile},
+	{"broadcast_topic", "Topic of the messages sent to all the mapped chats, like bridge/broadcast", &broadcastTopic},
+	{"broadcast_token", "Token the broadcasts must have in the token field", &broadcastToken},
+	{"dead_letter_topic", "Default topic of the messages that permanently failed, like {topic}_dead", &deadLetterTopic},
+	{"queue_size", "Capacity of the queue of MQTT messages to process, 0 to process them as received", nil},
+	{"queue_policy", "What to do when the queue is full: block, drop-oldest, drop-newest or aggregate", nil},
+	{"flood_rate", "Messages per minute each Telegram user can publish to MQTT, 0 for no limit", nil},
+	{"flood_burst", "Messages a Telegram user can send at once before the flood_rate applies", nil},
+	{"flood_mute", "How long a Telegram user exceeding the flood_rate is muted", nil},
+	{"pending_file", "File to persist scheduled messages", &pendingFile},
+	{"last_values_file", "File to persist the last value of each topic", &lastValuesFile},
+	{"last_values_max", "Number of last values kept per mapping, the oldest are dropped", nil},
+	{"language", "Default language of the bot texts: en, pt or es", &defaultLanguage},
+	{"timezone", "Default timezone of message timestamps", &defaultTimezone},
+	{"telegram_breaker_threshold", "Telegram failures before the circuit breaker opens", nil},
+	{"telegram_breaker_cooldown", "Time the Telegram circuit breaker stays open", nil},
+	{"ha_share_group", "Shared subscription group", &haShareGroup},
+	{"ha_leader_topic", "Leader election topic", &haLeaderTopic},
+	{"embedded_broker", "Listen address of the embedded MQTT broker", &embeddedBroker},
+	{"embedded_broker_ws", "Listen address of the embedded MQTT broker WebSocket", &embeddedBrokerWS},
+	{"embedded_broker_auth", "Auth ledger file of the embedded MQTT broker", &embeddedBrokerAuth},
+	{"amqp_exchange", "AMQP topic exchange of the mapping routing keys", &amqpExchange},
+	{"redis_streams", "Use Redis streams instead of pub/sub", &redisStreams},
+	{"redis_group", "Prefix of the Redis consumer group of each instance", &redisGroup},
+	{"redis_stream_maxlen", "Approximate maximum length of the Redis streams", nil},
+	{"kafka_group", "Kafka consumer group of the mapping topics", &kafkaGroup},
+	{"ha_instance_id", "Instance id for leader election", &haInstanceID},
+	{"control_topic", "Topic of the runtime control commands, like $bridge/control", &controlTopic},
+	{"control_token", "Token the control commands must have in the token field", &controlToken},
+	{"log_privacy", "Hide the message contents in the logs", &logPrivacy},
+	{"stats_topic", "Base topic of the retained bridge statistics", &statsTopic},
+	{"stats_interval", "Interval to publish the bridge statistics", nil},
+	{"ha_lease", "Leader election lease", nil},
+	{"http_listen", "HTTP server address", &httpListen},
+	{"metrics_listen", "HTTP server address (deprecated, use http_listen)", &metricsListen},
+	{"http_token", "Token of the protected HTTP endpoints", &httpToken},
+	{"grpc_listen", "gRPC server address", &grpcListen},
+	{"grpc_token", "Token of the gRPC API. Defaults to the http_token", &grpcToken},
+	{"dashboard", "Serve the web dashboard at /dashboard", &dashboardEnabled},
+	{"dashboard_user", "Basic auth user of the web dashboard", &dashboardUser},
+	{"dashboard_password", "Basic auth password of the web dashboard", &dashboardPassword},
+	{"archive_file", "SQLite message archive", &archiveFile},
+	{"archive_retention", "Archive retention, 0 keeps forever", nil},
+	{"archive_query_topic", "Topic to query the archive", &archiveQueryTopic},
+	{"discovery_mode", "Reply the chat id in unmapped chats", &discoveryMode},
+	{"inline_public", "Answer the inline queries of anyone", &inlinePublic},
+	{"public_commands", "Allow group members to run public commands", &publicCommands},
+	{"admin_failure_threshold", "Delivery failures in a row before notifying the admin", &adminFailureThreshold},
+	{"admin_panic_report", "Send panics to the admin", &adminPanicReport},
+	{"dump_file", "File to write the SIGUSR1 state dumps", &dumpFile},
+	{"transcription_url", "HTTP service to transcribe voice messages", &transcriptionURL},
+	{"media_workers", "Number of messages with media transcribed or uploaded concurrently", nil},
+	{"transcription_token", "Bearer token of the transcription service", &transcriptionToken},
+	{"transcription_model", "Model sent to the transcription service", &transcriptionModel},
+	{"s3_endpoint", "S3 compatible storage for the media received from Telegram, like s3.amazonaws.com", &s3Endpoint},
+	{"s3_bucket", "S3 bucket of the media", &s3Bucket},
+	{"s3_region", "S3 region", &s3Region},
+	{"s3_access_key", "S3 access key", &s3AccessKey},
+	{"s3_secret_key", "S3 secret key", &s3SecretKey},
+	{"s3_insecure", "Connect to the S3 storage without TLS", nil},
+	{"s3_url_expiry", "Expiration of the media presigned URLs", nil},
+	{"sentry_dsn", "Sentry DSN", &sentryDSN},
+	{"error_webhook", "URL to post error reports", &errorWebhook},
+}
+
+var (
+	showVersion       = flag.Bool("version", false, "Print the version and exit")
+	telegramTokenFile = flag.String("telegram-token-file", "", "Alias of --telegram-bot-token-file")
+)
+
+// flagName returns the flag of an environment variable: mqtt_server is --mqtt-server
+func flagName(env string) string {
+	return strings.Replace(env, "_", "-", -1)
+}
+
+// parseFlags parses the command line, overriding the environment variables with the given flags
+func parseFlags() {
+	values := map[string]*string{}
+	for _, f := range envFlags {
+		values[flagName(f.env)] = flag.String(flagName(f.env), "", fmt.Sprintf("%s (env %s)", f.usage, f.env))
+	}
+	configAlias := flag.String("config", "", "Alias of --config-file")
+
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Printf("mqtttelegram %s\n", version)
+		os.Exit(0)
+	}
+
+	if *configAlias != "" {
+		flag.Set("config-file", *configAlias)
+	}
+
+	if *telegramTokenFile != "" {
+		flag.Set("telegram-bot-token-file", *telegramTokenFile)
+	}
+
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	for _, f := range envFlags {
+		name := flagName(f.env)
+		if !set[name] {
+			continue
+		}
+
+		value := *values[name]
+		os.Setenv(f.env, value)
+
+		switch target := f.target.(type) {
+		case *string:
+			*target = value
+		case *bool:
+			*target = value == "true"
+		case *int:
+			i, err := strconv.Atoi(value)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "invalid value %q for --%s: %s\n", value, name, err)
+				os.Exit(2)
+			}
+			*target = i
+		}
+	}
+}
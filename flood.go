@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"sync"
+	"time"
+)
+
+// defaultFloodBurst is the burst of messages when flood_burst is not defined
+const defaultFloodBurst = 10
+
+// defaultFloodMute is how long a flooding user is muted when flood_mute is not defined
+const defaultFloodMute = 10 * time.Minute
+
+var floodDropped = NewCounterVec("mqtttelegram_flood_dropped_total", "Telegram messages not published to MQTT because the user was flooding, by mapping topic", "topic")
+
+// FloodProtection rate limits the Telegram messages published to MQTT by each user. Users exceeding the burst are muted for Mute.
+type FloodProtection struct {
+	Rate  float64 // Messages per second of each user
+	Burst int
+	Mute  time.Duration
+
+	lock  sync.Mutex
+	users map[int64]*floodUser
+}
+
+type floodUser struct {
+	limiter    *RateLimiter
+	mutedUntil time.Time
+}
+
+// floodProtection is nil when the Telegram messages are not rate limited (flood_rate=0)
+var floodProtection *FloodProtection
+
+func newFloodProtection(rate float64, burst int, mute time.Duration) *FloodProtection {
+	return &FloodProtection{Rate: rate, Burst: burst, Mute: mute, users: map[int64]*floodUser{}}
+}
+
+// Allow returns if a message of the user can be published, and if the user was just muted by it
+func (f *FloodProtection) Allow(user int64) (allowed, muted bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	u, ok := f.users[user]
+	if !ok {
+		f.prune()
+		u = &floodUser{limiter: NewRateLimiter(f.Rate, f.Burst)}
+		f.users[user] = u
+	}
+
+	if time.Now().Before(u.mutedUntil) {
+		return false, false
+	}
+
+	if u.limiter.Allow() {
+		return true, false
+	}
+
+	u.mutedUntil = time.Now().Add(f.Mute)
+	return false, true
+}
+
+// prune forgets the users not muted and without recent messages, so the users map doesn't grow without limit
+func (f *FloodProtection) prune() {
+	now := time.Now()
+	for id, u := range f.users {
+		if now.After(u.mutedUntil) && u.limiter.Full() {
+			delete(f.users, id)
+		}
+	}
+}
+
+// startFloodProtection enables the rate limit of the Telegram users with flood_rate, flood_burst and flood_mute
+func startFloodProtection() {
+	rate := getEnvInt("flood_rate", 0)
+	if rate <= 0 {
+		return
+	}
+
+	burst := getEnvInt("flood_burst", defaultFloodBurst)
+	mute := getEnvDuration("flood_mute", defaultFloodMute)
+	floodProtection = newFloodProtection(float64(rate)/60, burst, mute)
+
+	telLog.Info("Limiting each Telegram user to %d messages per minute (burst %d), muting floods for %s", rate, burst, mute)
+}
+
+// allowFromTelegram returns if a message of the user in the mapping chat can be published to MQTT. Users starting to flood
+// are muted, with a notice in the chat and to the admin. The admin and channel posts are not limited.
+func allowFromTelegram(mapping *Mapping, chat models.Chat, user *models.User) bool {
+	if floodProtection == nil || user == nil || isAdmin(user) {
+		return true
+	}
+
+	allowed, muted := floodProtection.Allow(user.ID)
+	if allowed {
+		return true
+	}
+
+	floodDropped.Inc(mapping.Topic)
+
+	if muted {
+		name := user.FirstName + " " + user.LastName
+		telLog.Warn("User %s (%d) flooding %s, muted for %s", name, user.ID, mapping.Topic, floodProtection.Mute)
+		notifyAdmin(fmt.Sprintf("User %s (%d) flooded chat %d (%s), muted for %s", name, user.ID, chat.ID, chat.Title, floodProtection.Mute))
+
+		if _, err := sendTelegram(&bot.SendMessageParams{ChatID: chat.ID, Text: mapping.tr("flood_muted", name, floodProtection.Mute)}); err != nil {
+			telLog.Error("Error sending flood notice to %s: %s", chat.Title, err)
+		}
+	}
+
+	return false
+}
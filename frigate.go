@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var frigateClient = &http.Client{Timeout: 2 * time.Minute}
+
+// frigateMaxMedia is the size limit of the event media, the largest upload of the Telegram Bot API
+const frigateMaxMedia = 50 << 20
+
+var errFrigateIgnored = fmt.Errorf("frigate event ignored")
+
+// FrigateConfig makes a mapping handle Frigate events, fetching the event media from the Frigate API
+type FrigateConfig struct {
+	URL    string   `json:"url"`    // Frigate API, like http://frigate:5000
+	Labels []string `json:"labels"` // Only events of these labels, like person or car. Empty allows all
+	Zones  []string `json:"zones"`  // Only events that entered these zones. Empty allows all
+	Clips  bool     `json:"clips"`  // Also send the event clip when it ends
+
+	lock sync.Mutex
+	sent map[string]time.Time // Events whose snapshot was sent, with the time it was sent
+}
+
+// frigateEventExpiry is how long the sent snapshots are remembered, for the events whose end was not received
+const frigateEventExpiry = 24 * time.Hour
+
+// frigateEvent is the after field of the events published at frigate/events
+type frigateEvent struct {
+	ID          string
+	Camera      string
+	Label       string
+	Score       float64
+	Zones       []string
+	HasSnapshot bool
+	HasClip     bool
+}
+
+func parseFrigateEvent(data map[string]interface{}) (frigateEvent, bool) {
+	after, ok := data["after"].(map[string]interface{})
+	if !ok {
+		return frigateEvent{}, false
+	}
+
+	e := frigateEvent{}
+	e.ID, _ = after["id"].(string)
+	e.Camera, _ = after["camera"].(string)
+	e.Label, _ = after["label"].(string)
+	e.HasSnapshot, _ = after["has_snapshot"].(bool)
+	e.HasClip, _ = after["has_clip"].(bool)
+
+	if e.Score, ok = after["top_score"].(float64); !ok {
+		e.Score, _ = after["score"].(float64)
+	}
+
+	zones, _ := after["entered_zones"].([]interface{})
+	if len(zones) == 0 {
+		zones, _ = after["current_zones"].([]interface{})
+	}
+	for _, z := range zones {
+		if zone, ok := z.(string); ok {
+			e.Zones = append(e.Zones, zone)
+		}
+	}
+
+	return e, e.ID != ""
+}
+
+// accepts checks the event against the label and zone filters
+func (c *FrigateConfig) accepts(e frigateEvent) bool {
+	if len(c.Labels) > 0 && !containsString(c.Labels, e.Label) {
+		return false
+	}
+
+	if len(c.Zones) == 0 {
+		return true
+	}
+
+	for _, zone := range e.Zones {
+		if containsString(c.Zones, zone) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// frigateEventPath returns the API path of an event media, escaping the event id of the payload
+func frigateEventPath(id, media string) string {
+	return "/api/events/" + url.PathEscape(id) + "/" + media
+}
+
+// fetch downloads an event media from the Frigate API
+func (c *FrigateConfig) fetch(path string) ([]byte, error) {
+	res, err := frigateClient.Get(strings.TrimSuffix(c.URL, "/") + path)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("received status %d from %s", res.StatusCode, path)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, frigateMaxMedia+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > frigateMaxMedia {
+		return nil, fmt.Errorf("%s is larger than %d MB", path, frigateMaxMedia>>20)
+	}
+
+	return data, nil
+}
+
+func (e frigateEvent) caption() string {
+	caption := fmt.Sprintf("%s detected on %s (%.0f%%)", titleCase(e.Label), e.Camera, e.Score*100)
+	if len(e.Zones) > 0 {
+		caption += " in " + strings.Join(e.Zones, ", ")
+	}
+
+	return caption
+}
+
+// deliverFrigateEvent sends the snapshot of a detection once it is available, and its clip when it ends.
+// Returns errFrigateIgnored for the events filtered out.
+func deliverFrigateEvent(mapping *Mapping, data map[string]interface{}) error {
+	c := mapping.Frigate
+
+	e, ok := parseFrigateEvent(data)
+	if !ok || !c.accepts(e) {
+		return errFrigateIgnored
+	}
+
+	if mapping.isMuted() {
+		return errMuted
+	}
+
+	eventType, _ := data["type"].(string)
+	sink := mapping.telegramSink()
+
+	c.lock.Lock()
+	now := time.Now()
+	for id, t := range c.sent {
+		if now.Sub(t) > frigateEventExpiry {
+			delete(c.sent, id)
+		}
+	}
+
+	_, sent := c.sent[e.ID]
+	sendSnapshot := e.HasSnapshot && !sent
+	if sendSnapshot {
+		c.sent[e.ID] = now
+	}
+	if eventType == "end" {
+		delete(c.sent, e.ID)
+	}
+	c.lock.Unlock()
+
+	if sendSnapshot {
+		snapshot, err := c.fetch(frigateEventPath(e.ID, "snapshot.jpg?bbox=1"))
+		if err != nil {
+			return fmt.Errorf("error fetching snapshot of event %s: %s", e.ID, err)
+		}
+
+		err = sink.SendPhoto(e.caption(), snapshot)
+		mapping.trackDelivery(err)
+		if err != nil {
+			return err
+		}
+	}
+
+	if eventType == "end" && c.Clips && e.HasClip {
+		clip, err := c.fetch(frigateEventPath(e.ID, "clip.mp4"))
+		if err != nil {
+			return fmt.Errorf("error fetching clip of event %s: %s", e.ID, err)
+		}
+
+		err = sink.SendRequest(func(ctx context.Context) error {
+			_, err := getTelegramBot().SendVideo(ctx, &bot.SendVideoParams{
+				ChatID:          sink.ChatID,
+				MessageThreadID: sink.Options.ThreadID,
+				Video:           &models.InputFileUpload{Filename: e.ID + ".mp4", Data: bytes.NewReader(clip)},
+				Caption:         e.caption(),
+				ProtectContent:  sink.Options.ProtectContent,
+			})
+			return err
+		})
+		mapping.trackDelivery(err)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFrigateFetch(t *testing.T) {
+	var path string
+	frigate := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		w.Write([]byte("jpeg"))
+	}))
+	defer frigate.Close()
+
+	c := &FrigateConfig{URL: frigate.URL}
+	e := frigateEvent{ID: "../../config", Label: "ñandu", Camera: "garden", Score: 0.9}
+
+	// The event id can't leave the event path
+	if _, err := c.fetch(frigateEventPath(e.ID, "clip.mp4")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if path != "/api/events/..%2F..%2Fconfig/clip.mp4" {
+		t.Errorf("expected the event id to be escaped, got %s", path)
+	}
+
+	if caption := e.caption(); caption != "Ñandu detected on garden (90%)" {
+		t.Errorf("unexpected caption %q", caption)
+	}
+}
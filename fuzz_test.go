@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// fuzzMappings are the mapping configurations payloads are fuzzed against, covering the codecs, profiles and payload features
+var fuzzMappings = []string{
+	`{}`,
+	`{"retained": "mark", "dedup_window": "1m", "template": "{{.Data.room}} {{.Message}}"}`,
+	`{"chart_field": "temperature", "thresholds": [{"field": "temperature", "above": 30, "recovery": "ok"}], "summary": {"cron": "0 8 * * *"}}`,
+	`{"fields": {"from": "device.name", "message": "event.description"}}`,
+	`{"profile": "zigbee2mqtt"}`,
+	`{"profile": "tasmota"}`,
+	`{"codec": "cbor"}`,
+	`{"codec": "protobuf", "codec_fields": {"1": "message", "2": "from"}}`,
+}
+
+var fuzzPayloads = []string{
+	`{"type": "message", "from": "sensor", "message": "hello"}`,
+	`{"type": "message", "from": 42, "message": "hello"}`,
+	`{"type": "message", "from": "sensor", "message": {"text": "hello"}}`,
+	`{"type": "message", "message": null}`,
+	`{"type": 1, "message": "hello"}`,
+	`{"type": "message", "message": "hello", "at": true, "delay": []}`,
+	`{"type": "message", "message": "hello", "expires_at": {}, "max_age": "x"}`,
+	`{"type": "message", "message": "hello", "critical": "yes", "time": -1e300}`,
+	`{"type": "chart", "duration": {}}`,
+	`{"type": "sticker", "file_id": 1}`,
+	`{"_lat": 1, "lat": "x", "lon": 2}`,
+	`{"specversion": "1.0", "type": "message", "data": "hello"}`,
+	`{"specversion": "1.0", "data": {"message": 1}}`,
+	`{"device": {"name": 1}, "event": {"description": ["ring"]}}`,
+	`{"temperature": "hot", "humidity": 1e400}`,
+	`{"state": "ON", "action": null, "battery": "low"}`,
+	`[1, 2, 3]`,
+	`"message"`,
+	`null`,
+	`ON`,
+	"\xa2\x61\x31\x65hello\x61\x32\x01",
+	"\x0a\x05hello\x12\x06sensor",
+	"",
+}
+
+func FuzzDecodePayload(f *testing.F) {
+	for i := range fuzzMappings {
+		for _, payload := range fuzzPayloads {
+			f.Add(uint8(i), []byte(payload))
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, index uint8, payload []byte) {
+		var m Mapping
+		json.Unmarshal([]byte(fuzzMappings[int(index)%len(fuzzMappings)]), &m)
+		m.GroupID = -100
+		m.Topic = "fuzz/topic"
+		if err := m.setup(); err != nil {
+			t.Fatalf("invalid fuzz mapping: %s", err)
+		}
+
+		data, err := m.decodePayload(payload)
+		if err != nil {
+			return
+		}
+
+		if isCloudEvent(data) {
+			data = fromCloudEvent(data)
+		}
+
+		m.applyProfile(m.Topic, data)
+	})
+}
+
+func FuzzDoMessage(f *testing.F) {
+	for i := range fuzzMappings {
+		for _, payload := range fuzzPayloads {
+			f.Add(uint8(i), []byte(payload), false)
+		}
+	}
+
+	telegram := newFakeTelegram(f)
+
+	f.Fuzz(func(t *testing.T, index uint8, payload []byte, retained bool) {
+		telegram.Reset()
+		broker := newFakeBroker(t)
+
+		previousPending := pendingMessages
+		pendingMessages = nil
+		t.Cleanup(func() { pendingMessages = previousPending })
+
+		var mapping Mapping
+		json.Unmarshal([]byte(fuzzMappings[int(index)%len(fuzzMappings)]), &mapping)
+		mapping.GroupID = -100
+		mapping.Topic = "fuzz/topic"
+		setupTestMappings(t, &mapping)
+
+		doMessage(&mapping, MQTTMessage{
+			Topic:         mapping.Topic,
+			Payload:       payload,
+			Retained:      retained,
+			ResponseTopic: "fuzz/reply",
+		})
+
+		replies := broker.Published("fuzz/reply")
+		if len(replies) != 1 {
+			t.Fatalf("expected 1 response, got %d", len(replies))
+		}
+
+		var response rpcResponse
+		json.Unmarshal(replies[0].Payload, &response)
+		if response.Error == "recovered from panic" {
+			t.Fatalf("doMessage panicked with payload %q", payload)
+		}
+	})
+}
+
+func FuzzParseGroupToTopic(f *testing.F) {
+	for _, seed := range []string{"", "-100:home/kitchen:house", "-100:home/kitchen;200:home/garage:car;", "-100", "a:b:c", ":::", ";;"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, groupToTopic string) {
+		mappings, err := parseGroupToTopic(groupToTopic)
+		if err != nil {
+			return
+		}
+
+		for _, m := range mappings {
+			if err := m.setup(); err != nil {
+				t.Fatalf("mapping %q parsed but failed setup: %s", groupToTopic, err)
+			}
+		}
+	})
+}
+
+func FuzzMappingSetup(f *testing.F) {
+	for _, seed := range fuzzMappings {
+		f.Add(seed)
+	}
+	for _, seed := range []string{
+		`{"group_id": -100, "topic": "t", "sinks": [{"type": "webhook", "url": "http://localhost"}], "fallback": {"type": "telegram", "chat_id": 1}}`,
+		`{"topic": "t", "keyboard": [[{"text": "On", "payload": "ON"}]]}`,
+		`{"topic": "t", "timestamp": "prefix", "timezone": "America/Sao_Paulo"}`,
+		`{"topic": "t", "encryption_key": "00112233445566778899aabbccddeeff"}`,
+		`{"topic": "t", "thresholds": [{"field": "x"}]}`,
+		`{"topic": "t", "summary": {"cron": "* * *"}}`,
+		`{"topic": "t", "frigate": {"url": "http://frigate"}}`,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, config string) {
+		var m Mapping
+		if err := json.Unmarshal([]byte(config), &m); err != nil {
+			return
+		}
+
+		m.setup()
+	})
+}
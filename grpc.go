@@ -0,0 +1,197 @@
+package main
+
+//go:generate protoc -I api --go_out=api --go_opt=paths=source_relative --go-grpc_out=api --go-grpc_opt=paths=source_relative api/mqtttelegram.proto
+
+import (
+	"context"
+	"crypto/subtle"
+	"github.com/racerxdl/mqtttelegram/api"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	grpcListen = os.Getenv("grpc_listen")
+	grpcToken  = os.Getenv("grpc_token")
+)
+
+var grpcLog = newLogger("gRPC")
+
+// grpcServer implements the Bridge service of api/mqtttelegram.proto
+type grpcServer struct {
+	api.UnimplementedBridgeServer
+}
+
+// checkGRPCToken validates the bearer token of the call metadata against the grpc_token (or the http_token)
+func checkGRPCToken(ctx context.Context) error {
+	token := grpcToken
+	if token == "" {
+		token = httpToken
+	}
+
+	if token == "" {
+		return status.Error(codes.PermissionDenied, "grpc_token not defined")
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, auth := range md.Get("authorization") {
+		if subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) == 1 {
+			return nil
+		}
+	}
+
+	return status.Error(codes.Unauthenticated, "invalid token")
+}
+
+func grpcUnaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := checkGRPCToken(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func grpcStreamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := checkGRPCToken(ss.Context()); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+func toAPIMapping(dm debugMapping) *api.Mapping {
+	m := &api.Mapping{
+		Topic:     dm.Topic,
+		GroupId:   dm.GroupID,
+		MessageTo: dm.MessageTo,
+		Sinks:     dm.Sinks,
+		Disabled:  dm.Disabled,
+		Failures:  int32(dm.Failures),
+	}
+	if !dm.MutedUntil.IsZero() {
+		m.MutedUntil = timestamppb.New(dm.MutedUntil)
+	}
+	return m
+}
+
+func (s *grpcServer) ListMappings(ctx context.Context, req *api.ListMappingsRequest) (*api.ListMappingsResponse, error) {
+	res := &api.ListMappingsResponse{}
+	for _, dm := range collectMappings() {
+		res.Mappings = append(res.Mappings, toAPIMapping(dm))
+	}
+	return res, nil
+}
+
+func (s *grpcServer) UpdateMapping(ctx context.Context, req *api.UpdateMappingRequest) (*api.Mapping, error) {
+	mapping, ok := topicMapping(req.Topic)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no mapping for topic %q", req.Topic)
+	}
+
+	if req.Mute != "" {
+		d, err := time.ParseDuration(req.Mute)
+		if err != nil || d <= 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid mute duration %q", req.Mute)
+		}
+		mapping.mute(d)
+	}
+
+	if req.Unmute {
+		mapping.unmute()
+	}
+
+	if req.Enable {
+		enableChat(mapping.GroupID)
+	}
+
+	for _, dm := range collectMappings() {
+		if dm.Topic == req.Topic {
+			return toAPIMapping(dm), nil
+		}
+	}
+
+	return nil, status.Errorf(codes.NotFound, "no mapping for topic %q", req.Topic)
+}
+
+func (s *grpcServer) Send(ctx context.Context, req *api.SendRequest) (*api.SendResponse, error) {
+	mapping, ok := topicMapping(req.Topic)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no mapping for topic %q", req.Topic)
+	}
+
+	from := req.From
+	if from == "" {
+		from = "gRPC"
+	}
+
+	err := deliverMessage(mapping, Notification{
+		Topic:    mapping.Topic,
+		From:     from,
+		Message:  req.Message,
+		Critical: req.Critical,
+		Time:     time.Now(),
+		ctx:      ctx,
+	})
+
+	if err == errMuted {
+		return &api.SendResponse{Status: rpcDropped}, nil
+	} else if err != nil {
+		return &api.SendResponse{Status: rpcError, Error: err.Error()}, nil
+	}
+
+	return &api.SendResponse{Status: rpcDelivered}, nil
+}
+
+func (s *grpcServer) StreamEvents(req *api.StreamEventsRequest, stream grpc.ServerStreamingServer[api.Event]) error {
+	c := subscribeStream()
+	defer unsubscribeStream(c)
+
+	for {
+		select {
+		case m := <-c:
+			if !streamAccepts(m, req.Topic, req.Direction) {
+				continue
+			}
+			err := stream.Send(&api.Event{
+				Time:      timestamppb.New(m.Time),
+				Direction: m.Direction,
+				Topic:     m.Topic,
+				Result:    m.Result,
+				Payload:   m.Payload,
+			})
+			if err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// startGRPCServer serves the Bridge gRPC service at grpc_listen
+func startGRPCServer() {
+	if grpcListen == "" {
+		return
+	}
+
+	l, err := net.Listen("tcp", grpcListen)
+	if err != nil {
+		grpcLog.Fatal("Error listening at %s: %s", grpcListen, err)
+	}
+
+	server := grpc.NewServer(grpc.UnaryInterceptor(grpcUnaryAuth), grpc.StreamInterceptor(grpcStreamAuth))
+	api.RegisterBridgeServer(server, &grpcServer{})
+
+	grpcLog.Info("Listening at %s", grpcListen)
+
+	go func() {
+		if err := server.Serve(l); err != nil {
+			grpcLog.Fatal("Error serving gRPC: %s", err)
+		}
+	}()
+}
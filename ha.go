@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	haShareGroup  = os.Getenv("ha_share_group")
+	haLeaderTopic = os.Getenv("ha_leader_topic")
+	haInstanceID  = os.Getenv("ha_instance_id")
+)
+
+var haLog = newLogger("HA")
+
+// leaderLease is the retained message published on ha_leader_topic by the current leader
+type leaderLease struct {
+	ID    string    `json:"id"`
+	Until time.Time `json:"until"`
+}
+
+var leaderLock = sync.Mutex{}
+var currentLeader leaderLease
+
+// sharedTopic returns the subscription filter of a mapping topic, using a shared subscription when ha_share_group is set
+func sharedTopic(topic string) string {
+	if haShareGroup == "" {
+		return topic
+	}
+
+	return "$share/" + haShareGroup + "/" + topic
+}
+
+// instanceID returns the ha_instance_id, or the hostname when not defined
+func instanceID() string {
+	if haInstanceID != "" {
+		return haInstanceID
+	}
+
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+func leaderHandler(msg MQTTMessage) {
+	var lease leaderLease
+
+	if len(msg.Payload) > 0 {
+		if err := json.Unmarshal(msg.Payload, &lease); err != nil {
+			haLog.Error("Invalid leader lease on %s: %s", msg.Topic, err)
+			return
+		}
+	}
+
+	leaderLock.Lock()
+	defer leaderLock.Unlock()
+
+	if lease.ID != currentLeader.ID {
+		haLog.Info("Leader is now %q", lease.ID)
+	}
+
+	currentLeader = lease
+}
+
+// isLeader returns if this instance should poll Telegram updates. Always true when leader election is disabled, unless draining.
+func isLeader() bool {
+	if isDraining() {
+		return false
+	}
+
+	if haLeaderTopic == "" {
+		return true
+	}
+
+	leaderLock.Lock()
+	defer leaderLock.Unlock()
+
+	return currentLeader.ID == haInstanceID && time.Now().Before(currentLeader.Until)
+}
+
+// claimLeadership publishes a new lease if there is no valid leader or this instance is the leader.
+// The lease is only taken after the broker delivers it back, so all instances agree on the last claim.
+func claimLeadership(lease time.Duration) {
+	leaderLock.Lock()
+	current := currentLeader
+	leaderLock.Unlock()
+
+	if current.ID != haInstanceID && time.Now().Before(current.Until) {
+		return
+	}
+
+	if isDraining() { // Let the lease expire, so another instance takes over
+		return
+	}
+
+	payload, _ := json.Marshal(leaderLease{
+		ID:    haInstanceID,
+		Until: time.Now().Add(lease),
+	})
+
+	err := getMQTTClient().Publish(MQTTMessage{
+		Topic:    mqttTopic(haLeaderTopic),
+		Payload:  payload,
+		Retained: true,
+	})
+
+	if err != nil {
+		haLog.Error("Error publishing leader lease: %s", err)
+	}
+}
+
+// startLeaderElection subscribes to ha_leader_topic and keeps claiming or renewing the leader lease
+func startLeaderElection() {
+	if haLeaderTopic == "" {
+		return
+	}
+
+	if haInstanceID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			haLog.Fatal("Cannot get hostname, please define ha_instance_id: %s", err)
+		}
+		haInstanceID = hostname
+	}
+
+	lease := getEnvDuration("ha_lease", 15*time.Second)
+
+	haLog.Info("Starting leader election on %s as %q", haLeaderTopic, haInstanceID)
+	subscribe(mqttTopic(haLeaderTopic), leaderHandler)
+
+	go func() {
+		tick := time.NewTicker(lease / 3)
+		for range tick.C {
+			claimLeadership(lease)
+		}
+	}()
+}
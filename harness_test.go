@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// telegramCall is a request received by the fake Telegram API
+type telegramCall struct {
+	Method string
+	Params url.Values
+}
+
+// fakeTelegram is a Telegram Bot API server recording the calls made by the bot
+type fakeTelegram struct {
+	server *httptest.Server
+
+	lock  sync.Mutex
+	calls []telegramCall
+	fail  map[string]string // Method -> error description returned instead of the result
+}
+
+// newFakeTelegram starts a fake Telegram API and points telegramBot to it for the duration of the test
+func newFakeTelegram(t testing.TB) *fakeTelegram {
+	t.Helper()
+
+	f := &fakeTelegram{fail: map[string]string{}}
+	f.server = httptest.NewServer(http.HandlerFunc(f.handle))
+
+	b, self, err := newTelegramBot("1:test-token", bot.WithServerURL(f.server.URL))
+	if err != nil {
+		f.server.Close()
+		t.Fatalf("error creating bot on fake telegram: %s", err)
+	}
+
+	previousBot, previousSelf, previousBreaker := telegramBot, telegramSelf, telegramBreaker
+	telegramBot, telegramSelf = b, self
+	telegramBreaker = &CircuitBreaker{Threshold: 5}
+
+	t.Cleanup(func() {
+		telegramBot, telegramSelf, telegramBreaker = previousBot, previousSelf, previousBreaker
+		f.server.Close()
+	})
+
+	return f
+}
+
+func (f *fakeTelegram) handle(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		r.ParseForm()
+	}
+
+	f.lock.Lock()
+	if method != "getMe" {
+		f.calls = append(f.calls, telegramCall{Method: method, Params: r.Form})
+	}
+	description, failed := f.fail[method]
+	id := len(f.calls)
+	f.lock.Unlock()
+
+	if failed {
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error_code": 400, "description": description})
+		return
+	}
+
+	var result interface{}
+	switch method {
+	case "getMe":
+		result = models.User{ID: 1, Username: "test_bot", FirstName: "Test"}
+	case "getUpdates":
+		result = []models.Update{}
+	case "answerCallbackQuery", "answerInlineQuery", "deleteMessage", "setMyCommands":
+		result = true
+	default:
+		chat := int64(0)
+		fmt.Sscan(r.Form.Get("chat_id"), &chat)
+		result = map[string]interface{}{"message_id": id, "date": 0, "chat": map[string]interface{}{"id": chat}, "text": r.Form.Get("text")}
+	}
+
+	raw, _ := json.Marshal(result)
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "result": json.RawMessage(raw)})
+}
+
+// Calls returns the requests made to a method, or all requests if method is empty
+func (f *fakeTelegram) Calls(method string) []telegramCall {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var calls []telegramCall
+	for _, c := range f.calls {
+		if method == "" || c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+
+	return calls
+}
+
+// Reset forgets the recorded calls
+func (f *fakeTelegram) Reset() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.calls = nil
+}
+
+// Fail makes all requests to method fail with the given description
+func (f *fakeTelegram) Fail(method, description string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.fail[method] = description
+}
+
+// fakeBroker is an in-memory MQTTClient that delivers published messages to the matching subscriptions
+type fakeBroker struct {
+	lock          sync.Mutex
+	connected     bool
+	subscriptions map[string]MQTTHandler
+	published     []MQTTMessage
+}
+
+// newFakeBroker creates a connected in-memory broker and sets it as mqttClient for the duration of the test
+func newFakeBroker(t testing.TB) *fakeBroker {
+	t.Helper()
+
+	b := &fakeBroker{subscriptions: map[string]MQTTHandler{}}
+	b.Connect()
+
+	previous := setMQTTClient(b)
+	t.Cleanup(func() { setMQTTClient(previous) })
+
+	return b
+}
+
+func (b *fakeBroker) Connect() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.connected = true
+	return nil
+}
+
+func (b *fakeBroker) Subscribe(topic string, handler MQTTHandler) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.subscriptions[topic] = handler
+	return nil
+}
+
+func (b *fakeBroker) Publish(msg MQTTMessage) error {
+	b.lock.Lock()
+	if !b.connected {
+		b.lock.Unlock()
+		return fmt.Errorf("not connected")
+	}
+
+	b.published = append(b.published, msg)
+
+	var handlers []MQTTHandler
+	for filter, handler := range b.subscriptions {
+		if topicMatches(filter, msg.Topic) {
+			handlers = append(handlers, handler)
+		}
+	}
+	b.lock.Unlock()
+
+	for _, handler := range handlers {
+		handler(msg)
+	}
+
+	return nil
+}
+
+func (b *fakeBroker) IsConnected() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.connected
+}
+
+func (b *fakeBroker) Disconnect() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.connected = false
+}
+
+// Published returns the messages published to a topic, or all messages if topic is empty
+func (b *fakeBroker) Published(topic string) []MQTTMessage {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var messages []MQTTMessage
+	for _, msg := range b.published {
+		if topic == "" || msg.Topic == topic {
+			messages = append(messages, msg)
+		}
+	}
+
+	return messages
+}
+
+// Reset forgets the published messages
+func (b *fakeBroker) Reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.published = nil
+}
+
+// setupTestMappings sets up the mappings and registers them as the only bridge mappings for the duration of the test
+func setupTestMappings(t testing.TB, mappings ...*Mapping) {
+	t.Helper()
+
+	previousGroups, previousTopics := groupMappings, topicMappings
+	groupMappings = map[int64]*Mapping{}
+	topicMappings = map[string]*Mapping{}
+	t.Cleanup(func() { groupMappings, topicMappings = previousGroups, previousTopics })
+
+	for _, m := range mappings {
+		if err := m.setup(); err != nil {
+			t.Fatalf("invalid mapping for topic %s: %s", m.Topic, err)
+		}
+		addMapping(m)
+	}
+}
+
+// waitFor polls condition until it holds, for the work done in the background, failing the test after a second
+func waitFor(t testing.TB, what string, condition func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(time.Second); !condition(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Maximum time without activity before a loop is considered wedged
+const (
+	maxLoopDelay      = 30 * time.Second
+	maxSchedulerDelay = 10 * time.Second
+	maxTelegramDelay  = 2 * time.Minute
+)
+
+var healthLock = sync.Mutex{}
+var (
+	lastLoop         = time.Now()
+	lastScheduler    = time.Now()
+	lastTelegramPoll = time.Now()
+)
+
+// heartbeat records the activity of one of the internal loops
+func heartbeat(last *time.Time) {
+	healthLock.Lock()
+	*last = time.Now()
+	healthLock.Unlock()
+}
+
+// checkHealth returns why the bridge is unhealthy, or nil if it started, MQTT is connected and the internal loops are running
+func checkHealth() error {
+	if stage := getStartupStage(); stage != StageReady {
+		return fmt.Errorf("not ready: %s", stage)
+	}
+
+	if client := getMQTTClient(); client == nil || !client.IsConnected() {
+		return fmt.Errorf("mqtt disconnected")
+	}
+
+	healthLock.Lock()
+	defer healthLock.Unlock()
+
+	if d := time.Since(lastLoop); d > maxLoopDelay {
+		return fmt.Errorf("main loop stalled for %s", d.Truncate(time.Second))
+	}
+
+	if d := time.Since(lastScheduler); d > maxSchedulerDelay {
+		return fmt.Errorf("scheduler stalled for %s", d.Truncate(time.Second))
+	}
+
+	if d := time.Since(lastTelegramPoll); isLeader() && d > maxTelegramDelay {
+		return fmt.Errorf("no successful telegram poll for %s", d.Truncate(time.Second))
+	}
+
+	return nil
+}
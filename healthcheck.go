@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	if err := checkHealth(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	fmt.Fprintln(w, "ok")
+}
+
+// runHealthcheck is the healthcheck subcommand: it queries the /health endpoint of the running instance
+func runHealthcheck() int {
+	listen := httpListen
+	if listen == "" {
+		listen = metricsListen
+	}
+
+	if listen == "" {
+		fmt.Fprintln(os.Stderr, "http_listen not defined")
+		return 1
+	}
+
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid http_listen %q: %s\n", listen, err)
+		return 1
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+
+	client := http.Client{Timeout: 5 * time.Second}
+
+	res, err := client.Get("http://" + net.JoinHostPort(host, port) + "/health")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unhealthy: %s\n", err)
+		return 1
+	}
+	defer res.Body.Close()
+
+	body, _ := ioutil.ReadAll(res.Body)
+
+	if res.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "unhealthy: %s", body)
+		return 1
+	}
+
+	fmt.Printf("%s", body)
+	return 0
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// homeAssistantTopic receives Home Assistant notify payloads at <homeassistant_topic>/<mapping topic>
+var homeAssistantTopic = os.Getenv("homeassistant_topic")
+
+// homeAssistantPhotoDir is the directory of the local photo files that notifications can send. Empty disables the files
+var homeAssistantPhotoDir = os.Getenv("homeassistant_photo_dir")
+
+// homeAssistantPhotoURLs enables downloading the notification photo URLs, only from public addresses
+// unless the host is in homeassistant_photo_hosts
+var homeAssistantPhotoURLs = os.Getenv("homeassistant_photo_urls") == "true"
+
+// homeAssistantPhotoHosts are the hosts (or host:port) photos can be downloaded from even on private addresses, like homeassistant:8123
+var homeAssistantPhotoHosts = os.Getenv("homeassistant_photo_hosts")
+
+var homeAssistantClient = &http.Client{
+	Timeout:   time.Minute,
+	Transport: &http.Transport{DialContext: dialPhotoHost},
+}
+
+// haDeviceName is the device_tokens entry of the Home Assistant notifications
+const haDeviceName = "homeassistant"
+
+// haNotification is a Home Assistant notify service call, as in the telegram and mobile_app notify platforms
+type haNotification struct {
+	Title   string `json:"title"`
+	Message string `json:"message"`
+	Token   string `json:"token"` // The mapping auth_token, or the homeassistant device_tokens entry
+	Data    struct {
+		Photo          json.RawMessage `json:"photo"` // A haPhoto or a list of them
+		InlineKeyboard []string        `json:"inline_keyboard"`
+		Actions        []haAction      `json:"actions"`
+	} `json:"data"`
+}
+
+type haPhoto struct {
+	URL     string `json:"url"`
+	File    string `json:"file"`
+	Caption string `json:"caption"`
+}
+
+type haAction struct {
+	Action string `json:"action"`
+	Title  string `json:"title"`
+	URI    string `json:"uri"`
+}
+
+// photos returns the photos of the notification, which can be a single photo or a list
+func (n *haNotification) photos() ([]haPhoto, error) {
+	if len(n.Data.Photo) == 0 {
+		return nil, nil
+	}
+
+	var photos []haPhoto
+	if err := json.Unmarshal(n.Data.Photo, &photos); err == nil {
+		return photos, nil
+	}
+
+	var photo haPhoto
+	if err := json.Unmarshal(n.Data.Photo, &photo); err != nil {
+		return nil, fmt.Errorf("invalid photo: %s", err)
+	}
+
+	return []haPhoto{photo}, nil
+}
+
+// keyboard returns the inline keyboard of the notification. Each inline_keyboard row is like
+// "Text:/command, Text2:/command2", and the actions are a row of their own.
+func (n *haNotification) keyboard() *models.InlineKeyboardMarkup {
+	var rows [][]models.InlineKeyboardButton
+
+	for _, row := range n.Data.InlineKeyboard {
+		var buttons []models.InlineKeyboardButton
+		for _, b := range strings.Split(row, ",") {
+			b = strings.TrimSpace(b)
+			if b == "" {
+				continue
+			}
+
+			text, data := b, b
+			if idx := strings.Index(b, ":"); idx != -1 {
+				text, data = b[:idx], b[idx+1:]
+			}
+			buttons = append(buttons, haButton(text, data))
+		}
+		if len(buttons) > 0 {
+			rows = append(rows, buttons)
+		}
+	}
+
+	var actions []models.InlineKeyboardButton
+	for _, a := range n.Data.Actions {
+		if a.URI != "" {
+			actions = append(actions, models.InlineKeyboardButton{Text: a.Title, URL: a.URI})
+		} else {
+			actions = append(actions, models.InlineKeyboardButton{Text: a.Title, CallbackData: a.Action})
+		}
+	}
+	if len(actions) > 0 {
+		rows = append(rows, actions)
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	return &models.InlineKeyboardMarkup{InlineKeyboard: rows}
+}
+
+// haButton creates a URL button for http(s) links, or a callback button
+func haButton(text, data string) models.InlineKeyboardButton {
+	if strings.HasPrefix(data, "http://") || strings.HasPrefix(data, "https://") {
+		return models.InlineKeyboardButton{Text: text, URL: data}
+	}
+
+	return models.InlineKeyboardButton{Text: text, CallbackData: data}
+}
+
+// allowedPhotoHost returns if the address (host:port) is in homeassistant_photo_hosts
+func allowedPhotoHost(address string) bool {
+	host, _, _ := net.SplitHostPort(address)
+	for _, h := range strings.Split(homeAssistantPhotoHosts, ",") {
+		h = strings.TrimSpace(h)
+		if h != "" && (h == address || h == host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isPrivateIP returns if the ip is a loopback, private, link local or unspecified address
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+// dialPhotoHost connects to a photo host, refusing the private addresses of the hosts not allowed.
+// The address is checked after resolving it, so a public name can't point to a private address.
+func dialPhotoHost(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+
+	if !allowedPhotoHost(address) {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, _ := net.SplitHostPort(address)
+			if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+				return fmt.Errorf("photo host %s is a private address", address)
+			}
+			return nil
+		}
+	}
+
+	return dialer.DialContext(ctx, network, address)
+}
+
+// photoFile returns the path of a photo file, which must be inside homeassistant_photo_dir
+func photoFile(file string) (string, error) {
+	if homeAssistantPhotoDir == "" {
+		return "", fmt.Errorf("photo files are disabled, set homeassistant_photo_dir")
+	}
+
+	dir, err := filepath.EvalSymlinks(homeAssistantPhotoDir)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Clean(file)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+
+	path, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+
+	if rel, err := filepath.Rel(dir, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("photo file %s is outside of homeassistant_photo_dir", file)
+	}
+
+	return path, nil
+}
+
+// readPhoto downloads a notification photo, or reads it from the file
+func readPhoto(p haPhoto) ([]byte, error) {
+	if p.File != "" {
+		path, err := photoFile(p.File)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadFile(path)
+	}
+
+	if !homeAssistantPhotoURLs {
+		return nil, fmt.Errorf("photo URLs are disabled, set homeassistant_photo_urls")
+	}
+
+	if !strings.HasPrefix(p.URL, "http://") && !strings.HasPrefix(p.URL, "https://") {
+		return nil, fmt.Errorf("invalid photo URL %q: only http and https are supported", p.URL)
+	}
+
+	res, err := homeAssistantClient.Get(p.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("received status %d from %s", res.StatusCode, p.URL)
+	}
+
+	return ioutil.ReadAll(res.Body)
+}
+
+// sendHomeAssistantNotification sends a notification to the mapping group: the photos, then the text with the keyboard
+func sendHomeAssistantNotification(mapping *Mapping, n *haNotification) error {
+	sink := mapping.telegramSink()
+
+	photos, err := n.photos()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range photos {
+		image, err := readPhoto(p)
+		if err != nil {
+			return fmt.Errorf("error reading photo: %s", err)
+		}
+
+		if err := sink.SendPhoto(p.Caption, image); err != nil {
+			return err
+		}
+	}
+
+	text := n.Message
+	if n.Title != "" {
+		text = sink.Options.bold(n.Title) + "\n" + n.Message
+	}
+
+	if text == "" {
+		return nil
+	}
+
+	params := &bot.SendMessageParams{
+		ChatID:          sink.ChatID,
+		MessageThreadID: sink.Options.ThreadID,
+		Text:            text,
+		ParseMode:       sink.Options.parseMode(),
+	}
+	if keyboard := n.keyboard(); keyboard != nil {
+		params.ReplyMarkup = keyboard
+	}
+
+	return sink.SendRequest(func(ctx context.Context) error {
+		_, err := getTelegramBot().SendMessage(ctx, params)
+		return err
+	})
+}
+
+// homeAssistantHandler handles the notify payloads of <homeassistant_topic>/<mapping topic>
+func homeAssistantHandler(msg MQTTMessage) {
+	topic := strings.TrimPrefix(msg.Topic, mqttTopic(homeAssistantTopic)+"/")
+
+	mapping, ok := topicMapping(topic)
+	if !ok {
+		mqttLog.Warn("Received Home Assistant notification for topic %s but no telegram channel associated.", topic)
+		return
+	}
+
+	if mapping.isMuted() {
+		mqttLog.Debug("Suppressing Home Assistant notification to muted topic %s", topic)
+		return
+	}
+
+	var n haNotification
+	if err := json.Unmarshal(msg.Payload, &n); err != nil {
+		mqttLog.Error("Received invalid Home Assistant notification on %s: %s", msg.Topic, err)
+		publishError(mapping, topic, fmt.Sprintf("There was an error processing the message: %s", err))
+		return
+	}
+
+	// Home Assistant has the mapping auth_token, or its own device_tokens entry
+	fields := map[string]interface{}{"from": haDeviceName}
+	if n.Token != "" {
+		fields["token"] = n.Token
+	}
+	if err := mapping.checkToken(fields); err != nil {
+		mqttLog.Error("Rejecting Home Assistant notification on %s: %s", msg.Topic, err)
+		publishError(mapping, topic, fmt.Sprintf("There was an error processing the message: %s", err))
+		return
+	}
+
+	err := sendHomeAssistantNotification(mapping, &n)
+	mapping.trackDelivery(err)
+	if err != nil {
+		mqttLog.Error("Error sending Home Assistant notification to %s: %s", topic, err)
+		publishError(mapping, topic, fmt.Sprintf("There was an error sending the message: %s", err))
+		return
+	}
+
+	archiveMessage(ArchivedMessage{
+		Time:      time.Now(),
+		Direction: DirectionToTelegram,
+		Topic:     topic,
+		ChatID:    mapping.GroupID,
+		From:      "Home Assistant",
+		Message:   strings.TrimSpace(n.Title + " " + n.Message),
+	})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHomeAssistantPhotos(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "home/garage"}
+	setupTestMappings(t, mapping)
+
+	image := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 32)...)
+
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "garage.png"), image, 0600)
+	secret := filepath.Join(t.TempDir(), "secret.png")
+	ioutil.WriteFile(secret, image, 0600)
+
+	camera := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(image)
+	}))
+	defer camera.Close()
+	cameraHost := strings.TrimPrefix(camera.URL, "http://")
+
+	previousDir, previousURLs, previousHosts := homeAssistantPhotoDir, homeAssistantPhotoURLs, homeAssistantPhotoHosts
+	t.Cleanup(func() {
+		homeAssistantPhotoDir, homeAssistantPhotoURLs, homeAssistantPhotoHosts = previousDir, previousURLs, previousHosts
+	})
+
+	tests := []struct {
+		name  string
+		dir   string
+		urls  bool
+		hosts string
+		photo string
+		sent  bool
+	}{
+		{"file inside the photo dir", dir, false, "", `{"file": "garage.png"}`, true},
+		{"absolute file inside the photo dir", dir, false, "", `{"file": "` + filepath.Join(dir, "garage.png") + `"}`, true},
+		{"file outside the photo dir", dir, false, "", `{"file": "` + secret + `"}`, false},
+		{"relative file escaping the photo dir", dir, false, "", `{"file": "../` + filepath.Base(filepath.Dir(secret)) + `/secret.png"}`, false},
+		{"files disabled", "", false, "", `{"file": "` + filepath.Join(dir, "garage.png") + `"}`, false},
+		{"urls disabled", "", false, cameraHost, `{"url": "` + camera.URL + `"}`, false},
+		{"url to a private address", "", true, "", `{"url": "` + camera.URL + `"}`, false},
+		{"url to an allowed host", "", true, cameraHost, `{"url": "` + camera.URL + `"}`, true},
+		{"url with another scheme", "", true, cameraHost, `{"url": "file:///etc/passwd"}`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			telegram.Reset()
+			homeAssistantPhotoDir, homeAssistantPhotoURLs, homeAssistantPhotoHosts = test.dir, test.urls, test.hosts
+
+			homeAssistantHandler(MQTTMessage{
+				Topic:   mqttTopic(homeAssistantTopic) + "/home/garage",
+				Payload: []byte(`{"message": "Garage open", "data": {"photo": ` + test.photo + `}}`),
+			})
+
+			if photos := telegram.Calls("sendPhoto"); (len(photos) == 1) != test.sent {
+				t.Errorf("expected photo sent %t, got %v", test.sent, photos)
+			}
+		})
+	}
+}
+
+func TestHomeAssistantToken(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	newFakeBroker(t)
+
+	setupTestMappings(t,
+		&Mapping{GroupID: -100, Topic: "home/garage", AuthToken: "shared"},
+		&Mapping{GroupID: -200, Topic: "home/office", DeviceTokens: map[string]string{"homeassistant": "h4ss"}},
+	)
+
+	tests := []struct {
+		topic   string
+		payload string
+		sent    bool
+	}{
+		{"home/garage", `{"message": "Garage open"}`, false},
+		{"home/garage", `{"message": "Garage open", "token": "guess"}`, false},
+		{"home/garage", `{"message": "Garage open", "token": "shared"}`, true},
+		{"home/office", `{"message": "Office open", "token": "shared"}`, false},
+		{"home/office", `{"message": "Office open", "token": "h4ss"}`, true},
+	}
+
+	for _, test := range tests {
+		telegram.Reset()
+
+		homeAssistantHandler(MQTTMessage{Topic: mqttTopic(homeAssistantTopic) + "/" + test.topic, Payload: []byte(test.payload)})
+
+		if calls := telegram.Calls("sendMessage"); (len(calls) == 1) != test.sent {
+			t.Errorf("%s %s: expected sent %t, got %v", test.topic, test.payload, test.sent, calls)
+		}
+	}
+}
+
+func TestHomeAssistantTitle(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	newFakeBroker(t)
+
+	setupTestMappings(t, &Mapping{GroupID: -100, Topic: "home/garage", TelegramOptions: TelegramOptions{ParseMode: "HTML"}})
+
+	homeAssistantHandler(MQTTMessage{Topic: mqttTopic(homeAssistantTopic) + "/home/garage", Payload: []byte(`{"title": "Door <1>", "message": "Open"}`)})
+
+	calls := telegram.Calls("sendMessage")
+	if len(calls) != 1 || calls[0].Params.Get("text") != "<b>Door &lt;1&gt;</b>\nOpen" {
+		t.Errorf("expected the title in bold for the parse mode, got %v", calls)
+	}
+}
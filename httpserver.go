@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var (
+	httpListen = os.Getenv("http_listen")
+	httpToken  = os.Getenv("http_token")
+)
+
+// httpMux holds the handlers of the HTTP server
+var httpMux = http.NewServeMux()
+
+// requireToken protects a handler with the http_token, sent as a bearer token or the token query parameter.
+// Handlers are disabled when http_token is not defined.
+func requireToken(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if httpToken == "" {
+			http.Error(w, "http_token not defined", http.StatusForbidden)
+			return
+		}
+
+		token := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			token = strings.TrimPrefix(auth, "Bearer ")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(token), []byte(httpToken)) != 1 {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// startHTTPServer serves the metrics and the other HTTP endpoints at http_listen (or metrics_listen)
+func startHTTPServer() {
+	listen := httpListen
+	if listen == "" {
+		listen = metricsListen
+	}
+
+	if listen == "" {
+		return
+	}
+
+	httpMux.HandleFunc("/metrics", metricsHandler)
+	httpMux.HandleFunc("/health", healthHandler)
+	httpMux.HandleFunc("/export", requireToken(exportHandler))
+	httpMux.HandleFunc("/stream", requireDashboardAuth(streamHandler))
+	registerDebugHandlers()
+	registerDashboardHandlers()
+
+	httpLog.Info("Listening at %s", listen)
+
+	go func() {
+		err := http.ListenAndServe(listen, httpMux)
+		if err != nil {
+			httpLog.Fatal("Error serving HTTP: %s", err)
+		}
+	}()
+}
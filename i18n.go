@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// defaultLanguage is the language of the bot texts of mappings without language and of the admin
+var defaultLanguage = os.Getenv("language")
+
+// messageCatalogs are the bot texts per language, as fmt formats. Missing texts fall back to english.
+var messageCatalogs = map[string]map[string]string{
+	"en": {
+		"not_mapped":             "This chat is not mapped to any topic",
+		"mute_usage":             "Usage: /mute <duration>, like /mute 30m",
+		"muted":                  "Messages from %s muted for %s",
+		"flood_muted":            "%s is sending too many messages, muted for %s",
+		"unmuted":                "Messages from %s unmuted, %d messages were suppressed",
+		"mute_expired":           "Mute expired, %d messages were suppressed",
+		"repeated":               "%s (repeated %d times)",
+		"repeated_once":          "%s (repeated once)",
+		"cooldown_summary":       "%d more messages on %s were suppressed during the %s cooldown",
+		"no_data":                "⏰ No data from %s for %s",
+		"data_resumed":           "✅ Data from %s resumed after %s",
+		"provisioned":            "This chat is now linked to the MQTT topic %s",
+		"retained":               "%s (retained)",
+		"unverified":             "%s (unverified)",
+		"processing_error":       "There was an error processing the message: %s",
+		"no_message":             "Received data without message: %s",
+		"chat_id":                "Chat id: %d\nType: %s",
+		"search_usage":           "Usage: /search <query>",
+		"search_error":           "Error searching archive: %s",
+		"search_empty":           "No messages found",
+		"export_usage":           "Usage: /export <topic> [since] [until] [csv|json]",
+		"export_error":           "Error exporting archive: %s",
+		"export_send_error":      "Error sending export: %s",
+		"graph_usage":            "Usage: /graph [duration] [topic]",
+		"graph_disabled":         "Charts are not enabled for %s",
+		"graph_invalid_duration": "Invalid duration %q",
+		"graph_no_values":        "Not enough values of %s to chart",
+		"graph_send_error":       "Error sending chart: %s",
+		"enable_usage":           "Usage: /enable <chat id>",
+		"chat_not_disabled":      "Chat %d is not disabled",
+		"chat_enabled":           "Chat %d enabled",
+		"get_usage":              "Usage: /get <topic>",
+		"get_no_value":           "No value received on %s",
+		"summary":                "Summary of %s since %s",
+		"summary_messages":       "MQTT messages: %d\nTelegram messages: %d",
+		"summary_talkers":        "Top talkers:",
+		"summary_alerts":         "Alerts:",
+		"summary_values":         "Values (min - max):",
+		"keyboard":               "Keyboard",
+		"keyboard_disabled":      "There is no keyboard for %s",
+		"dialog_confirm":         "Confirm",
+		"dialog_cancel":          "Cancel",
+		"ack_button":             "✅ Acknowledge",
+		"acknowledged":           "✅ Acknowledged by %s",
+		"alert_reminder":         "🔁 Not acknowledged: %s",
+		"alert_escalated":        "Alert on %s not acknowledged in %s: %s",
+		"device_offline":         "📴 %s offline since %s",
+		"device_online":          "✅ %s back online after %s",
+		"device_status_online":   "🟢 %s (seen %s ago)",
+		"device_status_offline":  "🔴 %s (offline for %s)",
+		"no_devices":             "No devices tracked",
+		"dialog_done":            "Done",
+		"dialog_cancelled":       "Cancelled",
+		"dialog_expired":         "This dialog has expired",
+	},
+	"pt": {
+		"not_mapped":             "Este chat não está associado a nenhum tópico",
+		"mute_usage":             "Uso: /mute <duração>, como /mute 30m",
+		"muted":                  "Mensagens de %s silenciadas por %s",
+		"flood_muted":            "%s está enviando mensagens demais, silenciado por %s",
+		"unmuted":                "Mensagens de %s reativadas, %d mensagens foram suprimidas",
+		"mute_expired":           "Silêncio expirou, %d mensagens foram suprimidas",
+		"repeated":               "%s (repetida %d vezes)",
+		"repeated_once":          "%s (repetida uma vez)",
+		"cooldown_summary":       "%d mensagens a mais em %s foram suprimidas durante o intervalo de %s",
+		"no_data":                "⏰ Sem dados de %s há %s",
+		"data_resumed":           "✅ Dados de %s retomados após %s",
+		"provisioned":            "Este chat agora está ligado ao tópico MQTT %s",
+		"retained":               "%s (retida)",
+		"unverified":             "%s (não verificada)",
+		"processing_error":       "Ocorreu um erro ao processar a mensagem: %s",
+		"no_message":             "Dados recebidos sem mensagem: %s",
+		"chat_id":                "Id do chat: %d\nTipo: %s",
+		"search_usage":           "Uso: /search <busca>",
+		"search_error":           "Erro ao buscar no arquivo: %s",
+		"search_empty":           "Nenhuma mensagem encontrada",
+		"export_usage":           "Uso: /export <tópico> [desde] [até] [csv|json]",
+		"export_error":           "Erro ao exportar o arquivo: %s",
+		"export_send_error":      "Erro ao enviar a exportação: %s",
+		"graph_usage":            "Uso: /graph [duração] [tópico]",
+		"graph_disabled":         "Gráficos não estão habilitados para %s",
+		"graph_invalid_duration": "Duração inválida %q",
+		"graph_no_values":        "Não há valores suficientes de %s para o gráfico",
+		"graph_send_error":       "Erro ao enviar o gráfico: %s",
+		"enable_usage":           "Uso: /enable <id do chat>",
+		"chat_not_disabled":      "O chat %d não está desabilitado",
+		"chat_enabled":           "Chat %d habilitado",
+		"get_usage":              "Uso: /get <tópico>",
+		"get_no_value":           "Nenhum valor recebido em %s",
+		"summary":                "Resumo de %s desde %s",
+		"summary_messages":       "Mensagens MQTT: %d\nMensagens do Telegram: %d",
+		"summary_talkers":        "Quem mais falou:",
+		"summary_alerts":         "Alertas:",
+		"summary_values":         "Valores (mín - máx):",
+		"keyboard":               "Teclado",
+		"keyboard_disabled":      "Não há teclado para %s",
+		"dialog_confirm":         "Confirmar",
+		"dialog_cancel":          "Cancelar",
+		"ack_button":             "✅ Confirmar",
+		"acknowledged":           "✅ Confirmado por %s",
+		"alert_reminder":         "🔁 Não confirmado: %s",
+		"alert_escalated":        "Alerta em %s não confirmado em %s: %s",
+		"device_offline":         "📴 %s offline desde %s",
+		"device_online":          "✅ %s online novamente após %s",
+		"device_status_online":   "🟢 %s (visto há %s)",
+		"device_status_offline":  "🔴 %s (offline há %s)",
+		"no_devices":             "Nenhum dispositivo monitorado",
+		"dialog_done":            "Feito",
+		"dialog_cancelled":       "Cancelado",
+		"dialog_expired":         "Este diálogo expirou",
+	},
+	"es": {
+		"not_mapped":             "Este chat no está asociado a ningún tópico",
+		"mute_usage":             "Uso: /mute <duración>, como /mute 30m",
+		"muted":                  "Mensajes de %s silenciados por %s",
+		"flood_muted":            "%s está enviando demasiados mensajes, silenciado por %s",
+		"unmuted":                "Mensajes de %s reactivados, %d mensajes fueron suprimidos",
+		"mute_expired":           "El silencio expiró, %d mensajes fueron suprimidos",
+		"repeated":               "%s (repetido %d veces)",
+		"repeated_once":          "%s (repetido una vez)",
+		"cooldown_summary":       "%d mensajes más en %s fueron suprimidos durante el intervalo de %s",
+		"no_data":                "⏰ Sin datos de %s desde hace %s",
+		"data_resumed":           "✅ Datos de %s reanudados después de %s",
+		"provisioned":            "Este chat ahora está vinculado al tópico MQTT %s",
+		"retained":               "%s (retenido)",
+		"unverified":             "%s (no verificado)",
+		"processing_error":       "Hubo un error al procesar el mensaje: %s",
+		"no_message":             "Datos recibidos sin mensaje: %s",
+		"chat_id":                "Id del chat: %d\nTipo: %s",
+		"search_usage":           "Uso: /search <búsqueda>",
+		"search_error":           "Error al buscar en el archivo: %s",
+		"search_empty":           "No se encontraron mensajes",
+		"export_usage":           "Uso: /export <tópico> [desde] [hasta] [csv|json]",
+		"export_error":           "Error al exportar el archivo: %s",
+		"export_send_error":      "Error al enviar la exportación: %s",
+		"graph_usage":            "Uso: /graph [duración] [tópico]",
+		"graph_disabled":         "Los gráficos no están habilitados para %s",
+		"graph_invalid_duration": "Duración inválida %q",
+		"graph_no_values":        "No hay suficientes valores de %s para el gráfico",
+		"graph_send_error":       "Error al enviar el gráfico: %s",
+		"enable_usage":           "Uso: /enable <id del chat>",
+		"chat_not_disabled":      "El chat %d no está deshabilitado",
+		"chat_enabled":           "Chat %d habilitado",
+		"get_usage":              "Uso: /get <tópico>",
+		"get_no_value":           "Ningún valor recibido en %s",
+		"summary":                "Resumen de %s desde %s",
+		"summary_messages":       "Mensajes MQTT: %d\nMensajes de Telegram: %d",
+		"summary_talkers":        "Quién más habló:",
+		"summary_alerts":         "Alertas:",
+		"summary_values":         "Valores (mín - máx):",
+		"keyboard":               "Teclado",
+		"keyboard_disabled":      "No hay teclado para %s",
+		"dialog_confirm":         "Confirmar",
+		"dialog_cancel":          "Cancelar",
+		"ack_button":             "✅ Confirmar",
+		"acknowledged":           "✅ Confirmado por %s",
+		"alert_reminder":         "🔁 No confirmado: %s",
+		"alert_escalated":        "Alerta en %s no confirmada en %s: %s",
+		"device_offline":         "📴 %s desconectado desde %s",
+		"device_online":          "✅ %s conectado de nuevo después de %s",
+		"device_status_online":   "🟢 %s (visto hace %s)",
+		"device_status_offline":  "🔴 %s (desconectado hace %s)",
+		"no_devices":             "Ningún dispositivo monitoreado",
+		"dialog_done":            "Hecho",
+		"dialog_cancelled":       "Cancelado",
+		"dialog_expired":         "Este diálogo ha expirado",
+	},
+}
+
+// addMessageCatalogs merges the user message catalogs of the config file, overriding the built-in texts
+func addMessageCatalogs(catalogs map[string]map[string]string) {
+	for lang, messages := range catalogs {
+		if messageCatalogs[lang] == nil {
+			messageCatalogs[lang] = map[string]string{}
+		}
+		for key, text := range messages {
+			messageCatalogs[lang][key] = text
+		}
+	}
+}
+
+// translate formats the text of a key in the language, falling back to the default language and english
+func translate(lang, key string, args ...interface{}) string {
+	text, ok := catalogText(lang, key)
+	if !ok {
+		return key
+	}
+
+	return fmt.Sprintf(text, args...)
+}
+
+// catalogText returns the format of a bot text in a language, falling back to the default language and english
+func catalogText(lang, key string) (string, bool) {
+	for _, l := range []string{lang, defaultLanguage, "en"} {
+		if text, ok := messageCatalogs[l][key]; ok {
+			return text, true
+		}
+	}
+
+	return "", false
+}
+
+// tr formats a bot text in the mapping language
+func (m *Mapping) tr(key string, args ...interface{}) string {
+	if m == nil {
+		return translate(defaultLanguage, key, args...)
+	}
+
+	return translate(m.Language, key, args...)
+}
+
+// formatted is an argument of trMessage already formatted for the parse mode, like the message of a payload
+type formatted string
+
+// trMessage formats a bot text sent along the mapping messages, like the retained mark, escaping the text and its
+// arguments for the mapping parse_mode, except the formatted ones
+func (m *Mapping) trMessage(key string, args ...interface{}) string {
+	return m.trMessageFor(m.TelegramOptions, key, args...)
+}
+
+// trMessageFor is trMessage escaping for the options of a sink, which may have another parse mode than the mapping
+func (m *Mapping) trMessageFor(options TelegramOptions, key string, args ...interface{}) string {
+	text, ok := catalogText(m.Language, key)
+	if !ok {
+		return key
+	}
+
+	escaped := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch a := arg.(type) {
+		case formatted:
+			escaped[i] = string(a)
+		case string:
+			escaped[i] = options.escape(a)
+		case fmt.Stringer:
+			escaped[i] = options.escape(a.String())
+		default:
+			escaped[i] = arg
+		}
+	}
+
+	return fmt.Sprintf(options.escape(text), escaped...)
+}
+
+// chatLanguage returns the language of the mapping of a chat, or the default language
+func chatLanguage(chat int64) string {
+	if m, ok := groupMapping(chat); ok && m.Language != "" {
+		return m.Language
+	}
+
+	return defaultLanguage
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrMessageEscaping(t *testing.T) {
+	tests := []struct {
+		parseMode string
+		expected  string
+	}{
+		{"", "3 more messages on living\\_room were suppressed during the 1m0s cooldown"},
+		{"MarkdownV2", "3 more messages on living\\_room were suppressed during the 1m0s cooldown"},
+		{"HTML", "3 more messages on a&lt;b&gt; were suppressed during the 1m0s cooldown"},
+		{"none", "3 more messages on living_room were suppressed during the 1m0s cooldown"},
+	}
+
+	for _, test := range tests {
+		m := &Mapping{TelegramOptions: TelegramOptions{ParseMode: test.parseMode}}
+		topic := "living_room"
+		if test.parseMode == "HTML" {
+			topic = "a<b>"
+		}
+
+		if text := m.trMessage("cooldown_summary", 3, topic, Duration{time.Minute}); text != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.parseMode, test.expected, text)
+		}
+	}
+
+	// The payload message is already formatted, only the mark is escaped
+	m := &Mapping{TelegramOptions: TelegramOptions{ParseMode: "MarkdownV2"}}
+	if text := m.trMessage("retained", formatted("*on*")); text != "*on* \\(retained\\)" {
+		t.Errorf("unexpected retained mark %q", text)
+	}
+}
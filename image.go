@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// isImage checks if a payload is a raw image by its content
+func isImage(payload []byte) bool {
+	return strings.HasPrefix(http.DetectContentType(payload), "image/")
+}
+
+// deliverImage sends an image payload as a photo to the mapping group
+func deliverImage(mapping *Mapping, n Notification, image []byte, unverified bool) error {
+	if mapping.isMuted() {
+		sinkLog.Debug("Suppressing image from muted topic %s", mapping.Topic)
+		return errMuted
+	}
+
+	caption := n.Topic
+	if mapping.imageCaption != nil {
+		text, err := renderTemplate(mapping.imageCaption, n)
+		if err != nil {
+			sinkLog.Error("Error rendering image caption for topic %s: %s", mapping.Topic, err)
+		} else {
+			caption = text
+		}
+	}
+
+	if unverified {
+		caption = mapping.tr("unverified", caption)
+	}
+
+	err := mapping.telegramSink().SendPhoto(caption, image)
+	mapping.trackDelivery(err)
+
+	return err
+}
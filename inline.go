@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"os"
+	"strconv"
+	"time"
+)
+
+// inlinePublic answers the inline queries of anyone, instead of only the admin
+var inlinePublic = os.Getenv("inline_public") == "true"
+
+// maxInlineResults is the maximum of results of an inline query allowed by Telegram
+const maxInlineResults = 50
+
+// handleInlineQuery answers inline queries (@bot temperature) with the last values of the matching topics
+func handleInlineQuery(q *models.InlineQuery) {
+	if !inlinePublic && !isAdmin(q.From) {
+		telLog.Warn("User %s is not allowed to run inline queries", q.From.Username)
+		return
+	}
+
+	results := []models.InlineQueryResult{}
+	for i, v := range findLastValues(q.Query, maxInlineResults) {
+		results = append(results, &models.InlineQueryResultArticle{
+			ID:                  strconv.Itoa(i),
+			Title:               v.Topic,
+			InputMessageContent: &models.InputTextMessageContent{MessageText: formatLastValue(v)},
+			Description:         fmt.Sprintf("%s (%s ago)", truncate(v.Payload, 200), time.Since(v.Time).Truncate(time.Second)),
+		})
+	}
+
+	ctx, cancel := telegramContext(context.Background())
+	defer cancel()
+
+	_, err := getTelegramBot().AnswerInlineQuery(ctx, &bot.AnswerInlineQueryParams{
+		InlineQueryID: q.ID,
+		Results:       results,
+		IsPersonal:    true,
+		CacheTime:     0, // Values change all the time
+	})
+	if err != nil {
+		telLog.Error("Error answering inline query %q: %s", q.Query, err)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// kafkaGroup is the consumer group of the shared subscriptions, like the mapping topics with ha_share_group, shared by
+// the bridge replicas. The other subscriptions, like the control and leader topics, use a group of each instance,
+// <kafka_group>-<ha_instance_id>, so every replica receives all their messages.
+var kafkaGroup = os.Getenv("kafka_group")
+
+// kafkaClient is a Kafka client using franz-go: a consumer group for the subscriptions and a producer for the publishes.
+// Topics are converted to Kafka topics (sensors/rack to sensors.rack) and filters to regular expressions, so the mappings work unchanged.
+type kafkaClient struct {
+	options  MQTTOptions
+	producer *kgo.Client
+
+	lock          sync.Mutex
+	consumers     []*kgo.Client
+	restart       *time.Timer // Pending start of the consumers with the new subscriptions
+	closed        bool
+	subscriptions map[string]kafkaSubscription // By subscription filter
+}
+
+type kafkaSubscription struct {
+	topics  *regexp.Regexp // Kafka topics of the filter
+	group   string         // Consumer group of the subscription
+	handler MQTTHandler
+}
+
+func newKafkaClient(o MQTTOptions) *kafkaClient {
+	return &kafkaClient{
+		options:       o,
+		subscriptions: map[string]kafkaSubscription{},
+	}
+}
+
+// kafkaConsumerDelay is the wait for more subscriptions before starting the consumer, so the subscriptions made
+// together, like the ones of the mappings at startup, start a single consumer
+var kafkaConsumerDelay = 100 * time.Millisecond
+
+// kafkaSubscriptionGroup returns the consumer group and the filter of a subscription: the kafka_group for the shared
+// subscriptions ($share/group/filter), as the group already delivers each message to only one replica, or else the
+// group of the instance
+func kafkaSubscriptionGroup(topic string) (string, string) {
+	group := kafkaGroup
+	if group == "" {
+		group = "mqtttelegram"
+	}
+
+	if parts := strings.SplitN(topic, "/", 3); parts[0] == "$share" && len(parts) == 3 {
+		return group, parts[2]
+	}
+
+	return group + "-" + instanceID(), topic
+}
+
+// kafkaConsumerGroups returns the regular expressions of the subscriptions of each consumer group
+func kafkaConsumerGroups(subscriptions map[string]kafkaSubscription) map[string][]string {
+	groups := map[string][]string{}
+	for filter, s := range subscriptions {
+		groups[s.group] = append(groups[s.group], kafkaFilter(filter))
+	}
+
+	for _, filters := range groups {
+		sort.Strings(filters)
+	}
+
+	return groups
+}
+
+// kafkaInvalidChars are the characters not allowed in Kafka topics, replaced by _
+var kafkaInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// kafkaTopic converts a MQTT topic to a Kafka topic, like $bridge/stats to _bridge.stats
+func kafkaTopic(topic string) string {
+	return kafkaInvalidChars.ReplaceAllString(strings.Replace(topic, "/", ".", -1), "_")
+}
+
+// kafkaFilter converts a MQTT filter to the regular expression of the matching Kafka topics
+func kafkaFilter(filter string) string {
+	var levels []string
+	for _, level := range strings.Split(filter, "/") {
+		switch level {
+		case "+":
+			levels = append(levels, `[^.]+`)
+		case "#":
+			levels = append(levels, `.*`)
+		default:
+			levels = append(levels, regexp.QuoteMeta(kafkaTopic(level)))
+		}
+	}
+
+	return "^" + strings.Join(levels, `\.`) + "$"
+}
+
+// clientOptions are the options of both the producer and consumer clients
+func (c *kafkaClient) clientOptions() []kgo.Opt {
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(strings.TrimPrefix(c.options.BrokerURL, "kafka://")),
+		kgo.DialTimeout(c.options.ConnectTimeout),
+		kgo.RetryBackoffFn(func(tries int) time.Duration {
+			d := time.Duration(tries) * time.Second
+			if d > c.options.MaxReconnectInterval {
+				d = c.options.MaxReconnectInterval
+			}
+			return d
+		}),
+	}
+
+	if c.options.Username != "" {
+		opts = append(opts, kgo.SASL(plain.Plain(func(context.Context) (plain.Auth, error) {
+			return plain.Auth{User: c.options.Username, Pass: c.options.Password()}, nil
+		})))
+	}
+
+	return opts
+}
+
+func (c *kafkaClient) Connect() error {
+	producer, err := kgo.NewClient(c.clientOptions()...)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.ConnectTimeout)
+	defer cancel()
+
+	if err := producer.Ping(ctx); err != nil {
+		producer.Close()
+		return err
+	}
+	c.producer = producer
+
+	if c.options.OnConnect != nil {
+		c.options.OnConnect()
+	}
+
+	return nil
+}
+
+// Subscribe adds the filter to its consumer group (see kafkaSubscriptionGroup), starting the consumers with all the
+// subscriptions after kafkaConsumerDelay
+func (c *kafkaClient) Subscribe(topic string, handler MQTTHandler) error {
+	group, topic := kafkaSubscriptionGroup(topic)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.subscriptions[topic] = kafkaSubscription{
+		topics:  regexp.MustCompile(kafkaFilter(topic)),
+		group:   group,
+		handler: handler,
+	}
+
+	if c.restart == nil {
+		c.restart = time.AfterFunc(kafkaConsumerDelay, c.restartConsumer)
+	} else {
+		c.restart.Reset(kafkaConsumerDelay)
+	}
+
+	return nil
+}
+
+// restartConsumer creates the consumers of the groups with all the subscriptions, as franz-go cannot add regular
+// expressions to a running consumer
+func (c *kafkaClient) restartConsumer() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closed {
+		return
+	}
+
+	for _, consumer := range c.consumers {
+		consumer.Close()
+	}
+	c.consumers = nil
+
+	for group, filters := range kafkaConsumerGroups(c.subscriptions) {
+		opts := append(c.clientOptions(),
+			kgo.ConsumerGroup(group),
+			kgo.ConsumeTopics(filters...),
+			kgo.ConsumeRegex(),
+			kgo.ConsumeResetOffset(kgo.NewOffset().AtEnd()), // New groups start with the new messages
+		)
+
+		consumer, err := kgo.NewClient(opts...)
+		if err != nil {
+			mqttLog.Error("Error creating kafka consumer of group %s: %s", group, err)
+			continue
+		}
+		c.consumers = append(c.consumers, consumer)
+
+		go c.consume(consumer, group)
+	}
+}
+
+// consume calls the handlers of the subscriptions of the consumer group
+func (c *kafkaClient) consume(consumer *kgo.Client, group string) {
+	for {
+		fetches := consumer.PollFetches(context.Background())
+		if fetches.IsClientClosed() {
+			return
+		}
+
+		fetches.EachError(func(topic string, partition int32, err error) {
+			mqttLog.Error("Error consuming kafka topic %s: %s", topic, err)
+		})
+
+		fetches.EachRecord(func(r *kgo.Record) {
+			msg := MQTTMessage{
+				Topic:   strings.Replace(r.Topic, ".", "/", -1),
+				Payload: r.Value,
+			}
+
+			if len(r.Headers) > 0 {
+				msg.UserProperties = map[string]string{}
+				for _, h := range r.Headers {
+					msg.UserProperties[h.Key] = string(h.Value)
+				}
+			}
+
+			c.lock.Lock()
+			var handlers []MQTTHandler
+			for _, s := range c.subscriptions {
+				if s.group == group && s.topics.MatchString(r.Topic) {
+					handlers = append(handlers, s.handler)
+				}
+			}
+			c.lock.Unlock()
+
+			for _, handler := range handlers {
+				handler(msg)
+			}
+		})
+	}
+}
+
+func (c *kafkaClient) Publish(msg MQTTMessage) error {
+	r := &kgo.Record{
+		Topic: kafkaTopic(msg.Topic),
+		Value: msg.Payload,
+	}
+
+	for k, v := range msg.UserProperties {
+		r.Headers = append(r.Headers, kgo.RecordHeader{Key: k, Value: []byte(v)})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.ConnectTimeout)
+	defer cancel()
+
+	return c.producer.ProduceSync(ctx, r).FirstErr()
+}
+
+// IsConnected checks if the brokers answer, as the franz-go clients connect on demand
+func (c *kafkaClient) IsConnected() bool {
+	if c.producer == nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.PingTimeout)
+	defer cancel()
+
+	return c.producer.Ping(ctx) == nil
+}
+
+func (c *kafkaClient) Disconnect() {
+	c.lock.Lock()
+	c.closed = true
+	if c.restart != nil {
+		c.restart.Stop()
+	}
+	for _, consumer := range c.consumers {
+		consumer.Close()
+	}
+	c.consumers = nil
+	c.lock.Unlock()
+
+	if c.producer != nil {
+		c.producer.Close()
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKafkaConsumerGroups(t *testing.T) {
+	previousGroup, previousInstance := kafkaGroup, haInstanceID
+	kafkaGroup, haInstanceID = "bridge", "replica-1"
+	t.Cleanup(func() { kafkaGroup, haInstanceID = previousGroup, previousInstance })
+
+	c := newKafkaClient(MQTTOptions{})
+	t.Cleanup(c.Disconnect)
+
+	for _, topic := range []string{"$share/ha/sensors/+", "$share/ha/alarm/#", "$bridge/control", "$bridge/leader"} {
+		c.Subscribe(topic, func(MQTTMessage) {})
+	}
+
+	c.lock.Lock()
+	groups := kafkaConsumerGroups(c.subscriptions)
+	c.lock.Unlock()
+
+	// The shared subscriptions are split between the replicas, the others are received by every instance
+	expected := map[string][]string{
+		"bridge":           {`^alarm\..*$`, `^sensors\.[^.]+$`},
+		"bridge-replica-1": {`^_bridge\.control$`, `^_bridge\.leader$`},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("expected groups %v, got %v", expected, groups)
+	}
+}
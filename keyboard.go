@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// KeyboardButton is a button of the mapping reply keyboard, publishing a payload to MQTT when pressed
+type KeyboardButton struct {
+	Text    string      `json:"text"`
+	Topic   string      `json:"topic"`
+	Payload interface{} `json:"payload"` // Strings are published as is, anything else as JSON
+	Retain  bool        `json:"retain"`
+
+	AdminOnly bool `json:"admin_only"` // Only the telegram_admin can press the button
+}
+
+// payloadBytes returns the payload published by the button
+func (b *KeyboardButton) payloadBytes() []byte {
+	if s, ok := b.Payload.(string); ok {
+		return []byte(s)
+	}
+
+	data, _ := json.Marshal(b.Payload)
+	return data
+}
+
+func (m *Mapping) setupKeyboard() error {
+	for _, row := range m.Keyboard {
+		for _, b := range row {
+			if b.Text == "" || b.Topic == "" {
+				return fmt.Errorf("keyboard buttons require text and topic")
+			}
+		}
+	}
+
+	return nil
+}
+
+// keyboardButton returns the keyboard button with the text, or nil
+func (m *Mapping) keyboardButton(text string) *KeyboardButton {
+	for _, row := range m.Keyboard {
+		for _, b := range row {
+			if b.Text == text {
+				return b
+			}
+		}
+	}
+
+	return nil
+}
+
+// replyKeyboard returns the Telegram reply keyboard of the mapping
+func (m *Mapping) replyKeyboard() models.ReplyKeyboardMarkup {
+	var rows [][]models.KeyboardButton
+	for _, row := range m.Keyboard {
+		var buttons []models.KeyboardButton
+		for _, b := range row {
+			buttons = append(buttons, models.KeyboardButton{Text: b.Text})
+		}
+		rows = append(rows, buttons)
+	}
+
+	return models.ReplyKeyboardMarkup{Keyboard: rows, ResizeKeyboard: true}
+}
+
+// canPressButton checks if the sender of msg can press the button: the admin, or the members of the mapped group when
+// public_commands is enabled, like the /keyboard command
+func canPressButton(b *KeyboardButton, msg *models.Message) bool {
+	if isAdmin(msg.From) {
+		return true
+	}
+
+	return !b.AdminOnly && publicCommands
+}
+
+// handleKeyboardPress publishes the payload of the keyboard button pressed. Returns false if the message is not a button press.
+func handleKeyboardPress(msg *models.Message) bool {
+	mapping, ok := groupMapping(msg.Chat.ID)
+	if !ok {
+		return false
+	}
+
+	b := mapping.keyboardButton(msg.Text)
+	if b == nil {
+		return false
+	}
+
+	if !canPressButton(b, msg) {
+		telLog.Warn("Button %q pressed by %s without permission", b.Text, telegramSender(msg))
+		return true
+	}
+
+	if !allowFromTelegram(mapping, msg.Chat, msg.From) || !moderateMessage(mapping, msg, map[string]interface{}{"message": b.Text}) {
+		return true
+	}
+
+	topic := mqttTopic(b.Topic)
+	telLog.Info("Button %q pressed by %s, publishing to %s", b.Text, telegramSender(msg), topic)
+
+	err := getMQTTClient().Publish(MQTTMessage{Topic: topic, Payload: b.payloadBytes(), Retained: b.Retain})
+	if err != nil {
+		mqttLog.Error("Error publishing to %s: %s", topic, err)
+	}
+
+	return true
+}
+
+// keyboardCommand shows the reply keyboard of the chat mapping
+func keyboardCommand(msg *models.Message) string {
+	mapping, ok := groupMapping(msg.Chat.ID)
+	if !ok {
+		return translate(defaultLanguage, "not_mapped")
+	}
+
+	if len(mapping.Keyboard) == 0 {
+		return mapping.tr("keyboard_disabled", mapping.Topic)
+	}
+
+	_, err := sendTelegram(&bot.SendMessageParams{
+		ChatID:          msg.Chat.ID,
+		MessageThreadID: msg.MessageThreadID,
+		Text:            mapping.tr("keyboard"),
+		ReplyMarkup:     mapping.replyKeyboard(),
+	})
+	if err != nil {
+		telLog.Error("Error sending keyboard to %d: %s", msg.Chat.ID, err)
+	}
+
+	return ""
+}
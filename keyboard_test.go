@@ -0,0 +1,88 @@
+package main
+
+import (
+	"github.com/go-telegram/bot/models"
+	"testing"
+	"time"
+)
+
+func TestKeyboardPress(t *testing.T) {
+	newFakeTelegram(t)
+	broker := newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "home", Keyboard: [][]*KeyboardButton{{
+		{Text: "Lights on", Topic: "home/lights/set", Payload: "ON"},
+		{Text: "Open gate", Topic: "home/gate/set", Payload: map[string]interface{}{"state": "open"}, AdminOnly: true},
+	}}}
+	setupTestMappings(t, mapping)
+
+	previousAdmin, previousPublic := telegramAdminId, publicCommands
+	telegramAdminId = "7"
+	t.Cleanup(func() { telegramAdminId, publicCommands = previousAdmin, previousPublic })
+
+	admin := &models.User{ID: 7, FirstName: "Admin"}
+	member := &models.User{ID: 8, FirstName: "Member"}
+
+	tests := []struct {
+		name    string
+		public  bool
+		user    *models.User
+		text    string
+		payload string // Payload expected to be published, if any
+	}{
+		{"admin", false, admin, "Lights on", "ON"},
+		{"admin only button by the admin", false, admin, "Open gate", `{"state":"open"}`},
+		{"member without public commands", false, member, "Lights on", ""},
+		{"member with public commands", true, member, "Lights on", "ON"},
+		{"admin only button by a member", true, member, "Open gate", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			broker.Reset()
+			publicCommands = test.public
+
+			msg := &models.Message{Chat: models.Chat{ID: -100}, From: test.user, Text: test.text}
+			if !handleKeyboardPress(msg) {
+				t.Fatalf("expected %q handled as a button press", test.text)
+			}
+
+			published := broker.Published("")
+			if test.payload == "" {
+				if len(published) > 0 {
+					t.Errorf("expected nothing published, got %s to %s", published[0].Payload, published[0].Topic)
+				}
+				return
+			}
+
+			if len(published) != 1 || string(published[0].Payload) != test.payload {
+				t.Errorf("expected %s published, got %v", test.payload, published)
+			}
+		})
+	}
+
+	if handleKeyboardPress(&models.Message{Chat: models.Chat{ID: -100}, From: admin, Text: "Lights"}) {
+		t.Errorf("expected a message that is not a button not handled")
+	}
+}
+
+func TestKeyboardPressFlood(t *testing.T) {
+	newFakeTelegram(t)
+	broker := newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "home", Keyboard: [][]*KeyboardButton{{{Text: "Lights on", Topic: "home/lights/set", Payload: "ON"}}}}
+	setupTestMappings(t, mapping)
+
+	previousPublic := publicCommands
+	publicCommands = true
+	floodProtection = newFloodProtection(0.001, 3, time.Minute)
+	t.Cleanup(func() { publicCommands, floodProtection = previousPublic, nil })
+
+	for i := 1; i <= 5; i++ {
+		handleKeyboardPress(&models.Message{ID: i, Chat: models.Chat{ID: -100}, From: &models.User{ID: 42, FirstName: "Jane"}, Text: "Lights on"})
+	}
+
+	if published := broker.Published("home/lights/set"); len(published) != 3 {
+		t.Errorf("expected the 3 presses of the burst to be published, got %d", len(published))
+	}
+}
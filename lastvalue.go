@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-telegram/bot/models"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lastValuesFile persists the last value cache so it survives restarts
+var lastValuesFile = os.Getenv("last_values_file")
+
+// lastValuesSaveInterval is how often the last value cache is saved to the last_values_file, when changed
+const lastValuesSaveInterval = 30 * time.Second
+
+// lastValuesMax is the number of last values kept per mapping. The oldest ones are dropped, so wildcard mappings
+// receiving many topics do not grow the cache without limit.
+var lastValuesMax = getEnvInt("last_values_max", 1000)
+
+// lastValue is the most recent payload received on a topic
+type lastValue struct {
+	Mapping  string    `json:"mapping,omitempty"` // Topic of the mapping that received it
+	Topic    string    `json:"topic"`
+	Payload  string    `json:"payload"`
+	Time     time.Time `json:"time"`
+	Retained bool      `json:"retained"`
+}
+
+var lastValuesLock sync.Mutex
+var lastValues = map[string]lastValue{}
+var lastValuesChanged bool
+
+// recordLastValue stores the payload as the last value of the topic, dropping the oldest value of the mapping
+// when it has lastValuesMax values
+func recordLastValue(mapping *Mapping, topic string, payload []byte, retained bool) {
+	lastValuesLock.Lock()
+	defer lastValuesLock.Unlock()
+
+	if _, ok := lastValues[topic]; !ok && lastValuesMax > 0 {
+		count, oldest := 0, ""
+		for t, v := range lastValues {
+			if v.Mapping != mapping.Topic {
+				continue
+			}
+			count++
+			if oldest == "" || v.Time.Before(lastValues[oldest].Time) {
+				oldest = t
+			}
+		}
+
+		if count >= lastValuesMax {
+			delete(lastValues, oldest)
+		}
+	}
+
+	lastValues[topic] = lastValue{
+		Mapping:  mapping.Topic,
+		Topic:    topic,
+		Payload:  string(payload),
+		Time:     time.Now(),
+		Retained: retained,
+	}
+	lastValuesChanged = true
+}
+
+// filterLastValues returns the last values accepted by the match function, sorted by topic
+func filterLastValues(match func(topic string) bool, limit int) []lastValue {
+	lastValuesLock.Lock()
+	var values []lastValue
+	for topic, v := range lastValues {
+		if match(topic) {
+			values = append(values, v)
+		}
+	}
+	lastValuesLock.Unlock()
+
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].Topic < values[j].Topic
+	})
+
+	if limit > 0 && len(values) > limit {
+		values = values[:limit]
+	}
+
+	return values
+}
+
+// findLastValues returns the last values of the topics containing all the words of the query, sorted by topic
+func findLastValues(query string, limit int) []lastValue {
+	words := strings.Fields(strings.ToLower(query))
+
+	return filterLastValues(func(topic string) bool {
+		for _, w := range words {
+			if !strings.Contains(strings.ToLower(topic), w) {
+				return false
+			}
+		}
+		return true
+	}, limit)
+}
+
+func saveLastValues() {
+	lastValuesLock.Lock()
+	if !lastValuesChanged {
+		lastValuesLock.Unlock()
+		return
+	}
+	data, _ := json.MarshalIndent(lastValues, "", "  ")
+	lastValuesChanged = false
+	lastValuesLock.Unlock()
+
+	tmpFile := lastValuesFile + ".tmp"
+	err := ioutil.WriteFile(tmpFile, data, 0600)
+	if err != nil {
+		mqttLog.Error("Error saving last values to %s: %s", lastValuesFile, err)
+		return
+	}
+
+	err = os.Rename(tmpFile, lastValuesFile)
+	if err != nil {
+		mqttLog.Error("Error saving last values to %s: %s", lastValuesFile, err)
+	}
+}
+
+// loadLastValues loads the last value cache from the last_values_file and saves it periodically
+func loadLastValues() {
+	if lastValuesFile == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(lastValuesFile)
+	if err != nil && !os.IsNotExist(err) {
+		mqttLog.Error("Error reading last values from %s: %s", lastValuesFile, err)
+	}
+
+	if err == nil {
+		lastValuesLock.Lock()
+		err = json.Unmarshal(data, &lastValues)
+		lastValuesLock.Unlock()
+		if err != nil {
+			mqttLog.Error("Error parsing last values from %s: %s", lastValuesFile, err)
+		} else {
+			mqttLog.Info("Loaded %d last values from %s", len(lastValues), lastValuesFile)
+		}
+	}
+
+	go func() {
+		for range time.Tick(lastValuesSaveInterval) {
+			saveLastValues()
+		}
+	}()
+}
+
+// formatLastValue formats a last value with its age
+func formatLastValue(v lastValue) string {
+	return fmt.Sprintf("%s: %s (%s ago)", v.Topic, truncate(v.Payload, 200), time.Since(v.Time).Truncate(time.Second))
+}
+
+// getCommand replies the last values received on a topic, which can have wildcards. Group members can only get the topics of their mapping.
+func getCommand(msg *models.Message) string {
+	filter := strings.TrimSpace(commandArguments(msg))
+	mapping, mapped := groupMapping(msg.Chat.ID)
+	lang := chatLanguage(msg.Chat.ID)
+
+	if filter == "" {
+		if !mapped {
+			return translate(lang, "get_usage")
+		}
+		filter = mapping.Topic
+	}
+
+	values := filterLastValues(func(topic string) bool {
+		if !isAdmin(msg.From) && !topicMatches(mapping.Topic, topic) {
+			return false
+		}
+		return topicMatches(filter, topic)
+	}, 20)
+
+	if len(values) == 0 {
+		return translate(lang, "get_no_value", filter)
+	}
+
+	var lines []string
+	for _, v := range values {
+		lines = append(lines, formatLastValue(v))
+	}
+
+	return strings.Join(lines, "\n")
+}
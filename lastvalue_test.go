@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLastValuesMax(t *testing.T) {
+	previous, previousMax := lastValues, lastValuesMax
+	lastValues, lastValuesMax = map[string]lastValue{}, 3
+	t.Cleanup(func() { lastValues, lastValuesMax = previous, previousMax })
+
+	sensors := &Mapping{Topic: "sensors/+"}
+	doors := &Mapping{Topic: "doors/+"}
+
+	recordLastValue(doors, "doors/front", []byte("open"), false)
+	for i := 0; i < 5; i++ {
+		recordLastValue(sensors, fmt.Sprintf("sensors/%d", i), []byte("23.5"), false)
+	}
+	recordLastValue(sensors, "sensors/4", []byte("24"), false)
+
+	if _, ok := lastValues["sensors/0"]; ok {
+		t.Errorf("expected the oldest values of the mapping to be dropped")
+	}
+	if v := lastValues["sensors/4"]; v.Payload != "24" {
+		t.Errorf("expected the last value to be updated, got %+v", v)
+	}
+	if _, ok := lastValues["doors/front"]; !ok {
+		t.Errorf("expected the values of the other mappings to be kept")
+	}
+	if len(lastValues) != 4 {
+		t.Errorf("expected 3 values of the mapping and 1 of the other, got %d", len(lastValues))
+	}
+}
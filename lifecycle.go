@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// adminFailureThreshold is the number of consecutive delivery failures of a mapping before the admin is notified
+var adminFailureThreshold = getEnvInt("admin_failure_threshold", 5)
+
+var mqttConnections = 0
+var mqttConnectionsLock = sync.Mutex{}
+
+func onMQTTConnect() {
+	mqttConnectionsLock.Lock()
+	mqttConnections++
+	reconnect := mqttConnections > 1
+	mqttConnectionsLock.Unlock()
+
+	if reconnect {
+		mqttLog.Info("Reconnected")
+		go notifyAdmin("MQTT reconnected")
+	}
+}
+
+func onMQTTConnectionLost(err error) {
+	mqttLog.Warn("Connection lost: %s", err)
+	go notifyAdmin(fmt.Sprintf("MQTT connection lost: %s", err))
+}
+
+// trackDelivery counts consecutive delivery failures of the mapping, notifying the admin when
+// they reach admin_failure_threshold and when deliveries recover
+func (m *Mapping) trackDelivery(err error) {
+	m.lock.Lock()
+	failures := m.failures
+	if err != nil {
+		m.failures++
+		m.lastError = mappingError{Error: err.Error(), Time: time.Now()}
+	} else {
+		m.failures = 0
+	}
+	m.lock.Unlock()
+
+	if err != nil && failures+1 == adminFailureThreshold {
+		go notifyAdmin(fmt.Sprintf("Messages from topic %s failed %d times in a row: %s", m.Topic, adminFailureThreshold, err))
+		reportError(fmt.Errorf("delivery failed %d times in a row: %s", adminFailureThreshold, err), map[string]string{"topic": m.Topic})
+	}
+
+	if err == nil && failures >= adminFailureThreshold {
+		go notifyAdmin(fmt.Sprintf("Messages from topic %s are being delivered again", m.Topic))
+	}
+}
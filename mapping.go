@@ -0,0 +1,473 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-telegram/bot/models"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Retained message policies
+const (
+	RetainedForward = "forward" // Forward retained messages as any other message (default)
+	RetainedIgnore  = "ignore"  // Never forward retained messages
+	RetainedMark    = "mark"    // Forward retained messages with a "(retained)" mark
+	RetainedFirst   = "first"   // Forward only the first retained message since start
+)
+
+// Mapping represents a link between a Telegram Group and a MQTT Topic
+type Mapping struct {
+	GroupID   int64    `json:"group_id"`
+	Topic     string   `json:"topic"`
+	MessageTo string   `json:"message_to"`
+	MaxAge    Duration `json:"max_age"`  // Messages older than this are discarded. Zero means no limit
+	Retained  string   `json:"retained"` // Retained message policy: forward, ignore, mark or first
+
+	DedupWindow  Duration `json:"dedup_window"`  // Identical messages inside this window are forwarded only once
+	DedupSummary bool     `json:"dedup_summary"` // Send a "(repeated N times)" message when the dedup window closes
+	Cooldown     Duration `json:"cooldown"`      // After an alert, messages of the same topic are suppressed for this long
+	CooldownBy   string   `json:"cooldown_by"`   // What alerts are suppressed by the cooldown: topic (default) or message, for identical ones
+
+	ExpectedInterval Duration `json:"expected_interval"` // Notify when a topic has no messages for longer than this, like a dead sensor
+
+	Sinks    []*SinkConfig `json:"sinks"`    // Where messages are delivered. Defaults to the Telegram group
+	Fallback *SinkConfig   `json:"fallback"` // Sink used when any of the sinks fail
+	Retries  int           `json:"retries"`  // Times a failed send to a sink is retried, with exponential backoff
+	Template string        `json:"template"` // text/template used to render messages in the sinks
+	Priority string        `json:"priority"` // Queue priority of the messages without a priority: high, normal (default) or low
+	DMUsers  []int64       `json:"dm_users"` // Telegram users that messages can be sent to in private, with the user_id payload field
+
+	Transform *TransformConfig `json:"transform"` // External command that can rewrite, route or drop messages
+
+	Moderation *ModerationConfig `json:"moderation"` // Blocklist and classifier of the Telegram messages published to MQTT
+
+	Acknowledge *AckConfig `json:"acknowledge"` // Send the critical messages with an Acknowledge button, escalating them when not acknowledged
+
+	Devices *DevicesConfig `json:"devices"` // Track the online status of devices, notifying the ones offline
+
+	CloudEvents    bool   `json:"cloudevents"`     // Publish Telegram messages to MQTT as CloudEvents
+	OutboundSchema string `json:"outbound_schema"` // Payload schema of the Telegram messages published to MQTT: v1 (default) or v2
+
+	Codec       string            `json:"codec"`        // Payload codec: json (default), cbor or protobuf
+	CodecFields map[string]string `json:"codec_fields"` // Renames decoded fields, like {"1": "message"} for protobuf
+	Fields      map[string]string `json:"fields"`       // gjson selectors of payload fields, like {"message": "state.text"}
+	Profile     string            `json:"profile"`      // Formatter of device payloads: zigbee2mqtt, tasmota or esphome
+
+	EncryptionKey string `json:"encryption_key"` // AES-GCM pre-shared key (hex or base64) for payloads in both directions
+
+	SigningKey      string `json:"signing_key"`      // HMAC-SHA256 key used to verify incoming and sign outgoing payloads
+	SignaturePolicy string `json:"signature_policy"` // What to do with unsigned or invalid messages: reject (default) or flag
+
+	AuthToken    string            `json:"auth_token"`    // Shared secret required in the token field of the payloads
+	DeviceTokens map[string]string `json:"device_tokens"` // Token of each device, by the payload from, replacing the auth_token
+
+	OutboundTopic   string `json:"outbound_topic"`    // Topic where Telegram messages are published. Defaults to {topic}_msg
+	ErrorTopic      string `json:"error_topic"`       // Topic where processing errors are published. Defaults to {topic}_error
+	DeadLetterTopic string `json:"dead_letter_topic"` // Topic where messages that permanently failed are published. Defaults to the dead_letter_topic environment variable
+	OutboundRetain  bool   `json:"outbound_retain"`   // Publish Telegram messages with the retain flag
+	CallbackTopic   string `json:"callback_topic"`    // Topic where inline button presses are published. Defaults to {topic}_callback
+	OwnTracksTopic  string `json:"owntracks_topic"`   // Topic where Telegram locations are published as OwnTracks, like owntracks/{user}/telegram
+
+	Timestamp       string `json:"timestamp"`        // Add the message time to the message: prefix or append. Disabled by default
+	TimestampFormat string `json:"timestamp_format"` // Go time layout of the timestamp. Defaults to 2006-01-02 15:04:05
+	Timezone        string `json:"timezone"`         // IANA timezone of the timestamp. Defaults to the timezone environment variable
+
+	Language string `json:"language"` // Language of the bot texts, like pt. Defaults to the language environment variable
+
+	TelegramOptions // Options of the messages sent to the Telegram group
+
+	Keyboard [][]*KeyboardButton `json:"keyboard"` // Rows of the reply keyboard shown by /keyboard
+
+	BinaryImage  bool   `json:"binary_image"`  // Send raw image payloads (JPEG, PNG, ...) to Telegram as photos
+	ImageCaption string `json:"image_caption"` // text/template of the photo caption. Defaults to the topic
+
+	ChartField  string   `json:"chart_field"`  // Numeric payload field buffered for /graph and chart messages
+	ChartWindow Duration `json:"chart_window"` // How long chart values are kept. Defaults to 24h
+
+	Thresholds []*ThresholdConfig `json:"thresholds"` // Alerts generated from numeric payload fields
+
+	Frigate *FrigateConfig `json:"frigate"` // Handle the payloads as Frigate events
+
+	Summary *SummaryConfig `json:"summary"` // Periodic digest of the mapping activity
+
+	lock         sync.Mutex
+	retainedSeen bool
+	dedup        map[string]*dedupEntry
+	cooldowns    map[string]*cooldownEntry
+	watchdogs    map[string]*watchdogState
+	sinks        []Sink
+	fallback     Sink
+	template     *template.Template
+	imageCaption *template.Template
+	codec        Codec
+	profile      Profile
+	key          []byte
+	failures     int
+	mutedUntil   time.Time
+	mutedCount   int
+	muteTimer    *time.Timer
+	location     *time.Location
+	series       []chartPoint
+	lastError    mappingError
+}
+
+// setup validates the mapping options and creates its sinks
+func (m *Mapping) setup() error {
+	switch m.Retained {
+	case "", RetainedForward, RetainedIgnore, RetainedMark, RetainedFirst:
+	default:
+		return fmt.Errorf("invalid retained policy %q", m.Retained)
+	}
+
+	switch m.SignaturePolicy {
+	case "", SignatureReject, SignatureFlag:
+	default:
+		return fmt.Errorf("invalid signature policy %q", m.SignaturePolicy)
+	}
+
+	if m.OutboundTopic == "" {
+		m.OutboundTopic = "{topic}_msg"
+	}
+
+	if m.ErrorTopic == "" {
+		m.ErrorTopic = "{topic}_error"
+	}
+
+	if m.CallbackTopic == "" {
+		m.CallbackTopic = "{topic}_callback"
+	}
+
+	if m.DeadLetterTopic == "" {
+		m.DeadLetterTopic = deadLetterTopic
+	}
+
+	if m.Retries < 0 {
+		return fmt.Errorf("invalid retries %d", m.Retries)
+	}
+
+	if m.Priority != "" && priorityLane(m.Priority) == -1 {
+		return fmt.Errorf("invalid priority %q", m.Priority)
+	}
+
+	if m.Language != "" && messageCatalogs[m.Language] == nil {
+		return fmt.Errorf("invalid language %q, no message catalog", m.Language)
+	}
+
+	if err := m.setupTimestamp(); err != nil {
+		return err
+	}
+
+	if err := m.TelegramOptions.validate(); err != nil {
+		return err
+	}
+
+	if err := m.setupOutboundSchema(); err != nil {
+		return err
+	}
+
+	if err := m.setupCooldown(); err != nil {
+		return err
+	}
+
+	if m.ExpectedInterval.Duration < 0 {
+		return fmt.Errorf("invalid expected_interval %s", m.ExpectedInterval)
+	}
+
+	if m.EncryptionKey != "" {
+		key, err := parseKey(m.EncryptionKey)
+		if err != nil {
+			return fmt.Errorf("invalid encryption_key: %s", err)
+		}
+		m.key = key
+	}
+
+	codec, err := getCodec(m.Codec)
+	if err != nil {
+		return err
+	}
+	m.codec = codec
+
+	if m.profile, err = getProfile(m.Profile); err != nil {
+		return err
+	}
+
+	if m.Transform != nil && len(m.Transform.Command) == 0 {
+		return fmt.Errorf("transform requires a command")
+	}
+
+	if m.Moderation != nil {
+		if err := m.Moderation.setup(); err != nil {
+			return err
+		}
+	}
+
+	if m.Acknowledge != nil {
+		if err := m.Acknowledge.setup(); err != nil {
+			return err
+		}
+	}
+
+	if m.Devices != nil {
+		if err := m.Devices.setup(); err != nil {
+			return err
+		}
+	}
+
+	if m.Template != "" {
+		t, err := parseTemplate(m.Topic, m.Template)
+		if err != nil {
+			return fmt.Errorf("invalid template: %s", err)
+		}
+		m.template = t
+	}
+
+	if m.ImageCaption != "" {
+		t, err := parseTemplate(m.Topic+"_caption", m.ImageCaption)
+		if err != nil {
+			return fmt.Errorf("invalid image_caption: %s", err)
+		}
+		m.imageCaption = t
+	}
+
+	if err := m.setupKeyboard(); err != nil {
+		return err
+	}
+
+	if m.Frigate != nil {
+		if m.Frigate.URL == "" {
+			return fmt.Errorf("frigate requires url")
+		}
+		m.Frigate.sent = map[string]time.Time{}
+	}
+
+	for _, c := range m.Thresholds {
+		if err := c.setup(m.Topic); err != nil {
+			return err
+		}
+	}
+
+	if m.Summary != nil {
+		if err := m.Summary.setup(m.Topic); err != nil {
+			return err
+		}
+	}
+
+	if len(m.Sinks) == 0 {
+		m.Sinks = []*SinkConfig{{Type: SinkTelegram, ChatID: m.GroupID, TelegramOptions: m.TelegramOptions}}
+	}
+
+	m.sinks = nil
+	for _, c := range m.Sinks {
+		s, err := c.newSink()
+		if err != nil {
+			return err
+		}
+		m.sinks = append(m.sinks, s)
+	}
+
+	if m.Fallback != nil {
+		s, err := m.Fallback.newSink()
+		if err != nil {
+			return fmt.Errorf("invalid fallback: %s", err)
+		}
+		m.fallback = s
+	}
+
+	return nil
+}
+
+// expandTopic replaces {topic} in a topic pattern
+func expandTopic(pattern, topic string) string {
+	return strings.Replace(pattern, "{topic}", topic, -1)
+}
+
+// topicLevel makes a value safe to be a topic level, replacing the separators and wildcards
+var topicLevel = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+
+// expandMessageTopic replaces {topic} and the placeholders of the Telegram message in a topic pattern: {chat_id},
+// {user_id}, {username} (or the user id, for users without username) and {thread_id} (0 outside forum topics)
+func expandMessageTopic(pattern, topic string, msg *models.Message) string {
+	pattern = expandTopic(pattern, topic)
+	if msg == nil || !strings.Contains(pattern, "{") {
+		return pattern
+	}
+
+	username, userID := "telegram", "0"
+	if msg.From != nil {
+		userID = strconv.FormatInt(msg.From.ID, 10)
+		username = msg.From.Username
+		if username == "" {
+			username = userID
+		}
+	}
+
+	threadID := 0
+	if msg.IsTopicMessage {
+		threadID = msg.MessageThreadID
+	}
+
+	return strings.NewReplacer(
+		"{chat_id}", strconv.FormatInt(msg.Chat.ID, 10),
+		"{user_id}", userID,
+		"{username}", topicLevel.Replace(username),
+		"{user}", topicLevel.Replace(username),
+		"{thread_id}", strconv.Itoa(threadID),
+	).Replace(pattern)
+}
+
+// outboundTopic returns the broker topic where the Telegram message msg of the mapping is published
+func (m *Mapping) outboundTopic(msg *models.Message) string {
+	return mqttTopic(expandMessageTopic(m.OutboundTopic, m.Topic, msg))
+}
+
+// telegramSink returns the sink of the mapping group, used for the photos, stickers and other direct sends
+func (m *Mapping) telegramSink() *TelegramSink {
+	return &TelegramSink{ChatID: m.GroupID, Options: m.TelegramOptions}
+}
+
+// callbackTopic returns the broker topic where the inline button presses of msg are published
+func (m *Mapping) callbackTopic(msg *models.Message) string {
+	return mqttTopic(expandMessageTopic(m.CallbackTopic, m.Topic, msg))
+}
+
+// acceptRetained returns if a retained message should be forwarded according to the mapping policy
+func (m *Mapping) acceptRetained() bool {
+	switch m.Retained {
+	case RetainedIgnore:
+		return false
+	case RetainedFirst:
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		if m.retainedSeen {
+			return false
+		}
+		m.retainedSeen = true
+	}
+
+	return true
+}
+
+// mappingsLock guards groupMappings and topicMappings, that get new mappings while running by the auto provisioning
+var mappingsLock = sync.RWMutex{}
+var groupMappings = map[int64]*Mapping{}
+var topicMappings = map[string]*Mapping{}
+
+// groupMapping returns the mapping of a Telegram chat
+func groupMapping(chat int64) (*Mapping, bool) {
+	mappingsLock.RLock()
+	defer mappingsLock.RUnlock()
+
+	m, ok := groupMappings[chat]
+	return m, ok
+}
+
+// topicMapping returns the mapping of a topic
+func topicMapping(topic string) (*Mapping, bool) {
+	mappingsLock.RLock()
+	defer mappingsLock.RUnlock()
+
+	m, ok := topicMappings[topic]
+	return m, ok
+}
+
+// listGroupMappings returns a copy of the mappings by chat, to be iterated without holding the lock
+func listGroupMappings() map[int64]*Mapping {
+	mappingsLock.RLock()
+	defer mappingsLock.RUnlock()
+
+	mappings := make(map[int64]*Mapping, len(groupMappings))
+	for chat, m := range groupMappings {
+		mappings[chat] = m
+	}
+	return mappings
+}
+
+// listTopicMappings returns a copy of the mappings by topic, to be iterated without holding the lock
+func listTopicMappings() map[string]*Mapping {
+	mappingsLock.RLock()
+	defer mappingsLock.RUnlock()
+
+	mappings := make(map[string]*Mapping, len(topicMappings))
+	for topic, m := range topicMappings {
+		mappings[topic] = m
+	}
+	return mappings
+}
+
+// parseGroupToTopic parses the group_to_topic syntax: groupId:mqttTopic:messageTo;groupId2:mqttTopic2:messageTo2
+func parseGroupToTopic(groupToTopic string) ([]*Mapping, error) {
+	var mappings []*Mapping
+
+	for _, m := range strings.Split(groupToTopic, ";") {
+		if m == "" {
+			continue
+		}
+
+		z := strings.Split(m, ":")
+		if len(z) < 2 {
+			return nil, fmt.Errorf("invalid mapping %q: expected groupId:mqttTopic[:messageTo]", m)
+		}
+
+		group, err := strconv.ParseInt(z[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid group id in mapping %q: %s", m, err)
+		}
+
+		if group == 0 {
+			return nil, fmt.Errorf("invalid group id in mapping %q: must not be zero", m)
+		}
+
+		mapping := &Mapping{
+			GroupID: group,
+			Topic:   z[1],
+		}
+
+		if len(z) > 2 {
+			mapping.MessageTo = z[2]
+		}
+
+		mappings = append(mappings, mapping)
+	}
+
+	return mappings, nil
+}
+
+// loadMappings parses the group_to_topic mappings and the config file mappings, validating all of them
+func loadMappings() ([]*Mapping, error) {
+	mappings, err := parseGroupToTopic(groupToTopic)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing group_to_topic: %s", err)
+	}
+
+	mappings = append(mappings, config.Mappings...)
+
+	provisioned, err := loadProvisionedMappings()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range mappings {
+		if err := m.setup(); err != nil {
+			return nil, fmt.Errorf("invalid mapping for topic %s: %s", m.Topic, err)
+		}
+	}
+
+	return append(mappings, provisioned...), nil
+}
+
+func addMapping(mapping *Mapping) {
+	mqttLog.Info("Mapping Telegram Group %d to MQTT Topic %s", mapping.GroupID, mapping.Topic)
+
+	if mapping.MessageTo == "" {
+		mqttLog.Warn("Topic %s does not have a third argument which represents the message to.", mapping.Topic)
+	}
+
+	mappingsLock.Lock()
+	defer mappingsLock.Unlock()
+
+	groupMappings[mapping.GroupID] = mapping
+	topicMappings[mapping.Topic] = mapping
+}
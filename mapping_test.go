@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseGroupToTopic(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []*Mapping
+		error    bool
+	}{
+		{name: "empty", input: ""},
+		{
+			name:     "single",
+			input:    "-100:home/kitchen:house",
+			expected: []*Mapping{{GroupID: -100, Topic: "home/kitchen", MessageTo: "house"}},
+		},
+		{
+			name:     "without message to",
+			input:    "-100:home/kitchen",
+			expected: []*Mapping{{GroupID: -100, Topic: "home/kitchen"}},
+		},
+		{
+			name:  "many with trailing separator",
+			input: "-100:home/kitchen:house;200:home/garage:car;",
+			expected: []*Mapping{
+				{GroupID: -100, Topic: "home/kitchen", MessageTo: "house"},
+				{GroupID: 200, Topic: "home/garage", MessageTo: "car"},
+			},
+		},
+		{name: "missing topic", input: "-100", error: true},
+		{name: "invalid group", input: "group:home/kitchen:house", error: true},
+		{name: "zero group", input: "0:home/kitchen:house", error: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mappings, err := parseGroupToTopic(test.input)
+			if test.error {
+				if err == nil {
+					t.Fatalf("expected error, got %d mappings", len(mappings))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if len(mappings) != len(test.expected) {
+				t.Fatalf("expected %d mappings, got %d", len(test.expected), len(mappings))
+			}
+
+			for i, m := range mappings {
+				e := test.expected[i]
+				if m.GroupID != e.GroupID || m.Topic != e.Topic || m.MessageTo != e.MessageTo {
+					t.Errorf("mapping %d: expected %d:%s:%s, got %d:%s:%s", i, e.GroupID, e.Topic, e.MessageTo, m.GroupID, m.Topic, m.MessageTo)
+				}
+			}
+		})
+	}
+}
+
+func TestMappingSetup(t *testing.T) {
+	tests := []struct {
+		name  string
+		json  string
+		error bool
+		check func(t *testing.T, m *Mapping)
+	}{
+		{
+			name: "defaults",
+			json: `{"group_id": -100, "topic": "home/kitchen"}`,
+			check: func(t *testing.T, m *Mapping) {
+				if m.outboundTopic(nil) != "home/kitchen_msg" || m.callbackTopic(nil) != "home/kitchen_callback" || m.ErrorTopic != "{topic}_error" {
+					t.Errorf("unexpected default topics %s, %s and %s", m.outboundTopic(nil), m.callbackTopic(nil), m.ErrorTopic)
+				}
+				if len(m.sinks) != 1 || !reflect.DeepEqual(m.sinks[0], &TelegramSink{ChatID: -100}) {
+					t.Errorf("expected a single telegram sink to the group, got %v", m.sinks)
+				}
+			},
+		},
+		{
+			name: "custom topics and durations",
+			json: `{"group_id": -100, "topic": "home/kitchen", "outbound_topic": "out/{topic}", "max_age": "5m", "dedup_window": 30}`,
+			check: func(t *testing.T, m *Mapping) {
+				if m.outboundTopic(nil) != "out/home/kitchen" {
+					t.Errorf("expected outbound topic out/home/kitchen, got %s", m.outboundTopic(nil))
+				}
+				if m.MaxAge.Minutes() != 5 || m.DedupWindow.Seconds() != 30 {
+					t.Errorf("unexpected durations %s and %s", m.MaxAge, m.DedupWindow)
+				}
+			},
+		},
+		{
+			name: "sinks",
+			json: `{"group_id": -100, "topic": "t", "sinks": [{"type": "telegram", "chat_id": -200}, {"type": "webhook", "url": "http://localhost", "rate_limit": 1}]}`,
+			check: func(t *testing.T, m *Mapping) {
+				if len(m.sinks) != 2 {
+					t.Fatalf("expected 2 sinks, got %d", len(m.sinks))
+				}
+				if _, ok := m.sinks[1].(*rateLimitedSink); !ok {
+					t.Errorf("expected rate limited webhook sink, got %T", m.sinks[1])
+				}
+			},
+		},
+		{
+			name: "template",
+			json: `{"group_id": -100, "topic": "t", "template": "{{.From}}: {{.Message}}"}`,
+			check: func(t *testing.T, m *Mapping) {
+				if m.template == nil {
+					t.Errorf("expected template to be compiled")
+				}
+			},
+		},
+		{name: "invalid retained policy", json: `{"topic": "t", "retained": "sometimes"}`, error: true},
+		{name: "invalid signature policy", json: `{"topic": "t", "signature_policy": "maybe"}`, error: true},
+		{name: "invalid language", json: `{"topic": "t", "language": "xx"}`, error: true},
+		{name: "invalid codec", json: `{"topic": "t", "codec": "xml"}`, error: true},
+		{name: "invalid template", json: `{"topic": "t", "template": "{{.From"}`, error: true},
+		{name: "invalid sink", json: `{"topic": "t", "sinks": [{"type": "webhook"}]}`, error: true},
+		{name: "invalid fallback", json: `{"group_id": -100, "topic": "t", "fallback": {"type": "pigeon"}}`, error: true},
+		{name: "transform without command", json: `{"topic": "t", "transform": {}}`, error: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var m Mapping
+			if err := json.Unmarshal([]byte(test.json), &m); err != nil {
+				t.Fatalf("invalid mapping json: %s", err)
+			}
+
+			err := m.setup()
+			if test.error {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			test.check(t, &m)
+		})
+	}
+}
+
+func TestLoadMappings(t *testing.T) {
+	previousGroupToTopic, previousConfig := groupToTopic, config
+	t.Cleanup(func() { groupToTopic, config = previousGroupToTopic, previousConfig })
+
+	groupToTopic = "-100:home/kitchen:house"
+	config = Config{Mappings: []*Mapping{{GroupID: -200, Topic: "home/garage", MessageTo: "car"}}}
+
+	mappings, err := loadMappings()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if len(mappings) != 2 || mappings[0].Topic != "home/kitchen" || mappings[1].Topic != "home/garage" {
+		t.Fatalf("expected environment and config mappings, got %v", mappings)
+	}
+
+	config.Mappings = []*Mapping{{GroupID: -200, Topic: "home/garage", Retained: "sometimes"}}
+	if _, err := loadMappings(); err == nil {
+		t.Errorf("expected error for invalid config mapping")
+	}
+}
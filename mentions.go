@@ -0,0 +1,91 @@
+package main
+
+import (
+	"github.com/go-telegram/bot/models"
+	"strings"
+	"sync"
+	"unicode/utf16"
+)
+
+var knownUsersLock = sync.Mutex{}
+
+// knownUsers are the users seen in the mapped chats by lowercase username, to resolve the @mentions into user ids
+var knownUsers = map[string]models.User{}
+
+// recordUser remembers a user seen in a mapped chat
+func recordUser(user *models.User) {
+	if user == nil || user.Username == "" {
+		return
+	}
+
+	knownUsersLock.Lock()
+	knownUsers[strings.ToLower(user.Username)] = *user
+	knownUsersLock.Unlock()
+}
+
+// lookupUser returns a user seen in the mapped chats by username
+func lookupUser(username string) (models.User, bool) {
+	knownUsersLock.Lock()
+	defer knownUsersLock.Unlock()
+
+	user, ok := knownUsers[strings.ToLower(username)]
+	return user, ok
+}
+
+// entityText returns the text of an entity. Entity offsets and lengths are in UTF-16 code units.
+func entityText(text []uint16, entity models.MessageEntity) string {
+	if entity.Offset < 0 || entity.Length < 0 || entity.Offset+entity.Length > len(text) {
+		return ""
+	}
+
+	return string(utf16.Decode(text[entity.Offset : entity.Offset+entity.Length]))
+}
+
+// mentionData returns the payload of a mentioned user
+func mentionData(user models.User) map[string]interface{} {
+	mention := map[string]interface{}{
+		"id":   user.ID,
+		"name": strings.TrimSpace(user.FirstName + " " + user.LastName),
+	}
+	if user.Username != "" {
+		mention["username"] = user.Username
+	}
+
+	return mention
+}
+
+// mentionsData returns the users mentioned in the text or caption of a message: @username mentions, with the
+// user id when the user was seen by the bridge, and text mentions of users without username
+func mentionsData(msg *models.Message) []map[string]interface{} {
+	var mentions []map[string]interface{}
+
+	add := func(text string, entities []models.MessageEntity) {
+		encoded := utf16.Encode([]rune(text))
+
+		for _, entity := range entities {
+			switch entity.Type {
+			case models.MessageEntityTypeMention:
+				username := strings.TrimPrefix(entityText(encoded, entity), "@")
+				if username == "" {
+					continue
+				}
+				if user, ok := lookupUser(username); ok {
+					mentions = append(mentions, mentionData(user))
+				} else {
+					mentions = append(mentions, map[string]interface{}{"username": username})
+				}
+			case models.MessageEntityTypeTextMention:
+				if entity.User != nil {
+					mention := mentionData(*entity.User)
+					mention["text"] = entityText(encoded, entity)
+					mentions = append(mentions, mention)
+				}
+			}
+		}
+	}
+
+	add(msg.Text, msg.Entities)
+	add(msg.Caption, msg.CaptionEntities)
+
+	return mentions
+}
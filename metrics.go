@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var metricsListen = os.Getenv("metrics_listen")
+
+var httpLog = newLogger("HTTP")
+
+// CounterVec is a set of counters partitioned by label values, exported in the Prometheus text format
+type CounterVec struct {
+	Name   string
+	Help   string
+	Labels []string
+
+	lock   sync.Mutex
+	values map[string]uint64
+}
+
+var metrics []*CounterVec
+
+var mqttMessages = NewCounterVec("mqtttelegram_mqtt_messages_total", "MQTT messages received by mapping topic and result", "topic", "result")
+var telegramReceived = NewCounterVec("mqtttelegram_telegram_messages_total", "Telegram messages published to MQTT by mapping topic", "topic")
+
+// NewCounterVec creates and registers a counter
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{
+		Name:   name,
+		Help:   help,
+		Labels: labels,
+		values: map[string]uint64{},
+	}
+	metrics = append(metrics, c)
+	return c
+}
+
+// Inc increments the counter with the specified label values
+func (c *CounterVec) Inc(values ...string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.values[strings.Join(values, "\xff")]++
+}
+
+// Each calls f for every label values combination, sorted by label values
+func (c *CounterVec) Each(f func(values []string, count uint64)) {
+	c.lock.Lock()
+	keys := make([]string, 0, len(c.values))
+	for k := range c.values {
+		keys = append(keys, k)
+	}
+	counts := make(map[string]uint64, len(c.values))
+	for k, v := range c.values {
+		counts[k] = v
+	}
+	c.lock.Unlock()
+
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		f(strings.Split(k, "\xff"), counts[k])
+	}
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", c.Name, c.Help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", c.Name)
+
+	c.Each(func(values []string, count uint64) {
+		var labels []string
+		for i, name := range c.Labels {
+			labels = append(labels, fmt.Sprintf("%s=%q", name, values[i]))
+		}
+		fmt.Fprintf(w, "%s{%s} %d\n", c.Name, strings.Join(labels, ","), count)
+	})
+}
+
+// GaugeFunc is a gauge read from value on every scrape
+type GaugeFunc struct {
+	Name  string
+	Help  string
+	value func() float64
+}
+
+var gauges []*GaugeFunc
+
+// NewGaugeFunc creates and registers a gauge
+func NewGaugeFunc(name, help string, value func() float64) *GaugeFunc {
+	g := &GaugeFunc{Name: name, Help: help, value: value}
+	gauges = append(gauges, g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", g.Name, g.Help)
+	fmt.Fprintf(w, "# TYPE %s gauge\n", g.Name)
+	fmt.Fprintf(w, "%s %g\n", g.Name, g.value())
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, c := range metrics {
+		c.write(w)
+	}
+	for _, g := range gauges {
+		g.write(w)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/go-telegram/bot/models"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// Moderation actions, what to do with the messages matching the blocklist or flagged by the classifier
+const (
+	ModerationAllow  = "allow"
+	ModerationReject = "reject" // Don't publish the message (default)
+	ModerationRedact = "redact" // Publish the message with the blocked text replaced
+)
+
+const defaultModerationTimeout = 5 * time.Second
+
+const defaultRedaction = "***"
+
+// moderatedFields are the data fields with the user text, moderated before publishing
+var moderatedFields = []string{"message", "caption", "transcript"}
+
+var moderated = NewCounterVec("mqtttelegram_moderated_total", "Telegram messages rejected or redacted by the moderation, by mapping topic and action", "topic", "action")
+
+// ModerationConfig filters the Telegram messages of a mapping before they are published to MQTT, with a regex blocklist
+// and an external HTTP classifier
+type ModerationConfig struct {
+	Blocklist   []string          `json:"blocklist"`   // Regular expressions of blocked text, like (?i)badword
+	Action      string            `json:"action"`      // What to do with blocklist matches: reject (default) or redact
+	Replacement string            `json:"replacement"` // Text replacing the redacted matches. Defaults to ***
+	URL         string            `json:"url"`         // Classifier receiving the messages as JSON
+	Headers     map[string]string `json:"headers"`     // Headers of the classifier requests, like Authorization
+	Timeout     Duration          `json:"timeout"`     // Timeout of the classifier requests. Defaults to 5s
+	FailOpen    bool              `json:"fail_open"`   // Publish the messages when the classifier fails, instead of rejecting them
+
+	blocklist []*regexp.Regexp
+}
+
+type moderationRequest struct {
+	Topic  string            `json:"topic"`
+	ChatID int64             `json:"chat_id"`
+	From   string            `json:"from"`
+	Fields map[string]string `json:"fields"` // Text fields of the message, like message and caption
+}
+
+type moderationResponse struct {
+	Action string            `json:"action"` // allow, reject or redact
+	Fields map[string]string `json:"fields"` // Redacted text fields, replacing the original ones
+}
+
+func (c *ModerationConfig) setup() error {
+	switch c.Action {
+	case "":
+		c.Action = ModerationReject
+	case ModerationReject, ModerationRedact:
+	default:
+		return fmt.Errorf("invalid moderation action %q", c.Action)
+	}
+
+	if c.Replacement == "" {
+		c.Replacement = defaultRedaction
+	}
+
+	c.blocklist = nil
+	for _, expr := range c.Blocklist {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid moderation blocklist %q: %s", expr, err)
+		}
+		c.blocklist = append(c.blocklist, re)
+	}
+
+	if len(c.blocklist) == 0 && c.URL == "" {
+		return fmt.Errorf("moderation requires blocklist or url")
+	}
+
+	return nil
+}
+
+// moderate applies the blocklist and the classifier to the text fields of data, redacting them in place.
+// Returns the action taken: allow, reject or redact.
+func (c *ModerationConfig) moderate(topic string, msg *models.Message, data map[string]interface{}) string {
+	action := ModerationAllow
+
+	for _, field := range moderatedFields {
+		text, ok := data[field].(string)
+		if !ok {
+			continue
+		}
+
+		for _, re := range c.blocklist {
+			if !re.MatchString(text) {
+				continue
+			}
+			if c.Action == ModerationReject {
+				return ModerationReject
+			}
+			text, action = re.ReplaceAllString(text, c.Replacement), ModerationRedact
+		}
+		data[field] = text
+	}
+
+	if c.URL == "" {
+		return action
+	}
+
+	res, err := c.classify(topic, msg, data)
+	if err != nil {
+		telLog.Error("Error classifying message of %s: %s", topic, err)
+		if c.FailOpen {
+			return action
+		}
+		return ModerationReject
+	}
+
+	switch res.Action {
+	case ModerationReject:
+		return ModerationReject
+	case ModerationRedact:
+		for _, field := range moderatedFields {
+			if text, ok := res.Fields[field]; ok {
+				data[field] = text
+			}
+		}
+		return ModerationRedact
+	}
+
+	return action
+}
+
+// classify sends the text fields of data to the classifier
+func (c *ModerationConfig) classify(topic string, msg *models.Message, data map[string]interface{}) (moderationResponse, error) {
+	res := moderationResponse{}
+
+	req := moderationRequest{Topic: topic, ChatID: msg.Chat.ID, From: telegramSender(msg), Fields: map[string]string{}}
+	for _, field := range moderatedFields {
+		if text, ok := data[field].(string); ok {
+			req.Fields[field] = text
+		}
+	}
+
+	body, _ := json.Marshal(req)
+	r, err := http.NewRequest("POST", c.URL, bytes.NewReader(body))
+	if err != nil {
+		return res, err
+	}
+
+	r.Header.Set("Content-Type", "application/json")
+	for k, v := range c.Headers {
+		r.Header.Set(k, v)
+	}
+
+	timeout := c.Timeout.Duration
+	if timeout <= 0 {
+		timeout = defaultModerationTimeout
+	}
+
+	response, err := (&http.Client{Timeout: timeout}).Do(r)
+	if err != nil {
+		return res, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode/100 != 2 {
+		return res, fmt.Errorf("received status %d", response.StatusCode)
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(&res); err != nil {
+		return res, fmt.Errorf("invalid classifier response: %s", err)
+	}
+
+	return res, nil
+}
+
+// moderateMessage moderates a Telegram message of the mapping before publishing, returning false if it was rejected
+func moderateMessage(mapping *Mapping, msg *models.Message, data map[string]interface{}) bool {
+	if mapping.Moderation == nil {
+		return true
+	}
+
+	action := mapping.Moderation.moderate(mapping.Topic, msg, data)
+	if action == ModerationAllow {
+		return true
+	}
+
+	moderated.Inc(mapping.Topic, action)
+	telLog.Info("Message from %s in %s %sed by the moderation", telegramSender(msg), msg.Chat.Title, action)
+
+	return action != ModerationReject
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/go-telegram/bot/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestModerationBlocklist(t *testing.T) {
+	msg := &models.Message{Chat: models.Chat{ID: -100, Title: "Home"}, From: &models.User{Username: "jane"}}
+
+	tests := []struct {
+		action   string
+		message  string
+		expected string
+		result   string
+	}{
+		{ModerationReject, "Jane: hello", "Jane: hello", ModerationAllow},
+		{ModerationReject, "Jane: you Idiot", "Jane: you Idiot", ModerationReject},
+		{ModerationRedact, "Jane: you Idiot, idiot", "Jane: you ***, ***", ModerationRedact},
+	}
+
+	for _, test := range tests {
+		c := &ModerationConfig{Blocklist: []string{`(?i)idiot`}, Action: test.action}
+		if err := c.setup(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		data := map[string]interface{}{"message": test.message}
+		if result := c.moderate("test/topic", msg, data); result != test.result {
+			t.Errorf("%s %q: expected %s, got %s", test.action, test.message, test.result, result)
+		}
+		if data["message"] != test.expected {
+			t.Errorf("%s %q: expected %q, got %q", test.action, test.message, test.expected, data["message"])
+		}
+	}
+
+	if err := (&ModerationConfig{Blocklist: []string{"("}}).setup(); err == nil {
+		t.Errorf("expected error for invalid blocklist")
+	}
+}
+
+func TestModerationClassifier(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req moderationRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		switch req.Fields["message"] {
+		case "Jane Doe: spam":
+			json.NewEncoder(w).Encode(moderationResponse{Action: ModerationReject})
+		case "Jane Doe: call 555-1234":
+			json.NewEncoder(w).Encode(moderationResponse{Action: ModerationRedact, Fields: map[string]string{"message": "Jane Doe: call [phone]"}})
+		case "Jane Doe: fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			json.NewEncoder(w).Encode(moderationResponse{Action: ModerationAllow})
+		}
+	}))
+	defer server.Close()
+
+	newFakeTelegram(t)
+	broker := newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "test/topic", MessageTo: "house", Moderation: &ModerationConfig{URL: server.URL}}
+	setupTestMappings(t, mapping)
+
+	for i, text := range []string{"hello", "spam", "call 555-1234", "fail"} {
+		forwardToMQTT(&models.Message{
+			ID:   i + 1,
+			From: &models.User{ID: 42, FirstName: "Jane", LastName: "Doe", Username: "jane"},
+			Chat: models.Chat{ID: -100, Title: "Home"},
+			Text: text,
+		})
+	}
+
+	published := broker.Published("test/topic_msg")
+	if len(published) != 2 {
+		t.Fatalf("expected 2 messages published, got %d", len(published))
+	}
+
+	var data map[string]interface{}
+	json.Unmarshal(published[1].Payload, &data)
+	if data["message"] != "Jane Doe: call [phone]" {
+		t.Errorf("expected the redacted message, got %s", published[1].Payload)
+	}
+}
@@ -0,0 +1,571 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-telegram/bot/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"net"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var presenceTopic = os.Getenv("presence_topic")
+
+// adminPanicReport sends the panics recovered on doMessage to the telegram_admin
+var adminPanicReport = os.Getenv("admin_panic_report") == "true"
+
+// maxPanicReport keeps the panic report inside the Telegram message limit
+const maxPanicReport = 3500
+
+// panicReport formats a recovered panic for the admin, truncating the payload and stack
+func panicReport(topic string, r interface{}, payload, stack []byte) string {
+	report := fmt.Sprintf("Panic processing message on topic %s: %v\n\nPayload: %s", topic, r, truncate(string(payload), 500))
+	report += "\n\n" + string(stack)
+
+	return truncate(report, maxPanicReport)
+}
+
+// truncate limits s to n bytes, cutting on a rune boundary and adding ... when truncated
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n] + "..."
+}
+
+var defaultBrokerPorts = map[string]string{
+	"tcp":    "1883",
+	"ssl":    "8883",
+	"tls":    "8883",
+	"tcps":   "8883",
+	"ws":     "80",
+	"wss":    "443",
+	"nats":   "4222",
+	"kafka":  "9092",
+	"amqp":   "5672",
+	"amqps":  "5671",
+	"redis":  "6379",
+	"rediss": "6380",
+}
+
+// parseBrokerURL accepts full broker URLs (ssl://broker:8883, ws://broker/mqtt) or bare host[:port],
+// filling the default port of the scheme when missing
+func parseBrokerURL(server string) (string, error) {
+	if !strings.Contains(server, "://") {
+		server = "tcp://" + server
+	}
+
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", err
+	}
+
+	defaultPort, ok := defaultBrokerPorts[u.Scheme]
+	if !ok {
+		return "", fmt.Errorf("unsupported broker scheme %q", u.Scheme)
+	}
+
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("missing broker host in %q", server)
+	}
+
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+
+	return u.String(), nil
+}
+
+// mappingHandler returns the subscription handler for a mapping topic
+func mappingHandler(mapping *Mapping) MQTTHandler {
+	return func(msg MQTTMessage) {
+		mqttLog.Debug(`Received Message on Topic %s: %s`, msg.Topic, logText(string(msg.Payload)))
+		if messageQueue != nil {
+			messageQueue.Push(mapping, msg)
+			return
+		}
+		doMessage(mapping, msg)
+	}
+}
+
+func presenceHandler(msg MQTTMessage) {
+	mqttLog.Info("Received presence on topic %s: %s", msg.Topic, logText(string(msg.Payload)))
+}
+
+func subscribe(topic string, handler MQTTHandler) {
+	if err := trySubscribe(topic, handler); err != nil {
+		mqttLog.Fatal("Error subscribing to %s: %s", topic, err)
+	}
+}
+
+// trySubscribe subscribes to the topic, recording the subscription to be made again on a new client
+func trySubscribe(topic string, handler MQTTHandler) error {
+	mqttSubscriptionsLock.Lock() // Also keeps the client from being replaced meanwhile
+	defer mqttSubscriptionsLock.Unlock()
+
+	client := getMQTTClient()
+	if err := client.Subscribe(topic, activeHandler(client, handler)); err != nil {
+		return err
+	}
+
+	mqttSubscriptions = append(mqttSubscriptions, mqttSubscription{topic: topic, handler: handler})
+	return nil
+}
+
+// doMessage processes a message received on a mapping topic
+func doMessage(mapping *Mapping, msg MQTTMessage) {
+	topic := strings.TrimPrefix(msg.Topic, topicPrefix)
+	jsonData := msg.Payload
+	retained := msg.Retained
+	received := time.Now()
+	stored := "" // Payload kept for /get and the debug dumps once validated, without the token
+
+	// accepted records a validated payload as the last value of the topic, restarting its silence watchdog
+	accepted := func(payload string) {
+		stored = payload
+		recordLastValue(mapping, topic, []byte(payload), retained)
+		mapping.watchTopic(topic, received)
+	}
+
+	response := &rpcResponse{Status: rpcIgnored}
+	defer sendRPCResponse(msg, response)
+
+	ctx, span := tracer.Start(extractTraceContext(msg.UserProperties), "mqtt.receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(topicAttribute(topic)))
+
+	defer func() {
+		mqttMessages.Inc(mapping.Topic, response.Status)
+		recordRecent(recentMessage{
+			Time:      received,
+			Direction: DirectionToTelegram,
+			Topic:     topic,
+			Result:    response.Status,
+			Payload:   stored,
+		})
+		span.SetAttributes(attribute.String("result", response.Status))
+		if response.Status == rpcError {
+			span.SetStatus(codes.Error, response.Error)
+			mapping.setLastError(response.Error)
+		}
+		span.End()
+	}()
+
+	fail := func(reason FailureReason, err error) {
+		publishError(mapping, topic, mapping.tr("processing_error", err))
+		publishDeadLetter(mapping, topic, msg, received, reason, err)
+		response.Status = rpcError
+		response.Error = err.Error()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			stack := debug.Stack()
+			mqttLog.Error("Recovered from panic on doMessage: %v\nPayload: %s\n%s", r, logText(string(msg.Payload)), string(stack))
+			reportPanic(r, map[string]string{"topic": topic})
+			if adminPanicReport {
+				go notifyAdmin(panicReport(topic, r, msg.Payload, stack))
+			}
+			fail(FailurePanic, fmt.Errorf("recovered from panic"))
+		}
+	}()
+
+	unverified := false
+	if mapping.SigningKey != "" {
+		payload, err := verifyPayload([]byte(mapping.SigningKey), jsonData)
+		if err != nil {
+			if mapping.SignaturePolicy != SignatureFlag {
+				mqttLog.Error("Rejecting message on topic %s: %s", topic, err)
+				fail(FailureSignature, err)
+				return
+			}
+			mqttLog.Warn("Unverified message on topic %s: %s", topic, err)
+			unverified = true
+		}
+		jsonData = payload
+	}
+
+	if mapping.BinaryImage && isImage(jsonData) {
+		if err := mapping.checkToken(map[string]interface{}{}); err != nil { // Raw images can't carry a token
+			mqttLog.Error("Rejecting image on topic %s: %s", topic, err)
+			fail(FailureAuth, err)
+			return
+		}
+
+		accepted(fmt.Sprintf("<image, %d bytes>", len(jsonData)))
+
+		if retained && !mapping.acceptRetained() {
+			mqttLog.Debug("Ignoring retained image on topic %s (policy %s)", topic, mapping.Retained)
+			response.Status = rpcDropped
+			return
+		}
+
+		err := deliverImage(mapping, Notification{
+			Topic:      topic,
+			From:       topic,
+			Properties: msg.UserProperties,
+			Time:       received,
+			ctx:        ctx,
+		}, jsonData, unverified)
+
+		if err == errMuted {
+			response.Status = rpcDropped
+		} else if err != nil {
+			fail(failureReason(err), err)
+		} else {
+			response.Status = rpcDelivered
+		}
+		return
+	}
+
+	data, err := mapping.decodePayload(jsonData)
+	if err != nil && mapping.profile != nil { // Device payloads can be plain values, like ON or 23.5
+		data, err = map[string]interface{}{"value": strings.TrimSpace(string(jsonData))}, nil
+	}
+	if err != nil {
+		mqttLog.Error("Received invalid payload: %s", err)
+		fail(FailureSchema, err)
+		return
+	}
+
+	cloudEvent := isCloudEvent(data)
+	if cloudEvent {
+		data = fromCloudEvent(data)
+	}
+
+	if err := mapping.checkToken(data); err != nil {
+		mqttLog.Error("Rejecting message on topic %s: %s", topic, err)
+		fail(FailureAuth, err)
+		return
+	}
+
+	if mapping.tokenRequired() || cloudEvent || !mapping.rawPayload() { // Without the token, and decrypted and decoded
+		payload, err := json.Marshal(data)
+		if err != nil { // Like a NaN of a CBOR payload
+			mqttLog.Error("Received payload that can't be encoded as JSON: %s", err)
+			fail(FailureSchema, err)
+			return
+		}
+		accepted(string(payload))
+	} else {
+		accepted(string(jsonData))
+	}
+
+	mapping.applyProfile(topic, data)
+
+	if mapping.Transform != nil {
+		_, transformSpan := tracer.Start(ctx, "transform")
+		result, err := runTransform(mapping.Transform, topic, data, retained)
+		endSpan(transformSpan, err)
+		if err != nil {
+			mqttLog.Error("Error transforming message on topic %s: %s", topic, err)
+			fail(FailureTransform, err)
+			return
+		}
+
+		if result.Drop {
+			mqttLog.Debug("Message on topic %s dropped by transform", topic)
+			response.Status = rpcDropped
+			return
+		}
+
+		if result.Topic != "" && result.Topic != topic {
+			routed, ok := topicMapping(result.Topic)
+			if !ok {
+				mqttLog.Warn("Transform routed message to topic %s but no telegram channel associated.", result.Topic)
+				return
+			}
+			mapping = routed
+			topic = result.Topic
+		}
+		data = result.Payload
+	}
+
+	if mapping.Frigate != nil {
+		err := deliverFrigateEvent(mapping, data)
+		if err == errFrigateIgnored {
+			response.Status = rpcIgnored
+		} else if err == errMuted {
+			response.Status = rpcDropped
+		} else if err != nil {
+			mqttLog.Error("Error sending Frigate event on topic %s: %s", topic, err)
+			fail(failureReason(err), err)
+		} else {
+			response.Status = rpcDelivered
+		}
+		return
+	}
+
+	// MQTT 5 message expiry interval is honored as the message expiration
+	if msg.Expiry > 0 && data["expires_at"] == nil {
+		data["expires_at"] = time.Now().Add(msg.Expiry).Format(time.RFC3339)
+	}
+
+	mapping.recordChartValue(data, received)
+	mapping.recordSummaryValues(data)
+	mapping.checkThresholds(ctx, topic, data, received)
+
+	t, _ := data["type"].(string) // Raw sensor payloads have no type
+
+	if t == "message" {
+		expired, err := isExpired(data, mapping, time.Now())
+		if err != nil {
+			mqttLog.Error("Received invalid expiration fields: %s", err)
+			fail(FailureSchema, err)
+			return
+		}
+
+		if expired {
+			mqttLog.Warn("Discarding stale message on topic %s: %s", topic, logText(string(jsonData)))
+			response.Status = rpcDropped
+			return
+		}
+
+		if retained && !mapping.acceptRetained() {
+			mqttLog.Debug("Ignoring retained message on topic %s (policy %s)", topic, mapping.Retained)
+			response.Status = rpcDropped
+			return
+		}
+
+		if data["message"] != nil {
+			from, _ := data["from"].(string)
+			if from == "" {
+				from = "Unknown"
+			}
+
+			message, ok := data["message"].(string)
+			if !ok {
+				mqttLog.Error("Received message that is not a string: %s", logText(string(jsonData)))
+				fail(FailureSchema, fmt.Errorf("invalid message field: expected string"))
+				return
+			}
+
+			if retained && mapping.Retained == RetainedMark {
+				message = mapping.trMessage("retained", formatted(message))
+			}
+
+			if unverified {
+				message = mapping.trMessage("unverified", formatted(message))
+			}
+
+			critical, _ := data["critical"].(bool)
+
+			user, err := mapping.directUser(data)
+			if err != nil {
+				mqttLog.Error("Rejecting message on topic %s: %s", topic, err)
+				fail(FailureSchema, err)
+				return
+			}
+
+			deliverAt, err := parseDeliveryTime(data)
+			if err != nil {
+				mqttLog.Error("Received invalid delivery time: %s", err)
+				fail(FailureSchema, err)
+				return
+			}
+
+			if deliverAt.After(time.Now()) {
+				pending := PendingMessage{
+					Topic:     topic,
+					From:      from,
+					Message:   message,
+					Critical:  critical,
+					UserID:    user,
+					DeliverAt: deliverAt,
+					Time:      messageTime(data, received),
+				}
+				if data["expires_at"] != nil {
+					pending.ExpiresAt, _ = parseTimeValue(data["expires_at"])
+				}
+				schedulePendingMessage(pending)
+				response.Status = rpcScheduled
+				return
+			}
+
+			if mapping.isDuplicate(from, message) {
+				mqttLog.Debug("Dropping duplicated message on topic %s", topic)
+				response.Status = rpcDropped
+				return
+			}
+
+			if mapping.inCooldown(topic, from, message) {
+				mqttLog.Debug("Suppressing message on topic %s in cooldown", topic)
+				response.Status = rpcDropped
+				return
+			}
+
+			n, drop := applyRules(mapping, Notification{
+				Topic:      topic,
+				From:       from,
+				Message:    message,
+				Critical:   critical,
+				UserID:     user,
+				Data:       data,
+				Properties: msg.UserProperties,
+				Time:       messageTime(data, received),
+				ctx:        ctx,
+				msg:        &msg,
+			})
+			if drop {
+				mqttLog.Debug("Dropping message on topic %s by the rules", topic)
+				response.Status = rpcDropped
+				return
+			}
+
+			if n.Critical && mapping.Acknowledge != nil {
+				newAlert(mapping, &n)
+			}
+
+			err = deliverMessage(mapping, n)
+			if n.alert != nil {
+				n.alert.delivered(err == nil)
+			}
+
+			if err == errMuted {
+				response.Status = rpcDropped
+			} else if err != nil {
+				publishDeadLetter(mapping, topic, msg, received, failureReason(err), err)
+				response.Status = rpcError
+				response.Error = err.Error()
+			} else {
+				mapping.startCooldown(topic, from, message)
+				response.Status = rpcDelivered
+			}
+		} else {
+			mqttLog.Error("Received data without message: %s", logText(string(jsonData)))
+			publishError(mapping, topic, mapping.tr("no_message", string(jsonData)))
+			publishDeadLetter(mapping, topic, msg, received, FailureSchema, fmt.Errorf("received data without message"))
+			response.Status = rpcError
+			response.Error = "received data without message"
+		}
+	} else if t == "chart" {
+		d := mapping.chartWindow()
+		if data["duration"] != nil {
+			if d, err = parseDurationValue(data["duration"]); err != nil {
+				fail(FailureSchema, fmt.Errorf("invalid duration field: %s", err))
+				return
+			}
+		}
+
+		err := deliverChart(mapping, d)
+		if err == errMuted {
+			response.Status = rpcDropped
+		} else if err != nil {
+			fail(failureReason(err), err)
+		} else {
+			response.Status = rpcDelivered
+		}
+	} else if t == "" && isOwnTracksLocation(data) {
+		err := deliverOwnTracks(mapping, topic, data)
+		if err == errMuted {
+			response.Status = rpcDropped
+		} else if err != nil {
+			fail(failureReason(err), err)
+		} else {
+			response.Status = rpcDelivered
+		}
+	} else if t == "sticker" {
+		fileID, _ := data["file_id"].(string)
+		if fileID == "" {
+			mqttLog.Error("Received sticker without file_id: %s", logText(string(jsonData)))
+			fail(FailureSchema, fmt.Errorf("received sticker without file_id"))
+			return
+		}
+
+		if mapping.isMuted() {
+			response.Status = rpcDropped
+			return
+		}
+
+		if err := mapping.telegramSink().SendSticker(fileID); err != nil {
+			fail(failureReason(err), err)
+			return
+		}
+		response.Status = rpcDelivered
+	} else {
+		mqttLog.Info("Received message (%s): %s", t, logText(string(jsonData)))
+	}
+}
+
+// publishToMQTT publishes a message received from Telegram to the mapping outbound topic
+func publishToMQTT(mapping *Mapping, msg *models.Message, data map[string]interface{}) {
+	if !moderateMessage(mapping, msg, data) {
+		return
+	}
+
+	var jsonData []byte
+
+	outboundTopic := mapping.outboundTopic(msg)
+	data = outboundPayload(mapping, msg, data)
+
+	if mapping.CloudEvents {
+		jsonData, _ = json.Marshal(toCloudEvent(msg, data))
+	} else {
+		jsonData, _ = json.Marshal(data)
+	}
+
+	mqttLog.Debug("Publishing to %s: %s", outboundTopic, logText(string(jsonData)))
+	telegramReceived.Inc(mapping.Topic)
+	mapping.recordSummaryTelegram(telegramSender(msg))
+	recordRecent(recentMessage{
+		Time:      time.Now(),
+		Direction: DirectionToMQTT,
+		Topic:     mapping.Topic,
+		Payload:   string(jsonData),
+	})
+
+	text, _ := data["message"].(string)
+	archiveMessage(ArchivedMessage{
+		Time:      time.Now(),
+		Direction: DirectionToMQTT,
+		Topic:     mapping.Topic,
+		ChatID:    msg.Chat.ID,
+		From:      telegramSender(msg),
+		Message:   text,
+	})
+
+	if mapping.key != nil {
+		encrypted, err := encryptPayload(mapping.key, jsonData)
+		if err != nil {
+			mqttLog.Error("Error encrypting message to %s: %s", outboundTopic, err)
+			return
+		}
+		jsonData = encrypted
+	}
+
+	if mapping.SigningKey != "" {
+		jsonData = signPayload([]byte(mapping.SigningKey), jsonData)
+	}
+
+	ctx, span := tracer.Start(context.Background(), "telegram.receive",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(topicAttribute(outboundTopic)))
+
+	properties := map[string]string{}
+	injectTraceContext(ctx, properties)
+
+	err := getMQTTClient().Publish(MQTTMessage{
+		Topic:          outboundTopic,
+		Payload:        jsonData,
+		Retained:       mapping.OutboundRetain,
+		UserProperties: properties,
+	})
+	endSpan(span, err)
+
+	if err != nil {
+		mqttLog.Error("Error publishing to %s: %s", outboundTopic, err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"github.com/eclipse/paho.mqtt.golang"
+	"sync"
+)
+
+// mqtt3Client is a MQTT 3.1.1 client using paho.mqtt.golang
+type mqtt3Client struct {
+	client  mqtt.Client
+	options MQTTOptions
+
+	lock          sync.Mutex
+	subscriptions map[string]MQTTHandler
+}
+
+func newMQTT3Client(o MQTTOptions) *mqtt3Client {
+	c := &mqtt3Client{
+		options:       o,
+		subscriptions: map[string]MQTTHandler{},
+	}
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(o.BrokerURL)
+	opts.SetDefaultPublishHandler(func(client mqtt.Client, message mqtt.Message) {
+		mqttLog.Debug(`Ignoring message on unsubscribed topic %s`, message.Topic())
+	})
+	opts.SetPingTimeout(o.PingTimeout)
+	opts.SetKeepAlive(o.KeepAlive)
+	opts.SetConnectTimeout(o.ConnectTimeout)
+	opts.SetMaxReconnectInterval(o.MaxReconnectInterval)
+	opts.SetOnConnectHandler(c.onConnect)
+	opts.SetCredentialsProvider(func() (string, string) {
+		return o.Username, o.Password()
+	})
+	opts.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		if o.OnConnectionLost != nil {
+			o.OnConnectionLost(err)
+		}
+	})
+
+	c.client = mqtt.NewClient(opts)
+
+	return c
+}
+
+func (c *mqtt3Client) onConnect(client mqtt.Client) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// Clean sessions lose the subscriptions on reconnect
+	for topic, handler := range c.subscriptions {
+		go c.subscribe(topic, handler)
+	}
+
+	if c.options.OnConnect != nil {
+		c.options.OnConnect()
+	}
+}
+
+func (c *mqtt3Client) subscribe(topic string, handler MQTTHandler) error {
+	token := c.client.Subscribe(topic, 0, func(client mqtt.Client, message mqtt.Message) {
+		handler(MQTTMessage{
+			Topic:    message.Topic(),
+			Payload:  message.Payload(),
+			Retained: message.Retained(),
+		})
+	})
+	token.Wait()
+
+	if token.Error() != nil {
+		mqttLog.Error("Error subscribing to %s: %s", topic, token.Error())
+	}
+
+	return token.Error()
+}
+
+func (c *mqtt3Client) Connect() error {
+	token := c.client.Connect()
+	token.Wait()
+	return token.Error()
+}
+
+func (c *mqtt3Client) Subscribe(topic string, handler MQTTHandler) error {
+	c.lock.Lock()
+	c.subscriptions[topic] = handler
+	c.lock.Unlock()
+
+	return c.subscribe(topic, handler)
+}
+
+func (c *mqtt3Client) Publish(msg MQTTMessage) error {
+	token := c.client.Publish(msg.Topic, 0, msg.Retained, msg.Payload)
+	token.Wait()
+	return token.Error()
+}
+
+func (c *mqtt3Client) IsConnected() bool {
+	return c.client.IsConnected()
+}
+
+func (c *mqtt3Client) Disconnect() {
+	c.client.Disconnect(250)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/eclipse/paho.golang/paho/extensions/topicaliases"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// mqtt5Client is a MQTT 5 client using paho.golang
+type mqtt5Client struct {
+	config  autopaho.ClientConfig
+	cm      *autopaho.ConnectionManager
+	options MQTTOptions
+
+	lock          sync.Mutex
+	subscriptions map[string]MQTTHandler
+	aliases       *topicaliases.TAHandler
+}
+
+func newMQTT5Client(o MQTTOptions) (*mqtt5Client, error) {
+	u, err := url.Parse(o.BrokerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &mqtt5Client{
+		options:       o,
+		subscriptions: map[string]MQTTHandler{},
+	}
+
+	maxReconnect := o.MaxReconnectInterval
+
+	c.config = autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{u},
+		KeepAlive:                     uint16(o.KeepAlive / time.Second),
+		ConnectTimeout:                o.ConnectTimeout,
+		CleanStartOnInitialConnection: true,
+		ReconnectBackoff: func(attempt int) time.Duration {
+			if attempt <= 0 {
+				return 0
+			}
+			d := time.Second << uint(attempt-1)
+			if d <= 0 || d > maxReconnect {
+				d = maxReconnect
+			}
+			return d
+		},
+		ConnectPacketBuilder: func(cp *paho.Connect, u *url.URL) (*paho.Connect, error) {
+			if o.Username != "" {
+				cp.Username = o.Username
+				cp.UsernameFlag = true
+			}
+			if password := o.Password(); password != "" {
+				cp.Password = []byte(password)
+				cp.PasswordFlag = true
+			}
+			return cp, nil
+		},
+		OnConnectionUp: c.onConnectionUp,
+		OnConnectionDown: func() bool {
+			if o.OnConnectionLost != nil {
+				o.OnConnectionLost(errors.New("connection lost"))
+			}
+			return true
+		},
+		OnConnectError: func(err error) {
+			mqttLog.Error("Error connecting to broker: %s", err)
+		},
+		ClientConfig: paho.ClientConfig{
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){c.onPublishReceived},
+			PublishHook:       c.publishHook,
+		},
+	}
+
+	if c.config.KeepAlive == 0 {
+		c.config.KeepAlive = 1
+	}
+
+	return c, nil
+}
+
+func (c *mqtt5Client) onConnectionUp(cm *autopaho.ConnectionManager, connack *paho.Connack) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// Outgoing topic aliases are assigned automatically up to the server limit
+	c.aliases = nil
+	if connack.Properties != nil && connack.Properties.TopicAliasMaximum != nil && *connack.Properties.TopicAliasMaximum > 0 {
+		c.aliases = topicaliases.NewTAHandler(*connack.Properties.TopicAliasMaximum)
+	}
+
+	for topic := range c.subscriptions {
+		go c.subscribe(cm, topic)
+	}
+
+	if c.options.OnConnect != nil {
+		c.options.OnConnect()
+	}
+}
+
+func (c *mqtt5Client) publishHook(p *paho.Publish) {
+	c.lock.Lock()
+	aliases := c.aliases
+	c.lock.Unlock()
+
+	if aliases != nil {
+		aliases.PublishHook(p)
+	}
+}
+
+func (c *mqtt5Client) onPublishReceived(pr paho.PublishReceived) (bool, error) {
+	p := pr.Packet
+
+	msg := MQTTMessage{
+		Topic:    p.Topic,
+		Payload:  p.Payload,
+		Retained: p.Retain,
+	}
+
+	if p.Properties != nil {
+		if len(p.Properties.User) > 0 {
+			msg.UserProperties = map[string]string{}
+			for _, prop := range p.Properties.User {
+				msg.UserProperties[prop.Key] = prop.Value
+			}
+		}
+		if p.Properties.MessageExpiry != nil {
+			msg.Expiry = time.Duration(*p.Properties.MessageExpiry) * time.Second
+		}
+		msg.ResponseTopic = p.Properties.ResponseTopic
+		msg.CorrelationData = p.Properties.CorrelationData
+	}
+
+	c.lock.Lock()
+	var handlers []MQTTHandler
+	for filter, handler := range c.subscriptions {
+		if topicMatches(filter, p.Topic) {
+			handlers = append(handlers, handler)
+		}
+	}
+	c.lock.Unlock()
+
+	if len(handlers) == 0 {
+		mqttLog.Debug(`Ignoring message on unsubscribed topic %s`, p.Topic)
+	}
+
+	for _, handler := range handlers {
+		handler(msg)
+	}
+
+	return true, nil
+}
+
+func (c *mqtt5Client) subscribe(cm *autopaho.ConnectionManager, topic string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.ConnectTimeout)
+	defer cancel()
+
+	_, err := cm.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: []paho.SubscribeOptions{{Topic: topic, QoS: 0}},
+	})
+
+	if err != nil {
+		mqttLog.Error("Error subscribing to %s: %s", topic, err)
+	}
+
+	return err
+}
+
+func (c *mqtt5Client) Connect() error {
+	cm, err := autopaho.NewConnection(context.Background(), c.config)
+	if err != nil {
+		return err
+	}
+	c.cm = cm
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.ConnectTimeout)
+	defer cancel()
+
+	return cm.AwaitConnection(ctx)
+}
+
+func (c *mqtt5Client) Subscribe(topic string, handler MQTTHandler) error {
+	c.lock.Lock()
+	c.subscriptions[topic] = handler
+	c.lock.Unlock()
+
+	return c.subscribe(c.cm, topic)
+}
+
+func (c *mqtt5Client) Publish(msg MQTTMessage) error {
+	p := &paho.Publish{
+		Topic:      msg.Topic,
+		Retain:     msg.Retained,
+		Payload:    msg.Payload,
+		Properties: &paho.PublishProperties{},
+	}
+
+	for k, v := range msg.UserProperties {
+		p.Properties.User.Add(k, v)
+	}
+
+	if msg.Expiry > 0 {
+		expiry := uint32(msg.Expiry / time.Second)
+		p.Properties.MessageExpiry = &expiry
+	}
+
+	p.Properties.ResponseTopic = msg.ResponseTopic
+	p.Properties.CorrelationData = msg.CorrelationData
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.ConnectTimeout)
+	defer cancel()
+
+	_, err := c.cm.Publish(ctx, p)
+
+	return err
+}
+
+func (c *mqtt5Client) IsConnected() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	return c.cm != nil && c.cm.AwaitConnection(ctx) == nil
+}
+
+func (c *mqtt5Client) Disconnect() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if c.cm != nil {
+		_ = c.cm.Disconnect(ctx)
+	}
+}
@@ -0,0 +1,814 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/go-telegram/bot/models"
+	"github.com/tidwall/gjson"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestDoMessageRouting(t *testing.T) {
+	tests := []struct {
+		name     string
+		mapping  *Mapping
+		prepare  func(m *Mapping)
+		payload  string
+		retained bool
+		status   string
+		method   string // Telegram method expected to be called, if any
+		text     string // Expected text (or sticker) sent to Telegram
+		error    string // Expected prefix of the message published to the error topic, if any
+	}{
+		{
+			name:    "message",
+			payload: `{"type": "message", "from": "sensor", "message": "hello"}`,
+			status:  rpcDelivered,
+			method:  "sendMessage",
+			text:    "*sensor*: hello",
+		},
+		{
+			name:    "message without from",
+			payload: `{"type": "message", "message": "hello"}`,
+			status:  rpcDelivered,
+			method:  "sendMessage",
+			text:    "*Unknown*: hello",
+		},
+		{
+			name:    "message with template",
+			mapping: &Mapping{Template: "{{.Data.room}} says {{.Message}}"},
+			payload: `{"type": "message", "message": "hello", "room": "kitchen"}`,
+			status:  rpcDelivered,
+			method:  "sendMessage",
+			text:    "kitchen says hello",
+		},
+		{
+			name:    "message without message field",
+			payload: `{"type": "message", "from": "sensor"}`,
+			status:  rpcError,
+			error:   "Received data without message",
+		},
+		{
+			name:    "invalid payload",
+			payload: `{"type": "message",`,
+			status:  rpcError,
+			error:   "There was an error processing the message",
+		},
+		{
+			name:    "message that is not a string",
+			payload: `{"type": "message", "from": 42, "message": {"text": "hello"}}`,
+			status:  rpcError,
+			error:   "There was an error processing the message",
+		},
+		{
+			name:    "null payload",
+			payload: `null`,
+			status:  rpcError,
+			error:   "There was an error processing the message",
+		},
+		{
+			name:    "unknown type",
+			payload: `{"type": "status", "value": 1}`,
+			status:  rpcIgnored,
+		},
+		{
+			name:     "retained ignored",
+			mapping:  &Mapping{Retained: RetainedIgnore},
+			payload:  `{"type": "message", "from": "sensor", "message": "hello"}`,
+			retained: true,
+			status:   rpcDropped,
+		},
+		{
+			name:     "retained marked",
+			mapping:  &Mapping{Retained: RetainedMark},
+			payload:  `{"type": "message", "from": "sensor", "message": "hello"}`,
+			retained: true,
+			status:   rpcDelivered,
+			method:   "sendMessage",
+			text:     "*sensor*: hello (retained)",
+		},
+		{
+			name:    "delayed message",
+			payload: `{"type": "message", "from": "sensor", "message": "hello", "delay": "1h"}`,
+			status:  rpcScheduled,
+		},
+		{
+			name:    "muted mapping",
+			prepare: func(m *Mapping) { m.mute(time.Hour) },
+			payload: `{"type": "message", "from": "sensor", "message": "hello"}`,
+			status:  rpcDropped,
+		},
+		{
+			name:    "sticker",
+			payload: `{"type": "sticker", "file_id": "CAADAgADQAADyIsGAAE7MpzFPFQX5QI"}`,
+			status:  rpcDelivered,
+			method:  "sendSticker",
+			text:    "CAADAgADQAADyIsGAAE7MpzFPFQX5QI",
+		},
+		{
+			name:    "sticker without file_id",
+			payload: `{"type": "sticker"}`,
+			status:  rpcError,
+			error:   "There was an error processing the message",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			telegram := newFakeTelegram(t)
+			broker := newFakeBroker(t)
+
+			previousPending := pendingMessages
+			pendingMessages = nil
+			t.Cleanup(func() { pendingMessages = previousPending })
+
+			mapping := test.mapping
+			if mapping == nil {
+				mapping = &Mapping{}
+			}
+			mapping.GroupID = -100
+			mapping.Topic = "test/topic"
+			setupTestMappings(t, mapping)
+			if test.prepare != nil {
+				test.prepare(mapping)
+			}
+
+			doMessage(mapping, MQTTMessage{
+				Topic:         mapping.Topic,
+				Payload:       []byte(test.payload),
+				Retained:      test.retained,
+				ResponseTopic: "test/reply",
+			})
+
+			replies := broker.Published("test/reply")
+			if len(replies) != 1 {
+				t.Fatalf("expected 1 response, got %d", len(replies))
+			}
+
+			var response rpcResponse
+			json.Unmarshal(replies[0].Payload, &response)
+			if response.Status != test.status {
+				t.Errorf("expected status %q, got %q (%s)", test.status, response.Status, response.Error)
+			}
+
+			calls := telegram.Calls("")
+			if test.method == "" && len(calls) > 0 {
+				t.Errorf("expected no Telegram calls, got %s", calls[0].Method)
+			}
+			if test.method != "" {
+				if len(calls) != 1 || calls[0].Method != test.method {
+					t.Fatalf("expected a single %s call, got %v", test.method, calls)
+				}
+				if calls[0].Params.Get("chat_id") != "-100" {
+					t.Errorf("expected chat_id -100, got %s", calls[0].Params.Get("chat_id"))
+				}
+				sent := calls[0].Params.Get("text")
+				if test.method == "sendSticker" {
+					sent = calls[0].Params.Get("sticker")
+				}
+				if sent != test.text {
+					t.Errorf("expected text %q, got %q", test.text, sent)
+				}
+			}
+
+			errors := broker.Published("test/topic_error")
+			if test.error == "" && len(errors) > 0 {
+				t.Errorf("expected no errors, got %s", errors[0].Payload)
+			}
+			if test.error != "" && (len(errors) != 1 || !strings.HasPrefix(string(errors[0].Payload), test.error)) {
+				t.Errorf("expected error %q, got %v", test.error, errors)
+			}
+
+			if test.status == rpcScheduled && len(pendingMessages) != 1 {
+				t.Errorf("expected 1 pending message, got %d", len(pendingMessages))
+			}
+		})
+	}
+}
+
+func TestMappingHandlerRoutesTopics(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	broker := newFakeBroker(t)
+
+	kitchen := &Mapping{GroupID: -1, Topic: "home/kitchen"}
+	garage := &Mapping{GroupID: -2, Topic: "home/garage"}
+	setupTestMappings(t, kitchen, garage)
+
+	for topic, mapping := range topicMappings {
+		broker.Subscribe(sharedTopic(mqttTopic(topic)), mappingHandler(mapping))
+	}
+
+	broker.Publish(MQTTMessage{Topic: "home/garage", Payload: []byte(`{"type": "message", "from": "door", "message": "open"}`)})
+	broker.Publish(MQTTMessage{Topic: "home/bedroom", Payload: []byte(`{"type": "message", "from": "door", "message": "open"}`)})
+
+	calls := telegram.Calls("sendMessage")
+	if len(calls) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(calls))
+	}
+
+	if calls[0].Params.Get("chat_id") != "-2" {
+		t.Errorf("expected message to garage group -2, got %s", calls[0].Params.Get("chat_id"))
+	}
+}
+
+func TestForwardToMQTT(t *testing.T) {
+	newFakeTelegram(t)
+	broker := newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "test/topic", MessageTo: "house"}
+	setupTestMappings(t, mapping)
+
+	forwardToMQTT(&models.Message{
+		ID:   1,
+		From: &models.User{ID: 42, FirstName: "Jane", LastName: "Doe", Username: "jane"},
+		Chat: models.Chat{ID: -100, Title: "Home"},
+		Text: "lights off",
+	})
+
+	published := broker.Published("test/topic_msg")
+	if len(published) != 1 {
+		t.Fatalf("expected 1 message on test/topic_msg, got %d", len(published))
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(published[0].Payload, &data); err != nil {
+		t.Fatalf("invalid payload %s: %s", published[0].Payload, err)
+	}
+
+	if data["to"] != "house" || data["message"] != "Jane Doe: lights off" {
+		t.Errorf("unexpected payload %s", published[0].Payload)
+	}
+
+	forwardToMQTT(&models.Message{
+		ID:   2,
+		From: &models.User{ID: 42, Username: "jane"},
+		Chat: models.Chat{ID: -200, Title: "Other"},
+		Text: "ignored",
+	})
+
+	if len(broker.Published("")) != 1 {
+		t.Errorf("expected messages of unmapped chats to be ignored")
+	}
+}
+
+func TestForwardToMQTTTopicPlaceholders(t *testing.T) {
+	newFakeTelegram(t)
+	broker := newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "home", MessageTo: "house", OutboundTopic: "{topic}/{chat_id}/{username}/{thread_id}/msg"}
+	setupTestMappings(t, mapping)
+
+	forwardToMQTT(&models.Message{ID: 1, From: &models.User{ID: 42, Username: "jane"}, Chat: models.Chat{ID: -100}, Text: "hi", IsTopicMessage: true, MessageThreadID: 5})
+	forwardToMQTT(&models.Message{ID: 2, From: &models.User{ID: 7}, Chat: models.Chat{ID: -100}, Text: "hi"})
+
+	for _, topic := range []string{"home/-100/jane/5/msg", "home/-100/7/0/msg"} {
+		if len(broker.Published(topic)) != 1 {
+			t.Errorf("expected a message on %s, got %v", topic, broker.Published(""))
+		}
+	}
+}
+
+func TestForwardToMQTTMentions(t *testing.T) {
+	newFakeTelegram(t)
+	broker := newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "test/topic", MessageTo: "house"}
+	setupTestMappings(t, mapping)
+
+	forwardToMQTT(&models.Message{ID: 1, From: &models.User{ID: 7, FirstName: "João", Username: "joao"}, Chat: models.Chat{ID: -100}, Text: "hi"})
+	broker.Reset()
+
+	forwardToMQTT(&models.Message{
+		ID:   2,
+		From: &models.User{ID: 42, FirstName: "Jane", Username: "jane"},
+		Chat: models.Chat{ID: -100},
+		Text: "🔔 notify @joao and Ana, not @bob",
+		Entities: []models.MessageEntity{
+			{Type: models.MessageEntityTypeMention, Offset: 10, Length: 5},
+			{Type: models.MessageEntityTypeTextMention, Offset: 20, Length: 3, User: &models.User{ID: 9, FirstName: "Ana"}},
+			{Type: models.MessageEntityTypeMention, Offset: 29, Length: 4},
+		},
+	})
+
+	published := broker.Published("test/topic_msg")
+	if len(published) != 1 {
+		t.Fatalf("expected 1 message on test/topic_msg, got %d", len(published))
+	}
+
+	mentions := gjson.GetBytes(published[0].Payload, "mentions")
+	expected := `[{"id":7,"name":"João","username":"joao"},{"id":9,"name":"Ana","text":"Ana"},{"username":"bob"}]`
+	if mentions.Raw != expected {
+		t.Errorf("expected mentions %s, got %s", expected, mentions.Raw)
+	}
+}
+
+func TestDoMessageParseMode(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	newFakeBroker(t)
+
+	tests := []struct {
+		parseMode string
+		expected  string
+		text      string
+	}{
+		{"", "Markdown", "*sensor\\_1*: <b>hot</b>"},
+		{"HTML", "HTML", "<b>sensor_1</b>: <b>hot</b>"},
+		{"MarkdownV2", "MarkdownV2", "*sensor\\_1*: <b>hot</b>"},
+		{"none", "", "sensor_1: <b>hot</b>"},
+	}
+
+	for _, test := range tests {
+		telegram.Reset()
+
+		mapping := &Mapping{GroupID: -100, Topic: "sensors", TelegramOptions: TelegramOptions{ParseMode: test.parseMode}}
+		setupTestMappings(t, mapping)
+
+		doMessage(mapping, MQTTMessage{Topic: "sensors", Payload: []byte(`{"type": "message", "from": "sensor_1", "message": "<b>hot</b>"}`)})
+
+		calls := telegram.Calls("sendMessage")
+		if len(calls) != 1 || calls[0].Params.Get("parse_mode") != test.expected || calls[0].Params.Get("text") != test.text {
+			t.Errorf("parse_mode %q: expected %q with %q, got %v", test.parseMode, test.expected, test.text, calls)
+		}
+	}
+
+	if err := (&Mapping{GroupID: -100, Topic: "sensors", TelegramOptions: TelegramOptions{ParseMode: "BBCode"}}).setup(); err == nil {
+		t.Errorf("expected invalid parse_mode error")
+	}
+}
+
+func TestDoMessageDirectUser(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	broker := newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "home/laundry", DMUsers: []int64{42}}
+	setupTestMappings(t, mapping)
+
+	doMessage(mapping, MQTTMessage{Topic: "home/laundry", Payload: []byte(`{"type": "message", "from": "washer", "message": "Your laundry is done", "user_id": 42}`)})
+
+	calls := telegram.Calls("sendMessage")
+	if len(calls) != 1 || calls[0].Params.Get("chat_id") != "42" {
+		t.Fatalf("expected the message sent only to the user, got %v", calls)
+	}
+
+	doMessage(mapping, MQTTMessage{Topic: "home/laundry", Payload: []byte(`{"type": "message", "from": "washer", "message": "Your laundry is done", "user_id": "7"}`)})
+
+	if calls := telegram.Calls("sendMessage"); len(calls) != 1 {
+		t.Errorf("expected the message to an user not in dm_users rejected, got %v", calls)
+	}
+	if errors := broker.Published("home/laundry_error"); len(errors) != 1 || !strings.Contains(string(errors[0].Payload), "not in dm_users") {
+		t.Errorf("expected the rejection published to the error topic, got %v", errors)
+	}
+}
+
+func TestDoMessageSigning(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	newFakeBroker(t)
+
+	key := []byte("s3cret")
+	image := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 32)...)
+	message := []byte(`{"type": "message", "from": "door", "message": "open"}`)
+
+	tests := []struct {
+		name    string
+		policy  string
+		payload []byte
+		method  string // Telegram method expected to be called, if any
+		text    string
+	}{
+		{"signed message", "", signPayload(key, message), "sendMessage", "*door*: open"},
+		{"unsigned message", "", message, "", ""},
+		{"wrong key", "", signPayload([]byte("other"), message), "", ""},
+		{"unsigned message flagged", SignatureFlag, message, "sendMessage", "*door*: open (unverified)"},
+		{"signed image", "", signPayload(key, image), "sendPhoto", "home/door"},
+		{"unsigned image", "", image, "", ""},
+		{"unsigned image flagged", SignatureFlag, image, "sendPhoto", "home/door (unverified)"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			telegram.Reset()
+
+			mapping := &Mapping{GroupID: -100, Topic: "home/door", SigningKey: string(key), SignaturePolicy: test.policy, BinaryImage: true}
+			setupTestMappings(t, mapping)
+
+			doMessage(mapping, MQTTMessage{Topic: "home/door", Payload: test.payload})
+
+			calls := telegram.Calls("")
+			if test.method == "" {
+				if len(calls) > 0 {
+					t.Errorf("expected the payload to be rejected, got %s", calls[0].Method)
+				}
+				return
+			}
+
+			if len(calls) != 1 || calls[0].Method != test.method {
+				t.Fatalf("expected a single %s call, got %v", test.method, calls)
+			}
+
+			sent := calls[0].Params.Get("text")
+			if test.method == "sendPhoto" {
+				sent = calls[0].Params.Get("caption")
+			}
+			if sent != test.text {
+				t.Errorf("expected text %q, got %q", test.text, sent)
+			}
+		})
+	}
+}
+
+func TestDoMessageToken(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	broker := newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "home/door", AuthToken: "shared", DeviceTokens: map[string]string{"lock": "l0ck"}}
+	setupTestMappings(t, mapping)
+
+	tests := []struct {
+		payload   string
+		delivered bool
+	}{
+		{`{"type": "message", "from": "bell", "message": "ring", "token": "shared"}`, true},
+		{`{"type": "message", "from": "lock", "message": "unlocked", "token": "l0ck"}`, true},
+		{`{"type": "message", "from": "lock", "message": "unlocked", "token": "shared"}`, false},
+		{`{"type": "message", "from": "bell", "message": "ring", "token": "wrong"}`, false},
+		{`{"type": "message", "from": "bell", "message": "ring"}`, false},
+	}
+
+	previousValues := lastValues
+	t.Cleanup(func() { lastValues = previousValues })
+
+	for _, test := range tests {
+		telegram.Reset()
+		broker.Reset()
+		lastValues = map[string]lastValue{}
+
+		doMessage(mapping, MQTTMessage{Topic: "home/door", Payload: []byte(test.payload), ResponseTopic: "home/reply"})
+
+		if calls := telegram.Calls("sendMessage"); (len(calls) == 1) != test.delivered {
+			t.Errorf("%s: expected delivered %t, got %v", test.payload, test.delivered, calls)
+		}
+
+		if !test.delivered && !strings.Contains(string(broker.Published("home/reply")[0].Payload), "token") {
+			t.Errorf("%s: expected the token error, got %v", test.payload, broker.Published("home/reply"))
+		}
+
+		recent := getRecentMessages()
+		if p := recent[len(recent)-1].Payload; strings.Contains(p, "token") || (!test.delivered && p != "") {
+			t.Errorf("%s: expected the validated payload without the token in the recent messages, got %s", test.payload, p)
+		}
+
+		v, recorded := lastValues["home/door"]
+		if recorded != test.delivered || strings.Contains(v.Payload, "token") {
+			t.Errorf("%s: expected the validated payload without the token as the last value, got %v", test.payload, v)
+		}
+	}
+}
+
+func TestDoMessageTelegramError(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	broker := newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "test/topic"}
+	setupTestMappings(t, mapping)
+
+	telegram.Fail("sendMessage", "Bad Request: message text is empty")
+
+	doMessage(mapping, MQTTMessage{
+		Topic:         mapping.Topic,
+		Payload:       []byte(`{"type": "message", "from": "sensor", "message": "hello"}`),
+		ResponseTopic: "test/reply",
+	})
+
+	var response rpcResponse
+	if replies := broker.Published("test/reply"); len(replies) == 1 {
+		json.Unmarshal(replies[0].Payload, &response)
+	}
+
+	if response.Status != rpcError || !strings.Contains(response.Error, "message text is empty") {
+		t.Errorf("expected telegram error response, got %+v", response)
+	}
+
+	if !strings.Contains(mapping.getLastError().Error, "message text is empty") {
+		t.Errorf("expected mapping last error to be recorded, got %+v", mapping.getLastError())
+	}
+}
+
+func TestDoMessageDeadLetter(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	broker := newFakeBroker(t)
+
+	previousBackoff := retryBackoff
+	retryBackoff = 0
+	t.Cleanup(func() { retryBackoff = previousBackoff })
+
+	mapping := &Mapping{GroupID: -100, Topic: "test/topic", DeadLetterTopic: "dead/{topic}", Retries: 2}
+	setupTestMappings(t, mapping)
+
+	telegram.Fail("sendMessage", "Bad Request: message text is empty")
+
+	tests := []struct {
+		payload  string
+		reason   FailureReason
+		attempts int
+	}{
+		{`{"type": "message"`, FailureSchema, 1},
+		{`{"type": "message", "message": 42}`, FailureSchema, 1},
+		{`{"type": "message", "from": "sensor", "message": "hello"}`, FailureDelivery, 3},
+	}
+
+	for _, test := range tests {
+		broker.Reset()
+		doMessage(mapping, MQTTMessage{Topic: mapping.Topic, Payload: []byte(test.payload)})
+
+		// The failed sends are retried and dead lettered in the background
+		waitFor(t, "the dead letter of "+test.payload, func() bool { return len(broker.Published("dead/test/topic")) > 0 })
+
+		published := broker.Published("dead/test/topic")
+		if len(published) != 1 {
+			t.Fatalf("%s: expected 1 dead letter, got %d", test.payload, len(published))
+		}
+
+		var dl DeadLetter
+		if err := json.Unmarshal(published[0].Payload, &dl); err != nil {
+			t.Fatalf("invalid dead letter %s: %s", published[0].Payload, err)
+		}
+
+		if dl.Topic != mapping.Topic || dl.Payload != test.payload || dl.Reason != test.reason || dl.Attempts != test.attempts || dl.Error == "" {
+			t.Errorf("unexpected dead letter %s", published[0].Payload)
+		}
+	}
+
+	if calls := telegram.Calls("sendMessage"); len(calls) != 3 {
+		t.Errorf("expected the send to be retried twice, got %d calls", len(calls))
+	}
+
+	// Wildcard mappings publish to the dead letter topic of the message topic
+	wildcard := &Mapping{GroupID: -200, Topic: "sensors/+", DeadLetterTopic: "{topic}_dead"}
+	setupTestMappings(t, wildcard)
+	broker.Reset()
+
+	doMessage(wildcard, MQTTMessage{Topic: "sensors/rack", Payload: []byte(`{"type": "message"`)})
+
+	if published := broker.Published("sensors/rack_dead"); len(published) != 1 {
+		t.Errorf("expected the dead letter at sensors/rack_dead, got %v", broker.Published(""))
+	}
+}
+
+func TestForwardToMQTTFlood(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	broker := newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "test/topic", MessageTo: "house"}
+	setupTestMappings(t, mapping)
+
+	floodProtection = newFloodProtection(0.001, 3, time.Minute)
+	t.Cleanup(func() { floodProtection = nil })
+
+	for i := 1; i <= 5; i++ {
+		forwardToMQTT(&models.Message{
+			ID:   i,
+			From: &models.User{ID: 42, FirstName: "Jane", LastName: "Doe", Username: "jane"},
+			Chat: models.Chat{ID: -100, Title: "Home"},
+			Text: "spam",
+		})
+	}
+
+	if published := broker.Published("test/topic_msg"); len(published) != 3 {
+		t.Fatalf("expected the 3 messages of the burst to be published, got %d", len(published))
+	}
+
+	if calls := telegram.Calls("sendMessage"); len(calls) != 1 {
+		t.Errorf("expected 1 flood notice, got %d", len(calls))
+	}
+
+	forwardToMQTT(&models.Message{
+		ID:   6,
+		From: &models.User{ID: 43, Username: "john"},
+		Chat: models.Chat{ID: -100, Title: "Home"},
+		Text: "hello",
+	})
+
+	if published := broker.Published("test/topic_msg"); len(published) != 4 {
+		t.Errorf("expected the other users to not be limited, got %d messages", len(published))
+	}
+}
+
+func TestForwardToMQTTSchemaV2(t *testing.T) {
+	newFakeTelegram(t)
+	broker := newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "test/topic", MessageTo: "house", OutboundSchema: SchemaV2}
+	setupTestMappings(t, mapping)
+
+	forwardToMQTT(&models.Message{
+		ID:             7,
+		Date:           1565445600,
+		From:           &models.User{ID: 42, FirstName: "Jane", LastName: "Doe", Username: "jane"},
+		Chat:           models.Chat{ID: -100, Title: "Home", Type: models.ChatTypeGroup},
+		Text:           "lights off",
+		ReplyToMessage: &models.Message{ID: 5},
+	})
+
+	published := broker.Published("test/topic_msg")
+	if len(published) != 1 {
+		t.Fatalf("expected 1 message on test/topic_msg, got %d", len(published))
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(published[0].Payload, &data); err != nil {
+		t.Fatalf("invalid payload %s: %s", published[0].Payload, err)
+	}
+
+	from, _ := data["from"].(map[string]interface{})
+	chat, _ := data["chat"].(map[string]interface{})
+
+	switch {
+	case data["version"] != 2.0 || data["sendmsg"] != nil:
+		t.Errorf("expected a v2 payload, got %s", published[0].Payload)
+	case data["text"] != "lights off" || data["message"] != "Jane Doe: lights off" || data["to"] != "house":
+		t.Errorf("unexpected text fields in %s", published[0].Payload)
+	case from["username"] != "jane" || chat["id"] != -100.0 || chat["type"] != "group":
+		t.Errorf("unexpected sender or chat in %s", published[0].Payload)
+	case data["message_id"] != 7.0 || data["reply_to_message_id"] != 5.0 || data["date"] != "2019-08-10T14:00:00Z":
+		t.Errorf("unexpected message metadata in %s", published[0].Payload)
+	}
+}
+
+func TestDoMessageCooldown(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "sensors/#", Cooldown: Duration{50 * time.Millisecond}}
+	setupTestMappings(t, mapping)
+
+	for _, topic := range []string{"sensors/hall", "sensors/hall", "sensors/garage", "sensors/hall"} {
+		doMessage(mapping, MQTTMessage{
+			Topic:   topic,
+			Payload: []byte(`{"type": "message", "from": "motion", "message": "motion detected"}`),
+		})
+	}
+
+	if calls := telegram.Calls("sendMessage"); len(calls) != 2 {
+		t.Fatalf("expected one alert per topic, got %d", len(calls))
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	calls := telegram.Calls("sendMessage")
+	if len(calls) != 3 || !strings.Contains(calls[2].Params.Get("text"), "2 more messages on sensors/hall") {
+		t.Errorf("expected the suppressed count of sensors/hall after the cooldown, got %v", calls)
+	}
+}
+
+func TestDoMessageCooldownAfterDelivery(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "sensors/hall", Cooldown: Duration{time.Minute}}
+	setupTestMappings(t, mapping)
+
+	payload := []byte(`{"type": "message", "from": "motion", "message": "motion detected"}`)
+
+	// A message that was not delivered does not start the cooldown
+	mapping.mute(time.Hour)
+	doMessage(mapping, MQTTMessage{Topic: mapping.Topic, Payload: payload})
+	mapping.unmute()
+
+	doMessage(mapping, MQTTMessage{Topic: mapping.Topic, Payload: payload})
+	doMessage(mapping, MQTTMessage{Topic: mapping.Topic, Payload: payload})
+
+	if calls := telegram.Calls("sendMessage"); len(calls) != 1 {
+		t.Errorf("expected the first delivered message to start the cooldown, got %d messages", len(calls))
+	}
+}
+
+func TestDoMessageUnencodablePayload(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	broker := newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "sensors/cbor", Codec: CodecCBOR}
+	setupTestMappings(t, mapping)
+
+	// {"message": "hi", "value": NaN}, which has no JSON encoding
+	payload := []byte("\xa2\x67message\x62hi\x65value\xfb\x7f\xf8\x00\x00\x00\x00\x00\x00")
+	doMessage(mapping, MQTTMessage{Topic: mapping.Topic, Payload: payload, ResponseTopic: "sensors/reply"})
+
+	var response rpcResponse
+	if replies := broker.Published("sensors/reply"); len(replies) == 1 {
+		json.Unmarshal(replies[0].Payload, &response)
+	}
+	if response.Status != rpcError {
+		t.Errorf("expected the payload to be rejected, got status %q", response.Status)
+	}
+	if calls := telegram.Calls("sendMessage"); len(calls) != 0 {
+		t.Errorf("expected no messages, got %d", len(calls))
+	}
+}
+
+func TestDoMessageExpectedInterval(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "greenhouse/temp", ExpectedInterval: Duration{40 * time.Millisecond}}
+	setupTestMappings(t, mapping)
+	t.Cleanup(mapping.stopWatchdogs)
+
+	payload := []byte(`{"type": "message", "from": "sensor", "message": "21.5"}`)
+	doMessage(mapping, MQTTMessage{Topic: "greenhouse/temp", Payload: payload})
+
+	time.Sleep(80 * time.Millisecond)
+
+	calls := telegram.Calls("sendMessage")
+	if len(calls) != 2 || !strings.Contains(calls[1].Params.Get("text"), "No data from greenhouse/temp") {
+		t.Fatalf("expected the silence notified after the expected interval, got %v", calls)
+	}
+
+	doMessage(mapping, MQTTMessage{Topic: "greenhouse/temp", Payload: payload})
+	time.Sleep(20 * time.Millisecond)
+
+	calls = telegram.Calls("sendMessage")
+	if len(calls) != 4 || !strings.Contains(calls[2].Params.Get("text")+calls[3].Params.Get("text"), "Data from greenhouse/temp resumed") {
+		t.Errorf("expected the message and the recovery, got %v", calls)
+	}
+}
+
+func TestDoMessageAcknowledge(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	broker := newFakeBroker(t)
+
+	mapping := &Mapping{GroupID: -100, Topic: "alarm", Acknowledge: &AckConfig{Timeout: Duration{30 * time.Millisecond}, Resend: 1, Topic: "{topic}_escalation"}}
+	setupTestMappings(t, mapping)
+
+	critical := []byte(`{"type": "message", "from": "smoke", "message": "smoke detected", "critical": true}`)
+
+	doMessage(mapping, MQTTMessage{Topic: "alarm", Payload: critical})
+
+	calls := telegram.Calls("sendMessage")
+	if len(calls) != 1 || !strings.Contains(calls[0].Params.Get("reply_markup"), ackCallbackPrefix) {
+		t.Fatalf("expected the alert with the acknowledge button, got %v", calls)
+	}
+
+	time.Sleep(45 * time.Millisecond)
+	if calls := telegram.Calls("sendMessage"); len(calls) != 2 || !strings.Contains(calls[1].Params.Get("text"), "Not acknowledged") {
+		t.Fatalf("expected the alert sent again after the timeout, got %v", calls)
+	}
+
+	time.Sleep(45 * time.Millisecond)
+	escalations := broker.Published("alarm_escalation")
+	if len(escalations) != 1 || !strings.Contains(string(escalations[0].Payload), `"event":"escalated"`) {
+		t.Fatalf("expected the escalation event, got %v", escalations)
+	}
+
+	telegram.Reset()
+	broker.Reset()
+	doMessage(mapping, MQTTMessage{Topic: "alarm", Payload: critical})
+
+	var data string
+	if calls := telegram.Calls("sendMessage"); len(calls) == 1 {
+		data = gjson.Get(calls[0].Params.Get("reply_markup"), "inline_keyboard.0.0.callback_data").String()
+	}
+
+	handleCallbackQuery(&models.CallbackQuery{
+		ID:      "1",
+		From:    models.User{ID: 42, FirstName: "Jane"},
+		Message: models.MaybeInaccessibleMessage{Message: &models.Message{ID: 1, Chat: models.Chat{ID: -100}}},
+		Data:    data,
+	})
+
+	if calls := telegram.Calls("editMessageText"); len(calls) != 1 || !strings.Contains(calls[0].Params.Get("text"), "Acknowledged by Jane") {
+		t.Errorf("expected the alert marked acknowledged, got %v", calls)
+	}
+
+	time.Sleep(45 * time.Millisecond)
+	if len(telegram.Calls("sendMessage")) != 1 {
+		t.Errorf("expected no resend after the acknowledgement")
+	}
+
+	events := broker.Published("alarm_escalation")
+	if len(events) != 1 || !strings.Contains(string(events[0].Payload), `"event":"acknowledged"`) {
+		t.Errorf("expected the acknowledgement event, got %v", events)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s        string
+		n        int
+		expected string
+	}{
+		{"hello", 10, "hello"},
+		{"hello world", 5, "hello..."},
+		{"água fria", 1, "..."},
+		{"água fria", 2, "á..."},
+		{"🌡️ 23.5", 3, "..."},
+	}
+
+	for _, test := range tests {
+		result := truncate(test.s, test.n)
+		if result != test.expected || !utf8.ValidString(result) {
+			t.Errorf("truncate(%q, %d): expected %q, got %q", test.s, test.n, test.expected, result)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// topicPrefix namespaces all topics of the bridge, like bridge/home1/, so many bridges can share a broker
+var topicPrefix = os.Getenv("topic_prefix")
+
+// MQTTMessage is a message received from or published to the MQTT broker.
+// UserProperties, Expiry, ResponseTopic and CorrelationData are only available on MQTT 5
+type MQTTMessage struct {
+	Topic           string
+	Payload         []byte
+	Retained        bool
+	UserProperties  map[string]string
+	Expiry          time.Duration // Remaining message expiry interval. Zero if not set
+	ResponseTopic   string
+	CorrelationData []byte
+}
+
+// MQTTHandler is called for every message received on a subscription
+type MQTTHandler func(msg MQTTMessage)
+
+// MQTTOptions are the connection options common to all MQTT clients
+type MQTTOptions struct {
+	BrokerURL            string
+	KeepAlive            time.Duration
+	PingTimeout          time.Duration
+	ConnectTimeout       time.Duration
+	MaxReconnectInterval time.Duration
+	Username             string
+	Password             func() string // Called on every connection
+
+	OnConnect        func()          // Called on every successful connection, including reconnections
+	OnConnectionLost func(err error) // Called when an established connection is lost
+}
+
+// MQTTClient is the broker transport, implemented by the MQTT 3.1.1, MQTT 5, NATS, Kafka, AMQP and Redis clients.
+// Subscriptions are restored automatically on reconnect.
+type MQTTClient interface {
+	Connect() error
+	Subscribe(topic string, handler MQTTHandler) error
+	Publish(msg MQTTMessage) error
+	IsConnected() bool
+	Disconnect()
+}
+
+// newMQTTClient creates the MQTT (or NATS, Kafka, AMQP and Redis, for nats://, kafka://, amqp:// and redis:// servers) client defined by mqtt_server, mqtt_version and the connection timing variables.
+// The client keeps connecting with the given password, so a password change does not affect the current client.
+func newMQTTClient(password string) (MQTTClient, error) {
+	brokerURL, err := parseBrokerURL(mqttHost)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mqtt_server %q: %s", mqttHost, err)
+	}
+
+	mqttOptions := MQTTOptions{
+		BrokerURL:            brokerURL,
+		PingTimeout:          getEnvDuration("mqtt_ping_timeout", 1*time.Second),
+		KeepAlive:            getEnvDuration("mqtt_keepalive", 2*time.Second),
+		ConnectTimeout:       getEnvDuration("mqtt_connect_timeout", 30*time.Second),
+		MaxReconnectInterval: getEnvDuration("mqtt_max_reconnect_interval", 10*time.Minute),
+		Username:             mqttUsername,
+		Password:             func() string { return password },
+		OnConnect:            onMQTTConnect,
+		OnConnectionLost:     onMQTTConnectionLost,
+	}
+
+	if strings.HasPrefix(brokerURL, "nats://") {
+		mqttLog.Info("Connecting to %s using NATS", brokerURL)
+		return newNATSClient(mqttOptions), nil
+	}
+
+	if strings.HasPrefix(brokerURL, "kafka://") {
+		mqttLog.Info("Connecting to %s using Kafka", brokerURL)
+		return newKafkaClient(mqttOptions), nil
+	}
+
+	if strings.HasPrefix(brokerURL, "amqp://") || strings.HasPrefix(brokerURL, "amqps://") {
+		mqttLog.Info("Connecting to %s using AMQP", brokerURL)
+		return newAMQPClient(mqttOptions), nil
+	}
+
+	if strings.HasPrefix(brokerURL, "redis://") || strings.HasPrefix(brokerURL, "rediss://") {
+		mqttLog.Info("Connecting to %s using Redis", brokerURL)
+		return newRedisClient(mqttOptions)
+	}
+
+	if mqttVersion == "5" {
+		mqttLog.Info("Connecting to %s using MQTT 5", brokerURL)
+		return newMQTT5Client(mqttOptions)
+	}
+
+	mqttLog.Info("Connecting to %s", brokerURL)
+	return newMQTT3Client(mqttOptions), nil
+}
+
+// topicMatches checks if a topic matches a subscription filter with + and # wildcards.
+// Shared subscription filters ($share/group/filter) match as the filter without the prefix.
+func topicMatches(filter, topic string) bool {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+
+	if f[0] == "$share" && len(f) > 2 {
+		f = f[2:]
+	}
+
+	for i, part := range f {
+		if part == "#" {
+			return true
+		}
+		if i >= len(t) {
+			return false
+		}
+		if part != "+" && part != t[i] {
+			return false
+		}
+	}
+
+	return len(f) == len(t)
+}
+
+// mqttTopic returns the broker topic of a bridge topic, with the topic_prefix
+func mqttTopic(topic string) string {
+	return topicPrefix + topic
+}
+
+// publishError publishes an error message to the mapping error topic
+func publishError(mapping *Mapping, topic, message string) {
+	errorTopic := mqttTopic(expandTopic(mapping.ErrorTopic, topic))
+
+	err := getMQTTClient().Publish(MQTTMessage{
+		Topic:   errorTopic,
+		Payload: []byte(message),
+	})
+
+	if err != nil {
+		mqttLog.Error("Error publishing to %s: %s", errorTopic, err)
+	}
+}
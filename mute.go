@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-telegram/bot/models"
+	"time"
+)
+
+var errMuted = fmt.Errorf("mapping muted")
+
+// isMuted returns true while the mapping is muted, counting the suppressed message
+func (m *Mapping) isMuted() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.mutedUntil.IsZero() || time.Now().After(m.mutedUntil) {
+		return false
+	}
+
+	m.mutedCount++
+	return true
+}
+
+// mute suppresses the mapping messages for d. The summary is sent to the mapping when the mute expires.
+func (m *Mapping) mute(d time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	until := time.Now().Add(d)
+	m.mutedUntil = until
+
+	if m.muteTimer != nil {
+		m.muteTimer.Stop()
+	}
+
+	m.muteTimer = time.AfterFunc(d, func() {
+		count := m.unmute()
+		sendToSinks(m, Notification{
+			Topic:   m.Topic,
+			From:    "Bridge",
+			Message: m.trMessage("mute_expired", count),
+		})
+	})
+}
+
+// unmute resumes the mapping messages, returning how many were suppressed
+func (m *Mapping) unmute() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.muteTimer != nil {
+		m.muteTimer.Stop()
+		m.muteTimer = nil
+	}
+
+	count := m.mutedCount
+	m.mutedUntil = time.Time{}
+	m.mutedCount = 0
+
+	return count
+}
+
+func muteCommand(msg *models.Message) string {
+	mapping, ok := groupMapping(msg.Chat.ID)
+	if !ok {
+		return translate(defaultLanguage, "not_mapped")
+	}
+
+	d, err := time.ParseDuration(commandArguments(msg))
+	if err != nil || d <= 0 {
+		return mapping.tr("mute_usage")
+	}
+
+	mapping.mute(d)
+	telLog.Info("Topic %s muted for %s by %s", mapping.Topic, d, telegramSender(msg))
+
+	return mapping.tr("muted", mapping.Topic, d)
+}
+
+func unmuteCommand(msg *models.Message) string {
+	mapping, ok := groupMapping(msg.Chat.ID)
+	if !ok {
+		return translate(defaultLanguage, "not_mapped")
+	}
+
+	count := mapping.unmute()
+	telLog.Info("Topic %s unmuted by %s", mapping.Topic, telegramSender(msg))
+
+	return mapping.tr("unmuted", mapping.Topic, count)
+}
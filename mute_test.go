@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/go-telegram/bot/models"
+	"testing"
+)
+
+func TestMuteChannelPost(t *testing.T) {
+	mapping := &Mapping{GroupID: -100, Topic: "test/topic"}
+	setupTestMappings(t, mapping)
+
+	// Channel posts have no sender
+	msg := &models.Message{Chat: models.Chat{ID: -100, Title: "Home", Type: models.ChatTypeChannel}, Text: "/mute 30m",
+		Entities: []models.MessageEntity{{Type: models.MessageEntityTypeBotCommand, Length: 5}}}
+
+	if reply := muteCommand(msg); reply != mapping.tr("muted", mapping.Topic, "30m0s") {
+		t.Errorf("unexpected mute reply %q", reply)
+	}
+	if mapping.mutedUntil.IsZero() {
+		t.Errorf("expected the mapping to be muted")
+	}
+
+	msg.Text, msg.Entities[0].Length = "/unmute", 7
+	if reply := unmuteCommand(msg); reply != mapping.tr("unmuted", mapping.Topic, 0) {
+		t.Errorf("unexpected unmute reply %q", reply)
+	}
+	if !mapping.mutedUntil.IsZero() {
+		t.Errorf("expected the mapping to be unmuted")
+	}
+}
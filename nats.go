@@ -0,0 +1,136 @@
+package main
+
+import (
+	"github.com/nats-io/nats.go"
+	"strings"
+	"sync"
+	"time"
+)
+
+// natsClient is a NATS client using nats.go. Topics are converted to subjects (sensors/+/temp to sensors.*.temp,
+// # to >) and back, so the mappings work unchanged. NATS has no retained messages.
+type natsClient struct {
+	conn    *nats.Conn
+	options MQTTOptions
+
+	lock          sync.Mutex
+	subscriptions []*nats.Subscription
+}
+
+func newNATSClient(o MQTTOptions) *natsClient {
+	return &natsClient{options: o}
+}
+
+// natsSubject converts a MQTT topic or filter to a NATS subject
+func natsSubject(topic string) string {
+	return strings.NewReplacer("/", ".", "+", "*", "#", ">").Replace(topic)
+}
+
+// natsTopic converts a NATS subject to a MQTT topic
+func natsTopic(subject string) string {
+	return strings.Replace(subject, ".", "/", -1)
+}
+
+func (c *natsClient) Connect() error {
+	opts := []nats.Option{
+		nats.Name("mqtttelegram"),
+		nats.Timeout(c.options.ConnectTimeout),
+		nats.PingInterval(c.options.KeepAlive),
+		nats.MaxReconnects(-1),
+		nats.CustomReconnectDelay(func(attempts int) time.Duration {
+			d := time.Duration(attempts) * time.Second
+			if d > c.options.MaxReconnectInterval {
+				d = c.options.MaxReconnectInterval
+			}
+			return d
+		}),
+		nats.ConnectHandler(func(*nats.Conn) { c.onConnect() }),
+		nats.ReconnectHandler(func(*nats.Conn) { c.onConnect() }),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil && c.options.OnConnectionLost != nil {
+				c.options.OnConnectionLost(err)
+			}
+		}),
+	}
+
+	if c.options.Username != "" {
+		opts = append(opts, nats.UserInfoHandler(func() (string, string) {
+			return c.options.Username, c.options.Password()
+		}))
+	}
+
+	conn, err := nats.Connect(c.options.BrokerURL, opts...)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+
+	return nil
+}
+
+func (c *natsClient) onConnect() {
+	if c.options.OnConnect != nil {
+		c.options.OnConnect()
+	}
+}
+
+// Subscribe subscribes to the subject of the topic filter. Shared subscriptions ($share/group/filter) are NATS queue groups.
+// NATS restores the subscriptions on reconnect.
+func (c *natsClient) Subscribe(topic string, handler MQTTHandler) error {
+	queue := ""
+	if parts := strings.SplitN(topic, "/", 3); parts[0] == "$share" && len(parts) == 3 {
+		queue, topic = parts[1], parts[2]
+	}
+
+	sub, err := c.conn.QueueSubscribe(natsSubject(topic), queue, func(m *nats.Msg) {
+		msg := MQTTMessage{
+			Topic:   natsTopic(m.Subject),
+			Payload: m.Data,
+		}
+
+		if m.Reply != "" {
+			msg.ResponseTopic = natsTopic(m.Reply)
+		}
+
+		if len(m.Header) > 0 {
+			msg.UserProperties = map[string]string{}
+			for k := range m.Header {
+				msg.UserProperties[k] = m.Header.Get(k)
+			}
+		}
+
+		handler(msg)
+	})
+
+	if err != nil {
+		mqttLog.Error("Error subscribing to %s: %s", natsSubject(topic), err)
+		return err
+	}
+
+	c.lock.Lock()
+	c.subscriptions = append(c.subscriptions, sub)
+	c.lock.Unlock()
+
+	return nil
+}
+
+func (c *natsClient) Publish(msg MQTTMessage) error {
+	m := nats.NewMsg(natsSubject(msg.Topic))
+	m.Data = msg.Payload
+
+	for k, v := range msg.UserProperties {
+		m.Header.Set(k, v)
+	}
+
+	return c.conn.PublishMsg(m)
+}
+
+func (c *natsClient) IsConnected() bool {
+	return c.conn != nil && c.conn.IsConnected()
+}
+
+func (c *natsClient) Disconnect() {
+	if c.conn != nil {
+		c.conn.Drain()
+	}
+}
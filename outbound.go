@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-telegram/bot/models"
+	"time"
+)
+
+// Outbound payload schemas of the Telegram messages published to MQTT
+const (
+	SchemaV1 = "v1" // Legacy {sendmsg, to, message} payloads (default)
+	SchemaV2 = "v2" // Payloads with the version, raw text, sender, chat and message metadata
+)
+
+// outboundPayload returns the payload published for data in the mapping outbound schema
+func outboundPayload(mapping *Mapping, msg *models.Message, data map[string]interface{}) map[string]interface{} {
+	if mapping.OutboundSchema != SchemaV2 {
+		return data
+	}
+
+	payload := map[string]interface{}{}
+	for k, v := range data {
+		if k != "sendmsg" {
+			payload[k] = v
+		}
+	}
+
+	payload["version"] = 2
+	payload["message_id"] = msg.ID
+	payload["date"] = time.Unix(int64(msg.Date), 0).UTC().Format(time.RFC3339)
+	payload["chat"] = map[string]interface{}{
+		"id":    msg.Chat.ID,
+		"title": msg.Chat.Title,
+		"type":  msg.Chat.Type,
+	}
+
+	if text := messageText(msg); text != "" {
+		payload["text"] = text
+	}
+
+	if msg.From != nil {
+		payload["from"] = map[string]interface{}{
+			"id":         msg.From.ID,
+			"username":   msg.From.Username,
+			"first_name": msg.From.FirstName,
+			"last_name":  msg.From.LastName,
+			"is_bot":     msg.From.IsBot,
+		}
+	}
+
+	if msg.ReplyToMessage != nil {
+		payload["reply_to_message_id"] = msg.ReplyToMessage.ID
+	}
+
+	return payload
+}
+
+// setupOutboundSchema checks the mapping outbound_schema, defaulting to v1
+func (m *Mapping) setupOutboundSchema() error {
+	switch m.OutboundSchema {
+	case "":
+		m.OutboundSchema = SchemaV1
+	case SchemaV1, SchemaV2:
+	default:
+		return fmt.Errorf("invalid outbound_schema %q", m.OutboundSchema)
+	}
+
+	return nil
+}
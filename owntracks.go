@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"strings"
+	"unicode/utf8"
+)
+
+// isOwnTracksLocation checks if a payload is an OwnTracks location
+func isOwnTracksLocation(data map[string]interface{}) bool {
+	_, hasLat := data["lat"].(float64)
+	_, hasLon := data["lon"].(float64)
+
+	return data["_type"] == "location" && hasLat && hasLon
+}
+
+// deliverOwnTracks sends an OwnTracks location to the mapping group, as a venue with the battery,
+// velocity and accuracy when available, or as a location pin
+func deliverOwnTracks(mapping *Mapping, topic string, data map[string]interface{}) error {
+	if mapping.isMuted() {
+		return errMuted
+	}
+
+	lat, lon := data["lat"].(float64), data["lon"].(float64)
+
+	var details []string
+	if batt, ok := data["batt"].(float64); ok {
+		details = append(details, fmt.Sprintf("battery %.0f%%", batt))
+	}
+	if vel, ok := data["vel"].(float64); ok {
+		details = append(details, fmt.Sprintf("%.0f km/h", vel))
+	}
+	if acc, ok := data["acc"].(float64); ok {
+		details = append(details, fmt.Sprintf("±%.0f m", acc))
+	}
+
+	sink := mapping.telegramSink()
+	send := func(ctx context.Context) error {
+		_, err := getTelegramBot().SendLocation(ctx, &bot.SendLocationParams{ChatID: sink.ChatID, MessageThreadID: sink.Options.ThreadID, Latitude: lat, Longitude: lon})
+		return err
+	}
+	if len(details) > 0 {
+		name := topicDevice(topic)
+		if tid, ok := data["tid"].(string); ok && tid != "" {
+			name = tid
+		}
+		send = func(ctx context.Context) error {
+			_, err := getTelegramBot().SendVenue(ctx, &bot.SendVenueParams{ChatID: sink.ChatID, MessageThreadID: sink.Options.ThreadID, Latitude: lat, Longitude: lon, Title: name, Address: strings.Join(details, ", ")})
+			return err
+		}
+	}
+
+	err := sink.SendRequest(send)
+	mapping.trackDelivery(err)
+
+	return err
+}
+
+// publishOwnTracks publishes a location shared in Telegram as an OwnTracks location to the mapping owntracks_topic
+func publishOwnTracks(mapping *Mapping, msg *models.Message) {
+	tid := "TG"
+	if msg.From != nil {
+		tid = initials(msg.From.FirstName, msg.From.LastName)
+	}
+
+	location := msg.Location
+	if msg.Venue != nil {
+		location = &msg.Venue.Location
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"_type": "location",
+		"lat":   location.Latitude,
+		"lon":   location.Longitude,
+		"tst":   msg.Date,
+		"tid":   tid,
+		"t":     "u", // Manually published
+	})
+
+	topic := mqttTopic(expandMessageTopic(mapping.OwnTracksTopic, mapping.Topic, msg))
+	if err := getMQTTClient().Publish(MQTTMessage{Topic: topic, Payload: payload, Retained: true}); err != nil {
+		mqttLog.Error("Error publishing to %s: %s", topic, err)
+	}
+}
+
+// initials returns the OwnTracks tracker id of a name, like JD for John Doe
+func initials(names ...string) string {
+	var tid string
+	for _, name := range names {
+		if r, _ := utf8.DecodeRuneInString(name); r != utf8.RuneError {
+			tid += string(r)
+		}
+	}
+
+	return strings.ToUpper(tid)
+}
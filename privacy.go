@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"github.com/quan-to/slog"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// logPrivacy hides the message contents in the logs, keeping only their size
+var logPrivacy = os.Getenv("log_privacy") == "true"
+
+var privacyLock sync.Mutex
+
+// logRedactions mask the secrets and contacts written in the logs: bot tokens, the token fields of the payloads,
+// international phone numbers and the phone_number fields of the shared contacts
+var logRedactions = []struct {
+	expr        *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`\d{6,12}:[A-Za-z0-9_-]{30,}`), "***"},
+	{regexp.MustCompile(`\+\d[\d ().-]{6,}\d`), "+***"},
+	{regexp.MustCompile(`("phone_number" ?: ?)"[^"]*"`), `$1"***"`},
+	{regexp.MustCompile(`("token" ?: ?)"[^"]*"`), `$1"***"`},
+}
+
+// redactingWriter masks the secrets of the log lines before writing them to out
+type redactingWriter struct {
+	out io.Writer
+}
+
+func (w redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.out, redactLog(string(p))); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// logOutput is the output of all loggers
+var logOutput io.Writer = redactingWriter{out: os.Stdout}
+
+func init() {
+	slog.SetDefaultOutput(logOutput)
+}
+
+// newLogger returns a scoped logger writing to logOutput
+func newLogger(scope string) *slog.Instance {
+	return slog.Scope(scope).WithCustomWriter(logOutput)
+}
+
+// redactLog masks the secrets of a log line, like the bot token and the MQTT password
+func redactLog(line string) string {
+	for _, secret := range []string{getTelegramBotToken(), getMQTTPassword(), controlToken, broadcastToken} {
+		if len(secret) >= 4 {
+			line = strings.ReplaceAll(line, secret, "***")
+		}
+	}
+
+	for _, r := range logRedactions {
+		line = r.expr.ReplaceAllString(line, r.replacement)
+	}
+
+	return line
+}
+
+// isPrivacyMode returns true when the message contents are hidden in the logs
+func isPrivacyMode() bool {
+	privacyLock.Lock()
+	defer privacyLock.Unlock()
+
+	return logPrivacy
+}
+
+func setPrivacyMode(enabled bool) {
+	privacyLock.Lock()
+	logPrivacy = enabled
+	privacyLock.Unlock()
+}
+
+// logText returns a message content to be logged, or only its size in privacy mode
+func logText(text string) string {
+	if isPrivacyMode() {
+		return fmt.Sprintf("<%d bytes>", len(text))
+	}
+
+	return text
+}
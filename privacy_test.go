@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRedactLog(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{"request url: https://api.telegram.org/bot123456789:AAHdqTcvCH1vGWJxfSeofSAs0K5PALDsaw/getMe", "request url: https://api.telegram.org/bot***/getMe"},
+		{"John: call me at +55 11 91234-5678", "John: call me at +***"},
+		{`{"contact": {"first_name": "Jane", "phone_number": "5511912345678"}}`, `{"contact": {"first_name": "Jane", "phone_number": "***"}}`},
+		{`{"type": "message", "from": "lock", "token": "l0ck"}`, `{"type": "message", "from": "lock", "token": "***"}`},
+		{"Mapping Telegram Group -100123456 to MQTT Topic home at 2026-10-14", "Mapping Telegram Group -100123456 to MQTT Topic home at 2026-10-14"},
+	}
+
+	for _, test := range tests {
+		if line := redactLog(test.line); line != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, line)
+		}
+	}
+}
+
+func TestLogText(t *testing.T) {
+	if text := logText("hello"); text != "hello" {
+		t.Errorf("expected the text outside privacy mode, got %q", text)
+	}
+
+	setPrivacyMode(true)
+	defer setPrivacyMode(false)
+
+	if text := logText("hello"); text != "<5 bytes>" {
+		t.Errorf("expected only the size in privacy mode, got %q", text)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Profile formats the payloads of a device ecosystem, like zigbee2mqtt, into messages
+type Profile interface {
+	// Format returns the sender and text of a device payload, or false if there is nothing to send
+	Format(topic string, data map[string]interface{}) (from, message string, ok bool)
+}
+
+var profiles = map[string]func() Profile{
+	"zigbee2mqtt": newZigbee2MQTTProfile,
+	"tasmota":     newTasmotaProfile,
+	"esphome":     newESPHomeProfile,
+}
+
+// getProfile creates the named formatter profile. Each mapping has its own profile state.
+func getProfile(name string) (Profile, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	newProfile, ok := profiles[name]
+	if !ok {
+		var names []string
+		for n := range profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("invalid profile %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+
+	return newProfile(), nil
+}
+
+// applyProfile turns a device payload without type into a message, using the mapping profile
+func (m *Mapping) applyProfile(topic string, data map[string]interface{}) {
+	if m.profile == nil || data["type"] != nil {
+		return
+	}
+
+	from, message, ok := m.profile.Format(topic, data)
+	if !ok {
+		return
+	}
+
+	data["type"] = "message"
+	data["from"] = from
+	data["message"] = message
+}
+
+// topicDevice returns the topic without its first level, like zigbee2mqtt/Front Door is Front Door
+func topicDevice(topic string) string {
+	parts := strings.SplitN(topic, "/", 2)
+	if len(parts) < 2 {
+		return topic
+	}
+
+	return parts[1]
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// esphomeProfile reports the changes of ESPHome states, published at <node>/<component>/<name>/state
+// and <node>/status
+type esphomeProfile struct {
+	lock sync.Mutex
+	last map[string]string
+}
+
+func newESPHomeProfile() Profile {
+	return &esphomeProfile{last: map[string]string{}}
+}
+
+func (p *esphomeProfile) Format(topic string, data map[string]interface{}) (string, string, bool) {
+	parts := strings.Split(topic, "/")
+
+	if len(parts) == 2 && parts[1] == "status" {
+		value, _ := data["value"].(string)
+		return parts[0], "is " + value, value != ""
+	}
+
+	if len(parts) != 4 || parts[3] != "state" {
+		return "", "", false
+	}
+
+	node, name := parts[0], strings.Replace(parts[2], "_", " ", -1)
+
+	// Sensors are plain values, lights and fans are JSON with the state
+	value := fmt.Sprint(data["value"])
+	if data["value"] == nil {
+		state, ok := data["state"].(string)
+		if !ok {
+			return "", "", false
+		}
+		value = state
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.last[topic] == value {
+		return "", "", false
+	}
+	p.last[topic] = value
+
+	return node, fmt.Sprintf("%s %s", name, value), true
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// tasmotaUnits are the units of the Tasmota sensor fields. Temperature and pressure units come in the payload
+var tasmotaUnits = map[string]string{
+	"Humidity":      "%",
+	"Power":         " W",
+	"Voltage":       " V",
+	"Current":       " A",
+	"Today":         " kWh",
+	"Yesterday":     " kWh",
+	"Total":         " kWh",
+	"Illuminance":   " lx",
+	"CarbonDioxide": " ppm",
+}
+
+// tasmotaProfile summarizes Tasmota telemetry, published at tele/<device>/SENSOR, tele/<device>/STATE,
+// tele/<device>/LWT and stat/<device>/POWER or RESULT
+type tasmotaProfile struct {
+	lock  sync.Mutex
+	power map[string]string
+}
+
+func newTasmotaProfile() Profile {
+	return &tasmotaProfile{power: map[string]string{}}
+}
+
+func (p *tasmotaProfile) Format(topic string, data map[string]interface{}) (string, string, bool) {
+	parts := strings.Split(topic, "/")
+	if len(parts) < 2 {
+		return "", "", false
+	}
+
+	device, kind := parts[len(parts)-2], parts[len(parts)-1]
+
+	switch {
+	case kind == "SENSOR":
+		summary := tasmotaSensors(data)
+		return device, summary, summary != ""
+	case kind == "LWT":
+		value, _ := data["value"].(string)
+		return device, "is " + strings.ToLower(value), value != ""
+	case strings.HasPrefix(kind, "POWER"): // Plain ON / OFF
+		value, _ := data["value"].(string)
+		return p.powerChanges(device, map[string]interface{}{kind: value})
+	case kind == "STATE" || kind == "RESULT":
+		return p.powerChanges(device, data)
+	}
+
+	return "", "", false
+}
+
+// powerChanges reports the POWER fields that changed since the last payload of the device
+func (p *tasmotaProfile) powerChanges(device string, data map[string]interface{}) (string, string, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var events []string
+	for _, field := range sortedKeys(data) {
+		value, ok := data[field].(string)
+		if !strings.HasPrefix(field, "POWER") || !ok {
+			continue
+		}
+
+		key := device + "/" + field
+		if p.power[key] != value {
+			p.power[key] = value
+			events = append(events, fmt.Sprintf("%s %s", field, value))
+		}
+	}
+
+	return device, strings.Join(events, ", "), len(events) > 0
+}
+
+// tasmotaSensors summarizes a SENSOR payload, like AM2301: Temperature 23.4°C, Humidity 55%
+func tasmotaSensors(data map[string]interface{}) string {
+	units := map[string]string{}
+	for k, v := range tasmotaUnits {
+		units[k] = v
+	}
+	if unit, ok := data["TempUnit"].(string); ok {
+		units["Temperature"] = "°" + unit
+		units["DewPoint"] = "°" + unit
+	}
+	if unit, ok := data["PressureUnit"].(string); ok {
+		units["Pressure"] = " " + unit
+		units["SeaPressure"] = " " + unit
+	}
+
+	var sensors []string
+	for _, name := range sortedKeys(data) {
+		fields, ok := data[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		var values []string
+		for _, field := range sortedKeys(fields) {
+			if value, ok := fields[field].(float64); ok {
+				values = append(values, fmt.Sprintf("%s %v%s", field, value, units[field]))
+			}
+		}
+		if len(values) > 0 {
+			sensors = append(sensors, fmt.Sprintf("%s: %s", name, strings.Join(values, ", ")))
+		}
+	}
+
+	return strings.Join(sensors, "; ")
+}
+
+func sortedKeys(data map[string]interface{}) []string {
+	var keys []string
+	for k := range data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
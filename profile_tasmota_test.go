@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestTasmotaSensorFormat(t *testing.T) {
+	p := newTasmotaProfile()
+
+	from, message, ok := p.Format("tele/kitchen/SENSOR", map[string]interface{}{
+		"Time":     "2024-01-01T10:00:00",
+		"AM2301":   map[string]interface{}{"Temperature": 23.5},
+		"TempUnit": "C",
+	})
+	if !ok || from != "kitchen" || message != "AM2301: Temperature 23.5°C" {
+		t.Errorf("unexpected sensor summary %q from %q (%v)", message, from, ok)
+	}
+
+	// Payloads without sensor values, like only the time, are not sent
+	if _, message, ok := p.Format("tele/kitchen/SENSOR", map[string]interface{}{"Time": "2024-01-01T10:00:00"}); ok {
+		t.Errorf("expected no message for a payload without sensors, got %q", message)
+	}
+}
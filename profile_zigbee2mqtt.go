@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// lowBattery is the battery percentage reported as low
+const lowBattery = 20
+
+// zigbee2mqttStates are the boolean device fields reported on change, with the text of true and false
+var zigbee2mqttStates = []struct {
+	field       string
+	true, false string
+}{
+	{"contact", "closed", "opened"},
+	{"occupancy", "occupancy detected", "occupancy cleared"},
+	{"presence", "presence detected", "presence cleared"},
+	{"water_leak", "water leak detected", "water leak cleared"},
+	{"smoke", "smoke detected", "smoke cleared"},
+	{"gas", "gas detected", "gas cleared"},
+	{"carbon_monoxide", "carbon monoxide detected", "carbon monoxide cleared"},
+	{"tamper", "tampered", "tamper cleared"},
+	{"vibration", "vibration detected", "vibration stopped"},
+	{"battery_low", "battery low", "battery ok"},
+}
+
+// zigbee2mqttProfile reports the changes of zigbee2mqtt device states, published at zigbee2mqtt/<friendly name>
+type zigbee2mqttProfile struct {
+	lock sync.Mutex
+	last map[string]map[string]interface{}
+}
+
+func newZigbee2MQTTProfile() Profile {
+	return &zigbee2mqttProfile{last: map[string]map[string]interface{}{}}
+}
+
+func (p *zigbee2mqttProfile) Format(topic string, data map[string]interface{}) (string, string, bool) {
+	device := topicDevice(topic)
+
+	if strings.HasPrefix(device, "bridge/") || strings.HasSuffix(device, "/set") || strings.HasSuffix(device, "/get") {
+		return "", "", false
+	}
+
+	if strings.HasSuffix(device, "/availability") {
+		state, _ := data["state"].(string)
+		if state == "" {
+			return "", "", false
+		}
+		return strings.TrimSuffix(device, "/availability"), "is " + state, true
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	last, seen := p.last[device]
+	p.last[device] = data
+
+	var events []string
+
+	// Actions are events, sent every time
+	if action, _ := data["action"].(string); action != "" {
+		events = append(events, "action "+action)
+	}
+
+	// States are only reported on change, the first payload of a device is its initial state
+	if !seen {
+		return device, strings.Join(events, ", "), len(events) > 0
+	}
+
+	for _, s := range zigbee2mqttStates {
+		value, ok := data[s.field].(bool)
+		previous, hasPrevious := last[s.field].(bool)
+		if !ok || (hasPrevious && value == previous) {
+			continue
+		}
+		if value {
+			events = append(events, s.true)
+		} else {
+			events = append(events, s.false)
+		}
+	}
+
+	if state, ok := data["state"].(string); ok && state != last["state"] {
+		events = append(events, "turned "+strings.ToLower(state))
+	}
+
+	battery, ok := numericValue(data["battery"])
+	previous, hasPrevious := numericValue(last["battery"])
+	if ok && battery < lowBattery && (!hasPrevious || previous >= lowBattery) {
+		events = append(events, fmt.Sprintf("battery at %.0f%%", battery))
+	}
+
+	return device, strings.Join(events, ", "), len(events) > 0
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// autoProvisionTopic is the topic pattern of the mappings created when the bot is added to a new group, like
+// telegram/{chat_id}. Disabled when empty.
+var autoProvisionTopic = os.Getenv("auto_provision_topic")
+
+// autoProvisionFile keeps the approved mappings across restarts
+var autoProvisionFile = os.Getenv("auto_provision_file")
+
+const provisionCallbackPrefix = "provision:"
+
+// provisionedChat is a group mapped by the auto provisioning
+type provisionedChat struct {
+	ChatID   int64     `json:"chat_id"`
+	Title    string    `json:"title"`
+	Topic    string    `json:"topic"`
+	Approved time.Time `json:"approved"`
+}
+
+var provisionLock = sync.Mutex{}
+var provisionRequests = map[int64]provisionedChat{}
+var provisionedChats []provisionedChat
+
+// newProvisionedMapping returns the mapping of a provisioned chat. Telegram messages are published with the chat id as messageTo.
+func newProvisionedMapping(p provisionedChat) (*Mapping, error) {
+	m := &Mapping{GroupID: p.ChatID, Topic: p.Topic, MessageTo: strconv.FormatInt(p.ChatID, 10)}
+	if err := m.setup(); err != nil {
+		return nil, fmt.Errorf("invalid provisioned mapping for topic %s: %s", p.Topic, err)
+	}
+
+	return m, nil
+}
+
+// loadProvisionedMappings returns the mappings approved before, from the auto_provision_file
+func loadProvisionedMappings() ([]*Mapping, error) {
+	if autoProvisionFile == "" {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(autoProvisionFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading auto_provision_file: %s", err)
+	}
+
+	provisionLock.Lock()
+	defer provisionLock.Unlock()
+
+	if err := json.Unmarshal(data, &provisionedChats); err != nil {
+		return nil, fmt.Errorf("error parsing auto_provision_file: %s", err)
+	}
+
+	var mappings []*Mapping
+	for _, p := range provisionedChats {
+		m, err := newProvisionedMapping(p)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, m)
+	}
+
+	return mappings, nil
+}
+
+// saveProvisionedChats writes the approved mappings to the auto_provision_file. Called with the lock held.
+func saveProvisionedChats() {
+	if autoProvisionFile == "" {
+		return
+	}
+
+	data, _ := json.MarshalIndent(provisionedChats, "", "  ")
+
+	tmpFile := autoProvisionFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, data, 0600); err != nil {
+		telLog.Error("Error saving provisioned mappings to %s: %s", autoProvisionFile, err)
+		return
+	}
+
+	if err := os.Rename(tmpFile, autoProvisionFile); err != nil {
+		telLog.Error("Error saving provisioned mappings to %s: %s", autoProvisionFile, err)
+	}
+}
+
+// requestProvisioning asks the admin to approve a mapping of a new group the bot was added to
+func requestProvisioning(msg *models.Message) {
+	if autoProvisionTopic == "" {
+		return
+	}
+
+	if _, ok := groupMapping(msg.Chat.ID); ok {
+		return
+	}
+
+	admin, err := strconv.ParseInt(telegramAdminId, 10, 64)
+	if err != nil {
+		telLog.Warn("Cannot provision chat %d, telegram_admin must be an user id", msg.Chat.ID)
+		return
+	}
+
+	topic := expandMessageTopic(autoProvisionTopic, "", msg)
+	if _, ok := topicMapping(topic); ok {
+		notifyAdmin(fmt.Sprintf("Bot added to chat %d (%s), but topic %s is already mapped", msg.Chat.ID, msg.Chat.Title, topic))
+		return
+	}
+
+	provisionLock.Lock()
+	provisionRequests[msg.Chat.ID] = provisionedChat{ChatID: msg.Chat.ID, Title: msg.Chat.Title, Topic: topic}
+	provisionLock.Unlock()
+
+	chat := strconv.FormatInt(msg.Chat.ID, 10)
+	keyboard := models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{{
+		{Text: "✅ Approve", CallbackData: provisionCallbackPrefix + "approve:" + chat},
+		{Text: "❌ Reject", CallbackData: provisionCallbackPrefix + "reject:" + chat},
+	}}}
+
+	telLog.Info("Requesting approval to map chat %d (%s) to topic %s", msg.Chat.ID, msg.Chat.Title, topic)
+
+	_, err = sendTelegram(&bot.SendMessageParams{
+		ChatID:      admin,
+		Text:        fmt.Sprintf("Bot added to chat %d (%s) by %s. Map it to topic %s?", msg.Chat.ID, msg.Chat.Title, telegramSender(msg), topic),
+		ReplyMarkup: keyboard,
+	})
+	if err != nil {
+		telLog.Error("Error requesting provisioning approval: %s", err)
+	}
+}
+
+// handleProvisionCallback approves or rejects a provisioning request, on a button press of the admin
+func handleProvisionCallback(q *models.CallbackQuery) {
+	if !isAdmin(&q.From) {
+		return
+	}
+
+	action, chat, _ := strings.Cut(strings.TrimPrefix(q.Data, provisionCallbackPrefix), ":")
+	chatID, err := strconv.ParseInt(chat, 10, 64)
+	if err != nil {
+		return
+	}
+
+	provisionLock.Lock()
+	p, ok := provisionRequests[chatID]
+	delete(provisionRequests, chatID)
+	provisionLock.Unlock()
+
+	if !ok {
+		return
+	}
+
+	result := fmt.Sprintf("Chat %d (%s) not mapped", p.ChatID, p.Title)
+	if action == "approve" {
+		if err := provisionChat(p); err != nil {
+			result = fmt.Sprintf("Error mapping chat %d (%s): %s", p.ChatID, p.Title, err)
+		} else {
+			result = fmt.Sprintf("Chat %d (%s) mapped to topic %s", p.ChatID, p.Title, p.Topic)
+		}
+	}
+
+	telLog.Info("%s", result)
+
+	if q.Message.Message == nil {
+		return
+	}
+
+	ctx, cancel := telegramContext(context.Background())
+	defer cancel()
+
+	_, err = getTelegramBot().EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    q.Message.Message.Chat.ID,
+		MessageID: q.Message.Message.ID,
+		Text:      result,
+	})
+	if err != nil {
+		telLog.Error("Error updating provisioning request: %s", err)
+	}
+}
+
+// provisionChat creates, subscribes and saves the mapping of an approved chat
+func provisionChat(p provisionedChat) error {
+	if _, ok := topicMapping(p.Topic); ok {
+		return fmt.Errorf("topic %s is already mapped", p.Topic)
+	}
+
+	m, err := newProvisionedMapping(p)
+	if err != nil {
+		return err
+	}
+
+	if err := trySubscribe(sharedTopic(mqttTopic(m.Topic)), mappingHandler(m)); err != nil {
+		return fmt.Errorf("error subscribing to %s: %s", m.Topic, err)
+	}
+	addMapping(m)
+
+	p.Approved = time.Now().UTC()
+
+	provisionLock.Lock()
+	provisionedChats = append(provisionedChats, p)
+	saveProvisionedChats()
+	provisionLock.Unlock()
+
+	if _, err := sendTelegram(&bot.SendMessageParams{ChatID: p.ChatID, Text: m.tr("provisioned", p.Topic)}); err != nil {
+		telLog.Error("Error notifying chat %d: %s", p.ChatID, err)
+	}
+
+	return nil
+}
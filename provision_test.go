@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"github.com/go-telegram/bot/models"
+	"github.com/tidwall/gjson"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAutoProvisioning(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	broker := newFakeBroker(t)
+	setupTestMappings(t)
+
+	previousTopic, previousFile, previousAdmin := autoProvisionTopic, autoProvisionFile, telegramAdminId
+	autoProvisionTopic, autoProvisionFile, telegramAdminId = "telegram/{chat_id}", filepath.Join(t.TempDir(), "provisioned.json"), "7"
+	provisionedChats = nil
+	t.Cleanup(func() {
+		autoProvisionTopic, autoProvisionFile, telegramAdminId = previousTopic, previousFile, previousAdmin
+		provisionedChats = nil
+	})
+
+	handleTelegramUpdate(context.Background(), nil, &models.Update{Message: &models.Message{
+		ID:             1,
+		From:           &models.User{ID: 42, Username: "jane"},
+		Chat:           models.Chat{ID: -300, Title: "Garage", Type: "group"},
+		NewChatMembers: []models.User{{ID: 1, IsBot: true}},
+	}})
+
+	calls := telegram.Calls("sendMessage")
+	if len(calls) != 1 || calls[0].Params.Get("chat_id") != "7" || !strings.Contains(calls[0].Params.Get("text"), "telegram/-300") {
+		t.Fatalf("expected the approval request sent to the admin, got %v", calls)
+	}
+
+	approve := gjson.Get(calls[0].Params.Get("reply_markup"), "inline_keyboard.0.0.callback_data").String()
+
+	handleCallbackQuery(&models.CallbackQuery{
+		ID:      "1",
+		From:    models.User{ID: 42},
+		Message: models.MaybeInaccessibleMessage{Message: &models.Message{ID: 1, Chat: models.Chat{ID: 7}}},
+		Data:    approve,
+	})
+	if _, ok := groupMappings[-300]; ok {
+		t.Fatalf("expected only the admin to approve")
+	}
+
+	handleCallbackQuery(&models.CallbackQuery{
+		ID:      "2",
+		From:    models.User{ID: 7},
+		Message: models.MaybeInaccessibleMessage{Message: &models.Message{ID: 1, Chat: models.Chat{ID: 7}}},
+		Data:    approve,
+	})
+
+	mapping, ok := topicMappings["telegram/-300"]
+	if !ok || mapping.GroupID != -300 {
+		t.Fatalf("expected the chat mapped to telegram/-300, got %v", topicMappings)
+	}
+	if _, ok := broker.subscriptions["telegram/-300"]; !ok {
+		t.Errorf("expected the provisioned topic subscribed")
+	}
+
+	if calls := telegram.Calls("editMessageText"); len(calls) != 1 || !strings.Contains(calls[0].Params.Get("text"), "mapped to topic telegram/-300") {
+		t.Errorf("expected the approval request updated, got %v", calls)
+	}
+
+	provisionedChats = nil
+	mappings, err := loadProvisionedMappings()
+	if err != nil || len(mappings) != 1 || mappings[0].Topic != "telegram/-300" || mappings[0].MessageTo != "-300" {
+		t.Errorf("expected the provisioned mapping saved, got %v: %v", mappings, err)
+	}
+}
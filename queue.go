@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"github.com/tidwall/gjson"
+	"os"
+	"sync"
+	"time"
+)
+
+// Queue overflow policies, what to do with a message received while the queue is full
+const (
+	QueueBlock      = "block"       // Wait for room, slowing down the MQTT client (default)
+	QueueDropOldest = "drop-oldest" // Drop the oldest queued message
+	QueueDropNewest = "drop-newest" // Drop the received message
+	QueueAggregate  = "aggregate"   // Replace the queued message of the same topic, keeping only the latest value, or else drop the oldest
+)
+
+// Message priorities. Queued messages of a higher priority are processed first.
+const (
+	PriorityHigh   = "high"   // Critical alerts
+	PriorityNormal = "normal" // Default
+	PriorityLow    = "low"    // Bulk telemetry
+)
+
+// priorityLanes are the queue lanes of the priorities, in processing order
+var priorityLanes = []string{PriorityHigh, PriorityNormal, PriorityLow}
+
+// priorityLane returns the lane of a priority, or -1 if invalid
+func priorityLane(priority string) int {
+	for i, p := range priorityLanes {
+		if p == priority {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// messageLane returns the queue lane of a message: the MQTT 5 priority user property, the payload priority field,
+// high for critical payloads, or the mapping priority. The payload is not decoded yet, so only plain JSON fields are seen.
+func messageLane(mapping *Mapping, msg MQTTMessage) int {
+	if lane := priorityLane(msg.UserProperties["priority"]); lane != -1 {
+		return lane
+	}
+
+	if lane := priorityLane(gjson.GetBytes(msg.Payload, "priority").String()); lane != -1 {
+		return lane
+	}
+
+	if gjson.GetBytes(msg.Payload, "critical").Bool() {
+		return priorityLane(PriorityHigh)
+	}
+
+	if lane := priorityLane(mapping.Priority); lane != -1 {
+		return lane
+	}
+
+	return priorityLane(PriorityNormal)
+}
+
+// defaultQueueSize is the capacity of the queue when queue_size is not defined
+const defaultQueueSize = 1000
+
+// queueDrainTimeout is how long the queued messages are processed on shutdown
+const queueDrainTimeout = 10 * time.Second
+
+var queueLog = newLogger("Queue")
+
+var queueDropped = NewCounterVec("mqtttelegram_queue_dropped_total", "MQTT messages dropped by the full queue by mapping topic and policy", "topic", "policy")
+var queueAggregated = NewCounterVec("mqtttelegram_queue_aggregated_total", "Queued MQTT messages replaced by a newer message of the same topic", "topic")
+
+// queuedMessage is a message received on a mapping topic waiting to be processed
+type queuedMessage struct {
+	mapping *Mapping
+	msg     MQTTMessage
+	lane    int
+}
+
+// MessageQueue is a bounded queue of the MQTT messages between the broker subscriptions and the processing,
+// with a FIFO lane per priority
+type MessageQueue struct {
+	Size   int
+	Policy string
+
+	lock     sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	lanes    [][]queuedMessage
+	length   int
+	closed   bool
+}
+
+// messageQueue is nil when the messages are processed in the subscription callbacks (queue_size=0)
+var messageQueue *MessageQueue
+
+func newMessageQueue(size int, policy string) (*MessageQueue, error) {
+	switch policy {
+	case QueueBlock, QueueDropOldest, QueueDropNewest, QueueAggregate:
+	default:
+		return nil, fmt.Errorf("invalid queue policy %q", policy)
+	}
+
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid queue size %d", size)
+	}
+
+	q := &MessageQueue{Size: size, Policy: policy, lanes: make([][]queuedMessage, len(priorityLanes))}
+	q.notEmpty = sync.NewCond(&q.lock)
+	q.notFull = sync.NewCond(&q.lock)
+
+	return q, nil
+}
+
+// Push queues a message in its priority lane, applying the overflow policy when the queue is full.
+// The dropped messages are taken from the lowest priority lanes first.
+func (q *MessageQueue) Push(mapping *Mapping, msg MQTTMessage) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	item := queuedMessage{mapping: mapping, msg: msg, lane: messageLane(mapping, msg)}
+
+	for q.length >= q.Size && !q.closed {
+		switch q.Policy {
+		case QueueBlock:
+			q.notFull.Wait()
+			continue
+		case QueueAggregate:
+			if q.replace(item) {
+				return
+			}
+		}
+
+		lowest := q.lowestLane()
+		if lowest < item.lane || (lowest == item.lane && q.Policy == QueueDropNewest) {
+			q.drop(item) // Everything queued has a higher priority
+			return
+		}
+
+		if q.Policy == QueueDropNewest {
+			q.drop(q.lanes[lowest][len(q.lanes[lowest])-1])
+			q.lanes[lowest] = q.lanes[lowest][:len(q.lanes[lowest])-1]
+		} else {
+			q.drop(q.lanes[lowest][0])
+			q.lanes[lowest] = q.lanes[lowest][1:]
+		}
+		q.length--
+	}
+
+	q.lanes[item.lane] = append(q.lanes[item.lane], item)
+	q.length++
+	q.notEmpty.Signal()
+}
+
+// replace replaces the newest queued message of the same topic and lane, returning false if there is none
+func (q *MessageQueue) replace(item queuedMessage) bool {
+	lane := q.lanes[item.lane]
+	for i := len(lane) - 1; i >= 0; i-- {
+		if lane[i].msg.Topic == item.msg.Topic {
+			queueAggregated.Inc(item.mapping.Topic)
+			lane[i] = item
+			return true
+		}
+	}
+
+	return false
+}
+
+// lowestLane returns the lowest priority lane with queued messages
+func (q *MessageQueue) lowestLane() int {
+	for i := len(q.lanes) - 1; i > 0; i-- {
+		if len(q.lanes[i]) > 0 {
+			return i
+		}
+	}
+
+	return 0
+}
+
+func (q *MessageQueue) drop(item queuedMessage) {
+	queueLog.Warn("Queue full, dropping %s priority message on topic %s (%s)", priorityLanes[item.lane], item.msg.Topic, q.Policy)
+	queueDropped.Inc(item.mapping.Topic, q.Policy)
+}
+
+// Pop waits for a queued message, from the highest priority lane. Returns false when the queue is closed and empty.
+func (q *MessageQueue) Pop() (queuedMessage, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for q.length == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+
+	for i, lane := range q.lanes {
+		if len(lane) > 0 {
+			item := lane[0]
+			q.lanes[i] = lane[1:]
+			q.length--
+			q.notFull.Signal()
+			return item, true
+		}
+	}
+
+	return queuedMessage{}, false
+}
+
+// Len returns the number of queued messages
+func (q *MessageQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.length
+}
+
+// LaneLengths returns the number of queued messages of each lane, in the priorityLanes order
+func (q *MessageQueue) LaneLengths() []int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	lengths := make([]int, len(q.lanes))
+	for i, lane := range q.lanes {
+		lengths[i] = len(lane)
+	}
+
+	return lengths
+}
+
+// Close wakes the blocked pushes, which queue anyway, and makes Pop return false once the queue is empty
+func (q *MessageQueue) Close() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+// queueDone is closed when the queue worker processed all the messages after Close
+var queueDone chan struct{}
+
+// startQueue creates the message queue with the queue_size and queue_policy and starts processing it
+func startQueue() {
+	size := getEnvInt("queue_size", defaultQueueSize)
+	if size == 0 {
+		return
+	}
+
+	policy := os.Getenv("queue_policy")
+	if policy == "" {
+		policy = QueueBlock
+	}
+
+	q, err := newMessageQueue(size, policy)
+	if err != nil {
+		queueLog.Fatal(err)
+	}
+
+	messageQueue, queueDone = q, make(chan struct{})
+	NewGaugeFunc("mqtttelegram_queue_length", "MQTT messages waiting to be processed", func() float64 { return float64(q.Len()) })
+
+	go func() {
+		defer close(queueDone)
+		for {
+			item, ok := q.Pop()
+			if !ok {
+				return
+			}
+			doMessage(item.mapping, item.msg)
+		}
+	}()
+
+	queueLog.Info("Queueing up to %d messages (%s)", size, policy)
+}
+
+// stopQueue processes the queued messages, waiting up to queueDrainTimeout
+func stopQueue() {
+	if messageQueue == nil {
+		return
+	}
+
+	messageQueue.Close()
+
+	select {
+	case <-queueDone:
+	case <-time.After(queueDrainTimeout):
+		queueLog.Warn("Stopping with %d messages still queued", messageQueue.Len())
+	}
+}
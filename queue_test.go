@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMessageQueuePolicies(t *testing.T) {
+	mapping := &Mapping{Topic: "test/topic"}
+
+	tests := []struct {
+		policy   string
+		expected []string
+	}{
+		{QueueDropOldest, []string{"b/2", "a/3", "a/4"}},
+		{QueueDropNewest, []string{"a/1", "b/2", "a/3"}},
+		{QueueAggregate, []string{"a/1", "b/2", "a/4"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.policy, func(t *testing.T) {
+			q, err := newMessageQueue(3, test.policy)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			for _, m := range []MQTTMessage{
+				{Topic: "a", Payload: []byte("1")},
+				{Topic: "b", Payload: []byte("2")},
+				{Topic: "a", Payload: []byte("3")},
+				{Topic: "a", Payload: []byte("4")},
+			} {
+				q.Push(mapping, m)
+			}
+
+			q.Close()
+			var got []string
+			for {
+				item, ok := q.Pop()
+				if !ok {
+					break
+				}
+				got = append(got, item.msg.Topic+"/"+string(item.msg.Payload))
+			}
+
+			if len(got) != len(test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, got)
+			}
+			for i := range got {
+				if got[i] != test.expected[i] {
+					t.Fatalf("expected %v, got %v", test.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMessageQueuePriority(t *testing.T) {
+	mapping := &Mapping{Topic: "test/topic", Priority: PriorityLow}
+
+	q, _ := newMessageQueue(3, QueueDropNewest)
+	for _, m := range []MQTTMessage{
+		{Topic: "telemetry/1"},
+		{Topic: "telemetry/2"},
+		{Topic: "door", Payload: []byte(`{"message": "open", "priority": "normal"}`)},
+		{Topic: "smoke", UserProperties: map[string]string{"priority": "high"}},
+		{Topic: "flood", Payload: []byte(`{"message": "water", "critical": true}`)},
+		{Topic: "telemetry/3"},
+	} {
+		q.Push(mapping, m)
+	}
+
+	if lengths := q.LaneLengths(); lengths[0] != 2 || lengths[1] != 1 || lengths[2] != 0 {
+		t.Errorf("unexpected lane lengths %v", lengths)
+	}
+
+	q.Close()
+	var got []string
+	for {
+		item, ok := q.Pop()
+		if !ok {
+			break
+		}
+		got = append(got, item.msg.Topic)
+	}
+
+	expected := []string{"smoke", "flood", "door"}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+	}
+}
+
+func TestMessageQueueBlock(t *testing.T) {
+	mapping := &Mapping{Topic: "test/topic"}
+
+	q, _ := newMessageQueue(1, QueueBlock)
+	q.Push(mapping, MQTTMessage{Topic: "a"})
+
+	pushed := make(chan struct{})
+	go func() {
+		q.Push(mapping, MQTTMessage{Topic: "b"})
+		close(pushed)
+	}()
+
+	select {
+	case <-pushed:
+		t.Fatalf("expected push to block while the queue is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if item, _ := q.Pop(); item.msg.Topic != "a" {
+		t.Errorf("expected a, got %s", item.msg.Topic)
+	}
+
+	select {
+	case <-pushed:
+	case <-time.After(time.Second):
+		t.Fatalf("expected push to continue after a pop")
+	}
+
+	if _, err := newMessageQueue(1, "sometimes"); err == nil {
+		t.Errorf("expected error for invalid policy")
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket limiter allowing Rate messages per second with bursts of up to Burst messages
+type RateLimiter struct {
+	Rate  float64
+	Burst int
+
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &RateLimiter{
+		Rate:   rate,
+		Burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// refill adds the tokens accumulated since the last call
+func (r *RateLimiter) refill() {
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * r.Rate
+	if r.tokens > float64(r.Burst) {
+		r.tokens = float64(r.Burst)
+	}
+	r.last = now
+}
+
+// Wait blocks until a message can be sent. The token is reserved under the lock, going negative when the bucket is
+// empty, and the wait for it happens after releasing the lock, so the waiting senders don't hold the Allow callers.
+func (r *RateLimiter) Wait() {
+	r.lock.Lock()
+	r.refill()
+	r.tokens--
+	wait := time.Duration(0)
+	if r.tokens < 0 {
+		wait = time.Duration(-r.tokens / r.Rate * float64(time.Second))
+	}
+	r.lock.Unlock()
+
+	time.Sleep(wait)
+}
+
+// Allow returns if a message can be sent now, without waiting
+func (r *RateLimiter) Allow() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.refill()
+	if r.tokens < 1 {
+		return false
+	}
+
+	r.tokens--
+	return true
+}
+
+// Full returns if the limiter refilled the whole burst, like a limiter that was not used recently
+func (r *RateLimiter) Full() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.refill()
+	return r.tokens >= float64(r.Burst)
+}
+
+// rateLimitedSink wraps a sink, waiting for the limiter before each send
+type rateLimitedSink struct {
+	sink    Sink
+	limiter *RateLimiter
+}
+
+func (s *rateLimitedSink) String() string {
+	return fmt.Sprintf("%s (%.2f msg/s)", s.sink, s.limiter.Rate)
+}
+
+func (s *rateLimitedSink) Send(n Notification) error {
+	s.limiter.Wait()
+	return s.sink.Send(n)
+}
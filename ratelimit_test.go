@@ -0,0 +1,36 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWait(t *testing.T) {
+	r := NewRateLimiter(20, 1)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Wait()
+		}()
+	}
+
+	// The senders waiting for their tokens don't hold the lock
+	time.Sleep(10 * time.Millisecond)
+	allowStart := time.Now()
+	if r.Allow() {
+		t.Errorf("expected no token while the senders wait")
+	}
+	if d := time.Since(allowStart); d > 20*time.Millisecond {
+		t.Errorf("expected Allow to return right away, took %s", d)
+	}
+
+	wg.Wait()
+	if d := time.Since(start); d < 90*time.Millisecond {
+		t.Errorf("expected the 3 messages to take 100ms at 20/s with a burst of 1, took %s", d)
+	}
+}
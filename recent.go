@@ -0,0 +1,42 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// maxRecentMessages is how many processed messages are kept for the state dumps
+const maxRecentMessages = 20
+
+type recentMessage struct {
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction"`
+	Topic     string    `json:"topic"`
+	Result    string    `json:"result,omitempty"`
+	Payload   string    `json:"payload"`
+}
+
+var recentLock = sync.Mutex{}
+var recentMessages []recentMessage
+
+// recordRecent keeps the last processed messages, with truncated payloads, and sends them to the stream clients
+func recordRecent(m recentMessage) {
+	broadcastStream(m)
+
+	m.Payload = truncate(m.Payload, 200)
+
+	recentLock.Lock()
+	defer recentLock.Unlock()
+
+	recentMessages = append(recentMessages, m)
+	if len(recentMessages) > maxRecentMessages {
+		recentMessages = recentMessages[len(recentMessages)-maxRecentMessages:]
+	}
+}
+
+func getRecentMessages() []recentMessage {
+	recentLock.Lock()
+	defer recentLock.Unlock()
+
+	return append([]recentMessage{}, recentMessages...)
+}
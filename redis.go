@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	redisStreams = os.Getenv("redis_streams") == "true"
+	redisGroup   = os.Getenv("redis_group")
+)
+
+// redisStreamMaxLen is the approximate maximum length of the streams written by the bridge
+var redisStreamMaxLen = int64(getEnvInt("redis_stream_maxlen", 10000))
+
+// redisGlobReplacer escapes the glob characters of the topics in the PSUBSCRIBE patterns
+var redisGlobReplacer = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// redisClient is a Redis client using go-redis. Topics are Redis pub/sub channels, or streams with redis_streams=true.
+type redisClient struct {
+	options MQTTOptions
+	client  *redis.Client
+
+	lock          sync.Mutex
+	pubsub        *redis.PubSub
+	subscriptions map[string]MQTTHandler // By subscription filter
+}
+
+func newRedisClient(o MQTTOptions) (*redisClient, error) {
+	if haShareGroup != "" && !redisStreams {
+		return nil, fmt.Errorf("ha_share_group requires redis_streams, pub/sub delivers every message to all the replicas")
+	}
+
+	opts, err := redis.ParseURL(o.BrokerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Username != "" {
+		opts.Username = o.Username
+		opts.CredentialsProvider = func() (string, string) {
+			return o.Username, o.Password()
+		}
+	}
+	opts.DialTimeout = o.ConnectTimeout
+	opts.MaxRetryBackoff = o.MaxReconnectInterval
+
+	return &redisClient{
+		options:       o,
+		client:        redis.NewClient(opts),
+		subscriptions: map[string]MQTTHandler{},
+	}, nil
+}
+
+// redisPattern converts a MQTT filter to a PSUBSCRIBE pattern. Patterns match more channels than the filter
+// (* matches the / too), so the received channels are checked against the filter.
+func redisPattern(filter string) string {
+	var levels []string
+	for _, level := range strings.Split(filter, "/") {
+		if level == "+" || level == "#" {
+			levels = append(levels, "*")
+		} else {
+			levels = append(levels, redisGlobReplacer.Replace(level))
+		}
+	}
+
+	return strings.Join(levels, "/")
+}
+
+func (c *redisClient) Connect() error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.ConnectTimeout)
+	defer cancel()
+
+	if err := c.client.Ping(ctx).Err(); err != nil {
+		return err
+	}
+
+	if c.options.OnConnect != nil {
+		c.options.OnConnect()
+	}
+
+	return nil
+}
+
+// redisSubscriptionGroup returns the stream consumer group and the topic of a subscription: the group of the shared
+// subscriptions ($share/group/filter), so each message is read by only one replica, or else a group of the instance,
+// <redis_group>-<ha_instance_id>, so every replica reads all the messages, like the control and leader topics
+func redisSubscriptionGroup(topic string) (string, string) {
+	if parts := strings.SplitN(topic, "/", 3); parts[0] == "$share" && len(parts) == 3 {
+		return parts[1], parts[2]
+	}
+
+	group := redisGroup
+	if group == "" {
+		group = "mqtttelegram"
+	}
+
+	return group + "-" + instanceID(), topic
+}
+
+// Subscribe subscribes to the pub/sub channels matching the filter, or reads the stream of the topic with its consumer
+// group (see redisSubscriptionGroup). Streams cannot have wildcards. Pub/sub has no shared subscriptions, so
+// newRedisClient refuses ha_share_group without streams.
+func (c *redisClient) Subscribe(topic string, handler MQTTHandler) error {
+	group, topic := redisSubscriptionGroup(topic)
+
+	if redisStreams {
+		return c.subscribeStream(topic, group, handler)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.subscriptions[topic] = handler
+
+	if c.pubsub != nil {
+		return c.pubsub.PSubscribe(context.Background(), redisPattern(topic))
+	}
+
+	c.pubsub = c.client.PSubscribe(context.Background(), redisPattern(topic))
+	go c.receive(c.pubsub)
+
+	return nil
+}
+
+// receive calls the handlers of the pub/sub messages. go-redis subscribes again on reconnect.
+func (c *redisClient) receive(pubsub *redis.PubSub) {
+	for m := range pubsub.Channel() {
+		c.lock.Lock()
+		var handlers []MQTTHandler
+		for filter, handler := range c.subscriptions {
+			if topicMatches(filter, m.Channel) {
+				handlers = append(handlers, handler)
+			}
+		}
+		c.lock.Unlock()
+
+		for _, handler := range handlers {
+			handler(MQTTMessage{Topic: m.Channel, Payload: []byte(m.Payload)})
+		}
+	}
+}
+
+func (c *redisClient) subscribeStream(topic, group string, handler MQTTHandler) error {
+	if strings.ContainsAny(topic, "+#") {
+		return fmt.Errorf("redis streams cannot subscribe to wildcard topic %s", topic)
+	}
+
+	err := c.client.XGroupCreateMkStream(context.Background(), topic, group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	consumer := instanceID()
+
+	ctx := context.Background()
+
+	go func() { // Reads until the client is closed
+		for {
+			streams, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+				Group:    group,
+				Consumer: consumer,
+				Streams:  []string{topic, ">"},
+				Count:    100,
+				Block:    5 * time.Second,
+			}).Result()
+
+			if err == redis.Nil {
+				continue
+			}
+			if err != nil {
+				if err == redis.ErrClosed {
+					return
+				}
+				mqttLog.Error("Error reading stream %s: %s", topic, err)
+				time.Sleep(time.Second)
+				continue
+			}
+
+			for _, stream := range streams {
+				for _, m := range stream.Messages {
+					handler(redisStreamMessage(stream.Stream, m))
+					c.client.XAck(ctx, topic, group, m.ID)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// redisStreamMessage converts a stream entry, with the payload field and the user properties as the other fields
+func redisStreamMessage(stream string, m redis.XMessage) MQTTMessage {
+	msg := MQTTMessage{Topic: stream}
+
+	for k, v := range m.Values {
+		s, _ := v.(string)
+		if k == "payload" {
+			msg.Payload = []byte(s)
+			continue
+		}
+		if msg.UserProperties == nil {
+			msg.UserProperties = map[string]string{}
+		}
+		msg.UserProperties[k] = s
+	}
+
+	return msg
+}
+
+func (c *redisClient) Publish(msg MQTTMessage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.ConnectTimeout)
+	defer cancel()
+
+	if !redisStreams {
+		return c.client.Publish(ctx, msg.Topic, msg.Payload).Err()
+	}
+
+	values := []interface{}{"payload", msg.Payload}
+	for k, v := range msg.UserProperties {
+		values = append(values, k, v)
+	}
+
+	return c.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: msg.Topic,
+		MaxLen: redisStreamMaxLen,
+		Approx: true,
+		Values: values,
+	}).Err()
+}
+
+func (c *redisClient) IsConnected() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.PingTimeout)
+	defer cancel()
+
+	return c.client.Ping(ctx).Err() == nil
+}
+
+func (c *redisClient) Disconnect() {
+	c.lock.Lock()
+	if c.pubsub != nil {
+		c.pubsub.Close()
+		c.pubsub = nil
+	}
+	c.lock.Unlock()
+
+	c.client.Close()
+}
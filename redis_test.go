@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestRedisSubscriptionGroup(t *testing.T) {
+	previousGroup, previousInstance := redisGroup, haInstanceID
+	redisGroup, haInstanceID = "bridge", "replica-1"
+	t.Cleanup(func() { redisGroup, haInstanceID = previousGroup, previousInstance })
+
+	tests := []struct {
+		filter, group, topic string
+	}{
+		{"$share/ha/sensors/kitchen", "ha", "sensors/kitchen"},
+		{"$bridge/control", "bridge-replica-1", "$bridge/control"},
+		{"sensors/kitchen", "bridge-replica-1", "sensors/kitchen"},
+	}
+
+	for _, test := range tests {
+		if group, topic := redisSubscriptionGroup(test.filter); group != test.group || topic != test.topic {
+			t.Errorf("%s: expected %s on %s, got %s on %s", test.filter, test.group, test.topic, group, topic)
+		}
+	}
+}
+
+func TestRedisSharedPubSub(t *testing.T) {
+	previousShare, previousStreams := haShareGroup, redisStreams
+	haShareGroup, redisStreams = "ha", false
+	t.Cleanup(func() { haShareGroup, redisStreams = previousShare, previousStreams })
+
+	if _, err := newRedisClient(MQTTOptions{BrokerURL: "redis://localhost:6379/0"}); err == nil {
+		t.Errorf("expected ha_share_group to be refused with pub/sub")
+	}
+
+	redisStreams = true
+	if _, err := newRedisClient(MQTTOptions{BrokerURL: "redis://localhost:6379/0"}); err != nil {
+		t.Errorf("unexpected error with streams: %s", err)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// mqttSubscription is a subscription of the bridge, made again on the new client when the client is replaced
+type mqttSubscription struct {
+	topic   string
+	handler MQTTHandler
+}
+
+// mqttSubscriptionsLock guards mqttSubscriptions, and is held while subscribing and replacing the client
+var mqttSubscriptionsLock = sync.Mutex{}
+var mqttSubscriptions []mqttSubscription
+
+// activeHandler returns a handler that ignores the messages received by client once it is no longer the mqttClient,
+// so the messages received by both the current and the new client while switching are processed only once
+func activeHandler(client MQTTClient, handler MQTTHandler) MQTTHandler {
+	return func(msg MQTTMessage) {
+		if client != getMQTTClient() {
+			return
+		}
+		handler(msg)
+	}
+}
+
+// replaceMQTTClient switches to a new client without losing messages: the new client is connected and subscribed
+// first, then it replaces the mqttClient and the current client is disconnected. On error, the current client is kept.
+func replaceMQTTClient(client MQTTClient) error {
+	if err := client.Connect(); err != nil {
+		client.Disconnect()
+		return fmt.Errorf("error connecting: %w", err)
+	}
+
+	mqttSubscriptionsLock.Lock()
+	defer mqttSubscriptionsLock.Unlock()
+
+	for _, s := range mqttSubscriptions {
+		if err := client.Subscribe(s.topic, activeHandler(client, s.handler)); err != nil {
+			client.Disconnect()
+			return fmt.Errorf("error subscribing to %s: %w", s.topic, err)
+		}
+	}
+
+	setMQTTClient(client).Disconnect()
+
+	mqttLog.Info("Switched to the new connection, %d subscriptions", len(mqttSubscriptions))
+	return nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestReplaceMQTTClient(t *testing.T) {
+	previous := newFakeBroker(t)
+
+	previousSubscriptions := mqttSubscriptions
+	mqttSubscriptions = nil
+	t.Cleanup(func() { mqttSubscriptions = previousSubscriptions })
+
+	received := 0
+	subscribe("sensors/#", func(msg MQTTMessage) { received++ })
+
+	next := &fakeBroker{subscriptions: map[string]MQTTHandler{}}
+	if err := replaceMQTTClient(next); err != nil {
+		t.Fatalf("error replacing client: %s", err)
+	}
+
+	if getMQTTClient() != next || previous.IsConnected() {
+		t.Fatalf("expected the new client active and the previous one disconnected")
+	}
+
+	// A message received by both connections while switching is processed once
+	previous.subscriptions["sensors/#"](MQTTMessage{Topic: "sensors/temp"})
+	next.Publish(MQTTMessage{Topic: "sensors/temp"})
+
+	if received != 1 {
+		t.Errorf("expected the message processed once, got %d", received)
+	}
+}
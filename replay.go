@@ -0,0 +1,200 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// replayQuery filters the archived dead letters. Empty fields are not filtered.
+type replayQuery struct {
+	Topic    string // Topic filter, MQTT wildcards allowed
+	Reason   string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+	Replayed bool // Include the dead letters already replayed
+}
+
+// archivedDeadLetter is a dead letter stored in the archive
+type archivedDeadLetter struct {
+	ID       int64
+	Replayed bool
+	DeadLetter
+}
+
+// searchDeadLetters returns the archived dead letters matching the query, oldest first
+func searchDeadLetters(db *sql.DB, q replayQuery) ([]archivedDeadLetter, error) {
+	var where []string
+	var args []interface{}
+
+	if !q.Replayed {
+		where = append(where, "replayed = 0")
+	}
+	if q.Reason != "" {
+		where = append(where, "reason = ?")
+		args = append(args, q.Reason)
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, q.Since.UnixNano())
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "time < ?")
+		args = append(args, q.Until.UnixNano())
+	}
+
+	query := "SELECT id, replayed, letter FROM dead_letters"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY time"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var letters []archivedDeadLetter
+	for rows.Next() {
+		var l archivedDeadLetter
+		var letter string
+		if err := rows.Scan(&l.ID, &l.Replayed, &letter); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(letter), &l.DeadLetter); err != nil {
+			return nil, fmt.Errorf("invalid dead letter %d: %s", l.ID, err)
+		}
+
+		// Topic filters have wildcards, so they are matched here instead of in the query
+		if q.Topic != "" && !topicMatches(q.Topic, l.Topic) {
+			continue
+		}
+
+		letters = append(letters, l)
+		if q.Limit > 0 && len(letters) == q.Limit {
+			break
+		}
+	}
+
+	return letters, rows.Err()
+}
+
+// replayDeadLetter publishes the original payload of a dead letter to its topic, so the bridge processes it again
+func replayDeadLetter(client MQTTClient, l archivedDeadLetter) error {
+	payload := []byte(l.Payload)
+	if l.PayloadBase64 != nil {
+		payload = l.PayloadBase64
+	}
+
+	properties := map[string]string{}
+	for k, v := range l.Properties {
+		properties[k] = v
+	}
+	properties["replayed_dead_letter"] = strconv.FormatInt(l.ID, 10)
+
+	return client.Publish(MQTTMessage{
+		Topic:          mqttTopic(l.Topic),
+		Payload:        payload,
+		UserProperties: properties,
+	})
+}
+
+// runReplay is the replay subcommand: it re-injects the archived dead letters into the bridge, marking them replayed
+func runReplay(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	topic := flags.String("topic", "", "Replay only the dead letters of the topic filter, like sensors/#")
+	reason := flags.String("reason", "", "Replay only the dead letters with the failure reason, like delivery")
+	since := flags.String("since", "", "Replay the dead letters since: RFC3339, 2006-01-02 or a duration before now")
+	until := flags.String("until", "", "Replay the dead letters until: RFC3339, 2006-01-02 or a duration before now")
+	limit := flags.Int("limit", 0, "Maximum of dead letters replayed, 0 for all")
+	interval := flags.Duration("interval", time.Second, "Wait between replays, to not flood the Telegram chats")
+	replayed := flags.Bool("replayed", false, "Replay again the dead letters already replayed")
+	dryRun := flags.Bool("dry-run", false, "List the dead letters without replaying them")
+	flags.Parse(args)
+
+	q := replayQuery{Topic: *topic, Reason: *reason, Limit: *limit, Replayed: *replayed}
+
+	var err error
+	if q.Since, err = parseRangeTime(*since); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if q.Until, err = parseRangeTime(*until); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if archiveFile == "" {
+		fmt.Fprintln(os.Stderr, "archive_file not defined, the dead letters are only archived with the archive enabled")
+		return 1
+	}
+
+	db, err := openArchiveDB(archiveFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening archive %s: %s\n", archiveFile, err)
+		return 1
+	}
+	defer db.Close()
+
+	letters, err := searchDeadLetters(db, q)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading the dead letters: %s\n", err)
+		return 1
+	}
+
+	for _, l := range letters {
+		fmt.Printf("#%d %s %s (%s): %s\n", l.ID, l.Failed.Format(time.RFC3339), l.Topic, l.Reason, l.Error)
+	}
+
+	if *dryRun || len(letters) == 0 {
+		fmt.Printf("%d dead letters\n", len(letters))
+		return 0
+	}
+
+	if err := loadSecrets(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	client, err := newMQTTClient(getMQTTPassword())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating MQTT client: %s\n", err)
+		return 1
+	}
+	if err := client.Connect(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error connecting to %s: %s\n", mqttHost, err)
+		return 1
+	}
+	defer client.Disconnect()
+
+	count := 0
+	for i, l := range letters {
+		if i > 0 {
+			time.Sleep(*interval)
+		}
+
+		if err := replayDeadLetter(client, l); err != nil {
+			fmt.Fprintf(os.Stderr, "Error replaying #%d: %s\n", l.ID, err)
+			continue
+		}
+
+		if _, err := db.Exec("UPDATE dead_letters SET replayed = 1 WHERE id = ?", l.ID); err != nil {
+			fmt.Fprintf(os.Stderr, "Error marking #%d replayed: %s\n", l.ID, err)
+		}
+		count++
+	}
+
+	fmt.Printf("Replayed %d of %d dead letters\n", count, len(letters))
+	if count < len(letters) {
+		return 1
+	}
+
+	return 0
+}
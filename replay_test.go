@@ -0,0 +1,61 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReplayDeadLetters(t *testing.T) {
+	db, err := openArchiveDB(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatalf("error opening archive: %s", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	previousDB := archiveDB
+	archiveDB = db
+	t.Cleanup(func() { archiveDB = previousDB })
+
+	newFakeTelegram(t)
+	broker := newFakeBroker(t)
+
+	kitchen := &Mapping{GroupID: -100, Topic: "home/kitchen"}
+	garage := &Mapping{GroupID: -200, Topic: "home/garage"}
+	setupTestMappings(t, kitchen, garage)
+
+	doMessage(kitchen, MQTTMessage{Topic: "home/kitchen", Payload: []byte(`{"type": "message", "message": 1}`), UserProperties: map[string]string{"source": "test"}})
+	doMessage(garage, MQTTMessage{Topic: "home/garage", Payload: []byte("\xff\xfe")})
+
+	letters, err := searchDeadLetters(db, replayQuery{})
+	if err != nil {
+		t.Fatalf("error searching dead letters: %s", err)
+	}
+	if len(letters) != 2 {
+		t.Fatalf("expected 2 archived dead letters, got %d", len(letters))
+	}
+
+	letters, _ = searchDeadLetters(db, replayQuery{Topic: "home/+", Reason: string(FailureSchema), Since: time.Now().Add(-time.Minute), Limit: 1})
+	if len(letters) != 1 || letters[0].Topic != "home/kitchen" || letters[0].Properties["source"] != "test" {
+		t.Fatalf("expected the kitchen dead letter, got %+v", letters)
+	}
+
+	if letters, _ := searchDeadLetters(db, replayQuery{Topic: "other/#"}); len(letters) != 0 {
+		t.Errorf("expected no dead letters for other/#, got %d", len(letters))
+	}
+
+	garageLetters, _ := searchDeadLetters(db, replayQuery{Topic: "home/garage"})
+	if len(garageLetters) != 1 || garageLetters[0].PayloadBase64 == nil {
+		t.Fatalf("expected the binary garage payload to be kept as base64, got %+v", garageLetters)
+	}
+
+	broker.Reset()
+	if err := replayDeadLetter(broker, garageLetters[0]); err != nil {
+		t.Fatalf("error replaying: %s", err)
+	}
+
+	published := broker.Published("home/garage")
+	if len(published) != 1 || string(published[0].Payload) != "\xff\xfe" || published[0].UserProperties["replayed_dead_letter"] == "" {
+		t.Errorf("expected the original payload to be replayed, got %+v", published)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+// RPC response statuses
+const (
+	rpcDelivered = "delivered"
+	rpcScheduled = "scheduled"
+	rpcDropped   = "dropped"
+	rpcIgnored   = "ignored"
+	rpcError     = "error"
+	rpcOK        = "ok" // Control command accepted
+)
+
+// rpcResponse is published to the MQTT 5 response topic of a message after it was processed
+type rpcResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// sendRPCResponse publishes the processing result to the message response topic (MQTT 5 request / response),
+// with the same correlation data of the request
+func sendRPCResponse(msg MQTTMessage, response *rpcResponse) {
+	if msg.ResponseTopic == "" {
+		return
+	}
+
+	payload, _ := json.Marshal(response)
+
+	err := getMQTTClient().Publish(MQTTMessage{
+		Topic:           msg.ResponseTopic,
+		Payload:         payload,
+		CorrelationData: msg.CorrelationData,
+	})
+
+	if err != nil {
+		mqttLog.Error("Error publishing response to %s: %s", msg.ResponseTopic, err)
+	}
+}
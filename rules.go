@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/tidwall/gjson"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var rulesMatched = NewCounterVec("mqtttelegram_rules_matched_total", "Messages matched by the routing rules, by rule name", "rule")
+
+// RuleConfig is a routing rule of the config file. The conditions that are defined must all match, then the actions
+// are applied to the message, in the order of the rules.
+type RuleConfig struct {
+	Name string `json:"name"` // Name of the rule in the logs and metrics. Defaults to rule N
+
+	Topic  string      `json:"topic"`  // Topic filter of the messages, MQTT wildcards allowed
+	Field  string      `json:"field"`  // gjson selector of a decoded payload field, compared with above, below and equals
+	Above  *float64    `json:"above"`  // The field is greater than
+	Below  *float64    `json:"below"`  // The field is less than
+	Equals interface{} `json:"equals"` // The field is equal to
+	Hours  string      `json:"hours"`  // Time range in the mapping timezone, like 22:00-07:00
+	If     string      `json:"if"`     // text/template rendering true, like {{eq .From "door"}}
+
+	Prefix   string `json:"prefix"`   // Text prepended to the message, like ⚠️
+	Silent   bool   `json:"silent"`   // Send without notification sound
+	Critical bool   `json:"critical"` // Mark the message critical, delivered to the only_critical sinks
+	ChatID   int64  `json:"chat_id"`  // Also send the message to this Telegram chat
+	Admin    bool   `json:"admin"`    // Also send the message to the telegram_admin
+	Drop     bool   `json:"drop"`     // Don't deliver the message
+	Stop     bool   `json:"stop"`     // Don't apply the next rules
+
+	condition *template.Template
+	from, to  int // Minutes of the day of the hours range
+}
+
+var rules []*RuleConfig
+
+// setupRules validates the rules of the config file
+func setupRules(configs []*RuleConfig) error {
+	for i, r := range configs {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+
+		if r.Field == "" && (r.Above != nil || r.Below != nil || r.Equals != nil) {
+			return fmt.Errorf("%s: above, below and equals require field", r.Name)
+		}
+
+		if r.Hours != "" {
+			var err error
+			if r.from, r.to, err = parseHoursRange(r.Hours); err != nil {
+				return fmt.Errorf("%s: %s", r.Name, err)
+			}
+		}
+
+		if r.If != "" {
+			t, err := parseTemplate(r.Name, r.If)
+			if err != nil {
+				return fmt.Errorf("%s: invalid if: %s", r.Name, err)
+			}
+			r.condition = t
+		}
+	}
+
+	rules = configs
+	return nil
+}
+
+// parseHoursRange parses a time range like 22:00-07:00, returning the minutes of the day of the start and end
+func parseHoursRange(hours string) (int, int, error) {
+	parts := strings.Split(hours, "-")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid hours %q, expected like 22:00-07:00", hours)
+	}
+
+	var minutes [2]int
+	for i, part := range parts {
+		t, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid hours %q, expected like 22:00-07:00", hours)
+		}
+		minutes[i] = t.Hour()*60 + t.Minute()
+	}
+
+	return minutes[0], minutes[1], nil
+}
+
+// matches returns if all the conditions of the rule match the notification, received on the mapping at now
+func (r *RuleConfig) matches(mapping *Mapping, n Notification, now time.Time) bool {
+	if r.Topic != "" && !topicMatches(r.Topic, n.Topic) {
+		return false
+	}
+
+	if r.Field != "" && !r.matchesField(n.Data) {
+		return false
+	}
+
+	if r.Hours != "" {
+		local := now.In(mapping.location)
+		minute := local.Hour()*60 + local.Minute()
+		inRange := minute >= r.from && minute < r.to
+		if r.from > r.to { // Range crossing midnight
+			inRange = minute >= r.from || minute < r.to
+		}
+		if !inRange {
+			return false
+		}
+	}
+
+	if r.condition != nil {
+		text, err := renderTemplate(r.condition, n)
+		if err != nil {
+			sinkLog.Error("Error evaluating %s on topic %s: %s", r.Name, n.Topic, err)
+			return false
+		}
+		if strings.TrimSpace(text) != "true" {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *RuleConfig) matchesField(data map[string]interface{}) bool {
+	payload, _ := json.Marshal(data)
+	field := gjson.GetBytes(payload, r.Field)
+	if !field.Exists() {
+		return false
+	}
+
+	value, numeric := numericValue(field.Value())
+	if r.Above != nil && (!numeric || value <= *r.Above) {
+		return false
+	}
+	if r.Below != nil && (!numeric || value >= *r.Below) {
+		return false
+	}
+
+	return r.Equals == nil || fmt.Sprint(r.Equals) == fmt.Sprint(field.Value())
+}
+
+// applyRules applies the matching rules to a notification of the mapping, sending the copies to the rule chats.
+// Returns the changed notification and if it must be dropped.
+func applyRules(mapping *Mapping, n Notification) (Notification, bool) {
+	now := time.Now()
+	drop := false
+
+	for _, r := range rules {
+		if !r.matches(mapping, n, now) {
+			continue
+		}
+
+		sinkLog.Debug("Rule %s matched message on topic %s", r.Name, n.Topic)
+		rulesMatched.Inc(r.Name)
+
+		if r.Prefix != "" {
+			n.Message = r.Prefix + " " + n.Message
+		}
+		n.Silent = n.Silent || r.Silent
+		n.Critical = n.Critical || r.Critical
+		drop = drop || r.Drop
+
+		if r.ChatID != 0 {
+			sendRuleCopy(r, r.ChatID, n)
+		}
+
+		if r.Admin {
+			if chat, err := strconv.ParseInt(telegramAdminId, 10, 64); err == nil {
+				sendRuleCopy(r, chat, n)
+			} else {
+				sinkLog.Warn("Cannot send %s to the admin, telegram_admin must be an user id", r.Name)
+			}
+		}
+
+		if r.Stop {
+			break
+		}
+	}
+
+	return n, drop
+}
+
+func sendRuleCopy(r *RuleConfig, chat int64, n Notification) {
+	s := &TelegramSink{ChatID: chat}
+	if err := s.Send(n); err != nil {
+		sinkLog.Error("Error sending %s copy of topic %s to %d: %s", r.Name, n.Topic, chat, err)
+	}
+}
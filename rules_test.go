@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRuleMatches(t *testing.T) {
+	mapping := &Mapping{Topic: "sensors/#", location: time.UTC}
+	low := 15.0
+
+	tests := []struct {
+		name     string
+		rule     RuleConfig
+		n        Notification
+		expected bool
+	}{
+		{"field below", RuleConfig{Field: "battery", Below: &low}, Notification{Data: map[string]interface{}{"battery": 12.0}}, true},
+		{"field not below", RuleConfig{Field: "battery", Below: &low}, Notification{Data: map[string]interface{}{"battery": 80.0}}, false},
+		{"missing field", RuleConfig{Field: "battery", Below: &low}, Notification{Data: map[string]interface{}{}}, false},
+		{"nested field equals", RuleConfig{Field: "state.door", Equals: "open"}, Notification{Data: map[string]interface{}{"state": map[string]interface{}{"door": "open"}}}, true},
+		{"topic", RuleConfig{Topic: "sensors/+/door"}, Notification{Topic: "sensors/garage/door"}, true},
+		{"other topic", RuleConfig{Topic: "sensors/+/door"}, Notification{Topic: "sensors/garage/window"}, false},
+		{"hours across midnight", RuleConfig{Hours: "22:00-07:00"}, Notification{}, true},
+		{"outside hours", RuleConfig{Hours: "08:00-20:00"}, Notification{}, false},
+		{"if template", RuleConfig{If: `{{eq .From "door"}}`}, Notification{From: "door"}, true},
+	}
+
+	now := time.Date(2026, 10, 14, 23, 30, 0, 0, time.UTC)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := test.rule
+			if err := setupRules([]*RuleConfig{&r}); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			t.Cleanup(func() { rules = nil })
+
+			if matched := r.matches(mapping, test.n, now); matched != test.expected {
+				t.Errorf("expected match %v, got %v", test.expected, matched)
+			}
+		})
+	}
+
+	if err := setupRules([]*RuleConfig{{Hours: "late"}}); err == nil {
+		t.Errorf("expected error for invalid hours")
+	}
+	rules = nil
+}
+
+func TestApplyRules(t *testing.T) {
+	telegram := newFakeTelegram(t)
+	mapping := &Mapping{Topic: "sensors/#", location: time.UTC}
+	low := 15.0
+
+	if err := setupRules([]*RuleConfig{
+		{Name: "low battery", Field: "battery", Below: &low, Prefix: "⚠️", ChatID: -200, Critical: true},
+		{Name: "drop test", Topic: "sensors/test", Drop: true, Stop: true},
+		{Name: "silent", Silent: true},
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	t.Cleanup(func() { rules = nil })
+
+	n, drop := applyRules(mapping, Notification{Topic: "sensors/remote", From: "remote", Message: "battery 12%", Data: map[string]interface{}{"battery": 12.0}})
+	if drop || n.Message != "⚠️ battery 12%" || !n.Critical || !n.Silent {
+		t.Errorf("unexpected notification %+v, dropped %v", n, drop)
+	}
+
+	calls := telegram.Calls("sendMessage")
+	if len(calls) != 1 || calls[0].Params.Get("chat_id") != "-200" {
+		t.Errorf("expected a copy to -200, got %v", calls)
+	}
+
+	n, drop = applyRules(mapping, Notification{Topic: "sensors/test", Message: "test"})
+	if !drop || n.Silent {
+		t.Errorf("expected the message dropped without the next rules, got %+v, dropped %v", n, drop)
+	}
+}
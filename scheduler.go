@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var pendingFile = os.Getenv("pending_file")
+
+var schedLog = newLogger("Scheduler")
+
+// PendingMessage is a message waiting to be delivered at a specific time
+type PendingMessage struct {
+	Topic     string    `json:"topic"`
+	From      string    `json:"from"`
+	Message   string    `json:"message"`
+	Critical  bool      `json:"critical"`
+	UserID    int64     `json:"user_id,omitempty"`
+	DeliverAt time.Time `json:"deliver_at"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+type cronSchedule struct {
+	config  ScheduleConfig
+	minute  map[int]bool
+	hour    map[int]bool
+	dom     map[int]bool
+	month   map[int]bool
+	dow     map[int]bool
+	anyDom  bool
+	anyDow  bool
+	lastRun time.Time
+}
+
+var pendingLock = sync.Mutex{}
+var pendingMessages []PendingMessage
+var cronSchedules []*cronSchedule
+
+// parseCronField parses a single cron field (like */5, 5/10, 1-3 or 1,2,3) into the set of matching values
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+
+	for _, part := range strings.Split(field, ",") {
+		step, stepped := 1, false
+		if idx := strings.Index(part, "/"); idx != -1 {
+			s, err := strconv.Atoi(part[idx+1:])
+			if err != nil || s <= 0 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			step, stepped = s, true
+			part = part[:idx]
+		}
+
+		start, end := min, max
+		if part != "*" {
+			if idx := strings.Index(part, "-"); idx != -1 {
+				s, err := strconv.Atoi(part[:idx])
+				if err != nil {
+					return nil, fmt.Errorf("invalid range in %q", part)
+				}
+				e, err := strconv.Atoi(part[idx+1:])
+				if err != nil {
+					return nil, fmt.Errorf("invalid range in %q", part)
+				}
+				start, end = s, e
+			} else {
+				v, err := strconv.Atoi(part)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q", part)
+				}
+				start, end = v, v
+				if stepped { // Like 5/10, from the value to the maximum
+					end = max
+				}
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return nil, fmt.Errorf("value out of range [%d-%d] in %q", min, max, field)
+		}
+
+		for i := start; i <= end; i += step {
+			values[i] = true
+		}
+	}
+
+	return values, nil
+}
+
+// parseCron parses a standard 5 field cron expression: minute hour day-of-month month day-of-week
+func parseCron(sc ScheduleConfig) (*cronSchedule, error) {
+	fields := strings.Fields(sc.Cron)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields in cron expression %q, got %d", sc.Cron, len(fields))
+	}
+
+	var err error
+	c := &cronSchedule{
+		config: sc,
+		anyDom: fields[2] == "*",
+		anyDow: fields[4] == "*",
+	}
+
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+
+	if c.dow[7] { // Both 0 and 7 are sunday
+		c.dow[0] = true
+	}
+
+	return c, nil
+}
+
+func (c *cronSchedule) matches(t time.Time) bool {
+	if !c.minute[t.Minute()] || !c.hour[t.Hour()] || !c.month[int(t.Month())] {
+		return false
+	}
+
+	domMatch := c.dom[t.Day()]
+	dowMatch := c.dow[int(t.Weekday())]
+
+	// Same as vixie cron: if both day fields are restricted, any of them matching is enough
+	if !c.anyDom && !c.anyDow {
+		return domMatch || dowMatch
+	}
+
+	return domMatch && dowMatch
+}
+
+// parseTimeValue parses a payload time field, which can be a RFC3339 string or a unix timestamp
+func parseTimeValue(v interface{}) (time.Time, error) {
+	switch value := v.(type) {
+	case string:
+		return time.Parse(time.RFC3339, value)
+	case float64:
+		return time.Unix(int64(value), 0), nil
+	default:
+		return time.Time{}, fmt.Errorf("expected string or number")
+	}
+}
+
+// parseDurationValue parses a payload duration field, which can be a duration string (5m, 1h30m) or a number of seconds
+func parseDurationValue(v interface{}) (time.Duration, error) {
+	switch value := v.(type) {
+	case string:
+		return time.ParseDuration(value)
+	case float64:
+		return time.Duration(value * float64(time.Second)), nil
+	default:
+		return 0, fmt.Errorf("expected string or number")
+	}
+}
+
+// parseDeliveryTime reads the optional "at" and "delay" fields from a MQTT payload.
+// Returns a zero time if none was specified.
+func parseDeliveryTime(data map[string]interface{}) (time.Time, error) {
+	if data["at"] != nil {
+		t, err := parseTimeValue(data["at"])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid at field: %s", err)
+		}
+		return t, nil
+	}
+
+	if data["delay"] != nil {
+		d, err := parseDurationValue(data["delay"])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid delay field: %s", err)
+		}
+		return time.Now().Add(d), nil
+	}
+
+	return time.Time{}, nil
+}
+
+func savePendingMessages() {
+	if pendingFile == "" {
+		return
+	}
+
+	data, _ := json.MarshalIndent(pendingMessages, "", "  ")
+
+	tmpFile := pendingFile + ".tmp"
+	err := ioutil.WriteFile(tmpFile, data, 0600)
+	if err != nil {
+		schedLog.Error("Error saving pending messages to %s: %s", pendingFile, err)
+		return
+	}
+
+	err = os.Rename(tmpFile, pendingFile)
+	if err != nil {
+		schedLog.Error("Error saving pending messages to %s: %s", pendingFile, err)
+	}
+}
+
+func loadPendingMessages() {
+	if pendingFile == "" {
+		return
+	}
+
+	data, err := ioutil.ReadFile(pendingFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			schedLog.Error("Error reading pending messages from %s: %s", pendingFile, err)
+		}
+		return
+	}
+
+	pendingLock.Lock()
+	defer pendingLock.Unlock()
+
+	err = json.Unmarshal(data, &pendingMessages)
+	if err != nil {
+		schedLog.Error("Error parsing pending messages from %s: %s", pendingFile, err)
+		return
+	}
+
+	schedLog.Info("Loaded %d pending messages from %s", len(pendingMessages), pendingFile)
+}
+
+func schedulePendingMessage(msg PendingMessage) {
+	pendingLock.Lock()
+	defer pendingLock.Unlock()
+
+	pendingMessages = append(pendingMessages, msg)
+	sort.Slice(pendingMessages, func(i, j int) bool {
+		return pendingMessages[i].DeliverAt.Before(pendingMessages[j].DeliverAt)
+	})
+
+	schedLog.Info("Scheduled message on topic %s to %s", msg.Topic, msg.DeliverAt.Format(time.RFC3339))
+	savePendingMessages()
+}
+
+func deliverPendingMessages(now time.Time) {
+	pendingLock.Lock()
+	var due []PendingMessage
+	for len(pendingMessages) > 0 && !pendingMessages[0].DeliverAt.After(now) {
+		due = append(due, pendingMessages[0])
+		pendingMessages = pendingMessages[1:]
+	}
+	if len(due) > 0 {
+		savePendingMessages()
+	}
+	pendingLock.Unlock()
+
+	for _, msg := range due {
+		mapping, ok := topicMapping(msg.Topic)
+		if !ok {
+			schedLog.Warn("Pending message for topic %s but no telegram channel associated.", msg.Topic)
+			continue
+		}
+
+		if !msg.ExpiresAt.IsZero() && !msg.ExpiresAt.After(now) {
+			schedLog.Warn("Discarding expired pending message on topic %s", msg.Topic)
+			continue
+		}
+
+		err := deliverMessage(mapping, Notification{
+			Topic:    msg.Topic,
+			From:     msg.From,
+			Message:  msg.Message,
+			Critical: msg.Critical,
+			UserID:   msg.UserID,
+			Time:     msg.Time,
+		})
+		if err != nil && err != errMuted { // The original payload is gone, the dead letter has the message fields
+			data := map[string]interface{}{"type": "message", "from": msg.From, "message": msg.Message, "critical": msg.Critical}
+			if msg.UserID != 0 {
+				data["user_id"] = msg.UserID
+			}
+			payload, _ := json.Marshal(data)
+			publishDeadLetter(mapping, msg.Topic, MQTTMessage{Payload: payload}, msg.Time, failureReason(err), err)
+		}
+	}
+}
+
+func runCronSchedules(now time.Time) {
+	minute := now.Truncate(time.Minute)
+	for _, c := range cronSchedules {
+		if c.lastRun.Equal(minute) || !c.matches(now) {
+			continue
+		}
+		c.lastRun = minute
+
+		mapping, ok := topicMapping(c.config.Topic)
+		if !ok {
+			schedLog.Warn("Schedule %q for topic %s but no telegram channel associated.", c.config.Cron, c.config.Topic)
+			continue
+		}
+
+		from := c.config.From
+		if from == "" {
+			from = "Scheduler"
+		}
+
+		deliverMessage(mapping, Notification{
+			Topic:   c.config.Topic,
+			From:    from,
+			Message: c.config.Message,
+			Time:    now,
+		})
+	}
+}
+
+func setupSchedules(schedules []ScheduleConfig) {
+	for _, sc := range schedules {
+		c, err := parseCron(sc)
+		if err != nil {
+			schedLog.Fatal("Invalid schedule for topic %s: %s", sc.Topic, err)
+		}
+		schedLog.Info("Scheduling message to topic %s at %q", sc.Topic, sc.Cron)
+		cronSchedules = append(cronSchedules, c)
+	}
+}
+
+func RunScheduler() {
+	tick := time.NewTicker(time.Second)
+	for now := range tick.C {
+		heartbeat(&lastScheduler)
+		deliverPendingMessages(now)
+		runCronSchedules(now)
+		runSummaries(now)
+	}
+}
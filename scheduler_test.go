@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseCronField(t *testing.T) {
+	tests := []struct {
+		field    string
+		expected []int
+	}{
+		{"*/15", []int{0, 15, 30, 45}},
+		{"5/20", []int{5, 25, 45}},
+		{"10-20/5", []int{10, 15, 20}},
+		{"1,2,30", []int{1, 2, 30}},
+		{"7", []int{7}},
+	}
+
+	for _, test := range tests {
+		values, err := parseCronField(test.field, 0, 59)
+		if err != nil {
+			t.Errorf("%s: unexpected error %s", test.field, err)
+			continue
+		}
+
+		var result []int
+		for v := range values {
+			result = append(result, v)
+		}
+		sort.Ints(result)
+
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.field, test.expected, result)
+		}
+	}
+
+	for _, field := range []string{"70/5", "5/0", "a/5", "30-10"} {
+		if _, err := parseCronField(field, 0, 59); err == nil {
+			t.Errorf("%s: expected an error", field)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/quan-to/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// sdNotify sends a state to systemd when running as a Type=notify service
+func sdNotify(state string) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		slog.Error("Error connecting to systemd notify socket: %s", err)
+		return
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		slog.Error("Error notifying systemd: %s", err)
+	}
+}
+
+// startWatchdog pings the systemd watchdog while the bridge is healthy, so systemd restarts it when it wedges
+func startWatchdog() {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return
+	}
+
+	interval := time.Duration(usec) * time.Microsecond / 2
+	slog.Info("Pinging systemd watchdog every %s", interval)
+
+	go func() {
+		for range time.Tick(interval) {
+			if err := checkHealth(); err != nil {
+				slog.Warn("Skipping watchdog ping, unhealthy: %s", err)
+				continue
+			}
+			sdNotify("WATCHDOG=1")
+		}
+	}()
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	telegramBotTokenFile = os.Getenv("telegram_bot_token_file")
+	mqttUsername         = os.Getenv("mqtt_username")
+	mqttPassword         = os.Getenv("mqtt_password")
+	mqttPasswordFile     = os.Getenv("mqtt_password_file")
+)
+
+// secretsLock guards the secrets and the bot, which change on secret reload. Nothing must be logged while holding it,
+// since the log lines are redacted with the current secrets
+var secretsLock = sync.Mutex{}
+
+// reloadLock serializes the secret reloads, which can be triggered by the watcher, SIGHUP and the control topic at once
+var reloadLock = sync.Mutex{}
+
+// readSecretFile reads a secret mounted as a file, like Docker and Kubernetes secrets
+func readSecretFile(filename string) (string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// loadSecrets reads the secrets defined as files, which take precedence over the environment variables
+func loadSecrets() error {
+	if telegramBotTokenFile != "" {
+		token, err := readSecretFile(telegramBotTokenFile)
+		if err != nil {
+			return fmt.Errorf("error reading telegram_bot_token_file: %s", err)
+		}
+		telegramBotToken = token
+	}
+
+	if mqttPasswordFile != "" {
+		password, err := readSecretFile(mqttPasswordFile)
+		if err != nil {
+			return fmt.Errorf("error reading mqtt_password_file: %s", err)
+		}
+		mqttPassword = password
+	}
+
+	return nil
+}
+
+// getTelegramBotToken returns the current bot token, which can change on secret reload
+func getTelegramBotToken() string {
+	secretsLock.Lock()
+	defer secretsLock.Unlock()
+
+	return telegramBotToken
+}
+
+// getTelegramBot returns the bot of the current token
+func getTelegramBot() *bot.Bot {
+	secretsLock.Lock()
+	defer secretsLock.Unlock()
+
+	return telegramBot
+}
+
+// getTelegramSelf returns the bot account of the current token
+func getTelegramSelf() *models.User {
+	secretsLock.Lock()
+	defer secretsLock.Unlock()
+
+	return telegramSelf
+}
+
+// setTelegramBot switches to the bot and account authorized with the token
+func setTelegramBot(token string, b *bot.Bot, self *models.User) {
+	secretsLock.Lock()
+	defer secretsLock.Unlock()
+
+	telegramBotToken = token
+	telegramBot, telegramSelf = b, self
+}
+
+// getMQTTPassword returns the current MQTT password, which can change on secret reload
+func getMQTTPassword() string {
+	secretsLock.Lock()
+	defer secretsLock.Unlock()
+
+	return mqttPassword
+}
+
+// watchSecrets checks the secret files every secret_reload_interval, reconnecting with the new credentials when they change
+func watchSecrets() {
+	if telegramBotTokenFile == "" && mqttPasswordFile == "" {
+		return
+	}
+
+	interval := getEnvDuration("secret_reload_interval", 30*time.Second)
+
+	go func() {
+		for range time.Tick(interval) {
+			reloadSecrets()
+		}
+	}()
+}
+
+// reloadSecrets reads the secret files again, switching to the new credentials when they changed
+func reloadSecrets() {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	reloadTelegramToken()
+	reloadMQTTPassword()
+}
+
+func reloadTelegramToken() {
+	if telegramBotTokenFile == "" {
+		return
+	}
+
+	token, err := readSecretFile(telegramBotTokenFile)
+	if err != nil {
+		telLog.Error("Error reading telegram_bot_token_file: %s", err)
+		return
+	}
+
+	if token == getTelegramBotToken() {
+		return
+	}
+
+	telLog.Info("Telegram bot token changed, authorizing again")
+
+	b, self, err := newTelegramBot(token)
+	if err != nil {
+		telLog.Error("Error authorizing with the new token, keeping the current one: %s", err)
+		return
+	}
+
+	setTelegramBot(token, b, self)
+
+	telLog.Info("Authorized on account %s", self.Username)
+}
+
+func reloadMQTTPassword() {
+	if mqttPasswordFile == "" {
+		return
+	}
+
+	password, err := readSecretFile(mqttPasswordFile)
+	if err != nil {
+		mqttLog.Error("Error reading mqtt_password_file: %s", err)
+		return
+	}
+
+	if password == getMQTTPassword() {
+		return
+	}
+
+	mqttLog.Info("MQTT password changed, connecting with the new password")
+
+	client, err := newMQTTClient(password)
+	if err == nil {
+		err = replaceMQTTClient(client)
+	}
+	if err != nil {
+		mqttLog.Error("Error connecting with the new password, keeping the current connection: %s", err)
+		return
+	}
+
+	secretsLock.Lock()
+	mqttPassword = password
+	secretsLock.Unlock()
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/tidwall/gjson"
+)
+
+// extractFields sets the payload fields selected by the mapping gjson paths, like {"message": "state.text"}.
+// Payloads with selectors and without a type are handled as messages.
+func (m *Mapping) extractFields(data map[string]interface{}) {
+	if len(m.Fields) == 0 {
+		return
+	}
+
+	payload, _ := json.Marshal(data)
+
+	for name, path := range m.Fields {
+		if result := gjson.GetBytes(payload, path); result.Exists() {
+			data[name] = result.Value()
+		}
+	}
+
+	if data["type"] == nil {
+		data["type"] = "message"
+	}
+}
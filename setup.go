@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// setupMapping is the mapping written by the setup wizard, without the unset options
+type setupMapping struct {
+	GroupID   int64  `json:"group_id"`
+	Topic     string `json:"topic"`
+	MessageTo string `json:"message_to,omitempty"`
+}
+
+type setupWizard struct {
+	in *bufio.Scanner
+}
+
+// ask prompts a question, returning def when nothing is typed
+func (w *setupWizard) ask(question, def string) string {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, def)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+
+	if !w.in.Scan() {
+		fmt.Println()
+		os.Exit(1)
+	}
+
+	answer := strings.TrimSpace(w.in.Text())
+	if answer == "" {
+		return def
+	}
+
+	return answer
+}
+
+func (w *setupWizard) confirm(question string) bool {
+	answer := strings.ToLower(w.ask(question+" (y/n)", "n"))
+	return answer == "y" || answer == "yes"
+}
+
+// discoverChat waits for a message in a group or channel the bot is in, skipping the chats already mapped
+func (w *setupWizard) discoverChat(updates <-chan *models.Update, mapped map[int64]bool) models.Chat {
+	fmt.Println("Add the bot to the group or channel and post any message there. Waiting...")
+
+	for update := range updates {
+		msg := update.Message
+		if msg == nil {
+			msg = update.ChannelPost
+		}
+		if msg == nil || mapped[msg.Chat.ID] {
+			continue
+		}
+
+		if msg.Chat.Type == models.ChatTypePrivate {
+			fmt.Printf("Received a private message from %s, post in the group instead.\n", telegramSender(msg))
+			continue
+		}
+
+		fmt.Printf("Found %s %q with id %d\n", msg.Chat.Type, msg.Chat.Title, msg.Chat.ID)
+		return msg.Chat
+	}
+
+	return models.Chat{}
+}
+
+// runSetup is the setup subcommand: it asks for the bot token, discovers the chats and writes the config file
+func runSetup() int {
+	w := &setupWizard{in: bufio.NewScanner(os.Stdin)}
+
+	fmt.Println("MQTT Telegram setup")
+	fmt.Println()
+
+	updates := make(chan *models.Update)
+	receive := bot.WithDefaultHandler(func(_ context.Context, _ *bot.Bot, update *models.Update) { updates <- update })
+
+	var b *bot.Bot
+	var self *models.User
+	for b == nil {
+		token := w.ask("Telegram bot token (from @BotFather)", telegramBotToken)
+		var err error
+		if b, self, err = newTelegramBot(token, receive); err != nil {
+			fmt.Printf("Invalid token: %s\n", err)
+			continue
+		}
+		telegramBotToken = token
+	}
+	fmt.Printf("Authorized as @%s\n\n", self.Username)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Start(ctx)
+
+	var mappings []setupMapping
+	mapped := map[int64]bool{}
+
+	for {
+		chat := w.discoverChat(updates, mapped)
+
+		m := &Mapping{GroupID: chat.ID}
+		for m.Topic == "" {
+			m.Topic = w.ask("MQTT topic to forward to this chat", "")
+		}
+		m.MessageTo = w.ask("Messages sent in this chat go to (empty to disable)", "")
+
+		if err := m.setup(); err != nil {
+			fmt.Printf("Invalid mapping: %s\n", err)
+			continue
+		}
+
+		mappings = append(mappings, setupMapping{GroupID: m.GroupID, Topic: m.Topic, MessageTo: m.MessageTo})
+		mapped[chat.ID] = true
+
+		if !w.confirm("Map another chat?") {
+			break
+		}
+	}
+
+	server := w.ask("MQTT server", mqttHost)
+	if _, err := parseBrokerURL(server); err != nil {
+		fmt.Printf("Warning: invalid MQTT server: %s\n", err)
+	}
+
+	filename := w.ask("Config file", "config.json")
+
+	data, _ := json.MarshalIndent(map[string]interface{}{"mappings": mappings}, "", "  ")
+	if err := ioutil.WriteFile(filename, append(data, '\n'), 0600); err != nil {
+		fmt.Printf("Error writing %s: %s\n", filename, err)
+		return 1
+	}
+
+	fmt.Printf("\nWrote %s. Start the bridge with:\n\n", filename)
+	fmt.Printf("  telegram_bot_token=<your token> mqtt_server=%s mqtttelegram --config %s\n", server, filename)
+
+	return 0
+}
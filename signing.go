@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Signature policies
+const (
+	SignatureReject = "reject" // Discard unsigned or invalid messages (default)
+	SignatureFlag   = "flag"   // Forward unsigned or invalid messages marked as "(unverified)"
+)
+
+// signedEnvelope is a payload signed with HMAC-SHA256.
+// Payload is the original payload, base64 encoded when Encoding is "base64" (for binary payloads)
+type signedEnvelope struct {
+	Payload   string `json:"payload"`
+	Encoding  string `json:"encoding,omitempty"`
+	Signature string `json:"signature"`
+}
+
+func signHMAC(key, payload []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signPayload wraps the payload into a signed envelope
+func signPayload(key, payload []byte) []byte {
+	envelope := signedEnvelope{
+		Payload:   string(payload),
+		Signature: signHMAC(key, payload),
+	}
+
+	if !json.Valid(payload) {
+		envelope.Payload = base64.StdEncoding.EncodeToString(payload)
+		envelope.Encoding = "base64"
+	}
+
+	data, _ := json.Marshal(envelope)
+
+	return data
+}
+
+// verifyPayload unwraps a signed envelope returning the original payload if the signature is valid
+func verifyPayload(key, payload []byte) ([]byte, error) {
+	var envelope signedEnvelope
+
+	err := json.Unmarshal(payload, &envelope)
+	if err != nil || envelope.Signature == "" {
+		return payload, fmt.Errorf("payload is not signed")
+	}
+
+	inner := []byte(envelope.Payload)
+	if envelope.Encoding == "base64" {
+		inner, err = base64.StdEncoding.DecodeString(envelope.Payload)
+		if err != nil {
+			return payload, fmt.Errorf("invalid signed payload encoding: %s", err)
+		}
+	}
+
+	expected, _ := hex.DecodeString(signHMAC(key, inner))
+	signature, err := hex.DecodeString(envelope.Signature)
+	if err != nil || !hmac.Equal(expected, signature) {
+		return inner, fmt.Errorf("invalid payload signature")
+	}
+
+	return inner, nil
+}
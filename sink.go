@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+var sinkLog = newLogger("Sink")
+
+// Sink types
+const (
+	SinkTelegram = "telegram"
+	SinkWebhook  = "webhook"
+	SinkEmail    = "email"
+	SinkNtfy     = "ntfy"
+	SinkPushover = "pushover"
+	SinkDiscord  = "discord"
+	SinkMatrix   = "matrix"
+	SinkSlack    = "slack"
+)
+
+// Notification is a message to be delivered to a Sink
+type Notification struct {
+	Topic    string                 `json:"topic"`
+	From     string                 `json:"from"`
+	Message  string                 `json:"message"`
+	Critical bool                   `json:"critical"`
+	Silent   bool                   `json:"silent,omitempty"`  // Send without notification sound, set by the rules
+	UserID   int64                  `json:"user_id,omitempty"` // Telegram user the message is sent to in private, instead of the sinks
+	Data     map[string]interface{} `json:"data,omitempty"`    // Decoded MQTT payload, if any
+	Text     string                 `json:"text,omitempty"`    // Message rendered by the mapping template, if any
+
+	Properties map[string]string `json:"properties,omitempty"` // MQTT 5 user properties, if any
+
+	Time time.Time `json:"time"` // Payload timestamp or the time the message was received
+
+	ctx context.Context // Trace context of the message
+
+	alert *pendingAlert // Acknowledgeable alert of the notification, if any
+
+	msg *MQTTMessage // MQTT message of the notification, if any, for the dead letter of the failed retries
+}
+
+// chatID returns the chat of the notification: its user, for the private messages, or the mapping group
+func (n Notification) chatID(mapping *Mapping) int64 {
+	if n.UserID != 0 {
+		return n.UserID
+	}
+	return mapping.GroupID
+}
+
+func (n Notification) context() context.Context {
+	if n.ctx == nil {
+		return context.Background()
+	}
+	return n.ctx
+}
+
+// Sink is a destination where notifications can be delivered
+type Sink interface {
+	Send(n Notification) error
+	String() string
+}
+
+// SinkConfig represents the configuration of a single Sink in a mapping
+type SinkConfig struct {
+	Type         string  `json:"type"`
+	OnlyCritical bool    `json:"only_critical"` // Only messages with "critical": true are sent to this sink
+	RateLimit    float64 `json:"rate_limit"`    // Maximum messages per second. Zero means no limit
+	RateBurst    int     `json:"rate_burst"`    // Messages that can be sent at once before rate limiting
+
+	// telegram
+	ChatID int64 `json:"chat_id"`
+	TelegramOptions
+
+	// webhook, ntfy
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+	Token   string            `json:"token"` // Also used as pushover application token
+
+	// pushover
+	User string `json:"user"`
+
+	// discord
+	ChannelID string `json:"channel_id"`
+
+	// slack
+	Channel string `json:"channel"`
+
+	// matrix
+	Homeserver string `json:"homeserver"`
+	RoomID     string `json:"room_id"`
+
+	// email
+	SMTPServer string   `json:"smtp_server"` // host:port
+	Username   string   `json:"username"`
+	Password   string   `json:"password"`
+	MailFrom   string   `json:"mail_from"`
+	MailTo     []string `json:"mail_to"`
+}
+
+// newSink creates the sink described by the config, rate limited if rate_limit is defined
+func (c *SinkConfig) newSink() (Sink, error) {
+	s, err := c.createSink()
+	if err != nil {
+		return nil, err
+	}
+
+	if c.RateLimit > 0 {
+		s = &rateLimitedSink{
+			sink:    s,
+			limiter: NewRateLimiter(c.RateLimit, c.RateBurst),
+		}
+	}
+
+	return s, nil
+}
+
+func (c *SinkConfig) createSink() (Sink, error) {
+	switch c.Type {
+	case SinkTelegram:
+		if c.ChatID == 0 {
+			return nil, fmt.Errorf("telegram sink requires chat_id")
+		}
+		if err := c.TelegramOptions.validate(); err != nil {
+			return nil, err
+		}
+		return &TelegramSink{ChatID: c.ChatID, Options: c.TelegramOptions}, nil
+	case SinkWebhook:
+		if c.URL == "" {
+			return nil, fmt.Errorf("webhook sink requires url")
+		}
+		return &WebhookSink{URL: c.URL, Method: c.Method, Headers: c.Headers}, nil
+	case SinkNtfy:
+		if c.URL == "" {
+			return nil, fmt.Errorf("ntfy sink requires url")
+		}
+		return &NtfySink{URL: c.URL, Token: c.Token}, nil
+	case SinkPushover:
+		if c.Token == "" || c.User == "" {
+			return nil, fmt.Errorf("pushover sink requires token and user")
+		}
+		return &PushoverSink{Token: c.Token, User: c.User}, nil
+	case SinkDiscord:
+		if c.URL == "" && (c.Token == "" || c.ChannelID == "") {
+			return nil, fmt.Errorf("discord sink requires webhook url or token and channel_id")
+		}
+		return &DiscordSink{WebhookURL: c.URL, Token: c.Token, ChannelID: c.ChannelID}, nil
+	case SinkMatrix:
+		if c.Homeserver == "" || c.Token == "" || c.RoomID == "" {
+			return nil, fmt.Errorf("matrix sink requires homeserver, token and room_id")
+		}
+		return &MatrixSink{Homeserver: c.Homeserver, AccessToken: c.Token, RoomID: c.RoomID}, nil
+	case SinkSlack:
+		if c.URL == "" && (c.Token == "" || c.Channel == "") {
+			return nil, fmt.Errorf("slack sink requires webhook url or token and channel")
+		}
+		return &SlackSink{WebhookURL: c.URL, Token: c.Token, Channel: c.Channel}, nil
+	case SinkEmail:
+		if c.SMTPServer == "" || c.MailFrom == "" || len(c.MailTo) == 0 {
+			return nil, fmt.Errorf("email sink requires smtp_server, mail_from and mail_to")
+		}
+		return &EmailSink{
+			SMTPServer: c.SMTPServer,
+			Username:   c.Username,
+			Password:   c.Password,
+			From:       c.MailFrom,
+			To:         c.MailTo,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("invalid sink type %q", c.Type)
+}
+
+func (c *SinkConfig) accepts(n Notification) bool {
+	return !c.OnlyCritical || n.Critical
+}
+
+// sinkHTTPClient is the client of the HTTP sinks and reports, so an endpoint that does not answer can't hold the delivery
+var sinkHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+func checkHTTPResponse(res *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("received status %d: %s", res.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// deliverMessage sends a notification to all sinks of the mapping.
+// Sinks that fail have the notification routed to the mapping fallback, if any.
+// Returns the last error if the notification could not be delivered to any of the sinks. Sends being retried in the
+// background are not errors: their retries track the delivery, and dead letter the notification if they fail.
+func deliverMessage(mapping *Mapping, n Notification) error {
+	if mapping.isMuted() {
+		sinkLog.Debug("Suppressing message from muted topic %s", mapping.Topic)
+		return errMuted
+	}
+
+	err := sendToSinks(mapping, n)
+	if err == errRetrying {
+		return nil
+	}
+
+	mapping.trackDelivery(err)
+	if err == nil {
+		recordDelivery(mapping, n)
+	}
+
+	return err
+}
+
+// recordDelivery records a delivered notification in the summary and the archive
+func recordDelivery(mapping *Mapping, n Notification) {
+	mapping.recordSummaryNotification(n)
+	archiveMessage(ArchivedMessage{
+		Time:      time.Now(),
+		Direction: DirectionToTelegram,
+		Topic:     mapping.Topic,
+		ChatID:    n.chatID(mapping),
+		From:      n.From,
+		Message:   n.Message,
+	})
+}
+
+// sendWithSpan sends the notification to a sink inside a span
+func sendWithSpan(s Sink, n Notification) error {
+	ctx, span := tracer.Start(n.context(), "sink.send", trace.WithAttributes(attribute.String("sink", s.String())))
+	n.ctx = ctx
+
+	err := s.Send(n)
+	endSpan(span, err)
+
+	return err
+}
+
+// retryBackoff is the wait before the first retry of a failed send, doubled on each retry
+var retryBackoff = time.Second
+
+// errRetrying is returned by the sends that failed and are being retried in the background
+var errRetrying = fmt.Errorf("retrying in the background")
+
+// sendWithRetries sends the notification to a sink. When the send fails with an error that is not permanent, it is
+// retried up to the mapping retries in the background, so a failing sink does not stall the delivery of the other
+// messages, and errRetrying is returned. Then done is called with the result of the last retry.
+func sendWithRetries(mapping *Mapping, s Sink, n Notification, done func(err error)) error {
+	err := sendWithSpan(s, n)
+	if err == nil || mapping.Retries == 0 || !isRetryable(err) {
+		return err
+	}
+
+	go func() {
+		backoff := retryBackoff
+		for retry := 1; retry <= mapping.Retries && err != nil && isRetryable(err); retry++ {
+			sinkLog.Warn("Retrying message from topic %s to %s in %s (%d/%d): %s", mapping.Topic, s, backoff, retry, mapping.Retries, err)
+			time.Sleep(backoff)
+			backoff *= 2
+
+			err = sendWithSpan(s, n)
+		}
+		done(err)
+	}()
+
+	return errRetrying
+}
+
+// finishRetries handles the result of the background retries of a notification: tracking the delivery, and
+// sending the notification to the fallback, if any, or else to the dead letter topic when the retries failed
+func finishRetries(mapping *Mapping, s Sink, n Notification, err error) {
+	if err != nil {
+		sinkLog.Error("Error sending message from topic %s to %s after %d retries: %s", mapping.Topic, s, mapping.Retries, err)
+
+		if n.UserID == 0 && mapping.fallback != nil && mapping.Fallback.accepts(n) {
+			sinkLog.Info("Sending message from topic %s to fallback %s", mapping.Topic, mapping.fallback)
+			if err = sendWithSpan(mapping.fallback, n); err != nil {
+				sinkLog.Error("Error sending message to fallback %s: %s", mapping.fallback, err)
+			}
+		}
+	}
+
+	mapping.trackDelivery(err)
+	if err != nil {
+		sendDeadLetter(mapping, notificationDeadLetter(mapping, n, err))
+		return
+	}
+
+	recordDelivery(mapping, n)
+}
+
+// isRetryable returns if a failed send can succeed when tried again
+func isRetryable(err error) bool {
+	if err == errMuted || err == errChatDisabled || err == errCircuitOpen {
+		return false
+	}
+
+	switch classifyTelegramError(err) {
+	case TelegramErrKicked, TelegramErrForbidden, TelegramErrChatNotFound, TelegramErrTooLong:
+		return false
+	}
+
+	return true
+}
+
+func sendToSinks(mapping *Mapping, n Notification) error {
+	var lastErr error
+
+	n.Message = mapping.stampMessage(n)
+
+	if mapping.template != nil {
+		text, err := renderTemplate(mapping.template, n)
+		if err != nil {
+			sinkLog.Error("Error rendering template for topic %s: %s", mapping.Topic, err)
+		} else {
+			n.Text = text
+		}
+	}
+
+	if n.UserID != 0 {
+		return sendDirect(mapping, n)
+	}
+
+	retrying := false
+	for i, s := range mapping.sinks {
+		if !mapping.Sinks[i].accepts(n) {
+			continue
+		}
+
+		s := s
+		err := sendWithRetries(mapping, s, n, func(err error) { finishRetries(mapping, s, n, err) })
+		if err == errRetrying {
+			retrying = true
+		} else if err != nil {
+			sinkLog.Error("Error sending message from topic %s to %s: %s", mapping.Topic, s, err)
+			lastErr = err
+		}
+	}
+
+	if lastErr == nil && retrying {
+		return errRetrying
+	}
+
+	if lastErr == nil || mapping.fallback == nil || !mapping.Fallback.accepts(n) {
+		return lastErr
+	}
+
+	sinkLog.Info("Sending message from topic %s to fallback %s", mapping.Topic, mapping.fallback)
+	err := sendWithSpan(mapping.fallback, n)
+	if err != nil {
+		sinkLog.Error("Error sending message to fallback %s: %s", mapping.fallback, err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const discordAPI = "https://discord.com/api/v10"
+
+// DiscordSink sends notifications to Discord, either through a channel webhook URL or a bot token + channel id
+type DiscordSink struct {
+	WebhookURL string
+	Token      string
+	ChannelID  string
+}
+
+func (s *DiscordSink) String() string {
+	if s.WebhookURL != "" {
+		return "discord(webhook)"
+	}
+	return fmt.Sprintf("discord(%s)", s.ChannelID)
+}
+
+func (s *DiscordSink) Send(n Notification) error {
+	content := n.Text
+	if content == "" {
+		content = fmt.Sprintf("**%s**: %s", n.From, n.Message)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"content": content,
+	})
+
+	url := s.WebhookURL
+	if url == "" {
+		url = fmt.Sprintf("%s/channels/%s/messages", discordAPI, s.ChannelID)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if s.WebhookURL == "" {
+		req.Header.Set("Authorization", "Bot "+s.Token)
+	}
+
+	return checkHTTPResponse(sinkHTTPClient.Do(req))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// emailTimeout is the timeout of the whole SMTP session, so a server that does not answer can't hold the delivery
+const emailTimeout = 30 * time.Second
+
+// emailHeaderReplacer removes the line breaks of the header values, which would inject other headers
+var emailHeaderReplacer = strings.NewReplacer("\r", " ", "\n", " ")
+
+// EmailSink sends notifications by email through a SMTP server
+type EmailSink struct {
+	SMTPServer string // host:port
+	Username   string
+	Password   string
+	From       string
+	To         []string
+}
+
+func (s *EmailSink) String() string {
+	return fmt.Sprintf("email(%s)", strings.Join(s.To, ","))
+}
+
+func (s *EmailSink) Send(n Notification) error {
+	message := n.Message
+	if n.Text != "" {
+		message = n.Text
+	}
+
+	subject := mime.QEncoding.Encode("utf-8", emailHeaderReplacer.Replace(n.From))
+	body := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n", s.From, strings.Join(s.To, ", "), subject, message)
+
+	return s.sendMail([]byte(body))
+}
+
+// sendMail is smtp.SendMail with a deadline on the connection
+func (s *EmailSink) sendMail(body []byte) error {
+	conn, err := net.DialTimeout("tcp", s.SMTPServer, emailTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(emailTimeout))
+
+	host := strings.Split(s.SMTPServer, ":")[0]
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(s.From); err != nil {
+		return err
+	}
+	for _, to := range s.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// fakeSMTP accepts a single mail, returning its data on the channel
+func fakeSMTP(t *testing.T) (string, chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	mails := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		c := textproto.NewConn(conn)
+		c.PrintfLine("220 fake")
+		for {
+			line, err := c.ReadLine()
+			if err != nil {
+				return
+			}
+			switch strings.ToUpper(strings.Fields(line + " ")[0]) {
+			case "DATA":
+				c.PrintfLine("354 go ahead")
+				data, _ := c.ReadDotBytes()
+				mails <- string(data)
+				c.PrintfLine("250 queued")
+			case "QUIT":
+				c.PrintfLine("221 bye")
+				return
+			default:
+				c.PrintfLine("250 ok")
+			}
+		}
+	}()
+
+	return l.Addr().String(), mails
+}
+
+func TestEmailSinkSubject(t *testing.T) {
+	server, mails := fakeSMTP(t)
+
+	s := &EmailSink{SMTPServer: server, From: "bridge@example.com", To: []string{"admin@example.com"}}
+	if err := s.Send(Notification{From: "Door\r\nBcc: victim@example.com ção", Message: "open"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	mail := <-mails
+	if strings.Contains(mail, "\nBcc:") {
+		t.Errorf("expected the line break of the subject to be removed, got %q", mail)
+	}
+	if !strings.Contains(mail, "Subject: =?utf-8?q?Door__Bcc:_victim@example.com_=C3=A7=C3=A3o?=\n") {
+		t.Errorf("expected an encoded subject, got %q", mail)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var matrixTxnCounter int64
+
+// MatrixSink sends notifications to a Matrix room using the client-server API
+type MatrixSink struct {
+	Homeserver  string
+	AccessToken string
+	RoomID      string
+}
+
+func (s *MatrixSink) String() string {
+	return fmt.Sprintf("matrix(%s)", s.RoomID)
+}
+
+func (s *MatrixSink) Send(n Notification) error {
+	body := n.Text
+	if body == "" {
+		body = fmt.Sprintf("%s: %s", n.From, n.Message)
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"msgtype": "m.text",
+		"body":    body,
+	})
+
+	txnID := fmt.Sprintf("mqtttelegram-%d-%d", time.Now().UnixNano(), atomic.AddInt64(&matrixTxnCounter, 1))
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimRight(s.Homeserver, "/"), url.PathEscape(s.RoomID), txnID)
+
+	req, err := http.NewRequest("PUT", endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.AccessToken)
+
+	return checkHTTPResponse(sinkHTTPClient.Do(req))
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NtfySink sends notifications to a ntfy topic URL (like https://ntfy.sh/mytopic)
+type NtfySink struct {
+	URL   string
+	Token string
+}
+
+func (s *NtfySink) String() string {
+	return fmt.Sprintf("ntfy(%s)", s.URL)
+}
+
+func (s *NtfySink) Send(n Notification) error {
+	body := n.Message
+	if n.Text != "" {
+		body = n.Text
+	}
+
+	req, err := http.NewRequest("POST", s.URL, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Title", n.From)
+	if n.Critical {
+		req.Header.Set("Priority", "urgent")
+	}
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	return checkHTTPResponse(sinkHTTPClient.Do(req))
+}
+
+// PushoverSink sends notifications through the Pushover API
+type PushoverSink struct {
+	Token string
+	User  string
+}
+
+func (s *PushoverSink) String() string {
+	return "pushover"
+}
+
+func (s *PushoverSink) Send(n Notification) error {
+	message := n.Message
+	if n.Text != "" {
+		message = n.Text
+	}
+
+	priority := "0"
+	if n.Critical {
+		priority = "1"
+	}
+
+	return checkHTTPResponse(sinkHTTPClient.PostForm("https://api.pushover.net/1/messages.json", url.Values{
+		"token":    {s.Token},
+		"user":     {s.User},
+		"title":    {n.From},
+		"message":  {message},
+		"priority": {priority},
+	}))
+}
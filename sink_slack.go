@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const slackPostMessageURL = "https://slack.com/api/chat.postMessage"
+
+// SlackSink sends notifications to Slack, either through an incoming webhook URL or a bot token + channel
+type SlackSink struct {
+	WebhookURL string
+	Token      string
+	Channel    string
+}
+
+func (s *SlackSink) String() string {
+	if s.WebhookURL != "" {
+		return "slack(webhook)"
+	}
+	return fmt.Sprintf("slack(%s)", s.Channel)
+}
+
+func (s *SlackSink) Send(n Notification) error {
+	text := n.Text
+	if text == "" {
+		text = fmt.Sprintf("*%s*: %s", n.From, n.Message)
+	}
+
+	payload := map[string]interface{}{
+		"text": text,
+	}
+
+	url := s.WebhookURL
+	if url == "" {
+		url = slackPostMessageURL
+		payload["channel"] = s.Channel
+	}
+
+	body, _ := json.Marshal(payload)
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	if s.WebhookURL == "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	res, err := sinkHTTPClient.Do(req)
+	if s.WebhookURL != "" {
+		return checkHTTPResponse(res, err)
+	}
+
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// Slack Web API returns 200 even on errors, with ok: false
+	var apiRes struct {
+		Ok    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+
+	err = json.NewDecoder(res.Body).Decode(&apiRes)
+	if err != nil {
+		return fmt.Errorf("invalid slack response (status %d): %s", res.StatusCode, err)
+	}
+
+	if !apiRes.Ok {
+		return fmt.Errorf("slack error: %s", apiRes.Error)
+	}
+
+	return nil
+}
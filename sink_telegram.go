@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"html"
+	"strconv"
+	"strings"
+)
+
+var errCircuitOpen = fmt.Errorf("circuit breaker open")
+var errChatDisabled = fmt.Errorf("chat disabled, the bot was removed from it")
+
+// TelegramOptions are the sendMessage options of the Telegram messages of a mapping or sink
+type TelegramOptions struct {
+	ParseMode             string `json:"parse_mode"` // Markdown (default), MarkdownV2, HTML or none
+	DisableWebPagePreview bool   `json:"disable_web_page_preview"`
+	DisableNotification   bool   `json:"disable_notification"` // Send silently
+	ProtectContent        bool   `json:"protect_content"`      // Messages can't be forwarded or saved
+	ChannelPost           bool   `json:"channel_post"`         // Post only the message, without the sender, as in broadcast channels
+	ThreadID              int    `json:"thread_id"`            // Forum topic of the chat where messages are sent
+}
+
+// ParseModeNone sends the messages as plain text
+const ParseModeNone = "none"
+
+func (o TelegramOptions) validate() error {
+	switch o.ParseMode {
+	case "", string(models.ParseModeMarkdownV1), string(models.ParseModeMarkdown), string(models.ParseModeHTML), ParseModeNone:
+		return nil
+	}
+
+	return fmt.Errorf("invalid parse_mode %q", o.ParseMode)
+}
+
+// parseMode returns the Telegram parse mode of the messages, empty for plain text
+func (o TelegramOptions) parseMode() models.ParseMode {
+	switch o.ParseMode {
+	case "":
+		return models.ParseModeMarkdownV1
+	case ParseModeNone:
+		return ""
+	}
+
+	return models.ParseMode(o.ParseMode)
+}
+
+// senderText formats a message with its sender in bold, escaping the sender for the parse mode
+func (o TelegramOptions) senderText(from, message string) string {
+	return o.bold(from) + ": " + message
+}
+
+// bold formats a plain text in bold, escaping it for the parse mode
+func (o TelegramOptions) bold(text string) string {
+	switch o.parseMode() {
+	case models.ParseModeMarkdown, models.ParseModeMarkdownV1:
+		return "*" + o.escape(text) + "*"
+	case models.ParseModeHTML:
+		return "<b>" + o.escape(text) + "</b>"
+	}
+
+	return text
+}
+
+// markdownV1Escaper escapes the Markdown (v1) entities
+var markdownV1Escaper = strings.NewReplacer("_", "\\_", "*", "\\*", "`", "\\`", "[", "\\[")
+
+// escape escapes a plain text, like the texts of the bridge, for the parse mode
+func (o TelegramOptions) escape(text string) string {
+	switch o.parseMode() {
+	case models.ParseModeMarkdownV1:
+		return markdownV1Escaper.Replace(text)
+	case models.ParseModeMarkdown:
+		return bot.EscapeMarkdown(text)
+	case models.ParseModeHTML:
+		return html.EscapeString(text)
+	}
+
+	return text
+}
+
+// TelegramSink sends notifications to a Telegram chat
+type TelegramSink struct {
+	ChatID  int64
+	Options TelegramOptions
+}
+
+func (s *TelegramSink) String() string {
+	return fmt.Sprintf("telegram(%d)", s.ChatID)
+}
+
+func (s *TelegramSink) Send(n Notification) error {
+	text := n.Text
+	if text == "" && s.Options.ChannelPost {
+		text = n.Message
+	} else if text == "" {
+		text = s.Options.senderText(n.From, n.Message)
+	}
+
+	options := s.Options
+	options.DisableNotification = options.DisableNotification || n.Silent
+
+	return s.send(n.context(), func(ctx context.Context) error {
+		if n.alert != nil {
+			return n.alert.send(ctx, s.ChatID, text, options)
+		}
+		return sendTelegramMessage(ctx, s.ChatID, text, options)
+	})
+}
+
+// SendSticker sends a sticker by file_id to the chat
+func (s *TelegramSink) SendSticker(fileID string) error {
+	return s.send(context.Background(), func(ctx context.Context) error {
+		return sendTelegramSticker(ctx, s.ChatID, fileID, s.Options)
+	})
+}
+
+// SendPhoto uploads a photo with a caption to the chat
+func (s *TelegramSink) SendPhoto(caption string, image []byte) error {
+	return s.send(context.Background(), func(ctx context.Context) error {
+		return sendTelegramPhoto(ctx, s.ChatID, caption, image, s.Options)
+	})
+}
+
+// SendRequest makes a Telegram request built by the caller, like messages with keyboards, to the chat
+func (s *TelegramSink) SendRequest(f func(ctx context.Context) error) error {
+	return s.send(context.Background(), f)
+}
+
+// send runs a Telegram send honoring the disabled chats and the circuit breaker
+func (s *TelegramSink) send(parent context.Context, f func(ctx context.Context) error) error {
+	chat := strconv.FormatInt(s.ChatID, 10)
+
+	if isChatDisabled(s.ChatID) {
+		return errChatDisabled
+	}
+
+	if !telegramBreaker.Allow() {
+		telegramErrors.Inc(chat, TelegramErrCircuitOpen)
+		return errCircuitOpen
+	}
+
+	ctx, cancel := telegramContext(parent)
+	defer cancel()
+
+	err := f(ctx)
+	if err != nil {
+		class := classifyTelegramError(err)
+		telegramErrors.Inc(chat, class)
+
+		// The chat is gone for good, retrying would only spam the log and open the breaker for the other chats
+		if class == TelegramErrKicked || class == TelegramErrChatNotFound {
+			disableChat(s.ChatID, err.Error())
+			return err
+		}
+
+		if !isTelegramOutage(err) {
+			return err
+		}
+
+		telegramBreaker.Failure()
+		if telegramBreaker.IsOpen() {
+			telLog.Warn("Circuit breaker open, pausing Telegram sends for %s", telegramBreaker.Cooldown)
+		}
+		return err
+	}
+
+	telegramSent.Inc(chat)
+	telegramBreaker.Success()
+
+	return nil
+}
+
+func sendTelegramMessage(ctx context.Context, group int64, text string, options TelegramOptions) error {
+	mqttLog.Info("[%d] %s", group, logText(text))
+
+	_, err := getTelegramBot().SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:              group,
+		MessageThreadID:     options.ThreadID,
+		Text:                text,
+		ParseMode:           options.parseMode(),
+		LinkPreviewOptions:  &models.LinkPreviewOptions{IsDisabled: &options.DisableWebPagePreview},
+		DisableNotification: options.DisableNotification,
+		ProtectContent:      options.ProtectContent,
+	})
+
+	if err != nil {
+		telLog.Error("Error sending message to group %d: %s", group, err)
+	}
+
+	return err
+}
+
+func sendTelegramSticker(ctx context.Context, group int64, fileID string, options TelegramOptions) error {
+	mqttLog.Info("[%d] sticker %s", group, fileID)
+
+	_, err := getTelegramBot().SendSticker(ctx, &bot.SendStickerParams{
+		ChatID:              group,
+		MessageThreadID:     options.ThreadID,
+		Sticker:             &models.InputFileString{Data: fileID},
+		DisableNotification: options.DisableNotification,
+		ProtectContent:      options.ProtectContent,
+	})
+	if err != nil {
+		telLog.Error("Error sending sticker to group %d: %s", group, err)
+	}
+
+	return err
+}
+
+func sendTelegramPhoto(ctx context.Context, group int64, caption string, image []byte, options TelegramOptions) error {
+	mqttLog.Info("[%d] photo (%d bytes) %s", group, len(image), caption)
+
+	_, err := getTelegramBot().SendPhoto(ctx, &bot.SendPhotoParams{
+		ChatID:              group,
+		MessageThreadID:     options.ThreadID,
+		Photo:               &models.InputFileUpload{Filename: "image", Data: bytes.NewReader(image)},
+		Caption:             caption,
+		DisableNotification: options.DisableNotification,
+		ProtectContent:      options.ProtectContent,
+	})
+	if err != nil {
+		telLog.Error("Error sending photo to group %d: %s", group, err)
+	}
+
+	return err
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"net/http"
+)
+
+// WebhookSink sends notifications as JSON to a HTTP endpoint
+type WebhookSink struct {
+	URL     string
+	Method  string
+	Headers map[string]string
+}
+
+func (s *WebhookSink) String() string {
+	return fmt.Sprintf("webhook(%s)", s.URL)
+}
+
+func (s *WebhookSink) Send(n Notification) error {
+	body, _ := json.Marshal(n)
+
+	method := s.Method
+	if method == "" {
+		method = "POST"
+	}
+
+	req, err := http.NewRequest(method, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+	otel.GetTextMapPropagator().Inject(n.context(), propagation.HeaderCarrier(req.Header))
+
+	return checkHTTPResponse(sinkHTTPClient.Do(req))
+}
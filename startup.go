@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"sync"
+	"time"
+)
+
+// Startup stages, in order. The bridge is healthy only when ready.
+const (
+	StageStarting = "starting"
+	StageTelegram = "connecting to telegram"
+	StageMQTT     = "connecting to mqtt"
+	StageReady    = "ready"
+	StageStopping = "stopping"
+)
+
+var startupLog = newLogger("Startup")
+
+var startupLock = sync.Mutex{}
+var startupStage = StageStarting
+
+// setStartupStage records the startup stage, reporting it to systemd
+func setStartupStage(stage string) {
+	startupLock.Lock()
+	startupStage = stage
+	startupLock.Unlock()
+
+	startupLog.Info("Stage: %s", stage)
+	sdNotify("STATUS=" + stage)
+}
+
+func getStartupStage() string {
+	startupLock.Lock()
+	defer startupLock.Unlock()
+
+	return startupStage
+}
+
+// errPermanent marks the startup errors that are not retried, like an invalid token
+var errPermanent = errors.New("permanent error")
+
+// startupRetry calls connect until it succeeds, waiting startup_retry_delay (default 1s) after the first failure,
+// doubled on each failure up to startup_retry_max_delay (default 30s). It gives up after startup_timeout
+// (default 5m, 0 to retry forever) or on errors wrapping errPermanent.
+func startupRetry(stage string, connect func() error) error {
+	setStartupStage(stage)
+
+	delay := getEnvDuration("startup_retry_delay", time.Second)
+	maxDelay := getEnvDuration("startup_retry_max_delay", 30*time.Second)
+	timeout := getEnvDuration("startup_timeout", 5*time.Minute)
+	start := time.Now()
+
+	for attempt := 1; ; attempt++ {
+		err := connect()
+		if err == nil {
+			return nil
+		}
+
+		if errors.Is(err, errPermanent) || (timeout > 0 && time.Since(start)+delay > timeout) {
+			return fmt.Errorf("%s failed after %d attempts: %w", stage, attempt, err)
+		}
+
+		startupLog.Warn("Error %s, retrying in %s (attempt %d): %s", stage, delay, attempt, err)
+		time.Sleep(delay)
+
+		if delay *= 2; delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
+
+// connectTelegram authorizes the bot token, retrying while Telegram is unreachable
+func connectTelegram() error {
+	return startupRetry(StageTelegram, func() error {
+		token := getTelegramBotToken()
+		b, self, err := newTelegramBot(token)
+		if errors.Is(err, bot.ErrorUnauthorized) {
+			return fmt.Errorf("%w: %w", errPermanent, err)
+		}
+		if err != nil {
+			return err
+		}
+
+		setTelegramBot(token, b, self)
+		return nil
+	})
+}
+
+// connectMQTT connects to the broker, retrying with a new client while it is unreachable
+func connectMQTT() error {
+	return startupRetry(StageMQTT, func() error {
+		client, err := newMQTTClient(getMQTTPassword())
+		if err != nil {
+			return fmt.Errorf("%w: %w", errPermanent, err)
+		}
+
+		if err := client.Connect(); err != nil {
+			client.Disconnect() // Stops the reconnections of the failed client
+			return err
+		}
+
+		setMQTTClient(client)
+		return nil
+	})
+}
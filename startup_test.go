@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestStartupRetry(t *testing.T) {
+	t.Setenv("startup_retry_delay", "1ms")
+	t.Setenv("startup_retry_max_delay", "2ms")
+
+	attempts := 0
+	err := startupRetry(StageMQTT, func() error {
+		if attempts++; attempts < 4 {
+			return fmt.Errorf("dial tcp: lookup broker: no such host")
+		}
+		return nil
+	})
+
+	if err != nil || attempts != 4 {
+		t.Errorf("expected success after 4 attempts, got %d: %v", attempts, err)
+	}
+
+	attempts = 0
+	err = startupRetry(StageTelegram, func() error {
+		attempts++
+		return fmt.Errorf("%w: invalid token", errPermanent)
+	})
+
+	if !errors.Is(err, errPermanent) || attempts != 1 {
+		t.Errorf("expected the permanent error without retries, got %d: %v", attempts, err)
+	}
+
+	t.Setenv("startup_timeout", "5ms")
+	err = startupRetry(StageMQTT, func() error { return fmt.Errorf("connection refused") })
+	if err == nil {
+		t.Errorf("expected the error after the startup timeout")
+	}
+
+	if stage := getStartupStage(); stage != StageMQTT {
+		t.Errorf("expected stage %q, got %q", StageMQTT, stage)
+	}
+	if err := checkHealth(); err == nil {
+		t.Errorf("expected unhealthy while not ready")
+	}
+}
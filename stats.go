@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statsTopic is the base of the retained statistics topics. Defaults to $bridge/stats, none disables them
+var statsTopic = os.Getenv("stats_topic")
+
+// statsTopicReplacer replaces the wildcards of the mapping topics, which cannot be published to
+var statsTopicReplacer = strings.NewReplacer("+", "_", "#", "_")
+
+// mappingError is the last processing or delivery error of a mapping
+type mappingError struct {
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+}
+
+// setLastError records the last error of the mapping
+func (m *Mapping) setLastError(err string) {
+	m.lock.Lock()
+	m.lastError = mappingError{Error: err, Time: time.Now()}
+	m.lock.Unlock()
+}
+
+func (m *Mapping) getLastError() mappingError {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.lastError
+}
+
+// bridgeStats returns the statistics of the bridge by topic, relative to the stats_topic
+func bridgeStats() map[string]string {
+	stats := map[string]string{
+		"uptime":         strconv.Itoa(int(time.Since(startTime).Seconds())),
+		"mqtt_connected": strconv.FormatBool(getMQTTClient().IsConnected()),
+		"leader":         strconv.FormatBool(isLeader()),
+	}
+
+	pendingLock.Lock()
+	stats["pending"] = strconv.Itoa(len(pendingMessages))
+	pendingLock.Unlock()
+
+	for topic, mapping := range listTopicMappings() {
+		base := "mappings/" + statsTopicReplacer.Replace(topic) + "/"
+
+		if lastError := mapping.getLastError(); lastError.Error != "" {
+			payload, _ := json.Marshal(lastError)
+			stats[base+"last_error"] = string(payload)
+		}
+	}
+
+	mqttMessages.Each(func(values []string, count uint64) {
+		stats["mappings/"+statsTopicReplacer.Replace(values[0])+"/mqtt/"+values[1]] = strconv.FormatUint(count, 10)
+	})
+
+	telegramReceived.Each(func(values []string, count uint64) {
+		stats["mappings/"+statsTopicReplacer.Replace(values[0])+"/telegram"] = strconv.FormatUint(count, 10)
+	})
+
+	telegramSent.Each(func(values []string, count uint64) {
+		stats["telegram/sent/"+values[0]] = strconv.FormatUint(count, 10)
+	})
+
+	return stats
+}
+
+// publishStats publishes the bridge statistics as retained messages, only the ones that changed since the last call
+func publishStats(published map[string]string) {
+	for topic, value := range bridgeStats() {
+		if published[topic] == value {
+			continue
+		}
+
+		statsMessageTopic := mqttTopic(statsTopic + "/" + topic)
+		err := getMQTTClient().Publish(MQTTMessage{
+			Topic:    statsMessageTopic,
+			Payload:  []byte(value),
+			Retained: true,
+		})
+		if err != nil {
+			mqttLog.Error("Error publishing stats to %s: %s", statsMessageTopic, err)
+			continue
+		}
+		published[topic] = value
+	}
+}
+
+// startStats publishes the bridge statistics every stats_interval
+func startStats() {
+	if statsTopic == "" {
+		statsTopic = "$bridge/stats"
+	}
+
+	if statsTopic == "none" {
+		return
+	}
+
+	interval := getEnvDuration("stats_interval", time.Minute)
+	mqttLog.Info("Publishing stats to %s every %s", mqttTopic(statsTopic), interval)
+
+	go func() {
+		published := map[string]string{}
+		for range time.Tick(interval) {
+			publishStats(published)
+		}
+	}()
+}
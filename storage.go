@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-telegram/bot/models"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"os"
+	"path"
+	"time"
+)
+
+var (
+	s3Endpoint  = os.Getenv("s3_endpoint")
+	s3Bucket    = os.Getenv("s3_bucket")
+	s3Region    = os.Getenv("s3_region")
+	s3AccessKey = os.Getenv("s3_access_key")
+	s3SecretKey = os.Getenv("s3_secret_key")
+)
+
+var storageLog = newLogger("Storage")
+
+// storageClient uploads the media received from Telegram. Nil when s3_endpoint is not defined.
+var storageClient *minio.Client
+
+var storageURLExpiry time.Duration
+
+// setupStorage connects to the S3 compatible storage defined by s3_endpoint
+func setupStorage() {
+	if s3Endpoint == "" {
+		return
+	}
+
+	if s3Bucket == "" {
+		storageLog.Fatal("s3_bucket is required when s3_endpoint is defined")
+	}
+
+	// Presigned URLs are valid for at most 7 days
+	storageURLExpiry = getEnvDuration("s3_url_expiry", 24*time.Hour)
+	if storageURLExpiry > 7*24*time.Hour {
+		storageURLExpiry = 7 * 24 * time.Hour
+	}
+
+	client, err := minio.New(s3Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(s3AccessKey, s3SecretKey, ""),
+		Secure: os.Getenv("s3_insecure") != "true",
+		Region: s3Region,
+	})
+	if err != nil {
+		storageLog.Fatal("Error creating S3 client for %s: %s", s3Endpoint, err)
+	}
+
+	storageClient = client
+	storageLog.Info("Uploading media to bucket %s at %s", s3Bucket, s3Endpoint)
+}
+
+// uploadMedia uploads the media of a message to the bucket, returning its presigned URL
+func uploadMedia(mapping *Mapping, msg *models.Message, media map[string]interface{}) (string, error) {
+	fileID, _ := media["file_id"].(string)
+
+	body, file, err := downloadTelegramFile(fileID)
+	if err != nil {
+		return "", fmt.Errorf("error downloading file: %s", err)
+	}
+	defer body.Close()
+
+	key := fmt.Sprintf("%s/%d/%d%s", mapping.Topic, msg.Chat.ID, msg.ID, path.Ext(file.FilePath))
+	contentType, _ := media["mime_type"].(string)
+
+	size := int64(file.FileSize)
+	if size == 0 {
+		size = -1
+	}
+
+	ctx := context.Background()
+	_, err = storageClient.PutObject(ctx, s3Bucket, key, body, size, minio.PutObjectOptions{ContentType: contentType})
+	if err != nil {
+		return "", err
+	}
+
+	url, err := storageClient.PresignedGetObject(ctx, s3Bucket, key, storageURLExpiry, nil)
+	if err != nil {
+		return "", err
+	}
+
+	storageLog.Debug("Uploaded %s to %s", fileID, key)
+	return url.String(), nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"github.com/gorilla/websocket"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// streamBuffer is how many messages can wait for a slow stream client before they are dropped
+const streamBuffer = 100
+
+var streamUpgrader = websocket.Upgrader{}
+
+var streamLock = sync.Mutex{}
+var streamClients = map[chan recentMessage]bool{}
+
+// broadcastStream sends a processed message to the stream clients, dropping it for the clients that are behind
+func broadcastStream(m recentMessage) {
+	streamLock.Lock()
+	defer streamLock.Unlock()
+
+	for c := range streamClients {
+		select {
+		case c <- m:
+		default:
+		}
+	}
+}
+
+// subscribeStream returns a channel receiving the processed messages, until unsubscribeStream
+func subscribeStream() chan recentMessage {
+	c := make(chan recentMessage, streamBuffer)
+
+	streamLock.Lock()
+	streamClients[c] = true
+	streamLock.Unlock()
+
+	return c
+}
+
+func unsubscribeStream(c chan recentMessage) {
+	streamLock.Lock()
+	delete(streamClients, c)
+	streamLock.Unlock()
+}
+
+// streamAccepts checks if a message matches the topic filter (wildcards allowed) and direction of a stream, empty for any
+func streamAccepts(m recentMessage, filter, direction string) bool {
+	return (filter == "" || topicMatches(filter, m.Topic)) && (direction == "" || direction == m.Direction)
+}
+
+// streamHandler upgrades to a WebSocket and sends the bridged messages as JSON while the client is connected.
+// The topic (wildcards allowed) and direction (to_telegram or to_mqtt) query parameters filter the messages.
+func streamHandler(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("topic")
+	direction := r.URL.Query().Get("direction")
+
+	conn, err := streamUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		httpLog.Error("Error upgrading stream connection: %s", err)
+		return
+	}
+	defer conn.Close()
+
+	c := subscribeStream()
+	defer unsubscribeStream(c)
+
+	httpLog.Info("Stream client %s connected", r.RemoteAddr)
+
+	closed := make(chan bool)
+	go func() { // Reads until the client closes the connection
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				close(closed)
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case m := <-c:
+			if !streamAccepts(m, filter, direction) {
+				continue
+			}
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteJSON(m); err != nil {
+				httpLog.Warn("Stream client %s disconnected: %s", r.RemoteAddr, err)
+				return
+			}
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				httpLog.Warn("Stream client %s disconnected: %s", r.RemoteAddr, err)
+				return
+			}
+		case <-closed:
+			httpLog.Info("Stream client %s disconnected", r.RemoteAddr)
+			return
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// summaryFrom is the sender of the summary reports, which are not counted on the next summary
+const summaryFrom = "Summary"
+
+// maxSummaryAlerts is the maximum of alerts listed in a summary
+const maxSummaryAlerts = 10
+
+// SummaryConfig posts a periodic digest of the mapping activity
+type SummaryConfig struct {
+	Cron   string   `json:"cron"`   // When the summary is sent, like "0 8 * * *" daily or "0 8 * * 1" weekly
+	Fields []string `json:"fields"` // Numeric payload fields with min / max. Defaults to all numeric fields
+	Top    int      `json:"top"`    // Number of top talkers. Defaults to 3
+
+	schedule *cronSchedule
+	stats    summaryStats
+}
+
+// summaryStats is the activity of a mapping since the last summary
+type summaryStats struct {
+	lock     sync.Mutex
+	since    time.Time
+	mqtt     int
+	telegram int
+	talkers  map[string]int
+	alerts   []string
+	values   map[string]*summaryValue
+}
+
+// summaryIgnoredFields are the message fields left out of the default summary values
+var summaryIgnoredFields = map[string]bool{"time": true, "at": true, "delay": true, "expires_at": true}
+
+type summaryValue struct {
+	min, max float64
+}
+
+func (c *SummaryConfig) setup(topic string) error {
+	var err error
+	if c.schedule, err = parseCron(ScheduleConfig{Topic: topic, Cron: c.Cron}); err != nil {
+		return fmt.Errorf("invalid summary cron: %s", err)
+	}
+
+	if c.Top == 0 {
+		c.Top = 3
+	}
+
+	c.stats.reset(time.Now())
+
+	return nil
+}
+
+func (s *summaryStats) reset(now time.Time) {
+	s.since = now
+	s.mqtt = 0
+	s.telegram = 0
+	s.talkers = map[string]int{}
+	s.alerts = nil
+	s.values = map[string]*summaryValue{}
+}
+
+// recordSummaryNotification counts a notification delivered by the mapping on its summary
+func (m *Mapping) recordSummaryNotification(n Notification) {
+	if m.Summary == nil || n.From == summaryFrom {
+		return
+	}
+
+	s := &m.Summary.stats
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.mqtt++
+	s.talkers[n.From]++
+	if (n.Critical || n.From == thresholdFrom) && len(s.alerts) < maxSummaryAlerts {
+		t := n.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+		s.alerts = append(s.alerts, m.TelegramOptions.escape(t.In(m.location).Format("01-02 15:04"))+" "+n.Message)
+	}
+}
+
+// recordSummaryTelegram counts a Telegram message published to MQTT by the mapping on its summary
+func (m *Mapping) recordSummaryTelegram(from string) {
+	if m.Summary == nil {
+		return
+	}
+
+	s := &m.Summary.stats
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.telegram++
+	s.talkers[from]++
+}
+
+// recordSummaryValues keeps the min / max of the numeric payload fields on the mapping summary
+func (m *Mapping) recordSummaryValues(data map[string]interface{}) {
+	if m.Summary == nil {
+		return
+	}
+
+	fields := m.Summary.Fields
+	if len(fields) == 0 {
+		for field := range data {
+			if !summaryIgnoredFields[field] {
+				fields = append(fields, field)
+			}
+		}
+	}
+
+	s := &m.Summary.stats
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, field := range fields {
+		if _, isString := data[field].(string); isString && len(m.Summary.Fields) == 0 {
+			continue // Only explicit fields are parsed from strings
+		}
+
+		value, ok := numericValue(data[field])
+		if !ok {
+			continue
+		}
+
+		v := s.values[field]
+		if v == nil {
+			s.values[field] = &summaryValue{min: value, max: value}
+			continue
+		}
+		if value < v.min {
+			v.min = value
+		}
+		if value > v.max {
+			v.max = value
+		}
+	}
+}
+
+// summaryText renders the summary report and resets the stats
+func (m *Mapping) summaryText(now time.Time) string {
+	s := &m.Summary.stats
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var b strings.Builder
+
+	b.WriteString(m.trMessage("summary", m.Topic, s.since.In(m.location).Format("2006-01-02 15:04")))
+	b.WriteString("\n")
+	b.WriteString(m.trMessage("summary_messages", s.mqtt, s.telegram))
+
+	var talkers []string
+	for from := range s.talkers {
+		talkers = append(talkers, from)
+	}
+	sort.Slice(talkers, func(i, j int) bool {
+		if s.talkers[talkers[i]] != s.talkers[talkers[j]] {
+			return s.talkers[talkers[i]] > s.talkers[talkers[j]]
+		}
+		return talkers[i] < talkers[j]
+	})
+	if len(talkers) > m.Summary.Top {
+		talkers = talkers[:m.Summary.Top]
+	}
+	if len(talkers) > 0 {
+		b.WriteString("\n\n" + m.trMessage("summary_talkers"))
+		for _, from := range talkers {
+			fmt.Fprintf(&b, "\n  %s: %d", m.TelegramOptions.escape(from), s.talkers[from])
+		}
+	}
+
+	if len(s.alerts) > 0 {
+		b.WriteString("\n\n" + m.trMessage("summary_alerts"))
+		for _, alert := range s.alerts {
+			b.WriteString("\n  " + alert)
+		}
+	}
+
+	if len(s.values) > 0 {
+		b.WriteString("\n\n" + m.trMessage("summary_values"))
+		var fields []string
+		for field := range s.values {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			b.WriteString("\n  " + m.TelegramOptions.escape(fmt.Sprintf("%s: %g - %g", field, s.values[field].min, s.values[field].max)))
+		}
+	}
+
+	s.reset(now)
+
+	return b.String()
+}
+
+// runSummaries sends the summaries whose cron matches the time
+func runSummaries(now time.Time) {
+	minute := now.Truncate(time.Minute)
+	for _, mapping := range listTopicMappings() {
+		if mapping.Summary == nil {
+			continue
+		}
+
+		c := mapping.Summary.schedule
+		if c.lastRun.Equal(minute) || !c.matches(now) {
+			continue
+		}
+		c.lastRun = minute
+
+		schedLog.Info("Sending summary of topic %s", mapping.Topic)
+		deliverMessage(mapping, Notification{
+			Topic:   mapping.Topic,
+			From:    summaryFrom,
+			Message: mapping.summaryText(now),
+			Time:    now,
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// telegramPollTimeout is the long polling timeout of the Telegram updates
+const telegramPollTimeout = 5 * time.Second
+
+// telegramRequestTimeout is the maximum duration of a Telegram API call
+const telegramRequestTimeout = 30 * time.Second
+
+var telegramSelf *models.User // The bot account, as returned by getMe
+
+// telegramAllowedUpdates are the updates received by the bot. Reactions are only sent to bots that are chat administrators.
+var telegramAllowedUpdates = bot.AllowedUpdates{"message", "channel_post", "callback_query", "inline_query", "message_reaction", "business_message"}
+
+// telegramHTTPClient is the HTTP client of the bot. It records a heartbeat on every successful long poll.
+type telegramHTTPClient struct {
+	client *http.Client
+}
+
+func (c telegramHTTPClient) Do(r *http.Request) (*http.Response, error) {
+	res, err := c.client.Do(r)
+	if err == nil && res.StatusCode == http.StatusOK && strings.HasSuffix(r.URL.Path, "/getUpdates") {
+		heartbeat(&lastTelegramPoll)
+	}
+
+	return res, err
+}
+
+// newTelegramBot authorizes the token, returning the bot and its account. Updates received by the bot are handled by handleTelegramUpdate.
+func newTelegramBot(token string, options ...bot.Option) (*bot.Bot, *models.User, error) {
+	client := telegramHTTPClient{client: &http.Client{Timeout: telegramPollTimeout + telegramRequestTimeout}}
+
+	options = append([]bot.Option{
+		bot.WithHTTPClient(telegramPollTimeout, client),
+		bot.WithSkipGetMe(),
+		bot.WithNotAsyncHandlers(),
+		bot.WithAllowedUpdates(telegramAllowedUpdates),
+		bot.WithDefaultHandler(handleTelegramUpdate),
+		bot.WithDebug(),
+		bot.WithDebugHandler(logTelegramDebug),
+		bot.WithErrorsHandler(func(err error) { telLog.Error("%s", err) }),
+	}, options...)
+
+	b, err := bot.New(token, options...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := telegramContext(context.Background())
+	defer cancel()
+
+	self, err := b.GetMe(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error authorizing telegram bot: %w", err)
+	}
+
+	return b, self, nil
+}
+
+// logTelegramDebug logs the requests and responses of the bot. In privacy mode, their payloads are hidden.
+func logTelegramDebug(format string, args ...any) {
+	if isPrivacyMode() {
+		for i := 1; i < len(args); i++ {
+			args[i] = logText(fmt.Sprint(args[i]))
+		}
+	}
+
+	telLog.Debug(format, args...)
+}
+
+// telegramContext returns the context of a Telegram API call, derived from parent (like the trace context of a notification)
+func telegramContext(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, telegramRequestTimeout)
+}
+
+// telegramPoller is the bot currently receiving updates
+var telegramPoller struct {
+	bot    *bot.Bot
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// pollTelegram starts receiving Telegram updates when leader and stops when not. The poller restarts when the bot changes, like after a token rotation.
+func pollTelegram(leader bool) {
+	current := getTelegramBot()
+
+	if telegramPoller.bot != nil && (!leader || telegramPoller.bot != current) {
+		telegramPoller.cancel()
+		<-telegramPoller.done // Two concurrent long polls of the same bot conflict
+		telegramPoller.bot = nil
+		telLog.Info("Stopped receiving updates")
+	}
+
+	if !leader || telegramPoller.bot != nil || current == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b, done := current, make(chan struct{})
+
+	telegramPoller.bot, telegramPoller.cancel, telegramPoller.done = b, cancel, done
+	heartbeat(&lastTelegramPoll)
+	telLog.Info("Receiving updates")
+
+	go func() {
+		defer close(done)
+		b.Start(ctx)
+	}()
+}
+
+// handleTelegramUpdate processes an update received from Telegram
+func handleTelegramUpdate(_ context.Context, _ *bot.Bot, update *models.Update) {
+	if update.CallbackQuery != nil {
+		handleCallbackQuery(update.CallbackQuery)
+	}
+
+	if update.InlineQuery != nil {
+		handleInlineQuery(update.InlineQuery)
+	}
+
+	if update.MessageReaction != nil {
+		forwardReaction(update.MessageReaction)
+	}
+
+	if update.BusinessMessage != nil { // Received on behalf of a business account, only forwarded
+		forwardToMQTT(update.BusinessMessage)
+	}
+
+	if update.ChannelPost != nil {
+		msg := update.ChannelPost
+
+		from := msg.Chat.Title
+		telLog.Info("%s: %s", from, logText(msg.Text))
+
+		if handleCommand(msg) {
+			return
+		}
+		replyChatID(msg)
+		forwardToMQTT(msg)
+	}
+
+	if update.Message != nil { // ignore any non-Message Updates
+		msg := update.Message
+
+		from := telegramSender(msg)
+
+		if msg.From != nil && msg.Chat.ID != msg.From.ID {
+			telLog.Info("[%s(%d)] %s: %s", msg.Chat.Title, msg.Chat.ID, from, logText(msg.Text))
+		} else {
+			telLog.Info("%s: %s", from, logText(msg.Text))
+		}
+
+		for _, member := range msg.NewChatMembers {
+			if member.ID != getTelegramSelf().ID {
+				continue
+			}
+			if enableChat(msg.Chat.ID) {
+				notifyAdmin(fmt.Sprintf("Bot added back to chat %d (%s), sends enabled", msg.Chat.ID, msg.Chat.Title))
+			}
+			requestProvisioning(msg)
+		}
+
+		if msg.GroupChatCreated { // The bot was added when the group was created
+			requestProvisioning(msg)
+		}
+
+		if handleCommand(msg) || handleKeyboardPress(msg) {
+			return
+		}
+		replyChatID(msg)
+		forwardToMQTT(msg)
+	}
+}
+
+// telegramSender returns the username of the message sender, or the chat title for channel posts
+func telegramSender(msg *models.Message) string {
+	if msg.From == nil {
+		return msg.Chat.Title
+	}
+
+	if msg.From.Username == "" {
+		return "Unknown"
+	}
+
+	return msg.From.Username
+}
+
+// sendTelegram sends a message built by the caller, like replies and messages with keyboards
+func sendTelegram(params *bot.SendMessageParams) (*models.Message, error) {
+	ctx, cancel := telegramContext(context.Background())
+	defer cancel()
+
+	return getTelegramBot().SendMessage(ctx, params)
+}
+
+// replyTo returns the reply parameters of a reply to msg
+func replyTo(msg *models.Message) *models.ReplyParameters {
+	return &models.ReplyParameters{MessageID: msg.ID, AllowSendingWithoutReply: true}
+}
+
+// isCommand returns if the message starts with a bot command, like /status
+func isCommand(msg *models.Message) bool {
+	return len(msg.Entities) > 0 && msg.Entities[0].Type == models.MessageEntityTypeBotCommand && msg.Entities[0].Offset == 0
+}
+
+// commandName returns the command of the message without the slash and the bot username, like status for /status@bot
+func commandName(msg *models.Message) string {
+	if !isCommand(msg) {
+		return ""
+	}
+
+	command := msg.Text[1:msg.Entities[0].Length]
+	if i := strings.Index(command, "@"); i != -1 {
+		command = command[:i]
+	}
+
+	return command
+}
+
+// commandArguments returns the text after the command of the message
+func commandArguments(msg *models.Message) string {
+	if !isCommand(msg) {
+		return ""
+	}
+
+	if len(msg.Text) <= msg.Entities[0].Length {
+		return ""
+	}
+
+	return strings.TrimSpace(msg.Text[msg.Entities[0].Length:])
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/go-telegram/bot"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// Telegram send error classes
+const (
+	TelegramErrRateLimited  = "rate_limited"
+	TelegramErrKicked       = "kicked"
+	TelegramErrForbidden    = "forbidden" // The bot is still in the chat, but can't send to it, like without the rights
+	TelegramErrChatNotFound = "chat_not_found"
+	TelegramErrTooLong      = "message_too_long"
+	TelegramErrCircuitOpen  = "circuit_open"
+	TelegramErrNetwork      = "network"
+	TelegramErrOther        = "other"
+)
+
+var telegramSent = NewCounterVec("mqtttelegram_telegram_sent_total", "Messages sent to Telegram", "chat")
+var telegramErrors = NewCounterVec("mqtttelegram_telegram_errors_total", "Telegram send errors by class", "chat", "class")
+
+// telegramServerErrorRegexp matches the errors of the 5xx responses, which the bot library does not wrap
+var telegramServerErrorRegexp = regexp.MustCompile(`^error response from telegram for method \S+, 5\d\d `)
+
+// isTelegramOutage returns if a send error means Telegram is unavailable: network errors, timeouts, 5xx and rate
+// limits. The other errors, like a bad message or a chat without rights, must not open the breaker for all the chats.
+func isTelegramOutage(err error) bool {
+	var netErr net.Error
+
+	return errors.As(err, &netErr) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		bot.IsTooManyRequestsError(err) ||
+		telegramServerErrorRegexp.MatchString(err.Error())
+}
+
+// classifyTelegramError returns the class of an error returned by the Telegram API
+func classifyTelegramError(err error) string {
+	if err == errCircuitOpen {
+		return TelegramErrCircuitOpen
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return TelegramErrNetwork
+	}
+
+	description := strings.ToLower(err.Error())
+
+	switch {
+	case bot.IsTooManyRequestsError(err):
+		return TelegramErrRateLimited
+	case strings.Contains(description, "bot was kicked"),
+		strings.Contains(description, "bot is not a member"):
+		return TelegramErrKicked
+	case errors.Is(err, bot.ErrorForbidden),
+		strings.Contains(description, "have no rights to send"):
+		return TelegramErrForbidden
+	case strings.Contains(description, "chat not found"):
+		return TelegramErrChatNotFound
+	case strings.Contains(description, "message is too long"):
+		return TelegramErrTooLong
+	}
+
+	return TelegramErrOther
+}
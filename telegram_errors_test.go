@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestClassifyTelegramError(t *testing.T) {
+	tests := []struct {
+		err   error
+		class string
+	}{
+		{errCircuitOpen, TelegramErrCircuitOpen},
+		{&bot.TooManyRequestsError{Message: "too many requests", RetryAfter: 5}, TelegramErrRateLimited},
+		{fmt.Errorf("%w, %s", bot.ErrorForbidden, "Forbidden: bot was kicked from the group chat"), TelegramErrKicked},
+		{fmt.Errorf("%w, %s", bot.ErrorForbidden, "Forbidden: bot is not a member of the channel chat"), TelegramErrKicked},
+		{fmt.Errorf("%w, %s", bot.ErrorForbidden, "Forbidden: bot was blocked by the user"), TelegramErrForbidden},
+		{fmt.Errorf("%w, %s", bot.ErrorBadRequest, "Bad Request: have no rights to send a message"), TelegramErrForbidden},
+		{fmt.Errorf("%w, %s", bot.ErrorBadRequest, "Bad Request: chat not found"), TelegramErrChatNotFound},
+		{fmt.Errorf("%w, %s", bot.ErrorBadRequest, "Bad Request: message is too long"), TelegramErrTooLong},
+		{fmt.Errorf("error do request for method sendMessage, %w", &url.Error{Op: "Post", Err: &net.OpError{Op: "dial"}}), TelegramErrNetwork},
+		{fmt.Errorf("%w, %s", bot.ErrorBadRequest, "Bad Request: can't parse entities"), TelegramErrOther},
+	}
+
+	for _, test := range tests {
+		if class := classifyTelegramError(test.err); class != test.class {
+			t.Errorf("%s: expected %s, got %s", test.err, test.class, class)
+		}
+	}
+}
+
+func TestIsTelegramOutage(t *testing.T) {
+	tests := []struct {
+		err    error
+		outage bool
+	}{
+		{&bot.TooManyRequestsError{Message: "too many requests", RetryAfter: 5}, true},
+		{fmt.Errorf("error do request for method sendMessage, %w", &url.Error{Op: "Post", Err: &net.OpError{Op: "dial"}}), true},
+		{fmt.Errorf("error do request for method sendMessage, %w", context.DeadlineExceeded), true},
+		{fmt.Errorf("error response from telegram for method sendMessage, 502 Bad Gateway"), true},
+		{fmt.Errorf("%w, %s", bot.ErrorBadRequest, "Bad Request: can't parse entities"), false},
+		{fmt.Errorf("%w, %s", bot.ErrorForbidden, "Forbidden: bot was blocked by the user"), false},
+		{fmt.Errorf("error response from telegram for method sendMessage, 420 Flood"), false},
+	}
+
+	for _, test := range tests {
+		if outage := isTelegramOutage(test.err); outage != test.outage {
+			t.Errorf("%s: expected outage %t, got %t", test.err, test.outage, outage)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var telegramFileClient = &http.Client{Timeout: 5 * time.Minute}
+
+// downloadTelegramFile opens the download of a file sent to the bot. The caller must close it.
+func downloadTelegramFile(fileID string) (io.ReadCloser, *models.File, error) {
+	ctx, cancel := telegramContext(context.Background())
+	defer cancel()
+
+	file, err := getTelegramBot().GetFile(ctx, &bot.GetFileParams{FileID: fileID})
+	if err != nil {
+		return nil, file, err
+	}
+
+	res, err := telegramFileClient.Get(getTelegramBot().FileDownloadLink(file))
+	if err != nil {
+		return nil, file, err
+	}
+
+	if res.StatusCode/100 != 2 {
+		res.Body.Close()
+		return nil, file, fmt.Errorf("received status %d", res.StatusCode)
+	}
+
+	return res.Body, file, nil
+}
+
+// messageText returns the text of a message, its caption for media messages or a description of the
+// stickers, contacts, locations and venues
+func messageText(msg *models.Message) string {
+	switch {
+	case msg.Text != "":
+		return msg.Text
+	case msg.Sticker != nil:
+		return msg.Sticker.Emoji
+	case msg.Contact != nil:
+		return strings.TrimSpace(fmt.Sprintf("%s %s %s", msg.Contact.FirstName, msg.Contact.LastName, msg.Contact.PhoneNumber))
+	case msg.Venue != nil:
+		return fmt.Sprintf("%s, %s", msg.Venue.Title, msg.Venue.Address)
+	case msg.Location != nil:
+		return fmt.Sprintf("%f,%f", msg.Location.Latitude, msg.Location.Longitude)
+	}
+
+	return msg.Caption
+}
+
+// messageEvent returns the type of a message: text, the media type, contact, location, venue or the chat event
+func messageEvent(msg *models.Message) string {
+	if media := mediaData(msg); media != nil {
+		return media["type"].(string)
+	}
+
+	switch {
+	case msg.Text != "":
+		return "text"
+	case msg.Contact != nil:
+		return "contact"
+	case msg.Venue != nil: // Venues also come with a location
+		return "venue"
+	case msg.Location != nil:
+		return "location"
+	case msg.Game != nil:
+		return "game"
+	case msg.Dice != nil:
+		return "dice"
+	case msg.NewChatMembers != nil:
+		return "new_chat_members"
+	case msg.LeftChatMember != nil:
+		return "left_chat_member"
+	case msg.NewChatTitle != "":
+		return "new_chat_title"
+	case msg.NewChatPhoto != nil || msg.DeleteChatPhoto:
+		return "chat_photo"
+	case msg.PinnedMessage != nil:
+		return "pinned_message"
+	case msg.MigrateToChatID != 0 || msg.MigrateFromChatID != 0:
+		return "migrate"
+	}
+
+	return "other"
+}
+
+// contactData returns the shared contact, location, venue or dice roll of the message as the field and its value,
+// or an empty field if there is none
+func contactData(msg *models.Message) (string, map[string]interface{}) {
+	switch {
+	case msg.Contact != nil:
+		return "contact", map[string]interface{}{
+			"first_name":   msg.Contact.FirstName,
+			"last_name":    msg.Contact.LastName,
+			"phone_number": msg.Contact.PhoneNumber,
+			"user_id":      msg.Contact.UserID,
+		}
+	case msg.Venue != nil:
+		return "venue", map[string]interface{}{
+			"title":         msg.Venue.Title,
+			"address":       msg.Venue.Address,
+			"latitude":      msg.Venue.Location.Latitude,
+			"longitude":     msg.Venue.Location.Longitude,
+			"foursquare_id": msg.Venue.FoursquareID,
+		}
+	case msg.Location != nil:
+		return "location", map[string]interface{}{
+			"latitude":  msg.Location.Latitude,
+			"longitude": msg.Location.Longitude,
+		}
+	case msg.Dice != nil:
+		return "dice", map[string]interface{}{
+			"emoji": msg.Dice.Emoji,
+			"value": msg.Dice.Value,
+		}
+	}
+
+	return "", nil
+}
+
+// mediaData returns the type, file_id and dimensions of the media attached to the message, or nil if there is none
+func mediaData(msg *models.Message) map[string]interface{} {
+	switch {
+	case len(msg.Photo) > 0:
+		largest := msg.Photo[0]
+		for _, p := range msg.Photo {
+			if p.Width*p.Height > largest.Width*largest.Height {
+				largest = p
+			}
+		}
+		return map[string]interface{}{
+			"type":      "photo",
+			"file_id":   largest.FileID,
+			"width":     largest.Width,
+			"height":    largest.Height,
+			"file_size": largest.FileSize,
+		}
+	case msg.Sticker != nil:
+		return map[string]interface{}{
+			"type":      "sticker",
+			"file_id":   msg.Sticker.FileID,
+			"emoji":     msg.Sticker.Emoji,
+			"set_name":  msg.Sticker.SetName,
+			"width":     msg.Sticker.Width,
+			"height":    msg.Sticker.Height,
+			"file_size": msg.Sticker.FileSize,
+		}
+	case msg.Animation != nil: // Animations also come as documents
+		return map[string]interface{}{
+			"type":      "animation",
+			"file_id":   msg.Animation.FileID,
+			"width":     msg.Animation.Width,
+			"height":    msg.Animation.Height,
+			"duration":  msg.Animation.Duration,
+			"file_name": msg.Animation.FileName,
+			"mime_type": msg.Animation.MimeType,
+			"file_size": msg.Animation.FileSize,
+		}
+	case msg.Video != nil:
+		return map[string]interface{}{
+			"type":      "video",
+			"file_id":   msg.Video.FileID,
+			"width":     msg.Video.Width,
+			"height":    msg.Video.Height,
+			"duration":  msg.Video.Duration,
+			"mime_type": msg.Video.MimeType,
+			"file_size": msg.Video.FileSize,
+		}
+	case msg.VideoNote != nil:
+		return map[string]interface{}{
+			"type":      "video_note",
+			"file_id":   msg.VideoNote.FileID,
+			"width":     msg.VideoNote.Length,
+			"height":    msg.VideoNote.Length,
+			"duration":  msg.VideoNote.Duration,
+			"file_size": msg.VideoNote.FileSize,
+		}
+	case msg.Voice != nil:
+		return map[string]interface{}{
+			"type":      "voice",
+			"file_id":   msg.Voice.FileID,
+			"duration":  msg.Voice.Duration,
+			"mime_type": msg.Voice.MimeType,
+			"file_size": msg.Voice.FileSize,
+		}
+	case msg.Audio != nil:
+		return map[string]interface{}{
+			"type":      "audio",
+			"file_id":   msg.Audio.FileID,
+			"duration":  msg.Audio.Duration,
+			"title":     msg.Audio.Title,
+			"performer": msg.Audio.Performer,
+			"mime_type": msg.Audio.MimeType,
+			"file_size": msg.Audio.FileSize,
+		}
+	case msg.Document != nil:
+		return map[string]interface{}{
+			"type":      "document",
+			"file_id":   msg.Document.FileID,
+			"file_name": msg.Document.FileName,
+			"mime_type": msg.Document.MimeType,
+			"file_size": msg.Document.FileSize,
+		}
+	}
+
+	return nil
+}
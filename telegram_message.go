@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-telegram/bot/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// telegramMessageData builds the MQTT payload of a message received in a mapped chat
+func telegramMessageData(mapping *Mapping, msg *models.Message) map[string]interface{} {
+	data := map[string]interface{}{
+		"sendmsg": true,
+		"to":      mapping.MessageTo,
+		"event":   messageEvent(msg),
+	}
+
+	text := messageText(msg)
+	origin := msg.ForwardOrigin
+
+	switch {
+	case origin != nil && origin.MessageOriginUser != nil:
+		data["message"] = fmt.Sprintf("%s %s: %s", origin.MessageOriginUser.SenderUser.FirstName, origin.MessageOriginUser.SenderUser.LastName, text)
+	case origin != nil && origin.MessageOriginHiddenUser != nil:
+		data["message"] = fmt.Sprintf("%s: %s", origin.MessageOriginHiddenUser.SenderUserName, text)
+	case origin != nil && origin.MessageOriginChat != nil:
+		data["message"] = fmt.Sprintf("%s: %s", origin.MessageOriginChat.SenderChat.Title, text)
+	case origin != nil && origin.MessageOriginChannel != nil:
+		data["message"] = fmt.Sprintf("%s: %s", origin.MessageOriginChannel.Chat.Title, text)
+	case msg.From == nil: // Channel post
+		data["message"] = text
+	default:
+		data["message"] = fmt.Sprintf("%s %s: %s", msg.From.FirstName, msg.From.LastName, text)
+	}
+
+	if msg.Caption != "" {
+		data["caption"] = msg.Caption
+	}
+
+	if msg.IsTopicMessage {
+		data["thread_id"] = msg.MessageThreadID
+	}
+
+	if msg.BusinessConnectionID != "" {
+		data["business_connection_id"] = msg.BusinessConnectionID
+	}
+
+	if media := mediaData(msg); media != nil {
+		data["media"] = media
+	}
+
+	if field, value := contactData(msg); field != "" {
+		data[field] = value
+	}
+
+	if forwarded := forwardedData(msg); forwarded != nil {
+		data["forwarded"] = forwarded
+	}
+
+	if mentions := mentionsData(msg); len(mentions) > 0 {
+		data["mentions"] = mentions
+	}
+
+	return data
+}
+
+// forwardedData returns the original sender, chat and date of a forwarded message, or nil if it was not forwarded
+func forwardedData(msg *models.Message) map[string]interface{} {
+	origin := msg.ForwardOrigin
+	if origin == nil {
+		return nil
+	}
+
+	forwarded := map[string]interface{}{}
+	date := 0
+
+	switch {
+	case origin.MessageOriginUser != nil:
+		user := origin.MessageOriginUser.SenderUser
+		forwarded["from"] = fmt.Sprintf("%s %s", user.FirstName, user.LastName)
+		forwarded["from_username"] = user.Username
+		forwarded["from_id"] = user.ID
+		date = origin.MessageOriginUser.Date
+	case origin.MessageOriginHiddenUser != nil: // The user hides their account in forwards
+		forwarded["from"] = origin.MessageOriginHiddenUser.SenderUserName
+		date = origin.MessageOriginHiddenUser.Date
+	case origin.MessageOriginChat != nil:
+		forwarded["chat"] = origin.MessageOriginChat.SenderChat.Title
+		forwarded["chat_id"] = origin.MessageOriginChat.SenderChat.ID
+		date = origin.MessageOriginChat.Date
+	case origin.MessageOriginChannel != nil:
+		forwarded["chat"] = origin.MessageOriginChannel.Chat.Title
+		forwarded["chat_id"] = origin.MessageOriginChannel.Chat.ID
+		forwarded["message_id"] = origin.MessageOriginChannel.MessageID
+		date = origin.MessageOriginChannel.Date
+	}
+
+	forwarded["date"] = time.Unix(int64(date), 0).UTC().Format(time.RFC3339)
+
+	if msg.From != nil {
+		forwarded["by"] = fmt.Sprintf("%s %s", msg.From.FirstName, msg.From.LastName)
+		forwarded["by_username"] = msg.From.Username
+	}
+
+	return forwarded
+}
+
+// mediaWorkers is the number of messages processed concurrently by the media workers
+var mediaWorkers = getEnvInt("media_workers", 2)
+
+// mediaQueueSize is the number of messages waiting for the media workers
+const mediaQueueSize = 100
+
+// mediaQueue has the messages waiting for the media workers, which transcribe and upload their media before publishing them
+var mediaQueue = make(chan func(), mediaQueueSize)
+var mediaWorkersOnce sync.Once
+
+// processMedia runs the slow processing of the media of a message, like the transcription and the upload, in the
+// media workers, so the updates of Telegram are not held. Returns false if the queue is full.
+func processMedia(process func()) bool {
+	mediaWorkersOnce.Do(func() {
+		for i := 0; i < max(mediaWorkers, 1); i++ {
+			go func() {
+				for process := range mediaQueue {
+					process()
+				}
+			}()
+		}
+	})
+
+	select {
+	case mediaQueue <- process:
+		return true
+	default:
+		return false
+	}
+}
+
+// forwardToMQTT publishes a message received in a mapped chat to the mapping outbound topic
+func forwardToMQTT(msg *models.Message) {
+	mapping, ok := groupMapping(msg.Chat.ID)
+	if !ok {
+		return
+	}
+
+	if msg.From == nil {
+		telLog.Debug("Redirecting message from Channel: %s", msg.Chat.Title)
+	} else {
+		telLog.Debug("Redirecting message from User: %s", msg.Chat.Title)
+	}
+
+	if !allowFromTelegram(mapping, msg.Chat, msg.From) {
+		return
+	}
+
+	recordUser(msg.From)
+
+	if (msg.Location != nil || msg.Venue != nil) && mapping.OwnTracksTopic != "" {
+		publishOwnTracks(mapping, msg)
+	}
+
+	if mapping.MessageTo == "" {
+		telLog.Error("Received message but can't send because no msgToName defined!")
+		return
+	}
+
+	data := telegramMessageData(mapping, msg)
+
+	media, hasMedia := data["media"].(map[string]interface{})
+	transcribe := msg.Voice != nil && transcriptionURL != ""
+	upload := hasMedia && storageClient != nil
+	if !transcribe && !upload {
+		publishToMQTT(mapping, msg, data)
+		return
+	}
+
+	queued := processMedia(func() {
+		if transcribe {
+			transcript, err := transcribeVoice(msg.Voice)
+			if err != nil {
+				telLog.Error("Error transcribing voice message from %s: %s", msg.Chat.Title, err)
+			} else {
+				data["transcript"] = transcript
+				if messageText(msg) == "" {
+					data["message"] = data["message"].(string) + transcript
+				}
+			}
+		}
+
+		if upload {
+			url, err := uploadMedia(mapping, msg, media)
+			if err != nil {
+				telLog.Error("Error uploading media from %s: %s", msg.Chat.Title, err)
+			} else {
+				media["url"] = url
+			}
+		}
+
+		publishToMQTT(mapping, msg, data)
+	})
+	if !queued {
+		telLog.Warn("Media queue full, publishing message from %s without processing its media", msg.Chat.Title)
+		publishToMQTT(mapping, msg, data)
+	}
+}
+
+// forwardReaction publishes a reaction to a message of a mapped chat to the mapping outbound topic
+func forwardReaction(r *models.MessageReactionUpdated) {
+	mapping, ok := groupMapping(r.Chat.ID)
+	if !ok || mapping.MessageTo == "" {
+		return
+	}
+
+	if !allowFromTelegram(mapping, r.Chat, r.User) {
+		return
+	}
+
+	var reactions []string
+	for _, reaction := range r.NewReaction {
+		if reaction.ReactionTypeEmoji != nil {
+			reactions = append(reactions, reaction.ReactionTypeEmoji.Emoji)
+		}
+	}
+
+	msg := &models.Message{ID: r.MessageID, Chat: r.Chat, From: r.User, Date: r.Date}
+
+	name := r.Chat.Title
+	if r.User != nil {
+		name = fmt.Sprintf("%s %s", r.User.FirstName, r.User.LastName)
+	}
+
+	publishToMQTT(mapping, msg, map[string]interface{}{
+		"sendmsg":    true,
+		"to":         mapping.MessageTo,
+		"event":      "reaction",
+		"message":    fmt.Sprintf("%s: %s", name, strings.Join(reactions, " ")),
+		"message_id": r.MessageID,
+		"reactions":  reactions,
+	})
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// templateFuncs are the helpers available to the message templates
+var templateFuncs = template.FuncMap{
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"title":      titleCase,
+	"round":      roundNumber,
+	"bytes":      humanizeBytes,
+	"duration":   humanizeDuration,
+	"ago":        ago,
+	"convert":    convertUnit,
+	"emoji":      emoji,
+	"formatTime": formatTime,
+}
+
+// parseTemplate compiles a message template. Templates receive the Notification as context,
+// so fields are available as {{.From}}, {{.Message}}, {{.Topic}} and payload fields as {{.Data.field}}
+func parseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=zero").Funcs(templateFuncs).Parse(text)
+}
+
+func renderTemplate(t *template.Template, n Notification) (string, error) {
+	buff := bytes.NewBuffer(nil)
+
+	err := t.Execute(buff, n)
+	if err != nil {
+		return "", err
+	}
+
+	return buff.String(), nil
+}
+
+// templateNumber reads a number argument of a template function
+func templateNumber(v interface{}) (float64, error) {
+	f, ok := numericValue(v)
+	if !ok {
+		return 0, fmt.Errorf("%v is not a number", v)
+	}
+
+	return f, nil
+}
+
+// titleCase uppercases the first letter of each word
+func titleCase(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		r, size := utf8.DecodeRuneInString(w)
+		words[i] = string(unicode.ToUpper(r)) + w[size:]
+	}
+
+	return strings.Join(words, " ")
+}
+
+// roundNumber rounds a number to places decimal places, like {{round .Data.temperature 1}}
+func roundNumber(v interface{}, places int) (float64, error) {
+	f, err := templateNumber(v)
+	if err != nil {
+		return 0, err
+	}
+
+	p := math.Pow(10, float64(places))
+	return math.Round(f*p) / p, nil
+}
+
+// humanizeBytes formats a number of bytes with SI units, like 1.5 MB
+func humanizeBytes(v interface{}) (string, error) {
+	f, err := templateNumber(v)
+	if err != nil {
+		return "", err
+	}
+
+	units := []string{"B", "kB", "MB", "GB", "TB", "PB"}
+	i := 0
+	for math.Abs(f) >= 1000 && i < len(units)-1 {
+		f /= 1000
+		i++
+	}
+
+	if i == 0 {
+		return fmt.Sprintf("%.0f B", f), nil
+	}
+
+	return fmt.Sprintf("%.1f %s", f, units[i]), nil
+}
+
+// templateDuration reads a number of seconds or a duration string (5m, 1h30m)
+func templateDuration(v interface{}) (time.Duration, error) {
+	if s, ok := v.(string); ok {
+		if d, err := time.ParseDuration(s); err == nil {
+			return d, nil
+		}
+	}
+
+	if d, ok := v.(time.Duration); ok {
+		return d, nil
+	}
+
+	f, err := templateNumber(v)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+// humanizeDuration formats a number of seconds or a duration string with its two largest units, like 2d 3h or 5m 10s
+func humanizeDuration(v interface{}) (string, error) {
+	d, err := templateDuration(v)
+	if err != nil {
+		return "", err
+	}
+
+	return formatDuration(d), nil
+}
+
+func formatDuration(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+
+	units := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+	}
+
+	var parts []string
+	for _, u := range units {
+		if d >= u.d {
+			parts = append(parts, fmt.Sprintf("%d%s", d/u.d, u.name))
+			d %= u.d
+		}
+		if len(parts) == 2 {
+			break
+		}
+	}
+
+	if len(parts) == 0 {
+		return "0s"
+	}
+
+	return sign + strings.Join(parts, " ")
+}
+
+// templateTime reads a time.Time, a RFC3339 string or a unix timestamp in seconds
+func templateTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		if parsed, err := time.Parse(time.RFC3339, t); err == nil {
+			return parsed, nil
+		}
+	}
+
+	f, err := templateNumber(v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%v is not a time", v)
+	}
+
+	return time.Unix(0, int64(f*float64(time.Second))), nil
+}
+
+// ago formats the time since t, like 5m 10s
+func ago(v interface{}) (string, error) {
+	t, err := templateTime(v)
+	if err != nil {
+		return "", err
+	}
+
+	return formatDuration(time.Since(t)), nil
+}
+
+// formatTime formats a time with a Go layout, in the optional IANA timezone, like {{formatTime .Data.ts "15:04" "America/Sao_Paulo"}}
+func formatTime(v interface{}, layout string, timezone ...string) (string, error) {
+	t, err := templateTime(v)
+	if err != nil {
+		return "", err
+	}
+
+	if len(timezone) > 0 {
+		location, err := time.LoadLocation(timezone[0])
+		if err != nil {
+			return "", err
+		}
+		t = t.In(location)
+	}
+
+	return t.Format(layout), nil
+}
+
+// unitFactors are the units of convert, by their value in the base unit of the dimension
+var unitFactors = map[string]struct {
+	dimension string
+	factor    float64
+}{
+	"mm":   {"length", 0.001},
+	"cm":   {"length", 0.01},
+	"m":    {"length", 1},
+	"km":   {"length", 1000},
+	"in":   {"length", 0.0254},
+	"ft":   {"length", 0.3048},
+	"mi":   {"length", 1609.344},
+	"m/s":  {"speed", 1},
+	"km/h": {"speed", 1 / 3.6},
+	"mph":  {"speed", 0.44704},
+	"kn":   {"speed", 1852.0 / 3600},
+	"g":    {"mass", 0.001},
+	"kg":   {"mass", 1},
+	"lb":   {"mass", 0.45359237},
+	"oz":   {"mass", 0.028349523125},
+	"Pa":   {"pressure", 1},
+	"hPa":  {"pressure", 100},
+	"kPa":  {"pressure", 1000},
+	"bar":  {"pressure", 100000},
+	"psi":  {"pressure", 6894.757293168},
+	"inHg": {"pressure", 3386.389},
+	"mmHg": {"pressure", 133.322387415},
+	"Wh":   {"energy", 1},
+	"kWh":  {"energy", 1000},
+	"MWh":  {"energy", 1000000},
+	"J":    {"energy", 1 / 3600.0},
+	"W":    {"power", 1},
+	"kW":   {"power", 1000},
+	"L":    {"volume", 1},
+	"mL":   {"volume", 0.001},
+	"m3":   {"volume", 1000},
+	"gal":  {"volume", 3.785411784},
+}
+
+// convertUnit converts a number between units of the same dimension, like {{convert .Data.temperature "C" "F"}}
+func convertUnit(v interface{}, from, to string) (float64, error) {
+	f, err := templateNumber(v)
+	if err != nil {
+		return 0, err
+	}
+
+	if kelvin, ok := toKelvin(f, from); ok {
+		if value, ok := fromKelvin(kelvin, to); ok {
+			return value, nil
+		}
+		return 0, fmt.Errorf("cannot convert %s to %s", from, to)
+	}
+
+	u1, ok1 := unitFactors[from]
+	u2, ok2 := unitFactors[to]
+	if !ok1 || !ok2 || u1.dimension != u2.dimension {
+		return 0, fmt.Errorf("cannot convert %s to %s", from, to)
+	}
+
+	return f * u1.factor / u2.factor, nil
+}
+
+func toKelvin(v float64, unit string) (float64, bool) {
+	switch unit {
+	case "C":
+		return v + 273.15, true
+	case "F":
+		return (v-32)*5/9 + 273.15, true
+	case "K":
+		return v, true
+	}
+
+	return 0, false
+}
+
+func fromKelvin(v float64, unit string) (float64, bool) {
+	switch unit {
+	case "C":
+		return v - 273.15, true
+	case "F":
+		return (v-273.15)*9/5 + 32, true
+	case "K":
+		return v, true
+	}
+
+	return 0, false
+}
+
+// emojis are the names of emoji, like {{emoji "fire"}}
+var emojis = map[string]string{
+	"alarm":       "🚨",
+	"battery":     "🔋",
+	"bell":        "🔔",
+	"bulb":        "💡",
+	"camera":      "📷",
+	"check":       "✅",
+	"clock":       "🕒",
+	"cloud":       "☁️",
+	"cross":       "❌",
+	"door":        "🚪",
+	"droplet":     "💧",
+	"fire":        "🔥",
+	"house":       "🏠",
+	"info":        "ℹ️",
+	"lock":        "🔒",
+	"low_battery": "🪫",
+	"plug":        "🔌",
+	"rain":        "🌧️",
+	"snow":        "❄️",
+	"sun":         "☀️",
+	"thermometer": "🌡️",
+	"unlock":      "🔓",
+	"warning":     "⚠️",
+	"wind":        "💨",
+	"zap":         "⚡",
+}
+
+// emoji returns the emoji of a name, or an empty string if unknown
+func emoji(name string) string {
+	return emojis[name]
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	n := Notification{
+		Topic:      "home/kitchen",
+		From:       "sensor",
+		Message:    "hello",
+		Data:       map[string]interface{}{"temperature": 23.56, "room": "kitchen", "free": 1536000.0, "uptime": 93784.0, "ts": "2019-08-10T14:00:00Z"},
+		Properties: map[string]string{"source": "zigbee"},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"plain text", "static text", "static text"},
+		{"fields", "{{.From}} on {{.Topic}}: {{.Message}}", "sensor on home/kitchen: hello"},
+		{"payload fields", "{{.Data.room}} is {{.Data.temperature}}", "kitchen is 23.56"},
+		{"missing payload field", "[{{.Data.missing}}]", "[<no value>]"},
+		{"user properties", "{{.Properties.source}}", "zigbee"},
+		{"conditionals", "{{if .Critical}}ALERT {{end}}{{.Message}}", "hello"},
+		{"upper and title", "{{upper .Data.room}} {{title \"living room\"}}", "KITCHEN Living Room"},
+		{"title with accents", "{{title \"água élevée\"}}", "Água Élevée"},
+		{"round", "{{round .Data.temperature 1}}", "23.6"},
+		{"bytes", "{{bytes .Data.free}} {{bytes 512}}", "1.5 MB 512 B"},
+		{"duration", "{{duration .Data.uptime}} {{duration \"90m\"}}", "1d 2h 1h 30m"},
+		{"convert", "{{convert 20 \"C\" \"F\"}} {{round (convert 10 \"km/h\" \"m/s\") 2}}", "68 2.78"},
+		{"emoji", "{{emoji \"thermometer\"}} {{.Data.temperature}}", "🌡️ 23.56"},
+		{"time formatting", "{{formatTime .Data.ts \"15:04\" \"America/Sao_Paulo\"}}", "11:00"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl, err := parseTemplate(test.name, test.template)
+			if err != nil {
+				t.Fatalf("error parsing template: %s", err)
+			}
+
+			text, err := renderTemplate(tmpl, n)
+			if err != nil {
+				t.Fatalf("error rendering template: %s", err)
+			}
+
+			if text != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, text)
+			}
+		})
+	}
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	for _, text := range []string{"{{.From", "{{if .Critical}}", "{{unknownFunc .From}}"} {
+		if _, err := parseTemplate("invalid", text); err == nil {
+			t.Errorf("expected error parsing %q", text)
+		}
+	}
+}
+
+func TestTemplateFunctionErrors(t *testing.T) {
+	for _, text := range []string{`{{round .Data.room 1}}`, `{{convert 1 "C" "km"}}`, `{{formatTime .Data.room "15:04"}}`} {
+		tmpl, err := parseTemplate("invalid", text)
+		if err != nil {
+			t.Fatalf("error parsing template: %s", err)
+		}
+
+		if _, err := renderTemplate(tmpl, Notification{Data: map[string]interface{}{"room": "kitchen"}}); err == nil {
+			t.Errorf("expected error rendering %q", text)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// thresholdFrom is the sender of the threshold alerts
+const thresholdFrom = "Alert"
+
+// ThresholdConfig generates alert and recovery messages when a numeric payload field crosses a limit
+type ThresholdConfig struct {
+	Field      string   `json:"field"`
+	Above      *float64 `json:"above"`      // Alert when the value goes above
+	Below      *float64 `json:"below"`      // Alert when the value goes below
+	Hysteresis float64  `json:"hysteresis"` // How much the value must come back past the limit to recover
+	Cooldown   Duration `json:"cooldown"`   // Minimum time between alerts
+	Message    string   `json:"message"`    // text/template of the alert. Receives .Topic, .Field, .Value and .Limit
+	Recovery   string   `json:"recovery"`   // text/template of the recovery message. Empty disables recovery messages
+	Critical   bool     `json:"critical"`
+
+	message  *template.Template
+	recovery *template.Template
+	states   map[string]*thresholdState // By topic, for the wildcard mappings
+}
+
+// thresholdState is the state of a threshold on a topic, kept while alerting or in the cooldown
+type thresholdState struct {
+	alerting  bool
+	lastAlert time.Time
+}
+
+// thresholdEvent is the context of the threshold templates
+type thresholdEvent struct {
+	Topic string
+	Field string
+	Value float64
+	Limit float64
+}
+
+func (c *ThresholdConfig) setup(topic string) error {
+	if c.Field == "" {
+		return fmt.Errorf("threshold requires field")
+	}
+
+	if c.Above == nil && c.Below == nil {
+		return fmt.Errorf("threshold of %s requires above or below", c.Field)
+	}
+
+	message := c.Message
+	if message == "" {
+		message = "{{.Field}} is {{.Value}} (limit {{.Limit}})"
+	}
+
+	var err error
+	if c.message, err = parseTemplate(topic+"_"+c.Field, message); err != nil {
+		return fmt.Errorf("invalid threshold message: %s", err)
+	}
+
+	if c.Recovery != "" {
+		if c.recovery, err = parseTemplate(topic+"_"+c.Field+"_recovery", c.Recovery); err != nil {
+			return fmt.Errorf("invalid threshold recovery: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// numericValue reads a payload number or numeric string
+func numericValue(v interface{}) (float64, bool) {
+	switch value := v.(type) {
+	case float64:
+		return value, true
+	case float32:
+		return float64(value), true
+	case int:
+		return float64(value), true
+	case int64:
+		return float64(value), true
+	case uint64:
+		return float64(value), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		return f, err == nil
+	}
+
+	return 0, false
+}
+
+// check updates the threshold state of a topic with a value, returning the crossed limit and if it is an alert or a recovery
+func (c *ThresholdConfig) check(topic string, value float64, now time.Time) (limit float64, alert, recovery bool) {
+	state, ok := c.states[topic]
+	if ok && !state.alerting && now.Sub(state.lastAlert) >= c.Cooldown.Duration {
+		delete(c.states, topic)
+		ok = false
+	}
+
+	if !ok || !state.alerting {
+		switch {
+		case c.Above != nil && value > *c.Above:
+			limit = *c.Above
+		case c.Below != nil && value < *c.Below:
+			limit = *c.Below
+		default:
+			return 0, false, false
+		}
+
+		if ok {
+			return 0, false, false // In the cooldown
+		}
+
+		if c.states == nil {
+			c.states = map[string]*thresholdState{}
+		}
+		c.states[topic] = &thresholdState{alerting: true, lastAlert: now}
+		return limit, true, false
+	}
+
+	switch {
+	case c.Above != nil && value > *c.Above-c.Hysteresis:
+		return 0, false, false
+	case c.Below != nil && value < *c.Below+c.Hysteresis:
+		return 0, false, false
+	}
+
+	state.alerting = false
+	if c.Above != nil {
+		limit = *c.Above
+	} else {
+		limit = *c.Below
+	}
+
+	return limit, false, true
+}
+
+// checkThresholds sends the alert and recovery messages of the mapping thresholds crossed by a payload
+func (m *Mapping) checkThresholds(ctx context.Context, topic string, data map[string]interface{}, t time.Time) {
+	for _, c := range m.Thresholds {
+		value, ok := numericValue(data[c.Field])
+		if !ok {
+			continue
+		}
+
+		m.lock.Lock()
+		limit, alert, recovery := c.check(topic, value, t)
+		m.lock.Unlock()
+
+		tmpl := c.message
+		if recovery {
+			tmpl = c.recovery
+		}
+
+		if (!alert && !recovery) || tmpl == nil {
+			continue
+		}
+
+		event := thresholdEvent{Topic: topic, Field: c.Field, Value: value, Limit: limit}
+		message := &strings.Builder{}
+		if err := tmpl.Execute(message, event); err != nil {
+			mqttLog.Error("Error rendering threshold message of %s on topic %s: %s", c.Field, topic, err)
+			continue
+		}
+
+		mqttLog.Info("Threshold of %s on topic %s crossed: %s", c.Field, topic, message.String())
+		deliverMessage(m, Notification{
+			Topic:    topic,
+			From:     thresholdFrom,
+			Message:  message.String(),
+			Critical: c.Critical && alert,
+			Data:     data,
+			Time:     t,
+			ctx:      ctx,
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThresholdPerTopic(t *testing.T) {
+	above := 30.0
+	c := &ThresholdConfig{Field: "temperature", Above: &above, Hysteresis: 2, Cooldown: Duration{time.Minute}}
+	now := time.Now()
+
+	if _, alert, _ := c.check("sensors/kitchen", 35, now); !alert {
+		t.Errorf("expected an alert of the kitchen")
+	}
+
+	// Another topic of the wildcard mapping alerts on its own
+	if _, alert, _ := c.check("sensors/garage", 35, now); !alert {
+		t.Errorf("expected an alert of the garage while the kitchen is alerting")
+	}
+
+	if _, alert, _ := c.check("sensors/kitchen", 36, now); alert {
+		t.Errorf("expected no alert while the kitchen is still alerting")
+	}
+
+	if _, _, recovery := c.check("sensors/kitchen", 27, now); !recovery {
+		t.Errorf("expected a recovery of the kitchen")
+	}
+
+	if _, alert, _ := c.check("sensors/kitchen", 35, now.Add(time.Second)); alert {
+		t.Errorf("expected no alert of the kitchen in the cooldown")
+	}
+
+	if _, alert, _ := c.check("sensors/kitchen", 35, now.Add(2*time.Minute)); !alert {
+		t.Errorf("expected an alert of the kitchen after the cooldown")
+	}
+
+	c.check("sensors/garage", 20, now)
+	c.check("sensors/garage", 20, now.Add(2*time.Minute))
+	if _, ok := c.states["sensors/garage"]; ok {
+		t.Errorf("expected the state of the recovered garage to expire after the cooldown")
+	}
+}
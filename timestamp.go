@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+	_ "time/tzdata" // The docker image has no zoneinfo
+)
+
+// Timestamp positions
+const (
+	TimestampPrefix = "prefix"
+	TimestampAppend = "append"
+)
+
+const defaultTimestampFormat = "2006-01-02 15:04:05"
+
+var defaultTimezone = os.Getenv("timezone")
+
+// messageTime returns the payload "timestamp" field when valid, otherwise the receive time
+func messageTime(data map[string]interface{}, received time.Time) time.Time {
+	if data["timestamp"] != nil {
+		if t, err := parseTimeValue(data["timestamp"]); err == nil {
+			return t
+		}
+	}
+
+	return received
+}
+
+// stampMessage adds the notification time to the message according to the mapping timestamp option
+func (m *Mapping) stampMessage(n Notification) string {
+	if m.Timestamp == "" || n.Time.IsZero() {
+		return n.Message
+	}
+
+	stamp := n.Time.In(m.location).Format(m.TimestampFormat)
+
+	if m.Timestamp == TimestampPrefix {
+		return fmt.Sprintf("[%s] %s", stamp, n.Message)
+	}
+
+	return fmt.Sprintf("%s (%s)", n.Message, stamp)
+}
+
+// setupTimestamp validates the timestamp options and loads the mapping timezone
+func (m *Mapping) setupTimestamp() error {
+	switch m.Timestamp {
+	case "", TimestampPrefix, TimestampAppend:
+	default:
+		return fmt.Errorf("invalid timestamp position %q", m.Timestamp)
+	}
+
+	if m.TimestampFormat == "" {
+		m.TimestampFormat = defaultTimestampFormat
+	}
+
+	timezone := m.Timezone
+	if timezone == "" {
+		timezone = defaultTimezone
+	}
+
+	m.location = time.Local
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone: %s", err)
+		}
+		m.location = loc
+	}
+
+	return nil
+}
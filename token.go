@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+)
+
+// checkToken validates the token field of a payload against the mapping auth_token, or the device_tokens token of
+// the payload from, so broker clients can't impersonate the devices. The token is removed from the payload.
+func (m *Mapping) checkToken(data map[string]interface{}) error {
+	if !m.tokenRequired() {
+		return nil
+	}
+
+	token, _ := data["token"].(string)
+	delete(data, "token")
+
+	expected := m.AuthToken
+	from, _ := data["from"].(string)
+	if t, ok := m.DeviceTokens[from]; ok {
+		expected = t
+	}
+
+	if expected == "" {
+		return fmt.Errorf("no token for %q", from)
+	}
+
+	if token == "" {
+		return fmt.Errorf("missing token")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		return fmt.Errorf("invalid token")
+	}
+
+	return nil
+}
+
+// tokenRequired returns if the payloads of the mapping must have a token
+func (m *Mapping) tokenRequired() bool {
+	return m.AuthToken != "" || len(m.DeviceTokens) > 0
+}
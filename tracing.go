@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"github.com/quan-to/slog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+	"time"
+)
+
+var tracer = otel.Tracer("github.com/racerxdl/mqtttelegram")
+
+var tracerProvider *sdktrace.TracerProvider
+
+// setupTracing exports spans with OTLP/HTTP when OTEL_EXPORTER_OTLP_ENDPOINT (or the traces specific variable) is defined.
+// The W3C trace context is always propagated.
+func setupTracing() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return
+	}
+
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		slog.Fatal("Error creating OTLP exporter: %s", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName("mqtttelegram")))
+	if err != nil {
+		slog.Fatal("Error creating tracing resource: %s", err)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES take precedence over the default service name
+	if env, err := resource.New(context.Background(), resource.WithFromEnv()); err == nil {
+		if merged, err := resource.Merge(res, env); err == nil {
+			res = merged
+		}
+	}
+
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tracerProvider)
+
+	slog.Info("Exporting traces with OTLP")
+}
+
+// shutdownTracing flushes the pending spans
+func shutdownTracing() {
+	if tracerProvider == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := tracerProvider.Shutdown(ctx); err != nil {
+		slog.Error("Error flushing traces: %s", err)
+	}
+}
+
+// extractTraceContext returns a context with the trace context carried by the MQTT 5 user properties
+func extractTraceContext(properties map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(properties))
+}
+
+// injectTraceContext adds the trace context to the MQTT 5 user properties
+func injectTraceContext(ctx context.Context, properties map[string]string) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.MapCarrier(properties))
+}
+
+// endSpan records the error, if any, and ends the span
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func topicAttribute(topic string) attribute.KeyValue {
+	return semconv.MessagingDestinationName(topic)
+}
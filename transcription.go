@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/go-telegram/bot/models"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	transcriptionURL   = os.Getenv("transcription_url")
+	transcriptionToken = os.Getenv("transcription_token")
+	transcriptionModel = os.Getenv("transcription_model")
+)
+
+var transcriptionClient = &http.Client{Timeout: 2 * time.Minute}
+
+// transcribeVoice downloads a voice message and sends it to the transcription service
+func transcribeVoice(voice *models.Voice) (string, error) {
+	voiceFile, _, err := downloadTelegramFile(voice.FileID)
+	if err != nil {
+		return "", fmt.Errorf("error downloading voice file: %s", err)
+	}
+	defer voiceFile.Close()
+
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+
+	if transcriptionModel != "" {
+		form.WriteField("model", transcriptionModel)
+	}
+
+	file, _ := form.CreateFormFile("file", "voice.ogg")
+	if _, err := io.Copy(file, voiceFile); err != nil {
+		return "", fmt.Errorf("error downloading voice file: %s", err)
+	}
+	form.Close()
+
+	req, err := http.NewRequest("POST", transcriptionURL, body)
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if transcriptionToken != "" {
+		req.Header.Set("Authorization", "Bearer "+transcriptionToken)
+	}
+
+	tres, err := transcriptionClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer tres.Body.Close()
+
+	result, _ := ioutil.ReadAll(tres.Body)
+	if tres.StatusCode/100 != 2 {
+		return "", fmt.Errorf("received status %d: %s", tres.StatusCode, string(result))
+	}
+
+	return parseTranscription(result), nil
+}
+
+// parseTranscription reads the text of a {"text": "..."} response, or the plain text response
+func parseTranscription(result []byte) string {
+	var data struct {
+		Text string `json:"text"`
+	}
+
+	if json.Unmarshal(result, &data) == nil {
+		return strings.TrimSpace(data.Text)
+	}
+
+	return strings.TrimSpace(string(result))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const defaultTransformTimeout = 5 * time.Second
+
+// TransformConfig represents an external command that can rewrite, enrich, route or drop messages before delivery
+type TransformConfig struct {
+	Command []string `json:"command"`
+	Timeout Duration `json:"timeout"`
+}
+
+type transformInput struct {
+	Topic    string                 `json:"topic"`
+	Retained bool                   `json:"retained"`
+	Payload  map[string]interface{} `json:"payload"`
+}
+
+type transformOutput struct {
+	Topic   string                 `json:"topic"`   // Route the message to another mapped topic
+	Drop    bool                   `json:"drop"`    // Discard the message
+	Payload map[string]interface{} `json:"payload"` // Payload that will be processed instead of the original one
+}
+
+// runTransform runs the transform command, sending the decoded payload as JSON in stdin and reading the result from stdout.
+// An empty output drops the message.
+func runTransform(tc *TransformConfig, topic string, data map[string]interface{}, retained bool) (transformOutput, error) {
+	out := transformOutput{}
+
+	input, _ := json.Marshal(transformInput{
+		Topic:    topic,
+		Retained: retained,
+		Payload:  data,
+	})
+
+	timeout := tc.Timeout.Duration
+	if timeout <= 0 {
+		timeout = defaultTransformTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stdout := bytes.NewBuffer(nil)
+	stderr := bytes.NewBuffer(nil)
+
+	cmd := exec.CommandContext(ctx, tc.Command[0], tc.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return out, fmt.Errorf("transform command failed: %s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		out.Drop = true
+		return out, nil
+	}
+
+	err = json.Unmarshal(stdout.Bytes(), &out)
+	if err != nil {
+		return out, fmt.Errorf("invalid transform output: %s", err)
+	}
+
+	if !out.Drop && out.Payload == nil {
+		return out, fmt.Errorf("transform output without payload")
+	}
+
+	return out, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// isExpired checks if a MQTT payload is stale and should not be forwarded.
+// A message is stale when:
+//   - "expires_at" is in the past
+//   - "ttl" has passed since the payload "timestamp"
+//   - mapping MaxAge has passed since the payload "timestamp"
+func isExpired(data map[string]interface{}, mapping *Mapping, now time.Time) (bool, error) {
+	if data["expires_at"] != nil {
+		expiresAt, err := parseTimeValue(data["expires_at"])
+		if err != nil {
+			return false, fmt.Errorf("invalid expires_at field: %s", err)
+		}
+		if !expiresAt.After(now) {
+			return true, nil
+		}
+	}
+
+	publishedAt := time.Time{}
+	if data["timestamp"] != nil {
+		t, err := parseTimeValue(data["timestamp"])
+		if err != nil {
+			return false, fmt.Errorf("invalid timestamp field: %s", err)
+		}
+		publishedAt = t
+	}
+
+	if data["ttl"] != nil {
+		ttl, err := parseDurationValue(data["ttl"])
+		if err != nil {
+			return false, fmt.Errorf("invalid ttl field: %s", err)
+		}
+		if !publishedAt.IsZero() && !publishedAt.Add(ttl).After(now) {
+			return true, nil
+		}
+	}
+
+	if mapping.MaxAge.Duration > 0 && !publishedAt.IsZero() && now.Sub(publishedAt) > mapping.MaxAge.Duration {
+		return true, nil
+	}
+
+	return false, nil
+}
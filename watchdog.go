@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// watchdogState is the silence timer of a topic of a mapping with expected_interval
+type watchdogState struct {
+	timer  *time.Timer
+	last   time.Time
+	silent bool
+}
+
+// startWatchdogs arms the silence timers of the mappings with expected_interval. Topics with wildcards are only
+// watched after their first message, as their subtopics are not known before.
+func startWatchdogs() {
+	now := time.Now()
+	for topic, mapping := range listTopicMappings() {
+		if mapping.ExpectedInterval.Duration > 0 && !strings.ContainsAny(topic, "+#") {
+			mapping.watchTopic(topic, now)
+		}
+	}
+}
+
+// watchTopic records a message received on topic, restarting its silence timer.
+// If the topic was notified silent, the mapping is notified the data resumed.
+func (m *Mapping) watchTopic(topic string, now time.Time) {
+	if m.ExpectedInterval.Duration <= 0 {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.watchdogs == nil {
+		m.watchdogs = map[string]*watchdogState{}
+	}
+
+	w, ok := m.watchdogs[topic]
+	if !ok {
+		w = &watchdogState{}
+		m.watchdogs[topic] = w
+	}
+
+	if w.silent {
+		go m.notifyWatchdog(topic, m.trMessage("data_resumed", topic, formatDuration(now.Sub(w.last))))
+	}
+
+	w.last, w.silent = now, false
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+
+	w.timer = time.AfterFunc(m.ExpectedInterval.Duration, func() {
+		m.lock.Lock()
+		if w.silent || time.Since(w.last) < m.ExpectedInterval.Duration {
+			m.lock.Unlock()
+			return
+		}
+		w.silent = true
+		last := w.last
+		m.lock.Unlock()
+
+		mqttLog.Warn("No data from %s since %s", topic, last.Format(time.RFC3339))
+		m.notifyWatchdog(topic, m.trMessage("no_data", topic, formatDuration(time.Since(last))))
+	})
+}
+
+func (m *Mapping) notifyWatchdog(topic, message string) {
+	if !isLeader() {
+		return
+	}
+
+	if err := deliverMessage(m, Notification{Topic: topic, From: "Bridge", Message: message, Time: time.Now()}); err != nil {
+		mqttLog.Error("Error notifying silence of %s: %s", topic, err)
+	}
+}
+
+// stopWatchdogs stops the silence timers of the mapping
+func (m *Mapping) stopWatchdogs() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for topic, w := range m.watchdogs {
+		w.timer.Stop()
+		delete(m.watchdogs, topic)
+	}
+}